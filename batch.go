@@ -0,0 +1,154 @@
+package newman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// BatchStatus is the outcome of a single message in a batch send
+type BatchStatus string
+
+const (
+	// BatchStatusSent indicates the provider accepted the message
+	BatchStatusSent BatchStatus = "sent"
+	// BatchStatusFailed indicates the message was rejected or could not be sent
+	BatchStatusFailed BatchStatus = "failed"
+	// BatchStatusSkipped indicates the message was never attempted, such as when the context was canceled
+	BatchStatusSkipped BatchStatus = "skipped"
+)
+
+// BatchItem is the outcome of one message in a batch, matched to its index in the input slice
+type BatchItem struct {
+	// Index is the position of the message in the slice passed to the batch send
+	Index int `json:"index"`
+	// Status is the outcome of the message
+	Status BatchStatus `json:"status"`
+	// MessageID is the identifier the provider assigned to the message, if it was sent
+	MessageID string `json:"message_id,omitempty"`
+	// Err is the reason the message was not sent
+	Err error `json:"-"`
+	// Rejected is the list of recipients of the message that were not sent to, such as suppressed addresses
+	Rejected []string `json:"rejected,omitempty"`
+}
+
+// BatchResult describes the per-message outcome of a batch send
+type BatchResult struct {
+	// Provider is the name of the provider that handled the batch
+	Provider string `json:"provider"`
+	// Items holds one entry per message, in the same order as the messages that were sent
+	Items []BatchItem `json:"items"`
+}
+
+// BatchResultSender is implemented by senders that report the per-message outcome of a batch send
+type BatchResultSender interface {
+	// SendBatchEmailWithResult sends a batch of emails and returns the outcome of each message. The
+	// error is only set when the batch as a whole could not be sent; failures of individual messages
+	// are reported on the result
+	SendBatchEmailWithResult(ctx context.Context, messages []*EmailMessage) (*BatchResult, error)
+}
+
+// NewBatchResult creates a BatchResult with an item for each of size messages
+func NewBatchResult(provider string, size int) *BatchResult {
+	result := &BatchResult{
+		Provider: provider,
+		Items:    make([]BatchItem, size),
+	}
+
+	for i := range result.Items {
+		result.Items[i].Index = i
+	}
+
+	return result
+}
+
+// SetSent marks the message at index as accepted by the provider
+func (r *BatchResult) SetSent(index int, messageID string) {
+	r.Items[index].Status = BatchStatusSent
+	r.Items[index].MessageID = messageID
+	r.Items[index].Err = nil
+}
+
+// SetFailed marks the message at index as not sent
+func (r *BatchResult) SetFailed(index int, err error) {
+	r.Items[index].Status = BatchStatusFailed
+	r.Items[index].MessageID = ""
+	r.Items[index].Err = err
+}
+
+// SetSkipped marks the message at index as never attempted
+func (r *BatchResult) SetSkipped(index int, err error) {
+	r.Items[index].Status = BatchStatusSkipped
+	r.Items[index].MessageID = ""
+	r.Items[index].Err = err
+}
+
+// Sent returns the items that were accepted by the provider
+func (r *BatchResult) Sent() []BatchItem {
+	return r.filter(func(item BatchItem) bool { return item.Status == BatchStatusSent })
+}
+
+// Failed returns the items that were not sent, including those that were skipped
+func (r *BatchResult) Failed() []BatchItem {
+	return r.filter(func(item BatchItem) bool { return item.Status != BatchStatusSent })
+}
+
+// filter returns the items matching keep
+func (r *BatchResult) filter(keep func(BatchItem) bool) []BatchItem {
+	items := []BatchItem{}
+
+	if r == nil {
+		return items
+	}
+
+	for _, item := range r.Items {
+		if keep(item) {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// Err returns nil when every message was sent, otherwise an error wrapping ErrBatchIncomplete
+// and the error of each message that was not sent
+func (r *BatchResult) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	errs := make([]error, 0, len(failed))
+
+	for _, item := range failed {
+		err := item.Err
+		if err == nil {
+			err = ErrBatchIncomplete
+		}
+
+		errs = append(errs, fmt.Errorf("message %d: %w", item.Index, err))
+	}
+
+	return fmt.Errorf("%w: %d of %d messages not sent: %w", ErrBatchIncomplete, len(failed), len(r.Items), errors.Join(errs...))
+}
+
+// SendBatchEmailWithResult sends the messages through the sender, returning the per-message outcome
+// when the sender implements BatchResultSender. Otherwise the batch is treated as all or nothing and
+// the result carries no message IDs
+func SendBatchEmailWithResult(ctx context.Context, sender EmailSender, messages []*EmailMessage) (*BatchResult, error) {
+	if bs, ok := sender.(BatchResultSender); ok {
+		return bs.SendBatchEmailWithResult(ctx, messages)
+	}
+
+	if err := sender.SendBatchEmailWithContext(ctx, messages); err != nil {
+		return nil, err
+	}
+
+	result := NewBatchResult(providerName(sender), len(messages))
+
+	for i := range messages {
+		result.SetSent(i, "")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,87 @@
+package newman_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/newman"
+)
+
+func TestBatchResult(t *testing.T) {
+	errBounced := errors.New("mailbox does not exist")
+
+	result := newman.NewBatchResult("resend", 3)
+	result.SetSent(0, "id-0")
+	result.SetFailed(1, errBounced)
+	result.SetSent(2, "id-2")
+
+	assert.Equal(t, []newman.BatchItem{
+		{Index: 0, Status: newman.BatchStatusSent, MessageID: "id-0"},
+		{Index: 2, Status: newman.BatchStatusSent, MessageID: "id-2"},
+	}, result.Sent())
+
+	failed := result.Failed()
+	require.Len(t, failed, 1)
+	assert.Equal(t, 1, failed[0].Index)
+	assert.Equal(t, newman.BatchStatusFailed, failed[0].Status)
+
+	err := result.Err()
+	require.ErrorIs(t, err, newman.ErrBatchIncomplete)
+	assert.ErrorIs(t, err, errBounced)
+	assert.ErrorContains(t, err, "1 of 3 messages not sent")
+	assert.ErrorContains(t, err, "message 1: mailbox does not exist")
+
+	result.SetSent(1, "id-1")
+	assert.NoError(t, result.Err())
+}
+
+func TestMockBatchPartialSuccess(t *testing.T) {
+	sender := newRetryTestSender(t)
+	sender.FailWith(nil, newman.NewRetryableError(errRateLimited))
+
+	messages := []*newman.EmailMessage{
+		newRetryTestMessage("jerry@seinfeld.com"),
+		newRetryTestMessage("george@seinfeld.com"),
+		newRetryTestMessage("not-an-email"),
+		newRetryTestMessage("elaine@seinfeld.com"),
+	}
+
+	result, err := newman.SendBatchEmailWithResult(context.Background(), sender, messages)
+	require.NoError(t, err)
+
+	assert.Equal(t, "mock", result.Provider)
+	require.Len(t, result.Items, 4)
+
+	assert.Equal(t, newman.BatchStatusSent, result.Items[0].Status)
+	assert.Equal(t, "mock-1", result.Items[0].MessageID)
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[1].Status)
+	assert.True(t, newman.IsRetryableError(result.Items[1].Err))
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[2].Status)
+	assert.ErrorContains(t, result.Items[2].Err, "to is required")
+	assert.Equal(t, newman.BatchStatusSent, result.Items[3].Status)
+	assert.Equal(t, "mock-2", result.Items[3].MessageID)
+
+	// the failures do not stop the rest of the batch from being captured
+	assert.Len(t, sender.Messages(), 2)
+
+	err = sender.SendBatchEmail(messages)
+	require.ErrorIs(t, err, newman.ErrBatchIncomplete)
+}
+
+func TestSendBatchEmailWithResultFallback(t *testing.T) {
+	sender := plainSender{newRetryTestSender(t)}
+
+	messages := []*newman.EmailMessage{
+		newRetryTestMessage("jerry@seinfeld.com"),
+		newRetryTestMessage("george@seinfeld.com"),
+	}
+
+	result, err := newman.SendBatchEmailWithResult(context.Background(), sender, messages)
+	require.NoError(t, err)
+	assert.Len(t, result.Sent(), 2)
+	assert.NoError(t, result.Err())
+}
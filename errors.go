@@ -2,24 +2,114 @@ package newman
 
 import (
 	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theopenlane/newman/shared"
 )
 
-// ErrBatchNotImplemented is returned by providers that do not support native batch sending
-var ErrBatchNotImplemented = errors.New("batch email sending is not implemented for this provider")
+var (
+	// ErrBatchNotImplemented is returned by providers that do not support native batch sending
+	ErrBatchNotImplemented = errors.New("batch email sending is not implemented for this provider")
+	// ErrRetryAttemptsExhausted is returned when a retrying sender gives up after the maximum number of attempts
+	ErrRetryAttemptsExhausted = errors.New("retry attempts exhausted")
+	// ErrAllProvidersFailed is returned when every provider behind a failover sender failed to send
+	ErrAllProvidersFailed = errors.New("all providers failed to send")
+	// ErrBatchIncomplete is returned when one or more messages in a batch were not sent
+	ErrBatchIncomplete = errors.New("batch incomplete")
+	// ErrRecipientsSuppressed is returned when every To recipient of a message is suppressed
+	ErrRecipientsSuppressed = errors.New("all recipients are suppressed")
+	// ErrInvalidSuppression is returned when a suppression has an invalid address or an unknown reason
+	ErrInvalidSuppression = errors.New("invalid suppression")
+	// ErrAttachmentTooLarge is returned when an attachment exceeds the maximum attachment size under AttachmentPolicyReject
+	ErrAttachmentTooLarge = shared.ErrAttachmentTooLarge
+	// ErrMessageTooLarge is returned before any request is made when a message exceeds the maximum message size of a provider
+	ErrMessageTooLarge = shared.ErrMessageTooLarge
+	// ErrTooManyRecipients is returned before any request is made when a message has more recipients than a provider accepts
+	ErrTooManyRecipients = shared.ErrTooManyRecipients
+	// ErrInvalidDKIMSigner is returned when a DKIM signer is missing its domain or selector, or cannot use its key
+	ErrInvalidDKIMSigner = shared.ErrInvalidDKIMSigner
+	// ErrDKIMVerification is returned when a DKIM signature is missing or does not verify
+	ErrDKIMVerification = shared.ErrDKIMVerification
+	// ErrInvalidSMIME is returned when S/MIME has neither a signer nor recipients, or cannot use a key or certificate
+	ErrInvalidSMIME = shared.ErrInvalidSMIME
+	// ErrInvalidPGPMIME is returned when PGP/MIME has neither a signer nor recipients, or cannot use a key
+	ErrInvalidPGPMIME = shared.ErrInvalidPGPMIME
+	// ErrSignatureVerification is returned when an S/MIME or PGP/MIME message is not signed or its signature does not verify
+	ErrSignatureVerification = shared.ErrSignatureVerification
+	// ErrDecryption is returned when an S/MIME or PGP/MIME message is not encrypted or cannot be decrypted with the key
+	ErrDecryption = shared.ErrDecryption
+	// ErrInvalidUnsubscriber is returned when an Unsubscriber has a short secret, an endpoint that is not HTTPS or an invalid mailto address
+	ErrInvalidUnsubscriber = shared.ErrInvalidUnsubscriber
+	// ErrUnsubscribeRecipients is returned by validation when a message with unsubscribe headers has more than one recipient
+	ErrUnsubscribeRecipients = shared.ErrUnsubscribeRecipients
+	// ErrInvalidUnsubscribeToken is returned when an unsubscribe token is malformed, was not signed with the secret or has expired
+	ErrInvalidUnsubscribeToken = shared.ErrInvalidUnsubscribeToken
+)
 
 type retryableError struct {
-	reason error
+	reason     error
+	retryAfter time.Duration
 }
 
 func (e retryableError) Error() string { return e.reason.Error() }
 
+// Unwrap returns the underlying reason so errors.Is and errors.As can inspect it
+func (e retryableError) Unwrap() error { return e.reason }
+
 // NewRetryableError creates a new retryable error with a given reason.
 func NewRetryableError(reason error) error {
 	return retryableError{reason: reason}
 }
 
+// NewRetryableErrorWithDelay creates a new retryable error carrying a Retry-After hint,
+// typically taken from a provider's rate limit response
+func NewRetryableErrorWithDelay(reason error, retryAfter time.Duration) error {
+	return retryableError{reason: reason, retryAfter: retryAfter}
+}
+
 // IsRetryableError checks if the error is retryable.
 func IsRetryableError(err error) bool {
 	var re retryableError
 	return errors.As(err, &re)
 }
+
+// RetryAfter returns the Retry-After hint carried on a retryable error, if any
+func RetryAfter(err error) (time.Duration, bool) {
+	var re retryableError
+	if !errors.As(err, &re) || re.retryAfter <= 0 {
+		return 0, false
+	}
+
+	return re.retryAfter, true
+}
+
+// ParseRetryAfter parses the value of a Retry-After response header, given either as a number
+// of seconds or as an HTTP date, into the duration to wait
+func ParseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	if wait := time.Until(at); wait > 0 {
+		return wait, true
+	}
+
+	return 0, false
+}
@@ -2,7 +2,9 @@ package newman
 
 import (
 	"errors"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -62,3 +64,18 @@ func TestRetryableErrorUnwrapping(t *testing.T) {
 	normalErr := errors.New("validation failed")
 	assert.False(t, errors.As(normalErr, &err))
 }
+
+func TestParseRetryAfter(t *testing.T) {
+	delay, ok := ParseRetryAfter("120")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, delay)
+
+	delay, ok = ParseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.InDelta(t, time.Hour, delay, float64(2*time.Second))
+
+	for _, value := range []string{"", "0", "-5", "soon", "Mon, 02 Jan 2006 15:04:05 GMT"} {
+		_, ok = ParseRetryAfter(value)
+		assert.False(t, ok, value)
+	}
+}
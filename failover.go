@@ -0,0 +1,408 @@
+package newman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/theopenlane/newman/shared"
+)
+
+const defaultFailoverCooldown = 30 * time.Second
+
+// ProviderNamer is implemented by senders that can report the name of the provider behind them
+type ProviderNamer interface {
+	// ProviderName returns the name of the provider
+	ProviderName() string
+}
+
+// namedSender attaches a provider name to an EmailSender
+type namedSender struct {
+	EmailSender
+	name string
+}
+
+// ProviderName satisfies the ProviderNamer interface
+func (n namedSender) ProviderName() string { return n.name }
+
+// SendEmailWithResult satisfies the ResultSender interface, reporting the attached name as the provider
+func (n namedSender) SendEmailWithResult(ctx context.Context, message *EmailMessage) (*SendResult, error) {
+	result, err := SendEmailWithResult(ctx, n.EmailSender, message)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Provider = n.name
+
+	return result, nil
+}
+
+// SendBatchEmailWithResult satisfies the BatchResultSender interface, reporting the attached name as the provider
+func (n namedSender) SendBatchEmailWithResult(ctx context.Context, messages []*EmailMessage) (*BatchResult, error) {
+	result, err := SendBatchEmailWithResult(ctx, n.EmailSender, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Provider = n.name
+
+	return result, nil
+}
+
+// Named wraps an EmailSender so that it reports the given provider name, used by Failover
+// when reporting which provider delivered a message
+func Named(name string, sender EmailSender) EmailSender {
+	return namedSender{EmailSender: sender, name: name}
+}
+
+// providerName returns the name reported by the sender, falling back to its type
+func providerName(sender EmailSender) string {
+	if n, ok := sender.(ProviderNamer); ok {
+		return n.ProviderName()
+	}
+
+	return fmt.Sprintf("%T", sender)
+}
+
+// Delivery reports which provider delivered a message sent through a FailoverSender
+type Delivery struct {
+	// Provider is the name of the provider that accepted the message
+	Provider string
+	// FailedOver lists the providers that were tried and failed before Provider, in order
+	FailedOver []string
+	// Result is the send result reported by the provider; it is nil for batch sends
+	Result *SendResult
+}
+
+// failoverProvider tracks the health of a single provider in a FailoverSender
+type failoverProvider struct {
+	name           string
+	sender         EmailSender
+	unhealthyUntil time.Time
+}
+
+// FailoverSender is an EmailSender that sends through the first healthy provider in order,
+// moving on to the next provider when a send fails with a retryable or transport error
+type FailoverSender struct {
+	mu         sync.Mutex
+	providers  []*failoverProvider
+	cooldown   time.Duration
+	onDelivery func(message *EmailMessage, delivery Delivery)
+}
+
+// Failover creates a FailoverSender that sends through primary and falls back to the secondaries
+// in the given order. A provider that fails with a retryable or transport error is skipped for
+// the cooldown window (30 seconds by default). A message over one provider's size limit is passed
+// to the next provider without marking it unhealthy; validation and other permanent errors are
+// returned without trying another provider
+func Failover(primary EmailSender, secondaries ...EmailSender) *FailoverSender {
+	f := &FailoverSender{
+		cooldown: defaultFailoverCooldown,
+	}
+
+	for _, sender := range append([]EmailSender{primary}, secondaries...) {
+		f.providers = append(f.providers, &failoverProvider{
+			name:   providerName(sender),
+			sender: sender,
+		})
+	}
+
+	return f
+}
+
+// SetCooldown sets how long a failed provider is skipped before it is tried again
+func (f *FailoverSender) SetCooldown(cooldown time.Duration) *FailoverSender {
+	f.cooldown = cooldown
+	return f
+}
+
+// SetDeliveryHook sets a function called with the Delivery of every message that is sent,
+// for callers that only hold the EmailSender interface
+func (f *FailoverSender) SetDeliveryHook(hook func(message *EmailMessage, delivery Delivery)) *FailoverSender {
+	f.onDelivery = hook
+	return f
+}
+
+// SendEmail satisfies the EmailSender interface
+func (f *FailoverSender) SendEmail(message *EmailMessage) error {
+	return f.SendEmailWithContext(context.Background(), message)
+}
+
+// SendEmailWithContext satisfies the EmailSender interface
+func (f *FailoverSender) SendEmailWithContext(ctx context.Context, message *EmailMessage) error {
+	_, err := f.SendEmailWithDelivery(ctx, message)
+
+	return err
+}
+
+// SendEmailWithResult satisfies the ResultSender interface
+func (f *FailoverSender) SendEmailWithResult(ctx context.Context, message *EmailMessage) (*SendResult, error) {
+	delivery, err := f.SendEmailWithDelivery(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery.Result, nil
+}
+
+// SendEmailWithDelivery sends the message and reports which provider delivered it
+func (f *FailoverSender) SendEmailWithDelivery(ctx context.Context, message *EmailMessage) (Delivery, error) {
+	var result *SendResult
+
+	delivery, err := f.do(ctx, func(ctx context.Context, sender EmailSender) error {
+		var err error
+
+		result, err = SendEmailWithResult(ctx, sender, message)
+
+		return err
+	})
+	if err != nil {
+		return delivery, err
+	}
+
+	result.Provider = delivery.Provider
+	delivery.Result = result
+
+	if f.onDelivery != nil {
+		f.onDelivery(message, delivery)
+	}
+
+	return delivery, nil
+}
+
+// SendBatchEmail satisfies the EmailSender interface
+func (f *FailoverSender) SendBatchEmail(messages []*EmailMessage) error {
+	return f.SendBatchEmailWithContext(context.Background(), messages)
+}
+
+// SendBatchEmailWithContext satisfies the EmailSender interface
+func (f *FailoverSender) SendBatchEmailWithContext(ctx context.Context, messages []*EmailMessage) error {
+	result, err := f.SendBatchEmailWithResult(ctx, messages)
+	if err != nil {
+		return err
+	}
+
+	return result.Err()
+}
+
+// SendBatchEmailWithResult satisfies the BatchResultSender interface. Only the messages that failed with a
+// retryable, transport or provider limit error move on to the next provider, so messages already accepted are
+// never sent twice. The whole batch fails over together when a provider rejects the batch request itself,
+// and providers returning ErrBatchNotImplemented are passed over without being marked unhealthy. Result.Provider
+// names the first provider that accepted any of the messages
+func (f *FailoverSender) SendBatchEmailWithResult(ctx context.Context, messages []*EmailMessage) (*BatchResult, error) {
+	var (
+		result     = NewBatchResult("", len(messages))
+		deliveries = make([]Delivery, len(messages))
+		itemErrs   = make([][]error, len(messages))
+		batchErrs  []error
+		handled    bool
+	)
+
+	pending := make([]int, len(messages))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	for _, p := range f.candidates() {
+		batch := make([]*EmailMessage, len(pending))
+		for j, i := range pending {
+			batch[j] = messages[i]
+		}
+
+		sent, err := SendBatchEmailWithResult(ctx, p.sender, batch)
+		if err != nil {
+			if !shouldFailover(err) {
+				if !handled {
+					return nil, err
+				}
+
+				for _, i := range pending {
+					result.SetFailed(i, err)
+				}
+
+				pending = nil
+
+				break
+			}
+
+			if marksUnhealthy(err) {
+				f.markUnhealthy(p)
+			}
+
+			batchErrs = append(batchErrs, fmt.Errorf("%s: %w", p.name, err))
+
+			for _, i := range pending {
+				deliveries[i].FailedOver = append(deliveries[i].FailedOver, p.name)
+				itemErrs[i] = append(itemErrs[i], fmt.Errorf("%s: %w", p.name, err))
+			}
+		} else {
+			handled = true
+			pending = f.mergeBatch(p, result, sent, pending, deliveries, itemErrs)
+		}
+
+		if len(pending) == 0 || ctx.Err() != nil {
+			break
+		}
+	}
+
+	if !handled {
+		return nil, fmt.Errorf("%w: %w", ErrAllProvidersFailed, errors.Join(batchErrs...))
+	}
+
+	for _, i := range pending {
+		result.SetFailed(i, fmt.Errorf("%w: %w", ErrAllProvidersFailed, errors.Join(itemErrs[i]...)))
+	}
+
+	if f.onDelivery != nil {
+		for i, item := range result.Items {
+			if item.Status == BatchStatusSent {
+				f.onDelivery(messages[i], deliveries[i])
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// mergeBatch records the outcome of sending the pending messages through the provider on result, and returns
+// the indexes of the messages that should be tried with the next provider
+func (f *FailoverSender) mergeBatch(p *failoverProvider, result, sent *BatchResult, pending []int, deliveries []Delivery, itemErrs [][]error) []int {
+	var (
+		next      []int
+		unhealthy bool
+	)
+
+	for j, item := range sent.Items {
+		i := pending[j]
+
+		switch {
+		case item.Status == BatchStatusSent:
+			if result.Provider == "" {
+				result.Provider = p.name
+			}
+
+			result.SetSent(i, item.MessageID)
+			result.Items[i].Rejected = item.Rejected
+			deliveries[i].Provider = p.name
+		case item.Err != nil && shouldFailover(item.Err):
+			unhealthy = unhealthy || marksUnhealthy(item.Err)
+
+			deliveries[i].FailedOver = append(deliveries[i].FailedOver, p.name)
+			itemErrs[i] = append(itemErrs[i], fmt.Errorf("%s: %w", p.name, item.Err))
+			next = append(next, i)
+		case item.Status == BatchStatusSkipped:
+			result.SetSkipped(i, item.Err)
+		default:
+			result.SetFailed(i, item.Err)
+		}
+	}
+
+	if unhealthy {
+		f.markUnhealthy(p)
+	}
+
+	return next
+}
+
+// do tries each provider in order until one accepts the send
+func (f *FailoverSender) do(ctx context.Context, send func(context.Context, EmailSender) error) (Delivery, error) {
+	var (
+		delivery Delivery
+		errs     []error
+	)
+
+	for _, p := range f.candidates() {
+		err := send(ctx, p.sender)
+		if err == nil {
+			delivery.Provider = p.name
+
+			return delivery, nil
+		}
+
+		if !shouldFailover(err) {
+			return delivery, err
+		}
+
+		if marksUnhealthy(err) {
+			f.markUnhealthy(p)
+		}
+
+		delivery.FailedOver = append(delivery.FailedOver, p.name)
+		errs = append(errs, fmt.Errorf("%s: %w", p.name, err))
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return delivery, fmt.Errorf("%w: %w", ErrAllProvidersFailed, errors.Join(errs...))
+}
+
+// candidates returns the healthy providers in order followed by those still cooling down,
+// so a send is always attempted even when every provider has recently failed
+func (f *FailoverSender) candidates() []*failoverProvider {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	healthy := make([]*failoverProvider, 0, len(f.providers))
+
+	var cooling []*failoverProvider
+
+	for _, p := range f.providers {
+		if now.Before(p.unhealthyUntil) {
+			cooling = append(cooling, p)
+		} else {
+			healthy = append(healthy, p)
+		}
+	}
+
+	return append(healthy, cooling...)
+}
+
+// markUnhealthy starts the cooldown window for the provider
+func (f *FailoverSender) markUnhealthy(p *failoverProvider) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p.unhealthyUntil = time.Now().Add(f.cooldown)
+}
+
+// shouldFailover reports whether a send error warrants trying the next provider
+func shouldFailover(err error) bool {
+	// a message another provider would also reject is not passed on, so every issue must be one of the provider's limits
+	var validationErr *shared.ValidationError
+	if errors.As(err, &validationErr) {
+		for _, issue := range validationErr.Issues {
+			if !errors.Is(issue, ErrMessageTooLarge) && !errors.Is(issue, ErrTooManyRecipients) {
+				return false
+			}
+		}
+
+		return len(validationErr.Issues) > 0
+	}
+
+	var missingField *shared.MissingRequiredFieldError
+	if errors.As(err, &missingField) {
+		return false
+	}
+
+	// a message over one provider's size or recipient limit may still be accepted by another
+	if IsRetryableError(err) || errors.Is(err, ErrBatchNotImplemented) || errors.Is(err, ErrMessageTooLarge) || errors.Is(err, ErrTooManyRecipients) {
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr)
+}
+
+// marksUnhealthy reports whether a send error that warrants failover should also put the provider into cooldown;
+// a provider that cannot batch or cannot take one message is still healthy
+func marksUnhealthy(err error) bool {
+	return !errors.Is(err, ErrBatchNotImplemented) && !errors.Is(err, ErrMessageTooLarge) && !errors.Is(err, ErrTooManyRecipients)
+}
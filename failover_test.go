@@ -0,0 +1,247 @@
+package newman_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/newman"
+	"github.com/theopenlane/newman/providers/mock"
+	"github.com/theopenlane/newman/shared"
+)
+
+func newFailoverSenders(t *testing.T) (*mock.EmailSender, *mock.EmailSender) {
+	primary, err := mock.New("")
+	require.NoError(t, err)
+
+	secondary, err := mock.New("")
+	require.NoError(t, err)
+
+	return primary, secondary
+}
+
+func TestFailoverUsesPrimary(t *testing.T) {
+	primary, secondary := newFailoverSenders(t)
+
+	sender := newman.Failover(newman.Named("resend", primary), newman.Named("smtp", secondary))
+
+	delivery, err := sender.SendEmailWithDelivery(context.Background(), newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "resend", delivery.Provider)
+	assert.Empty(t, delivery.FailedOver)
+	assert.Len(t, primary.Messages(), 1)
+	assert.Empty(t, secondary.Messages())
+}
+
+func TestFailoverOnRetryableError(t *testing.T) {
+	primary, secondary := newFailoverSenders(t)
+	primary.FailWith(newman.NewRetryableError(errRateLimited))
+
+	sender := newman.Failover(newman.Named("resend", primary), newman.Named("smtp", secondary))
+
+	delivery, err := sender.SendEmailWithDelivery(context.Background(), newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "smtp", delivery.Provider)
+	assert.Equal(t, []string{"resend"}, delivery.FailedOver)
+	assert.Empty(t, primary.Messages())
+	assert.Len(t, secondary.Messages(), 1)
+}
+
+func TestFailoverOnTransportError(t *testing.T) {
+	primary, secondary := newFailoverSenders(t)
+	primary.FailWith(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")})
+
+	var delivered []string
+
+	sender := newman.Failover(newman.Named("resend", primary), newman.Named("smtp", secondary)).
+		SetDeliveryHook(func(_ *newman.EmailMessage, delivery newman.Delivery) {
+			delivered = append(delivered, delivery.Provider)
+		})
+
+	require.NoError(t, sender.SendEmail(newRetryTestMessage("jerry@seinfeld.com")))
+	assert.Equal(t, []string{"smtp"}, delivered)
+}
+
+func TestFailoverDoesNotFailoverOnValidationError(t *testing.T) {
+	primary, secondary := newFailoverSenders(t)
+
+	sender := newman.Failover(primary, secondary)
+
+	err := sender.SendEmail(newRetryTestMessage("not-an-email"))
+
+	var missing *shared.MissingRequiredFieldError
+	require.ErrorAs(t, err, &missing)
+	assert.Empty(t, primary.Messages())
+	assert.Empty(t, secondary.Messages())
+}
+
+func TestFailoverTooManyRecipients(t *testing.T) {
+	primary, secondary := newFailoverSenders(t)
+
+	msg := newRetryTestMessage("jerry@seinfeld.com").SetCC([]string{"elaine@seinfeld.com"})
+	primary.FailWith(newman.ValidateEmailMessage(msg, newman.WithMaxRecipients(1)))
+
+	sender := newman.Failover(newman.Named("postmark", primary), newman.Named("resend", secondary))
+
+	delivery, err := sender.SendEmailWithDelivery(context.Background(), msg)
+	require.NoError(t, err)
+	assert.Equal(t, "resend", delivery.Provider)
+
+	// a recipient limit alongside a problem every provider rejects is not passed on
+	invalid := newRetryTestMessage("jerry@seinfeld.com").SetCC([]string{"elaine@seinfeld.com"})
+	invalid.Headers["X-Route"] = "42\r\nBcc: kramer@seinfeld.com"
+	primary.FailWith(newman.ValidateEmailMessage(invalid, newman.WithMaxRecipients(1)))
+
+	err = sender.SendEmail(msg)
+	require.ErrorIs(t, err, newman.ErrTooManyRecipients)
+	require.ErrorIs(t, err, shared.ErrInvalidHeader)
+	assert.Len(t, secondary.Messages(), 1)
+}
+
+func TestFailoverDoesNotFailoverOnPermanentError(t *testing.T) {
+	primary, secondary := newFailoverSenders(t)
+
+	permanent := errors.New("invalid api key")
+	primary.FailWith(permanent)
+
+	sender := newman.Failover(primary, secondary)
+
+	require.ErrorIs(t, sender.SendEmail(newRetryTestMessage("jerry@seinfeld.com")), permanent)
+	assert.Empty(t, secondary.Messages())
+}
+
+func TestFailoverCooldown(t *testing.T) {
+	primary, secondary := newFailoverSenders(t)
+	primary.FailWith(newman.NewRetryableError(errRateLimited))
+
+	sender := newman.Failover(newman.Named("resend", primary), newman.Named("smtp", secondary)).
+		SetCooldown(50 * time.Millisecond)
+
+	ctx := context.Background()
+
+	_, err := sender.SendEmailWithDelivery(ctx, newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+
+	// the primary is cooling down so the secondary is used without trying the primary first
+	delivery, err := sender.SendEmailWithDelivery(ctx, newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "smtp", delivery.Provider)
+	assert.Empty(t, delivery.FailedOver)
+
+	time.Sleep(60 * time.Millisecond)
+
+	delivery, err = sender.SendEmailWithDelivery(ctx, newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "resend", delivery.Provider)
+}
+
+func TestFailoverAllProvidersFail(t *testing.T) {
+	primary, secondary := newFailoverSenders(t)
+	primary.FailWith(newman.NewRetryableError(errRateLimited))
+	secondary.FailWith(newman.NewRetryableError(errRateLimited))
+
+	sender := newman.Failover(newman.Named("resend", primary), newman.Named("smtp", secondary))
+
+	delivery, err := sender.SendEmailWithDelivery(context.Background(), newRetryTestMessage("jerry@seinfeld.com"))
+	require.ErrorIs(t, err, newman.ErrAllProvidersFailed)
+	assert.True(t, newman.IsRetryableError(err))
+	assert.Equal(t, []string{"resend", "smtp"}, delivery.FailedOver)
+
+	// every provider is cooling down, they are still tried in order
+	delivery, err = sender.SendEmailWithDelivery(context.Background(), newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "resend", delivery.Provider)
+}
+
+// noBatchSender hides the batch results of the wrapped sender and rejects batches, like the Gmail provider
+type noBatchSender struct {
+	newman.EmailSender
+}
+
+func (noBatchSender) SendBatchEmailWithContext(context.Context, []*newman.EmailMessage) error {
+	return newman.ErrBatchNotImplemented
+}
+
+func TestFailoverBatchNotImplemented(t *testing.T) {
+	primary, secondary := newFailoverSenders(t)
+
+	var delivered []string
+
+	sender := newman.Failover(newman.Named("smtp", noBatchSender{primary}), newman.Named("resend", secondary)).
+		SetDeliveryHook(func(_ *newman.EmailMessage, delivery newman.Delivery) {
+			delivered = append(delivered, delivery.Provider)
+		})
+
+	messages := []*newman.EmailMessage{
+		newRetryTestMessage("jerry@seinfeld.com"),
+		newRetryTestMessage("george@seinfeld.com"),
+	}
+
+	require.NoError(t, sender.SendBatchEmail(messages))
+	assert.Equal(t, []string{"resend", "resend"}, delivered)
+
+	// ErrBatchNotImplemented does not put the provider into cooldown
+	delivery, err := sender.SendEmailWithDelivery(context.Background(), newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "smtp", delivery.Provider)
+}
+
+func TestFailoverBatchOnlyFailedMessages(t *testing.T) {
+	primary, secondary := newFailoverSenders(t)
+	primary.FailWith(nil, newman.NewRetryableError(errRateLimited), errors.New("invalid recipient"))
+
+	var delivered []newman.Delivery
+
+	sender := newman.Failover(newman.Named("resend", primary), newman.Named("smtp", secondary)).
+		SetDeliveryHook(func(_ *newman.EmailMessage, delivery newman.Delivery) {
+			delivered = append(delivered, delivery)
+		})
+
+	messages := []*newman.EmailMessage{
+		newRetryTestMessage("jerry@seinfeld.com"),
+		newRetryTestMessage("george@seinfeld.com"),
+		newRetryTestMessage("kramer@seinfeld.com"),
+	}
+
+	result, err := sender.SendBatchEmailWithResult(context.Background(), messages)
+	require.NoError(t, err)
+
+	assert.Equal(t, "resend", result.Provider)
+	assert.Equal(t, newman.BatchStatusSent, result.Items[0].Status)
+	assert.Equal(t, newman.BatchStatusSent, result.Items[1].Status)
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[2].Status)
+
+	// only the message that failed with a retryable error moved on, nothing was sent twice
+	require.Len(t, primary.Messages(), 1)
+	assert.Equal(t, messages[0], primary.Messages()[0])
+	require.Len(t, secondary.Messages(), 1)
+	assert.Equal(t, messages[1], secondary.Messages()[0])
+
+	require.Len(t, delivered, 2)
+	assert.Equal(t, newman.Delivery{Provider: "resend"}, delivered[0])
+	assert.Equal(t, newman.Delivery{Provider: "smtp", FailedOver: []string{"resend"}}, delivered[1])
+}
+
+func TestFailoverMessageTooLarge(t *testing.T) {
+	primary, secondary := newFailoverSenders(t)
+	primary.FailWith(&newman.MessageTooLargeError{Size: 12 * 1024 * 1024, Limit: 10 * 1024 * 1024})
+
+	sender := newman.Failover(newman.Named("postmark", primary), newman.Named("resend", secondary))
+
+	delivery, err := sender.SendEmailWithDelivery(context.Background(), newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "resend", delivery.Provider)
+	assert.Equal(t, []string{"postmark"}, delivery.FailedOver)
+
+	// a message too large for one provider does not put it into cooldown
+	delivery, err = sender.SendEmailWithDelivery(context.Background(), newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "postmark", delivery.Provider)
+}
@@ -0,0 +1,125 @@
+package newman
+
+import (
+	"context"
+	"sync"
+)
+
+const defaultFanOutWorkers = 4
+
+// fanOutSender implements batch sending by sending each message individually
+type fanOutSender struct {
+	next    EmailSender
+	workers int
+}
+
+// FanOutOption configures the EmailSender returned by FanOut
+type FanOutOption func(*fanOutSender)
+
+// WithFanOutWorkers sets how many messages of a batch are sent concurrently
+func WithFanOutWorkers(workers int) FanOutOption {
+	return func(f *fanOutSender) {
+		if workers > 0 {
+			f.workers = workers
+		}
+	}
+}
+
+// FanOut wraps an EmailSender so that batches are sent as individual SendEmailWithContext calls
+// spread over a bounded number of workers (4 by default). It gives providers without a native batch
+// API, which return ErrBatchNotImplemented, a working batch path. Results are reported in the order
+// of the input messages, and once the context is canceled any messages not yet started are skipped
+func FanOut(sender EmailSender, opts ...FanOutOption) EmailSender {
+	f := &fanOutSender{
+		next:    sender,
+		workers: defaultFanOutWorkers,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// ProviderName satisfies the ProviderNamer interface by reporting the wrapped sender's name
+func (f *fanOutSender) ProviderName() string {
+	return providerName(f.next)
+}
+
+// SendEmail satisfies the EmailSender interface
+func (f *fanOutSender) SendEmail(message *EmailMessage) error {
+	return f.next.SendEmail(message)
+}
+
+// SendEmailWithContext satisfies the EmailSender interface
+func (f *fanOutSender) SendEmailWithContext(ctx context.Context, message *EmailMessage) error {
+	return f.next.SendEmailWithContext(ctx, message)
+}
+
+// SendEmailWithResult satisfies the ResultSender interface
+func (f *fanOutSender) SendEmailWithResult(ctx context.Context, message *EmailMessage) (*SendResult, error) {
+	return SendEmailWithResult(ctx, f.next, message)
+}
+
+// SendBatchEmail satisfies the EmailSender interface
+func (f *fanOutSender) SendBatchEmail(messages []*EmailMessage) error {
+	return f.SendBatchEmailWithContext(context.Background(), messages)
+}
+
+// SendBatchEmailWithContext satisfies the EmailSender interface
+func (f *fanOutSender) SendBatchEmailWithContext(ctx context.Context, messages []*EmailMessage) error {
+	result, err := f.SendBatchEmailWithResult(ctx, messages)
+	if err != nil {
+		return err
+	}
+
+	return result.Err()
+}
+
+// SendBatchEmailWithResult satisfies the BatchResultSender interface
+func (f *fanOutSender) SendBatchEmailWithResult(ctx context.Context, messages []*EmailMessage) (*BatchResult, error) {
+	result := NewBatchResult(providerName(f.next), len(messages))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	// each worker writes only the items for the indexes it receives, so the result needs no locking
+	for range min(f.workers, len(messages)) {
+		wg.Go(func() {
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					result.SetSkipped(i, err)
+					continue
+				}
+
+				sent, err := SendEmailWithResult(ctx, f.next, messages[i])
+				if err != nil {
+					result.SetFailed(i, err)
+					continue
+				}
+
+				result.SetSent(i, sent.MessageID)
+				result.Items[i].Rejected = sent.Rejected
+			}
+		})
+	}
+
+queue:
+	for i := range messages {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			for j := i; j < len(messages); j++ {
+				result.SetSkipped(j, ctx.Err())
+			}
+
+			break queue
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return result, nil
+}
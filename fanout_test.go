@@ -0,0 +1,158 @@
+package newman_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/newman"
+	"github.com/theopenlane/newman/providers/mock"
+)
+
+// slowSender wraps an EmailSender, holding each send for a delay and tracking peak concurrency
+type slowSender struct {
+	newman.EmailSender
+	delay    time.Duration
+	inFlight atomic.Int32
+	peak     atomic.Int32
+	mu       sync.Mutex
+	started  []string
+}
+
+func (s *slowSender) SendEmailWithContext(ctx context.Context, message *newman.EmailMessage) error {
+	current := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+
+	for {
+		peak := s.peak.Load()
+		if current <= peak || s.peak.CompareAndSwap(peak, current) {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.started = append(s.started, message.To[0])
+	s.mu.Unlock()
+
+	time.Sleep(s.delay)
+
+	return s.EmailSender.SendEmailWithContext(ctx, message)
+}
+
+func newFanOutMessages(recipients ...string) []*newman.EmailMessage {
+	messages := make([]*newman.EmailMessage, 0, len(recipients))
+	for _, to := range recipients {
+		messages = append(messages, newRetryTestMessage(to))
+	}
+
+	return messages
+}
+
+func TestFanOutOrderedResults(t *testing.T) {
+	sender := newRetryTestSender(t)
+	sender.FailWith(newman.ErrBatchNotImplemented)
+
+	fanOut := newman.FanOut(sender, newman.WithFanOutWorkers(1))
+
+	messages := newFanOutMessages("jerry@seinfeld.com", "george@seinfeld.com", "not-an-email", "elaine@seinfeld.com")
+
+	result, err := newman.SendBatchEmailWithResult(context.Background(), fanOut, messages)
+	require.NoError(t, err)
+
+	assert.Equal(t, "mock", result.Provider)
+	require.Len(t, result.Items, 4)
+
+	for i, item := range result.Items {
+		assert.Equal(t, i, item.Index)
+	}
+
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[0].Status)
+	assert.Equal(t, newman.BatchStatusSent, result.Items[1].Status)
+	assert.Equal(t, "mock-1", result.Items[1].MessageID)
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[2].Status)
+	assert.Equal(t, newman.BatchStatusSent, result.Items[3].Status)
+	assert.Equal(t, "mock-2", result.Items[3].MessageID)
+
+	require.ErrorIs(t, fanOut.SendBatchEmail(newFanOutMessages("not-an-email")), newman.ErrBatchIncomplete)
+	require.NoError(t, fanOut.SendBatchEmail(newFanOutMessages("jerry@seinfeld.com")))
+}
+
+func TestFanOutKeepsRejectedRecipients(t *testing.T) {
+	sender, err := mock.New("")
+	require.NoError(t, err)
+
+	fanOut := newman.FanOut(newman.WithSuppression(sender, newSuppressionTestStore(t)), newman.WithFanOutWorkers(1))
+
+	messages := []*newman.EmailMessage{
+		newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello").SetCC([]string{"kramer@seinfeld.com"}),
+		newman.NewEmailMessage("newman@usps.com", []string{"george@seinfeld.com"}, "Mail route review", "Hello"),
+	}
+
+	result, err := newman.SendBatchEmailWithResult(context.Background(), fanOut, messages)
+	require.NoError(t, err)
+
+	assert.Equal(t, newman.BatchItem{Index: 0, Status: newman.BatchStatusSent, MessageID: "mock-1", Rejected: []string{"kramer@seinfeld.com"}}, result.Items[0])
+	assert.Equal(t, newman.BatchItem{Index: 1, Status: newman.BatchStatusSent, MessageID: "mock-2"}, result.Items[1])
+}
+
+func TestFanOutBoundsConcurrency(t *testing.T) {
+	sender := &slowSender{EmailSender: newRetryTestSender(t), delay: 20 * time.Millisecond}
+
+	fanOut := newman.FanOut(sender, newman.WithFanOutWorkers(3))
+
+	messages := newFanOutMessages(
+		"jerry@seinfeld.com", "george@seinfeld.com", "elaine@seinfeld.com",
+		"kramer@seinfeld.com", "newman@seinfeld.com", "frank@seinfeld.com",
+		"estelle@seinfeld.com", "morty@seinfeld.com", "helen@seinfeld.com",
+	)
+
+	require.NoError(t, fanOut.SendBatchEmailWithContext(context.Background(), messages))
+
+	assert.Equal(t, int32(3), sender.peak.Load())
+	assert.Len(t, sender.started, len(messages))
+}
+
+func TestFanOutCancellationSkipsQueuedSends(t *testing.T) {
+	sender := &slowSender{EmailSender: newRetryTestSender(t), delay: 50 * time.Millisecond}
+
+	fanOut := newman.FanOut(sender, newman.WithFanOutWorkers(2))
+
+	messages := newFanOutMessages(
+		"jerry@seinfeld.com", "george@seinfeld.com", "elaine@seinfeld.com",
+		"kramer@seinfeld.com", "newman@seinfeld.com", "frank@seinfeld.com",
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	result, err := newman.SendBatchEmailWithResult(ctx, fanOut, messages)
+	require.NoError(t, err)
+
+	// only the two sends already in flight when the context was canceled were started
+	assert.Len(t, sender.started, 2)
+
+	skipped := 0
+
+	for _, item := range result.Items {
+		if item.Status == newman.BatchStatusSkipped {
+			skipped++
+
+			assert.ErrorIs(t, item.Err, context.DeadlineExceeded)
+		}
+	}
+
+	assert.Equal(t, 4, skipped)
+}
+
+func TestFanOutEmptyBatch(t *testing.T) {
+	fanOut := newman.FanOut(newRetryTestSender(t))
+
+	result, err := newman.SendBatchEmailWithResult(context.Background(), fanOut, nil)
+	require.NoError(t, err)
+	assert.Empty(t, result.Items)
+}
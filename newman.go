@@ -2,6 +2,13 @@ package newman
 
 import (
 	"context"
+	"crypto"
+	"crypto/x509"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
 
 	"github.com/theopenlane/newman/shared"
 )
@@ -27,6 +34,55 @@ type Attachment = shared.Attachment
 // Tag is used to define custom metadata for message
 type Tag = shared.Tag
 
+// CalendarEvent is a calendar invite sent with an EmailMessage
+type CalendarEvent = shared.CalendarEvent
+
+// Address is an email address with an optional display name
+type Address = shared.Address
+
+// AttachmentPolicy controls what happens to an attachment larger than the maximum attachment size
+type AttachmentPolicy = shared.AttachmentPolicy
+
+// AttachmentDropHook is called for every attachment removed from a message under AttachmentPolicyDrop
+type AttachmentDropHook = shared.AttachmentDropHook
+
+// AttachmentTooLargeError is returned when an attachment exceeds the maximum attachment size
+type AttachmentTooLargeError = shared.AttachmentTooLargeError
+
+// MessageTooLargeError is returned before sending when a message exceeds the size a provider accepts
+type MessageTooLargeError = shared.MessageTooLargeError
+
+// ValidationMode controls which problems ValidateEmailMessage reports
+type ValidationMode = shared.ValidationMode
+
+// ValidationOption configures the limits ValidateEmailMessage checks a message against
+type ValidationOption = shared.ValidationOption
+
+// ValidationError is returned by ValidateEmailMessage with every problem found in the message
+type ValidationError = shared.ValidationError
+
+// ValidationIssue is a single problem found by ValidateEmailMessage
+type ValidationIssue = shared.ValidationIssue
+
+// MissingRequiredFieldError is the reason of a ValidationIssue for a missing sender or To recipient
+type MissingRequiredFieldError = shared.MissingRequiredFieldError
+
+const (
+	// AttachmentPolicyReject fails the send with an AttachmentTooLargeError, and is the default
+	AttachmentPolicyReject = shared.AttachmentPolicyReject
+	// AttachmentPolicyDrop removes the attachment and reports it to the drop hook
+	AttachmentPolicyDrop = shared.AttachmentPolicyDrop
+	// AttachmentPolicyCompress replaces the attachment with a zip archive
+	AttachmentPolicyCompress = shared.AttachmentPolicyCompress
+)
+
+const (
+	// ValidationLenient reports the problems that stop a message from being sent, and is the default
+	ValidationLenient = shared.ValidationLenient
+	// ValidationStrict also reports every invalid address, an empty subject and a message without a body
+	ValidationStrict = shared.ValidationStrict
+)
+
 // NewEmailMessage creates a new EmailMessage with the required fields
 func NewEmailMessage(from string, to []string, subject string, body string) *EmailMessage {
 	return shared.NewEmailMessage(from, to, subject, body)
@@ -45,19 +101,227 @@ func NewEmailMessageWithOptions(options ...MessageOption) *EmailMessage {
 	return &s
 }
 
+// NewAddress creates a new Address with the given display name and email address
+func NewAddress(name, address string) Address {
+	return shared.NewAddress(name, address)
+}
+
+// ParseAddress parses a bare email address or a mailbox with a display name such as "Jane Doe <jane@example.com>"
+func ParseAddress(address string) (Address, error) {
+	return shared.ParseAddress(address)
+}
+
+// ParseAddressList parses a comma separated list of addresses
+func ParseAddressList(list string) ([]Address, error) {
+	return shared.ParseAddressList(list)
+}
+
 // NewAttachment creates a new Attachment instance with the specified filename and content
 func NewAttachment(filename string, content []byte) *Attachment {
 	return shared.NewAttachment(filename, content)
 }
 
+// NewInlineAttachment creates a new inline Attachment that HTML content can reference as cid:contentID
+func NewInlineAttachment(filename, contentID string, content []byte) *Attachment {
+	return shared.NewInlineAttachment(filename, contentID, content)
+}
+
+// NewCalendarEvent creates a new CalendarEvent requesting attendance with a generated UID
+func NewCalendarEvent(summary string, start, end time.Time) *CalendarEvent {
+	return shared.NewCalendarEvent(summary, start, end)
+}
+
+// NewAttachmentFromReader creates a new Attachment whose content is streamed from r, which can only be read once
+func NewAttachmentFromReader(filename string, r io.Reader) *Attachment {
+	return shared.NewAttachmentFromReader(filename, r)
+}
+
+// NewAttachmentFromFS creates a new Attachment whose content is streamed from the named file in fsys
+func NewAttachmentFromFS(fsys fs.FS, name string) (*Attachment, error) {
+	return shared.NewAttachmentFromFS(fsys, name)
+}
+
 // NewAttachmentFromFile creates a new Attachment instance from the specified file path
 func NewAttachmentFromFile(filePath string) (*Attachment, error) {
 	return shared.NewAttachmentFromFile(filePath)
 }
 
+// MimeOption configures how BuildMimeMessage renders a message
+type MimeOption = shared.MimeOption
+
 // BuildMimeMessage constructs the MIME message for the email, including text, HTML, and attachments
-func BuildMimeMessage(message *EmailMessage) ([]byte, error) {
-	return shared.BuildMimeMessage(message)
+func BuildMimeMessage(message *EmailMessage, opts ...MimeOption) ([]byte, error) {
+	return shared.BuildMimeMessage(message, opts...)
+}
+
+// WriteMimeMessage writes the MIME message for the email to w, streaming attachments rather than holding them in memory
+func WriteMimeMessage(w io.Writer, message *EmailMessage, opts ...MimeOption) error {
+	return shared.WriteMimeMessage(w, message, opts...)
+}
+
+// ValidateEmailMessage checks the message according to its validation mode, returning a ValidationError listing every problem
+func ValidateEmailMessage(message *EmailMessage, opts ...ValidationOption) error {
+	return shared.ValidateEmailMessage(message, opts...)
+}
+
+// WithMaxRecipients sets the maximum number of recipients ValidateEmailMessage accepts
+func WithMaxRecipients(limit int) ValidationOption {
+	return shared.WithMaxRecipients(limit)
+}
+
+// ValidateMimeMessage checks that the message can be written safely as a MIME message
+func ValidateMimeMessage(message *EmailMessage) error {
+	return shared.ValidateMimeMessage(message)
+}
+
+// EmailMessageJSONSchema returns the JSON Schema of the wire format EmailMessage is marshaled as, for
+// services that enqueue messages without using this package
+func EmailMessageJSONSchema() []byte {
+	return shared.EmailMessageJSONSchema()
+}
+
+// ParseMimeMessage reads a MIME message, such as one written by BuildMimeMessage, back into an EmailMessage
+func ParseMimeMessage(r io.Reader) (*EmailMessage, error) {
+	return shared.ParseMimeMessage(r)
+}
+
+// WithMessageIDDomain sets the domain of generated Message-IDs, which defaults to the domain of the sender
+func WithMessageIDDomain(domain string) MimeOption {
+	return shared.WithMessageIDDomain(domain)
+}
+
+// DKIMSigner signs MIME messages with a relaxed/relaxed DKIM signature using an RSA or Ed25519 key
+type DKIMSigner = shared.DKIMSigner
+
+// DKIMOption configures a DKIMSigner
+type DKIMOption = shared.DKIMOption
+
+// DKIMKeyLookup returns the public key published for a DKIM selector of a domain
+type DKIMKeyLookup = shared.DKIMKeyLookup
+
+// NewDKIMSigner creates a DKIMSigner for the domain and selector with an *rsa.PrivateKey or ed25519.PrivateKey
+func NewDKIMSigner(domain, selector string, key crypto.Signer, opts ...DKIMOption) (*DKIMSigner, error) {
+	return shared.NewDKIMSigner(domain, selector, key, opts...)
+}
+
+// WithDKIMHeaders sets the headers a DKIMSigner signs, in addition to From
+func WithDKIMHeaders(headers ...string) DKIMOption {
+	return shared.WithDKIMHeaders(headers...)
+}
+
+// WithDKIMSigner signs the MIME message with the DKIM signer
+func WithDKIMSigner(signer *DKIMSigner) MimeOption {
+	return shared.WithDKIMSigner(signer)
+}
+
+// VerifyDKIM checks every DKIM signature of the message, looking up public keys in DNS when lookup is nil
+func VerifyDKIM(message []byte, lookup DKIMKeyLookup) error {
+	return shared.VerifyDKIM(message, lookup)
+}
+
+// ParseDKIMRecord parses the public key from a DKIM TXT record
+func ParseDKIMRecord(record string) (crypto.PublicKey, error) {
+	return shared.ParseDKIMRecord(record)
+}
+
+// SMIME signs and encrypts MIME messages with S/MIME
+type SMIME = shared.SMIME
+
+// SMIMEOption configures an SMIME
+type SMIMEOption = shared.SMIMEOption
+
+// NewSMIME creates an SMIME that signs, encrypts, or signs and encrypts messages
+func NewSMIME(opts ...SMIMEOption) (*SMIME, error) {
+	return shared.NewSMIME(opts...)
+}
+
+// WithSMIMESigner signs messages with the key of the certificate, including the intermediates in the signature
+func WithSMIMESigner(cert *x509.Certificate, key crypto.Signer, intermediates ...*x509.Certificate) SMIMEOption {
+	return shared.WithSMIMESigner(cert, key, intermediates...)
+}
+
+// WithSMIMERecipients encrypts messages to the certificates, which must hold RSA keys
+func WithSMIMERecipients(recipients ...*x509.Certificate) SMIMEOption {
+	return shared.WithSMIMERecipients(recipients...)
+}
+
+// WithSMIME signs and encrypts the MIME message with S/MIME. Encryption sets the package-global
+// pkcs7.ContentEncryptionAlgorithm, so it must not run alongside other pkcs7 encryption in the process
+func WithSMIME(s *SMIME) MimeOption {
+	return shared.WithSMIME(s)
+}
+
+// VerifySMIME checks the signature of an S/MIME signed message and returns the message with the signed content
+func VerifySMIME(message []byte, roots *x509.CertPool) ([]byte, error) {
+	return shared.VerifySMIME(message, roots)
+}
+
+// DecryptSMIME decrypts an S/MIME encrypted message and returns the message with the decrypted content
+func DecryptSMIME(message []byte, cert *x509.Certificate, key crypto.PrivateKey) ([]byte, error) {
+	return shared.DecryptSMIME(message, cert, key)
+}
+
+// PGPMIME signs and encrypts MIME messages with OpenPGP as PGP/MIME
+type PGPMIME = shared.PGPMIME
+
+// PGPOption configures a PGPMIME
+type PGPOption = shared.PGPOption
+
+// NewPGPMIME creates a PGPMIME that signs, encrypts, or signs and encrypts messages
+func NewPGPMIME(opts ...PGPOption) (*PGPMIME, error) {
+	return shared.NewPGPMIME(opts...)
+}
+
+// WithPGPSigner signs messages with the entity, which must hold a decrypted private signing key
+func WithPGPSigner(signer *openpgp.Entity) PGPOption {
+	return shared.WithPGPSigner(signer)
+}
+
+// WithPGPRecipients encrypts messages to the public keys of the entities
+func WithPGPRecipients(recipients ...*openpgp.Entity) PGPOption {
+	return shared.WithPGPRecipients(recipients...)
+}
+
+// WithPGPMIME signs and encrypts the MIME message with PGP/MIME
+func WithPGPMIME(p *PGPMIME) MimeOption {
+	return shared.WithPGPMIME(p)
+}
+
+// VerifyPGPMIME checks the signature of a PGP/MIME signed message and returns the message with the signed content
+func VerifyPGPMIME(message []byte, keyring openpgp.KeyRing) ([]byte, error) {
+	return shared.VerifyPGPMIME(message, keyring)
+}
+
+// DecryptPGPMIME decrypts a PGP/MIME encrypted message and returns the message with the decrypted content
+func DecryptPGPMIME(message []byte, keyring openpgp.KeyRing) ([]byte, error) {
+	return shared.DecryptPGPMIME(message, keyring)
+}
+
+// Unsubscriber generates and verifies one-click unsubscribe links
+type Unsubscriber = shared.Unsubscriber
+
+// UnsubscribeOption configures an Unsubscriber
+type UnsubscribeOption = shared.UnsubscribeOption
+
+// UnsubscribeRequest is the recipient and list an unsubscribe token was issued for
+type UnsubscribeRequest = shared.UnsubscribeRequest
+
+// UnsubscribeCallback is called by the unsubscribe handler with every verified request
+type UnsubscribeCallback = shared.UnsubscribeCallback
+
+// NewUnsubscriber creates an Unsubscriber signing tokens with the secret and linking to the HTTPS endpoint
+func NewUnsubscriber(secret []byte, endpoint string, opts ...UnsubscribeOption) (*Unsubscriber, error) {
+	return shared.NewUnsubscriber(secret, endpoint, opts...)
+}
+
+// WithUnsubscribeMailto adds a mailto address to the List-Unsubscribe header
+func WithUnsubscribeMailto(address string) UnsubscribeOption {
+	return shared.WithUnsubscribeMailto(address)
+}
+
+// WithUnsubscribeTTL expires unsubscribe tokens the duration after the message is built
+func WithUnsubscribeTTL(ttl time.Duration) UnsubscribeOption {
+	return shared.WithUnsubscribeTTL(ttl)
 }
 
 // ValidateEmail validates and sanitizes an email address
@@ -52,6 +52,27 @@ func TestNewEmailMessageWithOptions(t *testing.T) {
 	assert.Empty(t, emailMessage.GetCC())
 }
 
+func TestWithSubstitution(t *testing.T) {
+	emailMessage := NewEmailMessageWithOptions(
+		WithSubstitution("-name-", "Jerry"),
+		WithSubstitution("-city-", "New York"),
+	)
+
+	assert.Equal(t, map[string]string{"-name-": "Jerry", "-city-": "New York"}, emailMessage.Substitutions)
+}
+
+func TestThreadingOptions(t *testing.T) {
+	emailMessage := NewEmailMessageWithOptions(
+		WithMessageID("<reply@usps.com>"),
+		WithInReplyTo("<parent@usps.com>"),
+		WithReferences([]string{"<root@usps.com>", "<parent@usps.com>"}),
+	)
+
+	assert.Equal(t, "<reply@usps.com>", emailMessage.MessageID)
+	assert.Equal(t, "<parent@usps.com>", emailMessage.InReplyTo)
+	assert.Equal(t, []string{"<root@usps.com>", "<parent@usps.com>"}, emailMessage.References)
+}
+
 func TestNewAttachment(t *testing.T) {
 	filename := "test.txt"
 	content := []byte("test content")
@@ -19,6 +19,47 @@ func WithTo(to []string) MessageOption {
 	}
 }
 
+// WithFromAddress sets the sender of the email, including its display name
+func WithFromAddress(from Address) MessageOption {
+	return func(m *EmailMessage) {
+		m.SetFromAddress(from)
+	}
+}
+
+// WithToAddresses adds recipients, including their display names, to the email
+func WithToAddresses(to ...Address) MessageOption {
+	return func(m *EmailMessage) {
+		for _, address := range to {
+			m.AddToAddress(address)
+		}
+	}
+}
+
+// WithCcAddresses adds CC recipients, including their display names, to the email
+func WithCcAddresses(cc ...Address) MessageOption {
+	return func(m *EmailMessage) {
+		for _, address := range cc {
+			m.AddCCAddress(address)
+		}
+	}
+}
+
+// WithBccAddresses adds BCC recipients, including their display names, to the email
+func WithBccAddresses(bcc ...Address) MessageOption {
+	return func(m *EmailMessage) {
+		for _, address := range bcc {
+			m.AddBCCAddress(address)
+		}
+	}
+}
+
+// WithReplyToAddress sets the reply-to address of the email, including its display name
+func WithReplyToAddress(replyTo Address) MessageOption {
+	return func(m *EmailMessage) {
+		m.SetReplyToAddress(replyTo)
+	}
+}
+
 // WithSubject sets the subject of the email
 func WithSubject(subject string) MessageOption {
 	return func(m *EmailMessage) {
@@ -109,3 +150,84 @@ func WithHeaderMap(headers map[string]string) MessageOption {
 		maps.Copy(m.Headers, headers)
 	}
 }
+
+// WithSubstitution adds a template substitution to the email
+func WithSubstitution(key, value string) MessageOption {
+	return func(m *EmailMessage) {
+		if m.Substitutions == nil {
+			m.Substitutions = map[string]string{}
+		}
+
+		m.Substitutions[key] = value
+	}
+}
+
+// WithSubstitutions sets the template substitutions of the email
+func WithSubstitutions(substitutions map[string]string) MessageOption {
+	return func(m *EmailMessage) {
+		m.Substitutions = substitutions
+	}
+}
+
+// WithMessageID sets the Message-ID of the email
+func WithMessageID(messageID string) MessageOption {
+	return func(m *EmailMessage) {
+		m.MessageID = messageID
+	}
+}
+
+// WithInReplyTo sets the Message-ID of the email this one replies to
+func WithInReplyTo(messageID string) MessageOption {
+	return func(m *EmailMessage) {
+		m.InReplyTo = messageID
+	}
+}
+
+// WithReferences sets the Message-IDs of the thread the email belongs to
+func WithReferences(references []string) MessageOption {
+	return func(m *EmailMessage) {
+		m.References = references
+	}
+}
+
+// WithCalendarEvent sets the calendar invite sent with the email
+func WithCalendarEvent(event *CalendarEvent) MessageOption {
+	return func(m *EmailMessage) {
+		m.Calendar = event
+	}
+}
+
+// WithMaxAttachmentSize sets the maximum attachment size in bytes, or -1 for no limit
+func WithMaxAttachmentSize(size int) MessageOption {
+	return func(m *EmailMessage) {
+		m.SetMaxAttachmentSize(size)
+	}
+}
+
+// WithAttachmentPolicy sets what happens to attachments over the maximum attachment size
+func WithAttachmentPolicy(policy AttachmentPolicy) MessageOption {
+	return func(m *EmailMessage) {
+		m.SetAttachmentPolicy(policy)
+	}
+}
+
+// WithUnsubscribe adds one-click unsubscribe headers for the recipient and the list to a message with a single recipient
+func WithUnsubscribe(unsubscriber *Unsubscriber, list string) MessageOption {
+	return func(m *EmailMessage) {
+		m.SetUnsubscribe(unsubscriber, list)
+	}
+}
+
+// WithValidationMode sets which problems are reported when the message is validated before sending
+func WithValidationMode(mode ValidationMode) MessageOption {
+	return func(m *EmailMessage) {
+		m.SetValidationMode(mode)
+	}
+}
+
+// WithAttachmentDropHook sets the hook called for attachments dropped under AttachmentPolicyDrop
+func WithAttachmentDropHook(hook AttachmentDropHook) MessageOption {
+	return func(m *EmailMessage) {
+		m.SetAttachmentDropHook(hook)
+	}
+}
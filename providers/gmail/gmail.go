@@ -4,21 +4,67 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 
 	"github.com/theopenlane/newman"
 	"github.com/theopenlane/newman/credentials"
 )
 
+const (
+	providerName = "gmail"
+	// retryAfterHeader holds the delay Gmail asks for before a rate limited request is retried
+	retryAfterHeader = "Retry-After"
+)
+
 // gmailEmailSender wraps the Gmail UsersMessagesService
 type gmailEmailSender struct {
 	messageSender *gmail.UsersMessagesService
 	user          string
+	mimeOptions   []newman.MimeOption
+}
+
+// Option is a type representing a function that modifies a gmailEmailSender
+type Option func(*gmailEmailSender)
+
+// WithDKIMSigner signs every message with a DKIM signature before it is sent. Gmail may add its own
+// signature for the sending domain alongside it
+func WithDKIMSigner(signer *newman.DKIMSigner) Option {
+	return func(s *gmailEmailSender) {
+		s.mimeOptions = append(s.mimeOptions, newman.WithDKIMSigner(signer))
+	}
+}
+
+// WithSMIME signs and encrypts every message with S/MIME before it is sent
+func WithSMIME(smime *newman.SMIME) Option {
+	return func(s *gmailEmailSender) {
+		s.mimeOptions = append(s.mimeOptions, newman.WithSMIME(smime))
+	}
+}
+
+// WithPGPMIME signs and encrypts every message with PGP/MIME before it is sent
+func WithPGPMIME(pgp *newman.PGPMIME) Option {
+	return func(s *gmailEmailSender) {
+		s.mimeOptions = append(s.mimeOptions, newman.WithPGPMIME(pgp))
+	}
+}
+
+// newSender creates a gmailEmailSender for the messages service and applies the options
+func newSender(messageSender *gmail.UsersMessagesService, user string, opts ...Option) *gmailEmailSender {
+	s := &gmailEmailSender{messageSender: messageSender, user: user}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 // SendEmail satisfies the EmailSender interface
@@ -36,28 +82,56 @@ func (s *gmailEmailSender) SendBatchEmailWithContext(_ context.Context, _ []*new
 	return newman.ErrBatchNotImplemented
 }
 
+// ProviderName satisfies the newman.ProviderNamer interface
+func (s *gmailEmailSender) ProviderName() string {
+	return providerName
+}
+
 // SendEmailWithContext satisfies the EmailSender interface
-func (s *gmailEmailSender) SendEmailWithContext(_ context.Context, message *newman.EmailMessage) error {
-	mimeMessage, err := newman.BuildMimeMessage(message)
+func (s *gmailEmailSender) SendEmailWithContext(ctx context.Context, message *newman.EmailMessage) error {
+	_, err := s.SendEmailWithResult(ctx, message)
+
+	return err
+}
+
+// SendEmailWithResult satisfies the newman.ResultSender interface
+func (s *gmailEmailSender) SendEmailWithResult(ctx context.Context, message *newman.EmailMessage) (*newman.SendResult, error) {
+	if err := newman.ValidateEmailMessage(message); err != nil {
+		return nil, err
+	}
+
+	message, err := message.ApplyAttachmentPolicy()
 	if err != nil {
-		return ErrUnableToBuildMIMEMessage
+		return nil, err
 	}
 
-	mimeMessage = addBCCRecipients(mimeMessage, message.GetBCC())
+	mimeMessage, err := newman.BuildMimeMessage(message, s.mimeOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnableToBuildMIMEMessage, err)
+	}
+
+	bccs := make([]string, 0, len(message.Bcc))
+	for _, bcc := range message.GetBCCAddresses() {
+		bccs = append(bccs, bcc.Encode())
+	}
+
+	// the Bcc header is added after signing, so it is not covered by a DKIM signature
+	mimeMessage = addBCCRecipients(mimeMessage, bccs)
 
 	gMessage := &gmail.Message{
 		Raw: base64.URLEncoding.EncodeToString(mimeMessage),
 	}
 
-	if _, err = s.send(gMessage); err != nil {
-		return ErrFailedToSendEmail
+	sent, err := s.send(ctx, gMessage)
+	if err != nil {
+		return nil, sendError(err)
 	}
 
-	return nil
+	return newman.NewSendResult(providerName, sent.Id, message), nil
 }
 
 // send a Gmail message
-func (s *gmailEmailSender) send(message *gmail.Message) (*gmail.Message, error) {
+func (s *gmailEmailSender) send(ctx context.Context, message *gmail.Message) (*gmail.Message, error) {
 	if s.messageSender == nil {
 		return nil, ErrNoUsersMessagesService
 	}
@@ -67,7 +141,24 @@ func (s *gmailEmailSender) send(message *gmail.Message) (*gmail.Message, error)
 		user = "me"
 	}
 
-	return s.messageSender.Send(user, message).Do()
+	return s.messageSender.Send(user, message).Context(ctx).Do()
+}
+
+// sendError wraps an error from the Gmail API in ErrFailedToSendEmail. Rate limiting and server errors are
+// returned as retryable errors
+func sendError(err error) error {
+	err = fmt.Errorf("%w: %w", ErrFailedToSendEmail, err)
+
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || (apiErr.Code != http.StatusTooManyRequests && apiErr.Code < http.StatusInternalServerError) {
+		return err
+	}
+
+	if retryAfter, ok := newman.ParseRetryAfter(apiErr.Header.Get(retryAfterHeader)); ok {
+		return newman.NewRetryableErrorWithDelay(err, retryAfter)
+	}
+
+	return newman.NewRetryableError(err)
 }
 
 // addBCCRecipients adds BCC recipients to the message
@@ -91,7 +182,7 @@ type TokenManager interface {
 }
 
 // NewWithOauth2 initializes a new gmailEmailSenderOauth2 instance using OAuth2 credentials
-func NewWithOauth2(ctx context.Context, configJSON []byte, tokenManager TokenManager, user string) (newman.EmailSender, error) {
+func NewWithOauth2(ctx context.Context, configJSON []byte, tokenManager TokenManager, user string, opts ...Option) (newman.EmailSender, error) {
 	config, err := credentials.ParseCredentials(configJSON)
 	if err != nil {
 		return nil, err
@@ -114,11 +205,11 @@ func NewWithOauth2(ctx context.Context, configJSON []byte, tokenManager TokenMan
 		return nil, ErrUnableToStartGmailService
 	}
 
-	return &gmailEmailSender{messageSender: srv.Users.Messages, user: user}, nil
+	return newSender(srv.Users.Messages, user, opts...), nil
 }
 
 // NewWithServiceAccount initializes a new gmailEmailSenderServiceAccount instance using service account JSON credentials
-func NewWithServiceAccount(ctx context.Context, jsonCredentials []byte, user string) (newman.EmailSender, error) {
+func NewWithServiceAccount(ctx context.Context, jsonCredentials []byte, user string, opts ...Option) (newman.EmailSender, error) {
 	params := google.CredentialsParams{
 		Scopes:  []string{gmail.GmailSendScope},
 		Subject: user,
@@ -134,21 +225,21 @@ func NewWithServiceAccount(ctx context.Context, jsonCredentials []byte, user str
 		return nil, ErrUnableToStartGmailService
 	}
 
-	return &gmailEmailSender{messageSender: srv.Users.Messages, user: user}, nil
+	return newSender(srv.Users.Messages, user, opts...), nil
 }
 
 // NewWithAPIKey initializes a new gmailEmailSenderAPIKey instance using an API key
-func NewWithAPIKey(ctx context.Context, apiKey, user string) (newman.EmailSender, error) {
+func NewWithAPIKey(ctx context.Context, apiKey, user string, opts ...Option) (newman.EmailSender, error) {
 	srv, err := gmail.NewService(ctx, option.WithAPIKey(apiKey))
 	if err != nil {
 		return nil, ErrUnableToStartGmailService
 	}
 
-	return &gmailEmailSender{messageSender: srv.Users.Messages, user: user}, nil
+	return newSender(srv.Users.Messages, user, opts...), nil
 }
 
 // NewWithJWTConfig initializes a new gmailEmailSenderJWT instance using JWT configuration
-func NewWithJWTConfig(ctx context.Context, configJSON []byte, user string) (newman.EmailSender, error) {
+func NewWithJWTConfig(ctx context.Context, configJSON []byte, user string, opts ...Option) (newman.EmailSender, error) {
 	config, err := google.JWTConfigFromJSON(configJSON)
 	if err != nil {
 		return nil, ErrUnableToParseJWTCredentials
@@ -161,11 +252,11 @@ func NewWithJWTConfig(ctx context.Context, configJSON []byte, user string) (newm
 		return nil, ErrUnableToStartGmailService
 	}
 
-	return &gmailEmailSender{messageSender: srv.Users.Messages, user: user}, nil
+	return newSender(srv.Users.Messages, user, opts...), nil
 }
 
 // NewWithJWTAccess initializes a new gmailEmailSenderJWTAccess instance using a JWT access token
-func NewWithJWTAccess(ctx context.Context, jsonCredentials []byte, user string) (newman.EmailSender, error) {
+func NewWithJWTAccess(ctx context.Context, jsonCredentials []byte, user string, opts ...Option) (newman.EmailSender, error) {
 	tokenSource, err := google.JWTAccessTokenSourceFromJSON(jsonCredentials, gmail.GmailSendScope)
 	if err != nil {
 		return nil, ErrUnableToParseJWTCredentials
@@ -176,5 +267,5 @@ func NewWithJWTAccess(ctx context.Context, jsonCredentials []byte, user string)
 		return nil, ErrUnableToStartGmailService
 	}
 
-	return &gmailEmailSender{messageSender: srv.Users.Messages, user: user}, nil
+	return newSender(srv.Users.Messages, user, opts...), nil
 }
@@ -3,11 +3,19 @@ package gmail
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
@@ -15,6 +23,7 @@ import (
 	"google.golang.org/api/option"
 
 	"github.com/theopenlane/newman"
+	"github.com/theopenlane/newman/providers/mock"
 )
 
 // MockTokenManager is a mock implementation of the GmailTokenManager interface
@@ -36,6 +45,7 @@ func (m *MockTokenManager) GetToken() ([]byte, error) {
 type GmailMockRoundTripper struct {
 	Response *http.Response
 	Err      error
+	Requests [][]byte
 }
 
 func readRequestBody(req *http.Request) ([]byte, error) {
@@ -59,6 +69,8 @@ func (m *GmailMockRoundTripper) RoundTrip(req *http.Request) (*http.Response, er
 		return nil, err
 	}
 
+	m.Requests = append(m.Requests, reqBody)
+
 	return &http.Response{
 		StatusCode: http.StatusOK,
 		Body:       io.NopCloser(bytes.NewReader(reqBody)),
@@ -142,6 +154,77 @@ func TestSendEmailWithBCC(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSendEmailWithDKIMSigner(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signer, err := newman.NewDKIMSigner("usps.com", "route", key)
+	require.NoError(t, err)
+
+	transport := &GmailMockRoundTripper{}
+	mockGmailService, err := gmail.NewService(context.Background(), option.WithHTTPClient(&http.Client{Transport: transport}))
+	require.NoError(t, err)
+
+	emailSender := newSender(mockGmailService.Users.Messages, "me", WithDKIMSigner(signer))
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "The air is so dewy sweet you dont even have to lick the stamps").
+		SetBCC([]string{"kramer@seinfeld.com"})
+
+	require.NoError(t, emailSender.SendEmail(message))
+	require.Len(t, transport.Requests, 1)
+
+	var sent gmail.Message
+
+	require.NoError(t, json.Unmarshal(transport.Requests[0], &sent))
+
+	raw, err := base64.URLEncoding.DecodeString(sent.Raw)
+	require.NoError(t, err)
+
+	lookup := func(domain, selector string) (crypto.PublicKey, error) {
+		assert.Equal(t, "usps.com", domain)
+		assert.Equal(t, "route", selector)
+
+		return newman.ParseDKIMRecord(signer.DNSRecord())
+	}
+
+	// the Bcc header added for Gmail is not signed, so the signature still verifies
+	assert.True(t, bytes.HasPrefix(raw, []byte("Bcc: kramer@seinfeld.com\r\nDKIM-Signature: ")))
+	assert.NoError(t, newman.VerifyDKIM(raw, lookup))
+}
+
+func TestSendEmailWithPGPMIME(t *testing.T) {
+	signer, err := openpgp.NewEntity("Newman", "", "newman@usps.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	require.NoError(t, err)
+
+	pgp, err := newman.NewPGPMIME(newman.WithPGPSigner(signer))
+	require.NoError(t, err)
+
+	transport := &GmailMockRoundTripper{}
+	mockGmailService, err := gmail.NewService(context.Background(), option.WithHTTPClient(&http.Client{Transport: transport}))
+	require.NoError(t, err)
+
+	emailSender := newSender(mockGmailService.Users.Messages, "me", WithPGPMIME(pgp))
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "The air is so dewy sweet you dont even have to lick the stamps")
+
+	require.NoError(t, emailSender.SendEmail(message))
+	require.Len(t, transport.Requests, 1)
+
+	var sent gmail.Message
+
+	require.NoError(t, json.Unmarshal(transport.Requests[0], &sent))
+
+	raw, err := base64.URLEncoding.DecodeString(sent.Raw)
+	require.NoError(t, err)
+
+	verified, err := newman.VerifyPGPMIME(raw, openpgp.EntityList{signer})
+	require.NoError(t, err)
+
+	parsed, err := newman.ParseMimeMessage(bytes.NewReader(verified))
+	require.NoError(t, err)
+	assert.Equal(t, message.Text, parsed.Text)
+}
+
 func TestNewGmailEmailSenderOauth2(t *testing.T) {
 	configJSON := []byte(`{
 		"installed": {
@@ -355,3 +438,46 @@ func TestNewGmailEmailSenderServiceAccountInvalidJson(t *testing.T) {
 	_, err := NewWithServiceAccount(context.Background(), jsonCredentials, user)
 	assert.Error(t, err)
 }
+
+func TestSendEmailWithResult(t *testing.T) {
+	emailSender := buildMockGmailMessageSenderWrapper(nil)
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "The air is so dewy sweet you dont even have to lick the stamps")
+
+	result, err := emailSender.SendEmailWithResult(context.Background(), message)
+	require.NoError(t, err)
+
+	assert.Equal(t, "gmail", result.Provider)
+	assert.Equal(t, []string{"jerry@seinfeld.com"}, result.Accepted)
+}
+
+func TestServerErrorFailover(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		http.Error(w, `{"error":{"code":503,"message":"Backend Error"}}`, http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	srv, err := gmail.NewService(context.Background(), option.WithHTTPClient(ts.Client()), option.WithEndpoint(ts.URL))
+	require.NoError(t, err)
+
+	gmailSender := newSender(srv.Users.Messages, "me")
+
+	err = gmailSender.SendEmail(newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry"))
+	require.ErrorIs(t, err, ErrFailedToSendEmail)
+	assert.ErrorContains(t, err, "Backend Error")
+
+	retryAfter, ok := newman.RetryAfter(err)
+	require.True(t, ok)
+	assert.Equal(t, 7*time.Second, retryAfter)
+
+	backup, err := mock.New("")
+	require.NoError(t, err)
+
+	sender := newman.Failover(newman.Named(providerName, gmailSender), newman.Named("mock", backup))
+
+	delivery, err := sender.SendEmailWithDelivery(context.Background(), newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry"))
+	require.NoError(t, err)
+	assert.Equal(t, "mock", delivery.Provider)
+	assert.Equal(t, []string{providerName}, delivery.FailedOver)
+}
@@ -1,16 +1,30 @@
 package mailgun
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/mailgun/mailgun-go/v4"
 
 	"github.com/theopenlane/newman"
+	"github.com/theopenlane/newman/scrubber"
+	"github.com/theopenlane/newman/shared"
 )
 
+const providerName = "mailgun"
+
 type mailgunEmailSender struct {
-	client mailgun.Mailgun
+	client       mailgun.Mailgun
+	htmlScrubber scrubber.Scrubber
 }
 
 // Option is a type representing a function that modifies a mailgunEmailSender
@@ -23,6 +37,14 @@ func WithEurope() Option {
 	}
 }
 
+// WithHTMLScrubber sets a scrubber applied to HTML content before sending.
+// When set, every outbound message has its HTML sanitized by this scrubber
+func WithHTMLScrubber(s scrubber.Scrubber) Option {
+	return func(m *mailgunEmailSender) {
+		m.htmlScrubber = s
+	}
+}
+
 // New creates a new mailgunEmailSender
 func New(domain, apiKey string, opts ...Option) (newman.EmailSender, error) {
 	if apiKey == "" {
@@ -46,22 +68,346 @@ func (s *mailgunEmailSender) SendEmail(message *newman.EmailMessage) error {
 }
 
 // SendBatchEmail satisfies the EmailSender interface
-func (s *mailgunEmailSender) SendBatchEmail(_ []*newman.EmailMessage) error {
-	return newman.ErrBatchNotImplemented
+func (s *mailgunEmailSender) SendBatchEmail(messages []*newman.EmailMessage) error {
+	return s.SendBatchEmailWithContext(context.Background(), messages)
 }
 
 // SendBatchEmailWithContext satisfies the EmailSender interface
-func (s *mailgunEmailSender) SendBatchEmailWithContext(_ context.Context, _ []*newman.EmailMessage) error {
-	return newman.ErrBatchNotImplemented
+func (s *mailgunEmailSender) SendBatchEmailWithContext(ctx context.Context, messages []*newman.EmailMessage) error {
+	result, err := s.SendBatchEmailWithResult(ctx, messages)
+	if err != nil {
+		return err
+	}
+
+	return result.Err()
+}
+
+// SendBatchEmailWithResult satisfies the newman.BatchResultSender interface. Messages that differ only
+// in their To recipients and substitutions are merged into one Mailgun batch send, with each message's
+// substitutions attached to its recipients as recipient-variables (referenced in the body as
+// %recipient.<key>%). A message with several To recipients and no substitutions is sent on its own, so
+// its recipients receive one shared copy as they would with SendEmail. Mailgun assigns a single message
+// ID to each request, so every message merged into a request reports the same ID
+func (s *mailgunEmailSender) SendBatchEmailWithResult(ctx context.Context, messages []*newman.EmailMessage) (*newman.BatchResult, error) {
+	if len(messages) == 0 {
+		return nil, ErrEmptyBatch
+	}
+
+	result := newman.NewBatchResult(providerName, len(messages))
+
+	var (
+		order  []string
+		groups = map[string][]int{}
+		alone  []int
+	)
+
+	// the attachment policy is applied to copies, which are sent in place of the messages
+	messages = slices.Clone(messages)
+
+	for i, message := range messages {
+		if err := shared.ValidateEmailMessage(message, shared.WithMaxRecipients(mailgun.MaxNumberOfRecipients)); err != nil {
+			result.SetFailed(i, err)
+			continue
+		}
+
+		message, err := message.PrepareAttachments(0)
+		if err != nil {
+			result.SetFailed(i, err)
+			continue
+		}
+
+		messages[i] = message
+
+		// merging sends every To recipient a separate copy through recipient-variables
+		if len(message.GetTo()) > 1 && len(message.Substitutions) == 0 {
+			alone = append(alone, i)
+			continue
+		}
+
+		key := s.contentKey(message)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+
+		groups[key] = append(groups[key], i)
+	}
+
+	for _, key := range order {
+		for _, chunk := range chunkByRecipients(messages, groups[key]) {
+			s.sendChunk(ctx, messages, chunk, true, result)
+		}
+	}
+
+	for _, i := range alone {
+		s.sendChunk(ctx, messages, []int{i}, false, result)
+	}
+
+	return result, nil
+}
+
+// sendChunk sends the messages at the given indexes as a single Mailgun batch send and records the outcome,
+// with recipient-variables when withVariables is set
+func (s *mailgunEmailSender) sendChunk(ctx context.Context, messages []*newman.EmailMessage, chunk []int, withVariables bool, result *newman.BatchResult) {
+	mailMessage, err := s.newMessage(messages[chunk[0]])
+	if err == nil {
+		for _, i := range chunk {
+			if err = addRecipients(mailMessage, messages[i], withVariables); err != nil {
+				break
+			}
+		}
+	}
+
+	var id string
+	if err == nil {
+		id, err = s.send(ctx, mailMessage, ErrFailedToSendBatchEmail)
+	}
+
+	for _, i := range chunk {
+		if err != nil {
+			result.SetFailed(i, err)
+		} else {
+			result.SetSent(i, id)
+		}
+	}
+}
+
+// ProviderName satisfies the newman.ProviderNamer interface
+func (s *mailgunEmailSender) ProviderName() string {
+	return providerName
 }
 
 // SendEmailWithContext satisfies the EmailSender interface
 func (s *mailgunEmailSender) SendEmailWithContext(ctx context.Context, message *newman.EmailMessage) error {
-	mailMessage := mailgun.NewMessage(message.From, message.Subject, message.Text, message.To...)
+	_, err := s.SendEmailWithResult(ctx, message)
+
+	return err
+}
+
+// SendEmailWithResult satisfies the newman.ResultSender interface. When the message has substitutions
+// they are sent as recipient-variables, so each To recipient receives an individual copy
+func (s *mailgunEmailSender) SendEmailWithResult(ctx context.Context, message *newman.EmailMessage) (*newman.SendResult, error) {
+	if err := shared.ValidateEmailMessage(message, shared.WithMaxRecipients(mailgun.MaxNumberOfRecipients)); err != nil {
+		return nil, err
+	}
+
+	message, err := message.PrepareAttachments(0)
+	if err != nil {
+		return nil, err
+	}
+
+	mailMessage, err := s.newMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addRecipients(mailMessage, message, len(message.Substitutions) > 0); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToSendEmail, err)
+	}
+
+	id, err := s.send(ctx, mailMessage, ErrFailedToSendEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	return newman.NewSendResult(providerName, id, message), nil
+}
+
+// send posts the message to Mailgun and returns the ID it was assigned. Rate limiting and
+// server errors are returned as retryable errors wrapping the sentinel
+func (s *mailgunEmailSender) send(ctx context.Context, mailMessage *mailgun.Message, sentinel error) (string, error) {
+	_, id, err := s.client.Send(ctx, mailMessage)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", sentinel, err)
+
+		var unexpected *mailgun.UnexpectedResponseError
+		if errors.As(err, &unexpected) && (unexpected.Actual == http.StatusTooManyRequests || unexpected.Actual >= http.StatusInternalServerError) {
+			return "", newman.NewRetryableError(err)
+		}
+
+		return "", err
+	}
+
+	// mailgun returns the message id wrapped in angle brackets, webhooks report it without them
+	return strings.Trim(id, "<>"), nil
+}
+
+// newMessage creates a Mailgun message with everything but the To recipients of the message. Internationalized
+// domain names are sent as punycode
+func (s *mailgunEmailSender) newMessage(message *newman.EmailMessage) (*mailgun.Message, error) {
+	mailMessage := mailgun.NewMessage(message.GetFromAddress().ToASCII().String(), message.GetSubject(), message.GetText())
+
+	if htmlContent := s.html(message); htmlContent != "" {
+		mailMessage.SetHTML(htmlContent)
+	}
+
+	if replyTo := message.GetReplyToAddress(); !replyTo.IsZero() {
+		mailMessage.SetReplyTo(replyTo.ToASCII().String())
+	}
 
-	if _, _, err := s.client.Send(ctx, mailMessage); err != nil {
-		return fmt.Errorf("send message: %w", err)
+	for _, cc := range message.GetCCAddresses() {
+		mailMessage.AddCC(cc.ToASCII().String())
+	}
+
+	for _, bcc := range message.GetBCCAddresses() {
+		mailMessage.AddBCC(bcc.ToASCII().String())
+	}
+
+	if len(message.Tags) > mailgun.MaxNumberOfTags {
+		return nil, fmt.Errorf("%w: %d tags given, at most %d allowed", ErrTooManyTags, len(message.Tags), mailgun.MaxNumberOfTags)
+	}
+
+	for _, tag := range message.Tags {
+		if err := mailMessage.AddTag(tagValue(tag)); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrTooManyTags, err)
+		}
+	}
+
+	for key, value := range message.GetHeaders() {
+		mailMessage.AddHeader(key, value)
+	}
+
+	for _, attachment := range message.GetAttachments() {
+		// Mailgun gives an inline attachment its filename as Content-ID, so it is named by the content ID
+		// the HTML references
+		if attachment.IsInline() {
+			mailMessage.AddReaderInline(attachment.GetContentID(), io.NopCloser(bytes.NewReader(attachment.GetRawContent())))
+			continue
+		}
+
+		mailMessage.AddBufferAttachment(attachment.GetFilename(), attachment.GetRawContent())
+	}
+
+	return mailMessage, nil
+}
+
+// html returns the HTML content of the message, scrubbed when a scrubber is configured
+func (s *mailgunEmailSender) html(message *newman.EmailMessage) string {
+	htmlContent := message.GetHTML()
+	if s.htmlScrubber != nil {
+		htmlContent = s.htmlScrubber.Scrub(htmlContent)
+	}
+
+	return htmlContent
+}
+
+// contentKey identifies everything but the To recipients and substitutions of a message, which must
+// match for messages to be merged into one batch send
+func (s *mailgunEmailSender) contentKey(message *newman.EmailMessage) string {
+	h := sha256.New()
+
+	write := func(parts ...string) {
+		for _, part := range parts {
+			fmt.Fprintf(h, "%d:%s", len(part), part)
+		}
+	}
+
+	write(message.GetFromAddress().String(), message.GetReplyToAddress().String(), message.GetSubject(), message.GetText(), s.html(message))
+
+	for _, cc := range message.GetCCAddresses() {
+		write(cc.String())
+	}
+
+	write("|")
+
+	for _, bcc := range message.GetBCCAddresses() {
+		write(bcc.String())
+	}
+
+	write("|")
+
+	for _, tag := range message.Tags {
+		write(tag.Name, tag.Value)
+	}
+
+	write("|")
+
+	headers := message.GetHeaders()
+	for _, key := range slices.Sorted(maps.Keys(headers)) {
+		write(key, headers[key])
+	}
+
+	write("|")
+
+	for _, attachment := range message.GetAttachments() {
+		write(attachment.GetFilename(), attachment.GetContentID(), string(attachment.GetRawContent()))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// addRecipients adds the To recipients of the message, attaching its substitutions as
+// recipient-variables when withVariables is set
+func addRecipients(mailMessage *mailgun.Message, message *newman.EmailMessage, withVariables bool) error {
+	for _, to := range message.GetToAddresses() {
+		to = to.ToASCII()
+
+		if !withVariables {
+			if err := mailMessage.AddRecipient(to.String()); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		variables := make(map[string]any, len(message.Substitutions))
+		for key, value := range message.Substitutions {
+			variables[key] = value
+		}
+
+		// recipient-variables are keyed by the bare address, so display names cannot be sent with them
+		if err := mailMessage.AddRecipientAndVariables(to.Address, variables); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// chunkByRecipients splits the indexes of messages into batch sends that stay within the Mailgun
+// recipient limit and never repeat a To recipient, since recipient-variables are keyed by address.
+// The messages share their CC and BCC recipients, which count once towards the limit of each send
+func chunkByRecipients(messages []*newman.EmailMessage, indexes []int) [][]int {
+	var (
+		chunks [][]int
+		chunk  []int
+		count  int
+		seen   map[string]bool
+	)
+
+	for _, i := range indexes {
+		to := messages[i].GetTo()
+		repeated := slices.ContainsFunc(to, func(address string) bool { return seen[strings.ToLower(address)] })
+
+		if len(chunk) > 0 && (repeated || count+len(to) > mailgun.MaxNumberOfRecipients) {
+			chunks = append(chunks, chunk)
+			chunk = nil
+		}
+
+		if len(chunk) == 0 {
+			count = len(messages[i].GetCC()) + len(messages[i].GetBCC())
+			seen = map[string]bool{}
+		}
+
+		chunk = append(chunk, i)
+		count += len(to)
+
+		for _, address := range to {
+			seen[strings.ToLower(address)] = true
+		}
+	}
+
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// tagValue converts a tag into a Mailgun tag, which is a single string
+func tagValue(tag newman.Tag) string {
+	if tag.Value == "" {
+		return tag.Name
+	}
+
+	return tag.Name + ":" + tag.Value
+}
@@ -1,12 +1,293 @@
 package mailgun
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/mailgun/mailgun-go/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
 	"github.com/theopenlane/newman"
+	"github.com/theopenlane/newman/scrubber"
 )
 
 // TestEmailSenderImplementation checks if mailgunEmailSender implements the EmailSender interface
 func TestEmailSenderImplementation(t *testing.T) {
 	var _ newman.EmailSender = (*mailgunEmailSender)(nil)
 }
+
+// newTestMailgunSender creates a mailgunEmailSender pointed at the given test server
+func newTestMailgunSender(url string) *mailgunEmailSender {
+	client := mailgun.NewMailgun("seinfeld.com", "test-api-key")
+	client.SetAPIBase(url + "/v3")
+
+	return &mailgunEmailSender{client: client}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("seinfeld.com", "")
+	require.ErrorIs(t, err, ErrMissingAPIKey)
+
+	sender, err := New("seinfeld.com", "test-api-key")
+	require.NoError(t, err)
+	assert.NotNil(t, sender)
+}
+
+func TestSendEmailWithResult(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v3/seinfeld.com/messages", r.URL.Path)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		_, err := w.Write([]byte(`{"id":"<20240101.1@seinfeld.com>","message":"Queued. Thank you."}`))
+		require.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	sender := newTestMailgunSender(ts.URL)
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "The air is so dewy sweet you dont even have to lick the stamps")
+
+	result, err := sender.SendEmailWithResult(context.Background(), message)
+	require.NoError(t, err)
+
+	assert.Equal(t, "mailgun", result.Provider)
+	assert.Equal(t, "20240101.1@seinfeld.com", result.MessageID)
+	assert.Equal(t, []string{"jerry@seinfeld.com"}, result.Accepted)
+
+	require.NoError(t, sender.SendEmail(message))
+}
+
+func TestSendEmailError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	sender := newTestMailgunSender(ts.URL)
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "The air is so dewy sweet you dont even have to lick the stamps")
+
+	err := sender.SendEmail(message)
+	require.Error(t, err)
+}
+
+// capturedRequest is the form data of a request received by the capture server
+type capturedRequest struct {
+	values      map[string][]string
+	attachments map[string]string
+	inline      map[string]string
+}
+
+// newCaptureServer creates a test server recording the form data of every message sent to it
+func newCaptureServer(t *testing.T, requests *[]capturedRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+
+		captured := capturedRequest{values: r.MultipartForm.Value, attachments: map[string]string{}, inline: map[string]string{}}
+
+		for field, files := range map[string]map[string]string{"attachment": captured.attachments, "inline": captured.inline} {
+			for _, header := range r.MultipartForm.File[field] {
+				f, err := header.Open()
+				require.NoError(t, err)
+
+				content, err := io.ReadAll(f)
+				require.NoError(t, err)
+
+				files[header.Filename] = string(content)
+			}
+		}
+
+		*requests = append(*requests, captured)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		_, err := fmt.Fprintf(w, `{"id":"<%d@seinfeld.com>","message":"Queued. Thank you."}`, len(*requests))
+		require.NoError(t, err)
+	}))
+}
+
+func TestSendEmailAllFields(t *testing.T) {
+	var requests []capturedRequest
+
+	ts := newCaptureServer(t, &requests)
+	defer ts.Close()
+
+	sender := newTestMailgunSender(ts.URL)
+	WithHTMLScrubber(scrubber.NewPolicyScrubber())(sender)
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry").
+		SetHTML("<p>Hello, Jerry</p><script>alert(1)</script>").
+		SetCC([]string{"elaine@seinfeld.com"}).
+		SetBCC([]string{"kramer@seinfeld.com"}).
+		SetReplyTo("george@seinfeld.com").
+		AddAttachment(newman.NewAttachment("mail.txt", []byte("When you control the mail, you control information")))
+	message.Tags = []newman.Tag{{Name: "category", Value: "welcome"}, {Name: "themed"}}
+	message.Headers = map[string]string{"X-Route": "upstairs"}
+
+	require.NoError(t, sender.SendEmail(message))
+	require.Len(t, requests, 1)
+
+	values := requests[0].values
+	assert.Equal(t, []string{"jerry@seinfeld.com"}, values["to"])
+	assert.Equal(t, []string{"elaine@seinfeld.com"}, values["cc"])
+	assert.Equal(t, []string{"kramer@seinfeld.com"}, values["bcc"])
+	assert.Equal(t, []string{"george@seinfeld.com"}, values["h:Reply-To"])
+	assert.Equal(t, []string{"<p>Hello, Jerry</p>"}, values["html"])
+	assert.Equal(t, []string{"category:welcome", "themed"}, values["o:tag"])
+	assert.Equal(t, []string{"upstairs"}, values["h:X-Route"])
+	assert.Empty(t, values["recipient-variables"])
+	assert.Equal(t, "When you control the mail, you control information", requests[0].attachments["mail.txt"])
+}
+
+func TestSendEmailInlineAttachment(t *testing.T) {
+	var requests []capturedRequest
+
+	ts := newCaptureServer(t, &requests)
+	defer ts.Close()
+
+	sender := newTestMailgunSender(ts.URL)
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry").
+		SetHTML(`<img src="cid:logo@usps.com">`).
+		AddAttachment(newman.NewInlineAttachment("logo.png", "logo@usps.com", []byte("png"))).
+		AddAttachment(newman.NewAttachment("mail.txt", []byte("route")))
+
+	require.NoError(t, sender.SendEmail(message))
+	require.Len(t, requests, 1)
+
+	assert.Equal(t, map[string]string{"logo@usps.com": "png"}, requests[0].inline)
+	assert.Equal(t, map[string]string{"mail.txt": "route"}, requests[0].attachments)
+}
+
+func TestSendEmailDisplayNames(t *testing.T) {
+	var requests []capturedRequest
+
+	ts := newCaptureServer(t, &requests)
+	defer ts.Close()
+
+	sender := newTestMailgunSender(ts.URL)
+
+	message := newman.NewEmailMessage("Newman <newman@usps.com>", []string{"Jerry Seinfeld <jerry@seinfeld.com>"}, "Test Email", "Hello, Jerry").
+		SetCC([]string{"Elaine Benes <elaine@seinfeld.com>"})
+
+	require.NoError(t, sender.SendEmail(message))
+
+	// recipient-variables are keyed by the bare address
+	message.Substitutions = map[string]string{"name": "Jerry"}
+	require.NoError(t, sender.SendEmail(message))
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, []string{`"Newman" <newman@usps.com>`}, requests[0].values["from"])
+	assert.Equal(t, []string{`"Jerry Seinfeld" <jerry@seinfeld.com>`}, requests[0].values["to"])
+	assert.Equal(t, []string{`"Elaine Benes" <elaine@seinfeld.com>`}, requests[0].values["cc"])
+	assert.Equal(t, []string{"jerry@seinfeld.com"}, requests[1].values["to"])
+	assert.JSONEq(t, `{"jerry@seinfeld.com":{"name":"Jerry"}}`, requests[1].values["recipient-variables"][0])
+}
+
+func TestSendEmailTooManyTags(t *testing.T) {
+	sender := newTestMailgunSender("http://localhost")
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry")
+	message.Tags = []newman.Tag{{Name: "one"}, {Name: "two"}, {Name: "three"}, {Name: "four"}}
+
+	require.ErrorIs(t, sender.SendEmail(message), ErrTooManyTags)
+}
+
+func TestSendEmailRetryableError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	sender := newTestMailgunSender(ts.URL)
+
+	err := sender.SendEmail(newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry"))
+	require.ErrorIs(t, err, ErrFailedToSendEmail)
+	assert.True(t, newman.IsRetryableError(err))
+}
+
+func TestSendBatchEmailWithResult(t *testing.T) {
+	var requests []capturedRequest
+
+	ts := newCaptureServer(t, &requests)
+	defer ts.Close()
+
+	sender := newTestMailgunSender(ts.URL)
+
+	newMessage := func(to string, opts ...newman.MessageOption) *newman.EmailMessage {
+		return newman.NewEmailMessageWithOptions(append([]newman.MessageOption{
+			newman.WithFrom("newman@usps.com"),
+			newman.WithTo([]string{to}),
+			newman.WithSubject("Hello"),
+			newman.WithText("Hello, %recipient.name%"),
+		}, opts...)...)
+	}
+
+	messages := []*newman.EmailMessage{
+		newMessage("jerry@seinfeld.com", newman.WithSubstitution("name", "Jerry")),
+		newMessage("not-an-email"),
+		newMessage("george@seinfeld.com", newman.WithSubstitution("name", "George")),
+		newMessage("jerry@seinfeld.com", newman.WithSubstitution("name", "Jerome")),
+		newMessage("elaine@seinfeld.com", newman.WithText("Something else")),
+	}
+
+	result, err := sender.SendBatchEmailWithResult(context.Background(), messages)
+	require.NoError(t, err)
+
+	// jerry is repeated so his second message goes in a separate request
+	require.Len(t, requests, 3)
+	assert.Equal(t, []string{"jerry@seinfeld.com", "george@seinfeld.com"}, requests[0].values["to"])
+
+	var variables map[string]map[string]string
+	require.NoError(t, json.Unmarshal([]byte(requests[0].values["recipient-variables"][0]), &variables))
+	assert.Equal(t, map[string]map[string]string{
+		"jerry@seinfeld.com":  {"name": "Jerry"},
+		"george@seinfeld.com": {"name": "George"},
+	}, variables)
+
+	assert.Equal(t, []string{"jerry@seinfeld.com"}, requests[1].values["to"])
+	assert.Equal(t, []string{"elaine@seinfeld.com"}, requests[2].values["to"])
+	// recipient-variables are always sent so recipients merged into one request do not see each other
+	assert.NotEmpty(t, requests[2].values["recipient-variables"])
+
+	assert.Equal(t, "1@seinfeld.com", result.Items[0].MessageID)
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[1].Status)
+	assert.Equal(t, "1@seinfeld.com", result.Items[2].MessageID)
+	assert.Equal(t, "2@seinfeld.com", result.Items[3].MessageID)
+	assert.Equal(t, "3@seinfeld.com", result.Items[4].MessageID)
+
+	_, err = sender.SendBatchEmailWithResult(context.Background(), nil)
+	require.ErrorIs(t, err, ErrEmptyBatch)
+}
+
+func TestSendBatchEmailMultipleRecipients(t *testing.T) {
+	var requests []capturedRequest
+
+	ts := newCaptureServer(t, &requests)
+	defer ts.Close()
+
+	sender := newTestMailgunSender(ts.URL)
+
+	messages := []*newman.EmailMessage{
+		newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com", "elaine@seinfeld.com"}, "Hello", "Hello, everyone"),
+		newman.NewEmailMessage("newman@usps.com", []string{"george@seinfeld.com"}, "Hello", "Hello, everyone"),
+	}
+
+	result, err := sender.SendBatchEmailWithResult(context.Background(), messages)
+	require.NoError(t, err)
+	require.NoError(t, result.Err())
+
+	// the message to several recipients is sent as one shared copy, like SendEmail sends it
+	require.Len(t, requests, 2)
+	assert.Equal(t, []string{"george@seinfeld.com"}, requests[0].values["to"])
+	assert.Equal(t, []string{"jerry@seinfeld.com", "elaine@seinfeld.com"}, requests[1].values["to"])
+	assert.Empty(t, requests[1].values["recipient-variables"])
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"hash/fnv"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -17,6 +18,7 @@ import (
 
 const (
 	readWriteMode = 0755
+	providerName  = "mock"
 )
 
 // EmailSender is a mock email sender that captures sent messages for test assertion.
@@ -26,7 +28,12 @@ type EmailSender struct {
 	logger   *slog.Logger
 	mu       sync.Mutex
 	messages []*newman.EmailMessage
+	failures []error
 	storage  string
+	// dkimSigner signs the messages written to storage
+	dkimSigner *newman.DKIMSigner
+	// protection signs or encrypts the messages written to storage with S/MIME or PGP/MIME
+	protection newman.MimeOption
 }
 
 // New creates a mock email sender. If storage is non-empty, sent emails are
@@ -38,13 +45,65 @@ func New(storage string) (*EmailSender, error) {
 	}, nil
 }
 
-// Reset clears captured messages. Tests that send emails should call Reset
+// Reset clears captured messages and any queued failures. Tests that send emails should call Reset
 // as part of cleanup so other tests start with a clean slate
 func (s *EmailSender) Reset() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.messages = nil
+	s.failures = nil
+}
+
+// SetDKIMSigner signs the messages written to storage with a DKIM signature, so the stored files can be
+// checked with newman.VerifyDKIM
+func (s *EmailSender) SetDKIMSigner(signer *newman.DKIMSigner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dkimSigner = signer
+}
+
+// SetSMIME signs and encrypts the messages written to storage with S/MIME, so the stored files can be
+// checked with newman.VerifySMIME and newman.DecryptSMIME. It replaces PGP/MIME set with SetPGPMIME
+func (s *EmailSender) SetSMIME(smime *newman.SMIME) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.protection = newman.WithSMIME(smime)
+}
+
+// SetPGPMIME signs and encrypts the messages written to storage with PGP/MIME, so the stored files can be
+// checked with newman.VerifyPGPMIME and newman.DecryptPGPMIME. It replaces S/MIME set with SetSMIME
+func (s *EmailSender) SetPGPMIME(pgp *newman.PGPMIME) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.protection = newman.WithPGPMIME(pgp)
+}
+
+// FailWith queues errors that the next sends return, one per send, before any message is
+// captured. A nil entry lets that send through, so failures can be interleaved with successes
+func (s *EmailSender) FailWith(errs ...error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, errs...)
+}
+
+// nextFailure pops the next injected error, if any
+func (s *EmailSender) nextFailure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.failures) == 0 {
+		return nil
+	}
+
+	err := s.failures[0]
+	s.failures = s.failures[1:]
+
+	return err
 }
 
 // Messages returns a snapshot of all captured messages
@@ -70,19 +129,57 @@ func (s *EmailSender) SendBatchEmail(messages []*newman.EmailMessage) error {
 
 // SendBatchEmailWithContext validates and captures each message in the batch
 func (s *EmailSender) SendBatchEmailWithContext(ctx context.Context, messages []*newman.EmailMessage) error {
-	for _, message := range messages {
-		if err := s.SendEmailWithContext(ctx, message); err != nil {
-			return err
+	result, err := s.SendBatchEmailWithResult(ctx, messages)
+	if err != nil {
+		return err
+	}
+
+	return result.Err()
+}
+
+// SendBatchEmailWithResult validates and captures each message in the batch. A message that fails
+// does not stop the rest of the batch; its error is reported on the result
+func (s *EmailSender) SendBatchEmailWithResult(ctx context.Context, messages []*newman.EmailMessage) (*newman.BatchResult, error) {
+	result := newman.NewBatchResult(providerName, len(messages))
+
+	for i, message := range messages {
+		sent, err := s.SendEmailWithResult(ctx, message)
+		if err != nil {
+			result.SetFailed(i, err)
+			continue
 		}
+
+		result.SetSent(i, sent.MessageID)
 	}
 
-	return nil
+	return result, nil
+}
+
+// ProviderName satisfies the newman.ProviderNamer interface
+func (s *EmailSender) ProviderName() string {
+	return providerName
 }
 
 // SendEmailWithContext validates and captures the message for later assertion
-func (s *EmailSender) SendEmailWithContext(_ context.Context, message *newman.EmailMessage) error {
+func (s *EmailSender) SendEmailWithContext(ctx context.Context, message *newman.EmailMessage) error {
+	_, err := s.SendEmailWithResult(ctx, message)
+
+	return err
+}
+
+// SendEmailWithResult validates and captures the message, returning a result with a generated message ID
+func (s *EmailSender) SendEmailWithResult(_ context.Context, message *newman.EmailMessage) (*newman.SendResult, error) {
 	if err := shared.ValidateEmailMessage(message); err != nil {
-		return err
+		return nil, err
+	}
+
+	message, err := message.ApplyAttachmentPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.nextFailure(); err != nil {
+		return nil, err
 	}
 
 	s.logger.Info("Sending test email",
@@ -94,18 +191,20 @@ func (s *EmailSender) SendEmailWithContext(_ context.Context, message *newman.Em
 
 	s.mu.Lock()
 	s.messages = append(s.messages, message)
+	messageID := fmt.Sprintf("mock-%d", len(s.messages))
 	s.mu.Unlock()
 
 	if s.storage != "" {
 		if err := s.saveEmailToFile(message); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return newman.NewSendResult(providerName, messageID, message), nil
 }
 
-// saveEmailToFile for manual inspection
+// saveEmailToFile for manual inspection. The message is streamed to a temporary file, then renamed
+// once it has been written in full
 func (s *EmailSender) saveEmailToFile(message *newman.EmailMessage) error {
 	// we have already validated the message contains at least one recipient
 	firstTo := message.GetTo()[0]
@@ -115,28 +214,46 @@ func (s *EmailSender) saveEmailToFile(message *newman.EmailMessage) error {
 		return err
 	}
 
-	mimeMsg, err := shared.BuildMimeMessage(message)
+	f, err := os.CreateTemp(dir, ".*.mim")
 	if err != nil {
 		return err
 	}
 
-	path, err := generateUniqueFilename(dir, mimeMsg)
+	h := fnv.New32()
+
+	s.mu.Lock()
+	signer, protection := s.dkimSigner, s.protection
+	s.mu.Unlock()
+
+	var opts []newman.MimeOption
+	if protection != nil {
+		opts = append(opts, protection)
+	}
+
+	if signer != nil {
+		opts = append(opts, newman.WithDKIMSigner(signer))
+	}
+
+	err = shared.WriteMimeMessage(io.MultiWriter(f, h), message, opts...)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(f.Name(), readWriteMode)
+	}
+
 	if err != nil {
+		_ = os.Remove(f.Name())
 		return err
 	}
 
-	return os.WriteFile(path, mimeMsg, readWriteMode)
+	return os.Rename(f.Name(), generateUniqueFilename(dir, h.Sum32()))
 }
 
-func generateUniqueFilename(dir string, message []byte) (string, error) {
-	// Generate unique filename to avoid overwriting
+// generateUniqueFilename names a stored message by time and content hash to avoid overwriting
+func generateUniqueFilename(dir string, sum uint32) string {
 	ts := time.Now().Format(time.RFC3339)
-	h := fnv.New32()
-
-	_, err := h.Write(message)
-	if err != nil {
-		return "", err
-	}
 
-	return filepath.Join(dir, fmt.Sprintf("%s-%d.mim", ts, h.Sum32())), nil
+	return filepath.Join(dir, fmt.Sprintf("%s-%d.mim", ts, sum))
 }
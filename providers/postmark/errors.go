@@ -9,4 +9,8 @@ var (
 	ErrFailedToCreateHTTPRequest = errors.New("failed to create http request")
 	// ErrFailedToMarshallEmailData is returned when email data fails to be marshalled
 	ErrFailedToMarshallEmailData = errors.New("failed to marshall email data")
+	// ErrFailedToSendBatchEmail is returned when a batch email fails to send
+	ErrFailedToSendBatchEmail = errors.New("failed to send batch email")
+	// ErrEmptyBatch is returned when an empty batch is provided
+	ErrEmptyBatch = errors.New("batch must contain at least one message")
 )
@@ -2,6 +2,11 @@ package postmark
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -10,21 +15,37 @@ import (
 
 	"github.com/theopenlane/newman"
 	"github.com/theopenlane/newman/scrubber"
+	"github.com/theopenlane/newman/shared"
 )
 
 const (
 	requestURL    = "https://api.postmarkapp.com"
 	endpoint      = "/email"
+	batchEndpoint = "/email/batch"
 	clientTimeout = time.Millisecond * 100
-	tokenHeader   = "X-Postmark-Server-Token"
+	// batchClientTimeout bounds a batch request, which carries up to 500 messages
+	batchClientTimeout = time.Second * 30
+	tokenHeader        = "X-Postmark-Server-Token"
+	providerName       = "postmark"
+	// retryAfterHeader holds the delay Postmark asks for before a rate limited request is retried
+	retryAfterHeader = "Retry-After"
+	// maxBatchSize is the most messages Postmark accepts in a single batch request
+	maxBatchSize = 500
+	// maxBatchPayloadSize is the largest batch request body Postmark accepts
+	maxBatchPayloadSize = 50 * 1024 * 1024 // 50 MB
+	// maxMessageSize is the largest message Postmark accepts, including base64 encoded attachments
+	maxMessageSize = 10 * 1024 * 1024 // 10 MB
+	// maxRecipients is the most To, Cc and Bcc recipients Postmark accepts for a message
+	maxRecipients = 50
 )
 
 // postmarkEmailSender defines a struct for sending emails using the Postmark API
 type postmarkEmailSender struct {
-	serverToken  string
-	endpoint     string
-	url          string
-	htmlScrubber scrubber.Scrubber
+	serverToken   string
+	endpoint      string
+	batchEndpoint string
+	url           string
+	htmlScrubber  scrubber.Scrubber
 }
 
 // Option configures a postmarkEmailSender
@@ -48,22 +69,41 @@ type email struct {
 	HTMLBody    string       `json:"HTMLBody,omitempty"`
 	ReplyTo     string       `json:"ReplyTo,omitempty"`
 	Bcc         string       `json:"Bcc,omitempty"`
+	Headers     []header     `json:"Headers,omitempty"`
 	Attachments []attachment `json:"Attachments,omitempty"`
 }
 
+// header represents a custom header of a Postmark email
+type header struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
 // attachment represents an attachment for a Postmark email
 type attachment struct {
 	Name        string `json:"Name"`
 	Content     string `json:"Content"`
 	ContentType string `json:"ContentType"`
+	ContentID   string `json:"ContentID,omitempty"`
+}
+
+// sendResponse represents the response Postmark returns for an email; the batch
+// endpoint returns one per message, with a non-zero ErrorCode for rejected messages
+type sendResponse struct {
+	To          string `json:"To"`
+	SubmittedAt string `json:"SubmittedAt"`
+	MessageID   string `json:"MessageID"`
+	ErrorCode   int    `json:"ErrorCode"`
+	Message     string `json:"Message"`
 }
 
 // New creates a new instance of postmarkEmailSender
 func New(serverToken string, opts ...Option) (newman.EmailSender, error) {
 	pm := &postmarkEmailSender{
-		serverToken: serverToken,
-		endpoint:    endpoint,
-		url:         requestURL,
+		serverToken:   serverToken,
+		endpoint:      endpoint,
+		batchEndpoint: batchEndpoint,
+		url:           requestURL,
 	}
 
 	for _, opt := range opts {
@@ -79,64 +119,277 @@ func (s *postmarkEmailSender) SendEmail(message *newman.EmailMessage) error {
 }
 
 // SendBatchEmail satisfies the EmailSender interface
-func (s *postmarkEmailSender) SendBatchEmail(_ []*newman.EmailMessage) error {
-	return newman.ErrBatchNotImplemented
+func (s *postmarkEmailSender) SendBatchEmail(messages []*newman.EmailMessage) error {
+	return s.SendBatchEmailWithContext(context.Background(), messages)
 }
 
 // SendBatchEmailWithContext satisfies the EmailSender interface
-func (s *postmarkEmailSender) SendBatchEmailWithContext(_ context.Context, _ []*newman.EmailMessage) error {
-	return newman.ErrBatchNotImplemented
+func (s *postmarkEmailSender) SendBatchEmailWithContext(ctx context.Context, messages []*newman.EmailMessage) error {
+	result, err := s.SendBatchEmailWithResult(ctx, messages)
+	if err != nil {
+		return err
+	}
+
+	return result.Err()
+}
+
+// SendBatchEmailWithResult satisfies the newman.BatchResultSender interface. Messages are sent to
+// the batch endpoint in chunks of up to 500 messages and 50 MB, and a chunk that fails as a whole
+// marks each of its messages as failed without stopping the remaining chunks
+func (s *postmarkEmailSender) SendBatchEmailWithResult(ctx context.Context, messages []*newman.EmailMessage) (*newman.BatchResult, error) {
+	if len(messages) == 0 {
+		return nil, ErrEmptyBatch
+	}
+
+	requester, err := s.newRequester(batchClientTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newman.NewBatchResult(providerName, len(messages))
+
+	pending := make([]int, 0, len(messages))
+	encoded := make([]json.RawMessage, len(messages))
+
+	for i, message := range messages {
+		if err := shared.ValidateEmailMessage(message, shared.WithMaxRecipients(maxRecipients)); err != nil {
+			result.SetFailed(i, err)
+			continue
+		}
+
+		message, err := message.PrepareAttachments(maxMessageSize)
+		if err != nil {
+			result.SetFailed(i, err)
+			continue
+		}
+
+		if encoded[i], err = json.Marshal(s.toEmail(message)); err != nil {
+			result.SetFailed(i, fmt.Errorf("%w: %w", ErrFailedToMarshallEmailData, err))
+			continue
+		}
+
+		pending = append(pending, i)
+	}
+
+	for _, chunk := range chunkMessages(pending, encoded) {
+		emails := make([]json.RawMessage, 0, len(chunk))
+		for _, i := range chunk {
+			emails = append(emails, encoded[i])
+		}
+
+		responses, err := s.sendBatch(ctx, requester, emails)
+		if err != nil {
+			for _, i := range chunk {
+				result.SetFailed(i, err)
+			}
+
+			continue
+		}
+
+		for pos, i := range chunk {
+			switch {
+			case pos >= len(responses):
+				result.SetFailed(i, ErrFailedToSendBatchEmail)
+			case responses[pos].ErrorCode != 0:
+				result.SetFailed(i, fmt.Errorf("%w: %d %s", ErrFailedToSendBatchEmail, responses[pos].ErrorCode, responses[pos].Message))
+			default:
+				result.SetSent(i, responses[pos].MessageID)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// chunkMessages splits the indexes into chunks of at most maxBatchSize messages whose encoded emails, written
+// as a JSON array, fit in maxBatchPayloadSize
+func chunkMessages(indexes []int, encoded []json.RawMessage) [][]int {
+	var (
+		chunks [][]int
+		chunk  []int
+		size   int
+	)
+
+	for _, i := range indexes {
+		// each email adds its length and a separator to the brackets of the array
+		n := len(encoded[i]) + 1
+
+		if len(chunk) > 0 && (len(chunk) == maxBatchSize || size+n+1 > maxBatchPayloadSize) {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, 0
+		}
+
+		chunk = append(chunk, i)
+		size += n
+	}
+
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// sendBatch posts a single chunk of encoded emails to the batch endpoint
+func (s *postmarkEmailSender) sendBatch(ctx context.Context, requester *httpsling.Requester, emails []json.RawMessage) ([]sendResponse, error) {
+	resp, err := requester.ReceiveWithContext(ctx,
+		httpsling.Post(s.batchEndpoint),
+		httpsling.Body(emails),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToSendBatchEmail, err)
+	}
+
+	defer resp.Body.Close()
+
+	if !httpsling.IsSuccess(resp) {
+		return nil, responseError(resp, ErrFailedToSendBatchEmail)
+	}
+
+	var responses []sendResponse
+	if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToSendBatchEmail, err)
+	}
+
+	return responses, nil
+}
+
+// ProviderName satisfies the newman.ProviderNamer interface
+func (s *postmarkEmailSender) ProviderName() string {
+	return providerName
 }
 
 // SendEmailWithContext satisfies the EmailSender interface
-func (s *postmarkEmailSender) SendEmailWithContext(_ context.Context, message *newman.EmailMessage) error {
+func (s *postmarkEmailSender) SendEmailWithContext(ctx context.Context, message *newman.EmailMessage) error {
+	_, err := s.SendEmailWithResult(ctx, message)
+
+	return err
+}
+
+// SendEmailWithResult satisfies the newman.ResultSender interface
+func (s *postmarkEmailSender) SendEmailWithResult(ctx context.Context, message *newman.EmailMessage) (*newman.SendResult, error) {
+	if err := shared.ValidateEmailMessage(message, shared.WithMaxRecipients(maxRecipients)); err != nil {
+		return nil, err
+	}
+
+	message, err := message.PrepareAttachments(maxMessageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	requester, err := s.newRequester(clientTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := requester.ReceiveWithContext(ctx,
+		httpsling.Post(s.endpoint),
+		httpsling.Body(s.toEmail(message)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToSendEmail, err)
+	}
+
+	defer resp.Body.Close()
+
+	if !httpsling.IsSuccess(resp) {
+		return nil, responseError(resp, ErrFailedToSendEmail)
+	}
+
+	// the message was accepted, so a response body that cannot be decoded only loses the message ID
+	var sent sendResponse
+	_ = json.NewDecoder(resp.Body).Decode(&sent)
+
+	result := newman.NewSendResult(providerName, sent.MessageID, message)
+
+	if submittedAt, err := time.Parse(time.RFC3339Nano, sent.SubmittedAt); err == nil {
+		result.SentAt = submittedAt.UTC()
+	}
+
+	return result, nil
+}
+
+// responseError returns the error for an unsuccessful response, wrapping the sentinel with the status and the
+// error Postmark reported. Rate limiting and server errors are returned as retryable errors
+func responseError(resp *http.Response, sentinel error) error {
+	err := fmt.Errorf("%w: status %d", sentinel, resp.StatusCode)
+
+	var reported sendResponse
+	if json.NewDecoder(resp.Body).Decode(&reported) == nil && reported.Message != "" {
+		err = fmt.Errorf("%w: %d %s", err, reported.ErrorCode, reported.Message)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		if retryAfter, ok := newman.ParseRetryAfter(resp.Header.Get(retryAfterHeader)); ok {
+			return newman.NewRetryableErrorWithDelay(err, retryAfter)
+		}
+
+		return newman.NewRetryableError(err)
+	}
+
+	return err
+}
+
+// newRequester creates the http requester used to call the Postmark API, with the timeout of each request
+func (s *postmarkEmailSender) newRequester(timeout time.Duration) (*httpsling.Requester, error) {
+	return httpsling.New(
+		httpsling.Client(httpclient.Timeout(timeout)),
+		httpsling.URL(s.url),
+		httpsling.Header(tokenHeader, s.serverToken),
+	)
+}
+
+// toEmail converts a newman EmailMessage to the Postmark email representation
+func (s *postmarkEmailSender) toEmail(message *newman.EmailMessage) email {
 	htmlContent := message.GetHTML()
 	if s.htmlScrubber != nil {
 		htmlContent = s.htmlScrubber.Scrub(htmlContent)
 	}
 
 	emailStruct := email{
-		From:     message.GetFrom(),
-		To:       strings.Join(message.GetTo(), ","),
-		CC:       strings.Join(message.GetCC(), ","),
+		From:     message.GetFromAddress().ToASCII().String(),
+		To:       joinAddresses(message.GetToAddresses()),
+		CC:       joinAddresses(message.GetCCAddresses()),
 		Subject:  message.GetSubject(),
 		TextBody: message.GetText(),
 		HTMLBody: htmlContent,
-		ReplyTo:  message.GetReplyTo(),
-		Bcc:      strings.Join(message.GetBCC(), ","),
+		ReplyTo:  message.GetReplyToAddress().ToASCII().String(),
+		Bcc:      joinAddresses(message.GetBCCAddresses()),
+	}
+
+	// Custom headers, sorted so the request is stable
+	headers := message.GetHeaders()
+	for _, name := range slices.Sorted(maps.Keys(headers)) {
+		emailStruct.Headers = append(emailStruct.Headers, header{Name: name, Value: headers[name]})
 	}
 
 	// Add attachments
 	for _, a := range message.GetAttachments() {
-		emailStruct.Attachments = append(emailStruct.Attachments, attachment{
+		att := attachment{
 			Name:        a.GetFilename(),
 			Content:     a.GetBase64StringContent(),
-			ContentType: newman.GetMimeType(a.GetFilename()),
-		})
-	}
+			ContentType: a.GetContentType(),
+		}
 
-	requester, err := httpsling.New(
-		httpsling.Client(httpclient.Timeout(clientTimeout)),
-		httpsling.URL(s.url),
-		httpsling.Header(tokenHeader, s.serverToken),
-	)
-	if err != nil {
-		return err
-	}
+		// Postmark embeds attachments with a cid: content ID inline
+		if a.IsInline() {
+			att.ContentID = "cid:" + a.GetContentID()
+		}
 
-	resp, err := requester.Receive(
-		httpsling.Post(s.endpoint),
-		httpsling.Body(emailStruct),
-	)
-	if err != nil {
-		return ErrFailedToSendEmail
+		emailStruct.Attachments = append(emailStruct.Attachments, att)
 	}
 
-	defer resp.Body.Close()
+	return emailStruct
+}
 
-	if !httpsling.IsSuccess(resp) {
-		return ErrFailedToSendEmail
+// joinAddresses formats a recipient list as Postmark expects, "Name" <address> separated by commas with
+// internationalized domain names as punycode
+func joinAddresses(addresses []newman.Address) string {
+	formatted := make([]string, 0, len(addresses))
+
+	for _, address := range addresses {
+		formatted = append(formatted, address.ToASCII().String())
 	}
 
-	return nil
+	return strings.Join(formatted, ",")
 }
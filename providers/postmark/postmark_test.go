@@ -1,8 +1,12 @@
 package postmark
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/theopenlane/newman"
+	"github.com/theopenlane/newman/providers/mock"
 )
 
 // TestEmailSenderImplementation checks if postmarkEmailSender implements the EmailSender interface
@@ -166,6 +171,307 @@ func TestSendEmailWithEmptyFields(t *testing.T) {
 
 	postmarkSender.url = ts.URL
 
+	// the message is validated before any request is made
 	err = emailSender.SendEmail(message)
-	assert.NoError(t, err)
+
+	var missing *newman.MissingRequiredFieldError
+	require.ErrorAs(t, err, &missing)
+	assert.Equal(t, "to", missing.RequiredField)
+}
+
+func TestSendEmailWithResult(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		_, err := w.Write([]byte(`{"To":"jerry@seinfeld.com","SubmittedAt":"2010-11-26T12:01:05.1794748-05:00","MessageID":"b7bc2f4a-e38e-4336-af7d-e6c392c2f817","ErrorCode":0,"Message":"OK"}`))
+		if err != nil {
+			t.Errorf("failed to write response: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	sender := &postmarkEmailSender{serverToken: "test-server-token", endpoint: endpoint, url: ts.URL}
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "The air is so dewy sweet you dont even have to lick the stamps")
+
+	result, err := sender.SendEmailWithResult(context.Background(), message)
+	require.NoError(t, err)
+
+	assert.Equal(t, "postmark", result.Provider)
+	assert.Equal(t, "b7bc2f4a-e38e-4336-af7d-e6c392c2f817", result.MessageID)
+	assert.Equal(t, []string{"jerry@seinfeld.com"}, result.Accepted)
+	assert.Equal(t, time.Date(2010, 11, 26, 17, 1, 5, 179474800, time.UTC), result.SentAt)
+}
+
+func TestSendEmailMessageTooLarge(t *testing.T) {
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	sender := &postmarkEmailSender{serverToken: "test-server-token", endpoint: endpoint, batchEndpoint: batchEndpoint, url: ts.URL}
+
+	// 9 MB grows past the 10 MB limit once base64 encoded
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Route report", "Hello, Jerry").
+		AddAttachment(newman.NewAttachment("report.pdf", make([]byte, 9*1024*1024)))
+
+	_, err := sender.SendEmailWithResult(context.Background(), message)
+	require.ErrorIs(t, err, newman.ErrMessageTooLarge)
+
+	result, err := sender.SendBatchEmailWithResult(context.Background(), []*newman.EmailMessage{message})
+	require.NoError(t, err)
+	assert.ErrorIs(t, result.Items[0].Err, newman.ErrMessageTooLarge)
+
+	assert.Zero(t, requests)
+}
+
+func TestSendEmailTooManyRecipients(t *testing.T) {
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	sender := &postmarkEmailSender{serverToken: "test-server-token", endpoint: endpoint, batchEndpoint: batchEndpoint, url: ts.URL}
+
+	to := make([]string, 0, maxRecipients+1)
+	for i := range maxRecipients + 1 {
+		to = append(to, fmt.Sprintf("jerry+%d@seinfeld.com", i))
+	}
+
+	message := newman.NewEmailMessage("newman@usps.com", to, "Route report", "Hello, Jerry")
+
+	_, err := sender.SendEmailWithResult(context.Background(), message)
+	require.ErrorIs(t, err, newman.ErrTooManyRecipients)
+
+	result, err := sender.SendBatchEmailWithResult(context.Background(), []*newman.EmailMessage{message})
+	require.NoError(t, err)
+	assert.ErrorIs(t, result.Items[0].Err, newman.ErrTooManyRecipients)
+
+	assert.Zero(t, requests)
+}
+
+func newBatchTestMessages(count int) []*newman.EmailMessage {
+	messages := make([]*newman.EmailMessage, 0, count)
+	for i := range count {
+		messages = append(messages, newman.NewEmailMessage("newman@usps.com", []string{fmt.Sprintf("jerry+%d@seinfeld.com", i)}, "Batch", "Hello, Jerry"))
+	}
+
+	return messages
+}
+
+func TestSendBatchEmailWithResult(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, batchEndpoint, r.URL.Path)
+		assert.Equal(t, "test-server-token", r.Header.Get(tokenHeader))
+
+		var emails []email
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&emails))
+		require.Len(t, emails, 3)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		_, err := w.Write([]byte(`[
+			{"ErrorCode":0,"Message":"OK","MessageID":"id-0","SubmittedAt":"2010-11-26T12:01:05.1794748-05:00","To":"jerry+0@seinfeld.com"},
+			{"ErrorCode":406,"Message":"You tried to send to a recipient that has been marked as inactive."},
+			{"ErrorCode":0,"Message":"OK","MessageID":"id-2","SubmittedAt":"2010-11-26T12:01:05.1794748-05:00","To":"jerry+2@seinfeld.com"}
+		]`))
+		require.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	emailSender, err := New("test-server-token")
+	require.NoError(t, err)
+
+	postmarkSender, ok := emailSender.(*postmarkEmailSender)
+	require.True(t, ok)
+
+	postmarkSender.url = ts.URL
+
+	result, err := postmarkSender.SendBatchEmailWithResult(context.Background(), newBatchTestMessages(3))
+	require.NoError(t, err)
+
+	assert.Equal(t, "postmark", result.Provider)
+	assert.Equal(t, newman.BatchStatusSent, result.Items[0].Status)
+	assert.Equal(t, "id-0", result.Items[0].MessageID)
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[1].Status)
+	assert.ErrorIs(t, result.Items[1].Err, ErrFailedToSendBatchEmail)
+	assert.ErrorContains(t, result.Items[1].Err, "406 You tried to send to a recipient that has been marked as inactive.")
+	assert.Equal(t, newman.BatchStatusSent, result.Items[2].Status)
+	assert.Equal(t, "id-2", result.Items[2].MessageID)
+
+	err = emailSender.SendBatchEmail(newBatchTestMessages(3))
+	require.ErrorIs(t, err, newman.ErrBatchIncomplete)
+}
+
+func TestSendBatchEmailChunks(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		sizes []int
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var emails []email
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&emails))
+
+		mu.Lock()
+		sizes = append(sizes, len(emails))
+		mu.Unlock()
+
+		responses := make([]sendResponse, 0, len(emails))
+		for _, e := range emails {
+			responses = append(responses, sendResponse{To: e.To, MessageID: "id-" + e.To})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(responses))
+	}))
+	defer ts.Close()
+
+	postmarkSender := &postmarkEmailSender{serverToken: "test-server-token", batchEndpoint: batchEndpoint, url: ts.URL}
+
+	messages := newBatchTestMessages(maxBatchSize + 1)
+
+	result, err := postmarkSender.SendBatchEmailWithResult(context.Background(), messages)
+	require.NoError(t, err)
+	require.NoError(t, result.Err())
+
+	assert.Equal(t, []int{maxBatchSize, 1}, sizes)
+	assert.Equal(t, "id-jerry+500@seinfeld.com", result.Items[maxBatchSize].MessageID)
+}
+
+func TestSendBatchEmailChunkFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	postmarkSender := &postmarkEmailSender{serverToken: "test-server-token", batchEndpoint: batchEndpoint, url: ts.URL}
+
+	result, err := postmarkSender.SendBatchEmailWithResult(context.Background(), newBatchTestMessages(2))
+	require.NoError(t, err)
+
+	assert.Empty(t, result.Sent())
+	assert.Len(t, result.Failed(), 2)
+	assert.ErrorIs(t, result.Err(), ErrFailedToSendBatchEmail)
+}
+
+func TestSendBatchEmailEmpty(t *testing.T) {
+	emailSender, err := New("test-server-token")
+	require.NoError(t, err)
+
+	err = emailSender.SendBatchEmail(nil)
+	require.ErrorIs(t, err, ErrEmptyBatch)
+}
+
+func TestToEmailDisplayNames(t *testing.T) {
+	sender := &postmarkEmailSender{serverToken: "test-server-token", endpoint: endpoint}
+
+	message := newman.NewEmailMessage("Newman <newman@usps.com>", []string{"Jerry Seinfeld <jerry@seinfeld.com>", "elaine@seinfeld.com"}, "Test Email", "Hello, Jerry").
+		SetBCC([]string{`"Costanza, George" <george@seinfeld.com>`}).
+		SetReplyTo("postmaster@usps.com")
+
+	email := sender.toEmail(message)
+
+	assert.Equal(t, `"Newman" <newman@usps.com>`, email.From)
+	assert.Equal(t, `"Jerry Seinfeld" <jerry@seinfeld.com>,elaine@seinfeld.com`, email.To)
+	assert.Equal(t, `"Costanza, George" <george@seinfeld.com>`, email.Bcc)
+	assert.Equal(t, "postmaster@usps.com", email.ReplyTo)
+}
+
+func TestToEmailInlineAttachment(t *testing.T) {
+	sender := &postmarkEmailSender{serverToken: "test-server-token", endpoint: endpoint}
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry").
+		SetHTML(`<img src="cid:logo.png">`).
+		AddAttachment(newman.NewInlineAttachment("logo.png", "logo.png", []byte("png"))).
+		AddAttachment(newman.NewAttachment("test.txt", []byte("When you control the mail, you control information")))
+
+	email := sender.toEmail(message)
+	require.Len(t, email.Attachments, 2)
+
+	assert.Equal(t, "cid:logo.png", email.Attachments[0].ContentID)
+	assert.Empty(t, email.Attachments[1].ContentID)
+}
+
+func TestToEmailHeaders(t *testing.T) {
+	sender := &postmarkEmailSender{serverToken: "test-server-token", endpoint: endpoint}
+
+	unsubscriber, err := newman.NewUnsubscriber([]byte("when you control the mail you control information"), "https://usps.com/unsubscribe")
+	require.NoError(t, err)
+
+	message := newman.NewEmailMessageWithOptions(
+		newman.WithFrom("newman@usps.com"),
+		newman.WithTo([]string{"jerry@seinfeld.com"}),
+		newman.WithSubject("Test Email"),
+		newman.WithText("Hello, Jerry"),
+		newman.WithHeaders(map[string]string{"X-Route": "42"}),
+		newman.WithUnsubscribe(unsubscriber, ""),
+	)
+
+	email := sender.toEmail(message)
+
+	headers := unsubscriber.Headers("jerry@seinfeld.com", "")
+	assert.Equal(t, []header{
+		{Name: "List-Unsubscribe", Value: headers["List-Unsubscribe"]},
+		{Name: "List-Unsubscribe-Post", Value: "List-Unsubscribe=One-Click"},
+		{Name: "X-Route", Value: "42"},
+	}, email.Headers)
+}
+
+func TestServerErrorFailover(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"ErrorCode":100,"Message":"Maintenance"}`))
+	}))
+	defer ts.Close()
+
+	postmarkSender := &postmarkEmailSender{serverToken: "test-server-token", endpoint: endpoint, batchEndpoint: batchEndpoint, url: ts.URL}
+
+	err := postmarkSender.SendEmail(newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry"))
+	require.ErrorIs(t, err, ErrFailedToSendEmail)
+	assert.ErrorContains(t, err, "status 503: 100 Maintenance")
+
+	retryAfter, ok := newman.RetryAfter(err)
+	require.True(t, ok)
+	assert.Equal(t, 7*time.Second, retryAfter)
+
+	backup, err := mock.New("")
+	require.NoError(t, err)
+
+	sender := newman.Failover(newman.Named(providerName, postmarkSender), newman.Named("mock", backup))
+
+	delivery, err := sender.SendEmailWithDelivery(context.Background(), newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry"))
+	require.NoError(t, err)
+	assert.Equal(t, "mock", delivery.Provider)
+	assert.Equal(t, []string{providerName}, delivery.FailedOver)
+
+	// the provider is in cooldown, so the batch goes to the backup first
+	require.NoError(t, sender.SendBatchEmail(newBatchTestMessages(2)))
+	assert.Len(t, backup.Messages(), 3)
+}
+
+func TestChunkMessagesPayloadSize(t *testing.T) {
+	// six emails of 9 MB exceed the 50 MB limit of a batch request together, so they are split in two
+	encoded := make([]json.RawMessage, 7)
+	for i := range 6 {
+		encoded[i] = make(json.RawMessage, 9*1024*1024)
+	}
+
+	encoded[6] = json.RawMessage(`{}`)
+
+	assert.Equal(t, [][]int{{0, 1, 2, 3, 4}, {5, 6}}, chunkMessages([]int{0, 1, 2, 3, 4, 5, 6}, encoded))
+
+	// a single email is sent on its own even when it is larger than the limit
+	encoded = []json.RawMessage{make(json.RawMessage, maxBatchPayloadSize+1), json.RawMessage(`{}`)}
+	assert.Equal(t, [][]int{{0}, {1}}, chunkMessages([]int{0, 1}, encoded))
 }
@@ -2,11 +2,13 @@ package resend
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"maps"
+	"net/http"
 	"net/url"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/resend/resend-go/v3"
 
@@ -16,6 +18,18 @@ import (
 	"github.com/theopenlane/newman/shared"
 )
 
+const (
+	providerName = "resend"
+	// clientTimeout bounds each request to the Resend API
+	clientTimeout = time.Minute
+	// retryAfterHeader holds the delay Resend asks for before a request is retried
+	retryAfterHeader = "Retry-After"
+	// maxMessageSize is the largest message Resend accepts, including base64 encoded attachments
+	maxMessageSize = 40 * 1024 * 1024 // 40 MB
+	// maxRecipients is the most To, Cc and Bcc recipients Resend accepts for a message
+	maxRecipients = 50
+)
+
 // resendEmailSender represents a type that is responsible for sending email messages using the Resend service
 type resendEmailSender struct {
 	client             *resend.Client
@@ -31,7 +45,10 @@ type Option func(*resendEmailSender)
 func New(apiKey string, options ...Option) (newman.EmailSender, error) {
 	// initialize the resendEmailSender
 	s := &resendEmailSender{
-		client: resend.NewClient(apiKey),
+		client: resend.NewCustomClient(&http.Client{
+			Timeout:   clientTimeout,
+			Transport: &statusTransport{next: http.DefaultTransport},
+		}, strings.Trim(strings.TrimSpace(apiKey), "'")),
 	}
 
 	// apply the options
@@ -52,7 +69,8 @@ func New(apiKey string, options ...Option) (newman.EmailSender, error) {
 	return s, nil
 }
 
-// WithClient is an option that allows to set a custom Resend client
+// WithClient is an option that allows to set a custom Resend client. The Resend client does not report the
+// status of server errors, so they are only retried and failed over with the client New creates
 func WithClient(client *resend.Client) Option {
 	return func(s *resendEmailSender) {
 		s.client = client
@@ -116,9 +134,9 @@ func (s *resendEmailSender) SendBatchEmail(messages []*newman.EmailMessage) erro
 
 // toSendEmailRequest converts a newman EmailMessage to a resend SendEmailRequest.
 // Resend's batch API does not support attachments, so withAttachments controls
-// whether attachment fields are populated on the request
+// whether attachment fields, including the calendar invite, are populated on the request
 func (s *resendEmailSender) toSendEmailRequest(message *newman.EmailMessage, withAttachments bool) (*resend.SendEmailRequest, error) {
-	if err := shared.ValidateEmailMessage(message); err != nil {
+	if err := shared.ValidateEmailMessage(message, shared.WithMaxRecipients(maxRecipients)); err != nil {
 		return nil, err
 	}
 
@@ -128,28 +146,41 @@ func (s *resendEmailSender) toSendEmailRequest(message *newman.EmailMessage, wit
 	}
 
 	req := &resend.SendEmailRequest{
-		From:    message.GetFrom(),
-		To:      message.GetTo(),
+		From:    message.GetFromAddress().ToASCII().String(),
+		To:      formatAddresses(message.GetToAddresses()),
 		Subject: message.GetSubject(),
-		Bcc:     message.GetBCC(),
-		Cc:      message.GetCC(),
-		ReplyTo: message.GetReplyTo(),
+		Bcc:     formatAddresses(message.GetBCCAddresses()),
+		Cc:      formatAddresses(message.GetCCAddresses()),
+		ReplyTo: message.GetReplyToAddress().ToASCII().String(),
 		Html:    htmlContent,
 		Text:    message.GetText(),
 		Tags:    make([]resend.Tag, 0, len(message.Tags)),
-		Headers: maps.Clone(message.Headers),
+		Headers: message.GetHeaders(),
 	}
 
 	if withAttachments {
-		req.Attachments = make([]*resend.Attachment, 0, len(message.Attachments))
+		prepared, err := message.PrepareAttachments(maxMessageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments := prepared.GetAttachments()
+		req.Attachments = make([]*resend.Attachment, 0, len(attachments))
 
-		for _, attachment := range message.Attachments {
-			req.Attachments = append(req.Attachments, &resend.Attachment{
-				Content:     attachment.Content,
-				Filename:    attachment.Filename,
+		for _, attachment := range attachments {
+			a := &resend.Attachment{
+				Content:     attachment.GetRawContent(),
+				Filename:    attachment.GetFilename(),
 				Path:        attachment.FilePath,
 				ContentType: attachment.ContentType,
-			})
+			}
+
+			// Resend sends attachments with a content ID inline
+			if attachment.IsInline() {
+				a.ContentId = attachment.GetContentID()
+			}
+
+			req.Attachments = append(req.Attachments, a)
 		}
 
 		req.Attachments = append(req.Attachments, slices.Clone(s.defaultAttachments)...)
@@ -165,39 +196,169 @@ func (s *resendEmailSender) toSendEmailRequest(message *newman.EmailMessage, wit
 	return req, nil
 }
 
-// handleSendError normalizes resend API errors into sentinel or retryable errors
+// handleSendError normalizes resend API errors into sentinel or retryable errors. Rate limiting and
+// server errors are retryable, after the delay Resend asked for when it sent one
 func handleSendError(err error, sentinel error) error {
-	if strings.Contains(strings.ToLower(err.Error()), "too many requests") {
-		return newman.NewRetryableError(err)
-	}
-
-	if strings.Contains(err.Error(), "use our testing email address") {
+	var (
+		rateLimit *resend.RateLimitError
+		server    *serverError
+	)
+
+	switch {
+	case errors.As(err, &rateLimit):
+		return retryableError(fmt.Errorf("%w: %w", sentinel, err), rateLimit.RetryAfter)
+	case errors.As(err, &server):
+		return retryableError(fmt.Errorf("%w: %w", sentinel, err), server.retryAfter)
+	case strings.Contains(strings.ToLower(err.Error()), "too many requests"):
+		return newman.NewRetryableError(fmt.Errorf("%w: %w", sentinel, err))
+	case strings.Contains(err.Error(), "use our testing email address"):
 		return nil
 	}
 
 	return fmt.Errorf("%w: %w", sentinel, err)
 }
 
+// retryableError marks err as retryable, after the delay of the Retry-After value when it has one
+func retryableError(err error, retryAfter string) error {
+	if delay, ok := newman.ParseRetryAfter(retryAfter); ok {
+		return newman.NewRetryableErrorWithDelay(err, delay)
+	}
+
+	return newman.NewRetryableError(err)
+}
+
+// serverError is returned by statusTransport for a server error response, which the Resend client would
+// otherwise report without its status
+type serverError struct {
+	status     int
+	retryAfter string
+}
+
+// Error returns the serverError in string format
+func (e *serverError) Error() string {
+	return fmt.Sprintf("resend returned status %d", e.status)
+}
+
+// statusTransport turns server error responses into a serverError, so they can be told apart from
+// requests Resend rejected
+type statusTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip satisfies the http.RoundTripper interface
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode < http.StatusInternalServerError {
+		return resp, err
+	}
+
+	resp.Body.Close()
+
+	return nil, &serverError{status: resp.StatusCode, retryAfter: resp.Header.Get(retryAfterHeader)}
+}
+
 // SendBatchEmailWithContext satisfies the EmailSender interface
 func (s *resendEmailSender) SendBatchEmailWithContext(ctx context.Context, messages []*newman.EmailMessage) error {
+	result, err := s.SendBatchEmailWithResult(ctx, messages)
+	if err != nil {
+		return err
+	}
+
+	return result.Err()
+}
+
+// SendBatchEmailWithResult satisfies the newman.BatchResultSender interface. Messages that fail
+// validation are reported as failed without being sent, and the batch is sent in permissive mode
+// so Resend accepts the valid messages even when others in the batch are rejected. The batch API
+// does not take attachments, so messages with attachments or a calendar invite, and every message
+// when default attachments are set, are sent one at a time once the batch has been accepted
+func (s *resendEmailSender) SendBatchEmailWithResult(ctx context.Context, messages []*newman.EmailMessage) (*newman.BatchResult, error) {
 	if len(messages) == 0 {
-		return ErrEmptyBatch
+		return nil, ErrEmptyBatch
 	}
 
+	result := newman.NewBatchResult(providerName, len(messages))
 	requests := make([]*resend.SendEmailRequest, 0, len(messages))
+	indexes := make([]int, 0, len(messages))
+
+	var alone []int
+
+	for i, message := range messages {
+		// routed on every attachment, not only those under the size limit, so the attachment policy is applied
+		if len(message.Attachments) > 0 || message.Calendar != nil || len(s.defaultAttachments) > 0 {
+			alone = append(alone, i)
+			continue
+		}
 
-	for _, message := range messages {
 		req, err := s.toSendEmailRequest(message, false)
 		if err != nil {
-			return err
+			result.SetFailed(i, err)
+			continue
 		}
 
 		requests = append(requests, req)
+		indexes = append(indexes, i)
+	}
+
+	if len(requests) > 0 {
+		if err := s.sendBatch(ctx, requests, indexes, result); err != nil {
+			return nil, err
+		}
 	}
 
-	_, err := s.client.Batch.SendWithContext(ctx, requests)
+	for _, i := range alone {
+		sent, err := s.SendEmailWithResult(ctx, messages[i])
+		if err != nil {
+			result.SetFailed(i, err)
+			continue
+		}
+
+		result.SetSent(i, sent.MessageID)
+	}
+
+	return result, nil
+}
+
+// sendBatch sends the requests through the batch API and records the outcome of the messages at the
+// indexes on result. The error is only set when the batch as a whole was not accepted
+func (s *resendEmailSender) sendBatch(ctx context.Context, requests []*resend.SendEmailRequest, indexes []int, result *newman.BatchResult) error {
+	resp, err := s.client.Batch.SendWithOptions(ctx, requests, &resend.BatchSendEmailOptions{
+		BatchValidation: resend.BatchValidationPermissive,
+	})
 	if err != nil {
-		return handleSendError(err, ErrFailedToSendBatchEmail)
+		if err = handleSendError(err, ErrFailedToSendBatchEmail); err != nil {
+			return err
+		}
+
+		for _, i := range indexes {
+			result.SetSent(i, "")
+		}
+
+		return nil
+	}
+
+	// errors are reported against the position in the request, and data holds the
+	// ids of the accepted emails in request order
+	rejected := make(map[int]string, len(resp.Errors))
+	for _, batchErr := range resp.Errors {
+		rejected[batchErr.Index] = batchErr.Message
+	}
+
+	next := 0
+
+	for pos, i := range indexes {
+		if reason, ok := rejected[pos]; ok {
+			result.SetFailed(i, fmt.Errorf("%w: %s", ErrFailedToSendBatchEmail, reason))
+			continue
+		}
+
+		var id string
+		if next < len(resp.Data) {
+			id = resp.Data[next].Id
+			next++
+		}
+
+		result.SetSent(i, id)
 	}
 
 	return nil
@@ -205,15 +366,43 @@ func (s *resendEmailSender) SendBatchEmailWithContext(ctx context.Context, messa
 
 // SendEmailWithContext satisfies the EmailSender interface
 func (s *resendEmailSender) SendEmailWithContext(ctx context.Context, message *newman.EmailMessage) error {
+	_, err := s.SendEmailWithResult(ctx, message)
+
+	return err
+}
+
+// SendEmailWithResult satisfies the newman.ResultSender interface
+func (s *resendEmailSender) SendEmailWithResult(ctx context.Context, message *newman.EmailMessage) (*newman.SendResult, error) {
 	req, err := s.toSendEmailRequest(message, true)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = s.client.Emails.SendWithContext(ctx, req)
+	resp, err := s.client.Emails.SendWithContext(ctx, req)
 	if err != nil {
-		return handleSendError(err, ErrFailedToSendEmail)
+		if err = handleSendError(err, ErrFailedToSendEmail); err != nil {
+			return nil, err
+		}
+
+		return newman.NewSendResult(providerName, "", message), nil
 	}
 
-	return nil
+	return newman.NewSendResult(providerName, resp.Id, message), nil
+}
+
+// ProviderName satisfies the newman.ProviderNamer interface
+func (s *resendEmailSender) ProviderName() string {
+	return providerName
+}
+
+// formatAddresses formats a recipient list as "Name" <address> strings, keeping display names and writing
+// internationalized domain names as punycode
+func formatAddresses(addresses []newman.Address) []string {
+	formatted := make([]string, 0, len(addresses))
+
+	for _, address := range addresses {
+		formatted = append(formatted, address.ToASCII().String())
+	}
+
+	return formatted
 }
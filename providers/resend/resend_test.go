@@ -7,12 +7,14 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/resend/resend-go/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/theopenlane/newman"
+	"github.com/theopenlane/newman/providers/mock"
 )
 
 // TestEmailSenderImplementation checks if resendEmailSender implements the EmailSender interface
@@ -445,3 +447,280 @@ func TestSendEmailRetryable(t *testing.T) {
 	assert.Error(t, err)
 	assert.True(t, newman.IsRetryableError(err))
 }
+
+func TestSendEmailWithResult(t *testing.T) {
+	apiKey := "re_send_api_key" // #nosec G101
+
+	mc, ts := mockClient(t, apiKey, true)
+	defer ts.Close()
+
+	sender := &resendEmailSender{client: mc}
+
+	message := newman.NewEmailMessageWithOptions(
+		newman.WithFrom("newman@usps.com"),
+		newman.WithTo([]string{"jerry@seinfeld.com", "not-an-email"}),
+		newman.WithCc([]string{"elaine@seinfeld.com"}),
+		newman.WithSubject("Test Email"),
+		newman.WithText("The air is so dewy sweet you dont even have to lick the stamps"),
+	)
+
+	result, err := sender.SendEmailWithResult(context.Background(), message)
+	require.NoError(t, err)
+
+	assert.Equal(t, "resend", result.Provider)
+	assert.Equal(t, "sent", result.MessageID)
+	assert.Equal(t, []string{"jerry@seinfeld.com", "elaine@seinfeld.com"}, result.Accepted)
+	assert.Equal(t, []string{"not-an-email"}, result.Rejected)
+	assert.False(t, result.SentAt.IsZero())
+}
+
+func TestSendBatchEmailWithResultPartialSuccess(t *testing.T) {
+	apiKey := "re_send_api_key" // #nosec G101
+
+	var captured []resend.SendEmailRequest
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "permissive", r.Header.Get("x-batch-validation"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&captured))
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"data": [{"id": "sent-1"}, {"id": "sent-3"}], "errors": [{"index": 1, "message": "The to field is blocked"}]}`))
+	}))
+	defer ts.Close()
+
+	mc := resend.NewClient(apiKey)
+	baseURL, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	mc.BaseURL = baseURL
+
+	sender := &resendEmailSender{client: mc}
+
+	newMessage := func(to string) *newman.EmailMessage {
+		return newman.NewEmailMessage("newman@usps.com", []string{to}, "Batch", "Hello")
+	}
+
+	messages := []*newman.EmailMessage{
+		newMessage("jerry@seinfeld.com"),
+		newMessage("invalid"),
+		newMessage("george@seinfeld.com"),
+		newMessage("elaine@seinfeld.com"),
+	}
+
+	result, err := sender.SendBatchEmailWithResult(context.Background(), messages)
+	require.NoError(t, err)
+
+	// the invalid message is never sent to resend
+	require.Len(t, captured, 3)
+
+	assert.Equal(t, "resend", result.Provider)
+	assert.Equal(t, newman.BatchStatusSent, result.Items[0].Status)
+	assert.Equal(t, "sent-1", result.Items[0].MessageID)
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[1].Status)
+	assert.ErrorContains(t, result.Items[1].Err, "to is required")
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[2].Status)
+	assert.ErrorIs(t, result.Items[2].Err, ErrFailedToSendBatchEmail)
+	assert.ErrorContains(t, result.Items[2].Err, "The to field is blocked")
+	assert.Equal(t, newman.BatchStatusSent, result.Items[3].Status)
+	assert.Equal(t, "sent-3", result.Items[3].MessageID)
+
+	err = sender.SendBatchEmailWithContext(context.Background(), messages)
+	require.ErrorIs(t, err, newman.ErrBatchIncomplete)
+}
+
+func TestToSendEmailRequestDisplayNames(t *testing.T) {
+	sender := &resendEmailSender{}
+
+	msg := newman.NewEmailMessageWithOptions(
+		newman.WithFromAddress(newman.NewAddress("Newman", "newman@usps.com")),
+		newman.WithTo([]string{"Jerry Seinfeld <jerry@seinfeld.com>"}),
+		newman.WithToAddresses(newman.NewAddress("", "elaine@seinfeld.com")),
+		newman.WithCcAddresses(newman.NewAddress("Cosmo Kramer", "kramer@seinfeld.com")),
+		newman.WithReplyToAddress(newman.NewAddress("Postmaster", "postmaster@usps.com")),
+		newman.WithSubject("Hello"),
+		newman.WithText("Hello, Jerry"),
+	)
+
+	req, err := sender.toSendEmailRequest(msg, false)
+	require.NoError(t, err)
+
+	assert.Equal(t, `"Newman" <newman@usps.com>`, req.From)
+	assert.Equal(t, []string{`"Jerry Seinfeld" <jerry@seinfeld.com>`, "elaine@seinfeld.com"}, req.To)
+	assert.Equal(t, []string{`"Cosmo Kramer" <kramer@seinfeld.com>`}, req.Cc)
+	assert.Equal(t, `"Postmaster" <postmaster@usps.com>`, req.ReplyTo)
+}
+
+func TestToSendEmailRequestInlineAttachment(t *testing.T) {
+	sender := &resendEmailSender{}
+
+	msg := newman.NewEmailMessageWithOptions(
+		newman.WithFrom("sender@example.com"),
+		newman.WithTo([]string{"to@example.com"}),
+		newman.WithSubject("Hello"),
+		newman.WithHTML(`<img src="cid:logo">`),
+		newman.WithAttachment(newman.NewInlineAttachment("logo.png", "logo", []byte("png"))),
+		newman.WithAttachment(newman.NewAttachment("test.txt", []byte("When you control the mail, you control information"))),
+	)
+
+	req, err := sender.toSendEmailRequest(msg, true)
+	require.NoError(t, err)
+	require.Len(t, req.Attachments, 2)
+
+	assert.Equal(t, "logo", req.Attachments[0].ContentId)
+	assert.Empty(t, req.Attachments[1].ContentId)
+}
+
+func TestToSendEmailRequestCalendarInvite(t *testing.T) {
+	sender := &resendEmailSender{}
+
+	start := time.Date(2026, time.March, 20, 9, 0, 0, 0, time.UTC)
+	event := newman.NewCalendarEvent("Mail route review", start, start.Add(time.Hour)).SetOrganizer("newman@usps.com", "Newman")
+
+	msg := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello, Jerry").
+		SetCalendar(event)
+
+	req, err := sender.toSendEmailRequest(msg, true)
+	require.NoError(t, err)
+	require.Len(t, req.Attachments, 1)
+	assert.Equal(t, "invite.ics", req.Attachments[0].Filename)
+	assert.Contains(t, string(req.Attachments[0].Content), "BEGIN:VCALENDAR")
+}
+
+func TestSendBatchEmailWithResultAttachments(t *testing.T) {
+	var (
+		batch  []resend.SendEmailRequest
+		single []resend.SendEmailRequest
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/emails/batch" {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+
+			_, _ = w.Write([]byte(`{"data": [{"id": "batch-1"}]}`))
+
+			return
+		}
+
+		var req resend.SendEmailRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		single = append(single, req)
+
+		_, _ = w.Write([]byte(`{"id": "single-1"}`))
+	}))
+	defer ts.Close()
+
+	mc := resend.NewClient("re_send_api_key")
+	baseURL, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	mc.BaseURL = baseURL
+
+	sender := &resendEmailSender{client: mc}
+
+	messages := []*newman.EmailMessage{
+		newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Batch", "Hello").
+			AddAttachment(newman.NewAttachment("route.txt", []byte("upstairs"))),
+		newman.NewEmailMessage("newman@usps.com", []string{"george@seinfeld.com"}, "Batch", "Hello"),
+	}
+
+	result, err := sender.SendBatchEmailWithResult(context.Background(), messages)
+	require.NoError(t, err)
+	require.NoError(t, result.Err())
+
+	// the message with an attachment is sent on its own so the attachment is not dropped
+	require.Len(t, batch, 1)
+	assert.Equal(t, []string{"george@seinfeld.com"}, batch[0].To)
+	require.Len(t, single, 1)
+	assert.Equal(t, []string{"jerry@seinfeld.com"}, single[0].To)
+	require.Len(t, single[0].Attachments, 1)
+	assert.Equal(t, "route.txt", single[0].Attachments[0].Filename)
+
+	assert.Equal(t, "single-1", result.Items[0].MessageID)
+	assert.Equal(t, "batch-1", result.Items[1].MessageID)
+}
+
+func TestServerErrorFailover(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"message":"service unavailable"}`))
+	}))
+	defer ts.Close()
+
+	baseURL, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	resendSender, err := New("re_send_api_key", WithBaseURL(*baseURL))
+	require.NoError(t, err)
+
+	err = resendSender.SendEmail(newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry"))
+	require.ErrorIs(t, err, ErrFailedToSendEmail)
+	assert.ErrorContains(t, err, "status 503")
+
+	retryAfter, ok := newman.RetryAfter(err)
+	require.True(t, ok)
+	assert.Equal(t, 7*time.Second, retryAfter)
+
+	backup, err := mock.New("")
+	require.NoError(t, err)
+
+	sender := newman.Failover(newman.Named(providerName, resendSender), newman.Named("mock", backup))
+
+	delivery, err := sender.SendEmailWithDelivery(context.Background(), newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry"))
+	require.NoError(t, err)
+	assert.Equal(t, "mock", delivery.Provider)
+	assert.Equal(t, []string{providerName}, delivery.FailedOver)
+
+	_, err = resendSender.(newman.BatchResultSender).SendBatchEmailWithResult(context.Background(), []*newman.EmailMessage{
+		newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry"),
+	})
+	require.ErrorIs(t, err, ErrFailedToSendBatchEmail)
+	assert.True(t, newman.IsRetryableError(err))
+}
+
+func TestSendBatchEmailWithResultAttachmentPolicy(t *testing.T) {
+	var single []resend.SendEmailRequest
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NotEqual(t, "/emails/batch", r.URL.Path)
+
+		var req resend.SendEmailRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		single = append(single, req)
+
+		_, _ = w.Write([]byte(`{"id": "single-1"}`))
+	}))
+	defer ts.Close()
+
+	mc := resend.NewClient("re_send_api_key")
+	baseURL, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	mc.BaseURL = baseURL
+
+	sender := &resendEmailSender{client: mc}
+
+	var dropped []string
+
+	message := newman.NewEmailMessageWithOptions(
+		newman.WithFrom("newman@usps.com"),
+		newman.WithTo([]string{"jerry@seinfeld.com"}),
+		newman.WithSubject("Batch"),
+		newman.WithText("Hello"),
+		newman.WithAttachment(newman.NewAttachment("route.pdf", make([]byte, 2048))),
+		newman.WithMaxAttachmentSize(1024),
+		newman.WithAttachmentPolicy(newman.AttachmentPolicyDrop),
+		newman.WithAttachmentDropHook(func(_ *newman.EmailMessage, err *newman.AttachmentTooLargeError) {
+			dropped = append(dropped, err.Filename)
+		}),
+	)
+
+	result, err := sender.SendBatchEmailWithResult(context.Background(), []*newman.EmailMessage{message})
+	require.NoError(t, err)
+	require.NoError(t, result.Err())
+
+	// the oversized attachment is dropped through the policy, which reports it, rather than lost in the batch
+	assert.Equal(t, []string{"route.pdf"}, dropped)
+	require.Len(t, single, 1)
+	assert.Empty(t, single[0].Attachments)
+}
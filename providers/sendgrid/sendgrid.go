@@ -2,13 +2,33 @@ package sendgrid
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"net/http"
+	"slices"
 
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 
 	"github.com/theopenlane/newman"
 	"github.com/theopenlane/newman/scrubber"
+	"github.com/theopenlane/newman/shared"
+)
+
+const (
+	providerName     = "sendgrid"
+	messageIDHeader  = "X-Message-Id"
+	retryAfterHeader = "Retry-After"
+	// maxPersonalizations is the most personalizations SendGrid accepts in a single request
+	maxPersonalizations = 1000
+	// maxMessageSize is the largest message SendGrid accepts, including base64 encoded attachments
+	maxMessageSize = 30 * 1024 * 1024 // 30 MB
+	// maxRecipients is the most To, Cc and Bcc recipients SendGrid accepts for a message
+	maxRecipients = 1000
+	// maxRequestRecipients is the most To, Cc and Bcc recipients SendGrid accepts across every personalization
+	// of a single request
+	maxRequestRecipients = 1000
 )
 
 // sendGridEmailSender defines a struct for sending emails using the SendGrid API
@@ -47,46 +67,182 @@ func (s *sendGridEmailSender) SendEmail(message *newman.EmailMessage) error {
 }
 
 // SendBatchEmail satisfies the EmailSender interface
-func (s *sendGridEmailSender) SendBatchEmail(_ []*newman.EmailMessage) error {
-	return newman.ErrBatchNotImplemented
+func (s *sendGridEmailSender) SendBatchEmail(messages []*newman.EmailMessage) error {
+	return s.SendBatchEmailWithContext(context.Background(), messages)
 }
 
 // SendBatchEmailWithContext satisfies the EmailSender interface
-func (s *sendGridEmailSender) SendBatchEmailWithContext(_ context.Context, _ []*newman.EmailMessage) error {
-	return newman.ErrBatchNotImplemented
+func (s *sendGridEmailSender) SendBatchEmailWithContext(ctx context.Context, messages []*newman.EmailMessage) error {
+	result, err := s.SendBatchEmailWithResult(ctx, messages)
+	if err != nil {
+		return err
+	}
+
+	return result.Err()
+}
+
+// SendBatchEmailWithResult satisfies the newman.BatchResultSender interface. Messages sharing the
+// same sender, reply-to, body and attachments are sent in one API call with a personalization per
+// message carrying its recipients, subject and substitutions. SendGrid assigns a single message ID
+// to each call, so every message in a group reports the same ID
+func (s *sendGridEmailSender) SendBatchEmailWithResult(ctx context.Context, messages []*newman.EmailMessage) (*newman.BatchResult, error) {
+	if len(messages) == 0 {
+		return nil, ErrEmptyBatch
+	}
+
+	result := newman.NewBatchResult(providerName, len(messages))
+
+	var (
+		order  []string
+		groups = map[string][]int{}
+	)
+
+	// the attachment policy is applied to copies, which are sent in place of the messages
+	messages = slices.Clone(messages)
+
+	for i, message := range messages {
+		if err := shared.ValidateEmailMessage(message, shared.WithMaxRecipients(maxRecipients)); err != nil {
+			result.SetFailed(i, err)
+			continue
+		}
+
+		message, err := message.PrepareAttachments(maxMessageSize)
+		if err != nil {
+			result.SetFailed(i, err)
+			continue
+		}
+
+		messages[i] = message
+
+		key := s.contentKey(message)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+
+		groups[key] = append(groups[key], i)
+	}
+
+	for _, key := range order {
+		for _, chunk := range chunkMessages(messages, groups[key]) {
+			v3Mail := s.newMail(messages[chunk[0]])
+			for _, i := range chunk {
+				v3Mail.AddPersonalizations(newPersonalization(messages[i]))
+			}
+
+			messageID, err := s.send(ctx, v3Mail, ErrFailedToSendBatchEmail)
+
+			for _, i := range chunk {
+				if err != nil {
+					result.SetFailed(i, err)
+				} else {
+					result.SetSent(i, messageID)
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// chunkMessages splits the indexes of messages sent in one group into requests within the SendGrid limits on
+// personalizations and on recipients across them
+func chunkMessages(messages []*newman.EmailMessage, indexes []int) [][]int {
+	var (
+		chunks     [][]int
+		chunk      []int
+		recipients int
+	)
+
+	for _, i := range indexes {
+		message := messages[i]
+		count := len(message.GetToAddresses()) + len(message.GetCCAddresses()) + len(message.GetBCCAddresses())
+
+		if len(chunk) > 0 && (len(chunk) == maxPersonalizations || recipients+count > maxRequestRecipients) {
+			chunks = append(chunks, chunk)
+			chunk, recipients = nil, 0
+		}
+
+		chunk = append(chunk, i)
+		recipients += count
+	}
+
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// ProviderName satisfies the newman.ProviderNamer interface
+func (s *sendGridEmailSender) ProviderName() string {
+	return providerName
 }
 
 // SendEmailWithContext satisfies the EmailSender interface
 func (s *sendGridEmailSender) SendEmailWithContext(ctx context.Context, message *newman.EmailMessage) error {
-	from := mail.NewEmail("", message.GetFrom())
-	toRecipients := []*mail.Email{}
+	_, err := s.SendEmailWithResult(ctx, message)
 
-	for _, to := range message.GetTo() {
-		toRecipients = append(toRecipients, mail.NewEmail("", to))
+	return err
+}
+
+// SendEmailWithResult satisfies the newman.ResultSender interface
+func (s *sendGridEmailSender) SendEmailWithResult(ctx context.Context, message *newman.EmailMessage) (*newman.SendResult, error) {
+	if err := shared.ValidateEmailMessage(message, shared.WithMaxRecipients(maxRecipients)); err != nil {
+		return nil, err
 	}
 
-	v3Mail := mail.NewV3Mail()
-	v3Mail.SetFrom(from)
-	v3Mail.Subject = message.GetSubject()
+	message, err := message.PrepareAttachments(maxMessageSize)
+	if err != nil {
+		return nil, err
+	}
 
-	// Create personalization for To recipients
-	personalization := mail.NewPersonalization()
-	for _, to := range toRecipients {
-		personalization.AddTos(to)
+	v3Mail := s.newMail(message)
+	v3Mail.AddPersonalizations(newPersonalization(message))
+
+	messageID, err := s.send(ctx, v3Mail, ErrFailedToSendEmail)
+	if err != nil {
+		return nil, err
 	}
 
-	// Add BCC recipients
-	for _, bcc := range message.GetBCC() {
-		personalization.AddBCCs(mail.NewEmail("", bcc))
+	return newman.NewSendResult(providerName, messageID, message), nil
+}
+
+// send posts the mail to SendGrid and returns the message ID it was assigned. Rate limiting and
+// server errors are returned as retryable errors wrapping the sentinel
+func (s *sendGridEmailSender) send(ctx context.Context, v3Mail *mail.SGMailV3, sentinel error) (string, error) {
+	response, err := s.client.SendWithContext(ctx, v3Mail)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", sentinel, err)
 	}
 
-	// Add Reply-To if specified
-	if message.GetReplyTo() != "" {
-		replyTo := mail.NewEmail("", message.GetReplyTo())
-		v3Mail.SetReplyTo(replyTo)
+	headers := http.Header(response.Headers)
+
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= http.StatusInternalServerError:
+		err := fmt.Errorf("%w: status %d", sentinel, response.StatusCode)
+
+		if retryAfter, ok := newman.ParseRetryAfter(headers.Get(retryAfterHeader)); ok {
+			return "", newman.NewRetryableErrorWithDelay(err, retryAfter)
+		}
+
+		return "", newman.NewRetryableError(err)
+	case response.StatusCode >= http.StatusBadRequest:
+		return "", fmt.Errorf("%w: status %d", sentinel, response.StatusCode)
 	}
 
-	v3Mail.AddPersonalizations(personalization)
+	return headers.Get(messageIDHeader), nil
+}
+
+// newMail creates a SendGrid mail with the content shared by every recipient of the message
+func (s *sendGridEmailSender) newMail(message *newman.EmailMessage) *mail.SGMailV3 {
+	v3Mail := mail.NewV3Mail()
+	v3Mail.SetFrom(newEmail(message.GetFromAddress()))
+	v3Mail.Subject = message.GetSubject()
+
+	// Add Reply-To if specified
+	if replyTo := message.GetReplyToAddress(); !replyTo.IsZero() {
+		v3Mail.SetReplyTo(newEmail(replyTo))
+	}
 
 	// Add plain text content
 	if message.GetText() != "" {
@@ -94,12 +250,7 @@ func (s *sendGridEmailSender) SendEmailWithContext(ctx context.Context, message
 	}
 
 	// Add HTML content
-	htmlContent := message.GetHTML()
-	if s.htmlScrubber != nil {
-		htmlContent = s.htmlScrubber.Scrub(htmlContent)
-	}
-
-	if htmlContent != "" {
+	if htmlContent := s.html(message); htmlContent != "" {
 		v3Mail.AddContent(mail.NewContent("text/html", htmlContent))
 	}
 
@@ -107,20 +258,82 @@ func (s *sendGridEmailSender) SendEmailWithContext(ctx context.Context, message
 	for _, attachment := range message.GetAttachments() {
 		a := mail.NewAttachment()
 		a.SetContent(attachment.GetBase64StringContent())
-		a.SetType(newman.GetMimeType(attachment.GetFilename()))
+		a.SetType(attachment.GetContentType())
 		a.SetFilename(attachment.GetFilename())
 		a.SetDisposition("attachment")
+
+		if attachment.IsInline() {
+			a.SetDisposition("inline")
+			a.SetContentID(attachment.GetContentID())
+		}
+
 		v3Mail.AddAttachment(a)
 	}
 
-	response, err := s.client.SendWithContext(ctx, v3Mail)
-	if err != nil {
-		return ErrFailedToSendEmail
+	return v3Mail
+}
+
+// html returns the HTML content of the message, scrubbed when a scrubber is configured
+func (s *sendGridEmailSender) html(message *newman.EmailMessage) string {
+	htmlContent := message.GetHTML()
+	if s.htmlScrubber != nil {
+		htmlContent = s.htmlScrubber.Scrub(htmlContent)
 	}
 
-	if response.StatusCode >= http.StatusBadRequest {
-		return ErrFailedToSendEmail
+	return htmlContent
+}
+
+// contentKey identifies the content of a message that must match for it to share a batch request
+func (s *sendGridEmailSender) contentKey(message *newman.EmailMessage) string {
+	h := sha256.New()
+
+	for _, part := range []string{message.GetFromAddress().String(), message.GetReplyToAddress().String(), message.GetText(), s.html(message)} {
+		fmt.Fprintf(h, "%d:%s", len(part), part)
+	}
+
+	for _, attachment := range message.GetAttachments() {
+		fmt.Fprintf(h, "%d:%s", len(attachment.GetFilename()), attachment.GetFilename())
+		fmt.Fprintf(h, "%d:%s", len(attachment.GetContentID()), attachment.GetContentID())
+		fmt.Fprintf(h, "%d:", len(attachment.GetRawContent()))
+		h.Write(attachment.GetRawContent())
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// newPersonalization creates the personalization holding the recipients, subject, headers and substitutions of
+// the message, so per-recipient headers such as List-Unsubscribe survive batching
+func newPersonalization(message *newman.EmailMessage) *mail.Personalization {
+	personalization := mail.NewPersonalization()
+	personalization.Subject = message.GetSubject()
+
+	for _, to := range message.GetToAddresses() {
+		personalization.AddTos(newEmail(to))
 	}
 
-	return nil
+	for _, cc := range message.GetCCAddresses() {
+		personalization.AddCCs(newEmail(cc))
+	}
+
+	for _, bcc := range message.GetBCCAddresses() {
+		personalization.AddBCCs(newEmail(bcc))
+	}
+
+	for key, value := range message.GetHeaders() {
+		personalization.SetHeader(key, value)
+	}
+
+	for key, value := range message.Substitutions {
+		personalization.SetSubstitution(key, value)
+	}
+
+	return personalization
+}
+
+// newEmail creates a SendGrid email carrying the display name of the address, with an internationalized
+// domain name as punycode since SendGrid only accepts ASCII domains
+func newEmail(address newman.Address) *mail.Email {
+	address = address.ToASCII()
+
+	return mail.NewEmail(address.Name, address.Address)
 }
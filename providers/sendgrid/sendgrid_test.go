@@ -1,15 +1,21 @@
 package sendgrid
 
 import (
+	"context"
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/theopenlane/newman"
 )
@@ -117,7 +123,10 @@ func TestSendGridEmailSender_SendEmailWithEmptyFields(t *testing.T) {
 	)
 
 	err := emailSender.SendEmail(message)
-	assert.NoError(t, err)
+
+	var missing *newman.MissingRequiredFieldError
+	require.ErrorAs(t, err, &missing)
+	assert.Equal(t, "to", missing.RequiredField)
 }
 
 func TestSendGridEmailSender_SendEmailWithAttachments(t *testing.T) {
@@ -150,3 +159,272 @@ func TestSendGridEmailSender_SendEmailWithAttachments(t *testing.T) {
 
 	assert.Equal(t, v3Mail.Attachments[0].Content, message.GetAttachments()[0].GetBase64StringContent())
 }
+
+func TestSendGridEmailSender_SendEmailWithResult(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Message-Id", "14c5d75ce93.dfd.64b469.filter0001.16648.5515E0B88.0")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	emailSender := NewMockSendGridEmailSender("test-api-key", ts.URL)
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "The air is so dewy sweet you dont even have to lick the stamps")
+
+	result, err := emailSender.SendEmailWithResult(context.Background(), message)
+	require.NoError(t, err)
+
+	assert.Equal(t, "sendgrid", result.Provider)
+	assert.Equal(t, "14c5d75ce93.dfd.64b469.filter0001.16648.5515E0B88.0", result.MessageID)
+	assert.Equal(t, []string{"jerry@seinfeld.com"}, result.Accepted)
+}
+
+// captureSendGridServer records the decoded body of every request it receives
+func captureSendGridServer(t *testing.T, bodies *[]mail.SGMailV3) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		var body mail.SGMailV3
+		require.NoError(t, json.Unmarshal(raw, &body))
+
+		*bodies = append(*bodies, body)
+
+		w.Header().Set("X-Message-Id", "msg-"+string(rune('a'+len(*bodies)-1)))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+}
+
+// newBatchMessage creates a message sharing the batch body, addressed to a single recipient
+func newBatchMessage(to, subject string, opts ...newman.MessageOption) *newman.EmailMessage {
+	opts = append([]newman.MessageOption{
+		newman.WithFrom("newman@usps.com"),
+		newman.WithTo([]string{to}),
+		newman.WithSubject(subject),
+		newman.WithText("Hello, -name-"),
+	}, opts...)
+
+	return newman.NewEmailMessageWithOptions(opts...)
+}
+
+func TestSendGridEmailSender_SendEmailWithCC(t *testing.T) {
+	var bodies []mail.SGMailV3
+
+	ts := captureSendGridServer(t, &bodies)
+	defer ts.Close()
+
+	emailSender := NewMockSendGridEmailSender("test-api-key", ts.URL)
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Newman").
+		SetCC([]string{"elaine@seinfeld.com"}).
+		SetBCC([]string{"kramer@seinfeld.com"})
+
+	require.NoError(t, emailSender.SendEmail(message))
+	require.Len(t, bodies, 1)
+	require.Len(t, bodies[0].Personalizations, 1)
+
+	personalization := bodies[0].Personalizations[0]
+	require.Len(t, personalization.CC, 1)
+	assert.Equal(t, "elaine@seinfeld.com", personalization.CC[0].Address)
+	require.Len(t, personalization.BCC, 1)
+	assert.Equal(t, "kramer@seinfeld.com", personalization.BCC[0].Address)
+}
+
+func TestSendGridEmailSender_SendBatchEmailWithResult(t *testing.T) {
+	var bodies []mail.SGMailV3
+
+	ts := captureSendGridServer(t, &bodies)
+	defer ts.Close()
+
+	emailSender := NewMockSendGridEmailSender("test-api-key", ts.URL)
+
+	messages := []*newman.EmailMessage{
+		newBatchMessage("jerry@seinfeld.com", "Hello Jerry", newman.WithSubstitution("-name-", "Jerry")),
+		newBatchMessage("not-an-email", "Hello"),
+		newBatchMessage("george@seinfeld.com", "Hello George", newman.WithSubstitutions(map[string]string{"-name-": "George"})),
+		newman.NewEmailMessage("newman@usps.com", []string{"elaine@seinfeld.com"}, "Something else", "A different body"),
+	}
+
+	result, err := emailSender.SendBatchEmailWithResult(context.Background(), messages)
+	require.NoError(t, err)
+
+	// messages sharing a body are merged into one request with a personalization each
+	require.Len(t, bodies, 2)
+	require.Len(t, bodies[0].Personalizations, 2)
+	assert.Equal(t, "Hello Jerry", bodies[0].Personalizations[0].Subject)
+	assert.Equal(t, map[string]string{"-name-": "Jerry"}, bodies[0].Personalizations[0].Substitutions)
+	assert.Equal(t, "george@seinfeld.com", bodies[0].Personalizations[1].To[0].Address)
+	assert.Equal(t, map[string]string{"-name-": "George"}, bodies[0].Personalizations[1].Substitutions)
+	require.Len(t, bodies[1].Personalizations, 1)
+
+	assert.Equal(t, newman.BatchStatusSent, result.Items[0].Status)
+	assert.Equal(t, "msg-a", result.Items[0].MessageID)
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[1].Status)
+	assert.Equal(t, "msg-a", result.Items[2].MessageID)
+	assert.Equal(t, "msg-b", result.Items[3].MessageID)
+}
+
+func TestSendGridEmailSender_SendBatchEmailRecipientLimit(t *testing.T) {
+	var bodies []mail.SGMailV3
+
+	ts := captureSendGridServer(t, &bodies)
+	defer ts.Close()
+
+	emailSender := NewMockSendGridEmailSender("test-api-key", ts.URL)
+
+	// each message has 400 recipients, so no more than two fit in a request
+	messages := make([]*newman.EmailMessage, 3)
+	for i := range messages {
+		bcc := make([]string, 399)
+		for j := range bcc {
+			bcc[j] = fmt.Sprintf("carrier-%d-%d@usps.com", i, j)
+		}
+
+		messages[i] = newBatchMessage("jerry@seinfeld.com", "Route update", newman.WithBcc(bcc))
+	}
+
+	result, err := emailSender.SendBatchEmailWithResult(context.Background(), messages)
+	require.NoError(t, err)
+	require.NoError(t, result.Err())
+
+	require.Len(t, bodies, 2)
+	assert.Len(t, bodies[0].Personalizations, 2)
+	assert.Len(t, bodies[1].Personalizations, 1)
+	assert.Equal(t, "msg-a", result.Items[1].MessageID)
+	assert.Equal(t, "msg-b", result.Items[2].MessageID)
+}
+
+func TestSendGridEmailSender_SendBatchEmailWithUnsubscribe(t *testing.T) {
+	var bodies []mail.SGMailV3
+
+	ts := captureSendGridServer(t, &bodies)
+	defer ts.Close()
+
+	emailSender := NewMockSendGridEmailSender("test-api-key", ts.URL)
+
+	unsubscriber, err := newman.NewUnsubscriber([]byte("when you control the mail you control information"), "https://usps.com/unsubscribe")
+	require.NoError(t, err)
+
+	messages := []*newman.EmailMessage{
+		newBatchMessage("jerry@seinfeld.com", "Hello Jerry", newman.WithUnsubscribe(unsubscriber, "newsletter")),
+		newBatchMessage("george@seinfeld.com", "Hello George", newman.WithUnsubscribe(unsubscriber, "newsletter")),
+	}
+
+	require.NoError(t, emailSender.SendBatchEmail(messages))
+
+	// the unsubscribe headers differ per recipient, so they are sent with each personalization
+	require.Len(t, bodies, 1)
+	require.Len(t, bodies[0].Personalizations, 2)
+	assert.Empty(t, bodies[0].Headers)
+
+	for i, to := range []string{"jerry@seinfeld.com", "george@seinfeld.com"} {
+		assert.Equal(t, unsubscriber.Headers(to, "newsletter"), bodies[0].Personalizations[i].Headers)
+	}
+}
+
+func TestSendGridEmailSender_SendBatchEmailEmpty(t *testing.T) {
+	emailSender := NewMockSendGridEmailSender("test-api-key", "http://localhost")
+
+	require.ErrorIs(t, emailSender.SendBatchEmail(nil), ErrEmptyBatch)
+}
+
+func TestSendGridEmailSender_SendEmailRetryableErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		retryAfter string
+		retryable  bool
+		delay      time.Duration
+	}{
+		{name: "rate limited", statusCode: http.StatusTooManyRequests, retryAfter: "7", retryable: true, delay: 7 * time.Second},
+		{name: "rate limited without hint", statusCode: http.StatusTooManyRequests, retryable: true},
+		{name: "server error", statusCode: http.StatusServiceUnavailable, retryable: true},
+		{name: "bad request", statusCode: http.StatusBadRequest},
+		{name: "unauthorized", statusCode: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+
+				w.WriteHeader(tc.statusCode)
+			}))
+			defer ts.Close()
+
+			emailSender := NewMockSendGridEmailSender("test-api-key", ts.URL)
+
+			err := emailSender.SendEmail(newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Newman"))
+			require.ErrorIs(t, err, ErrFailedToSendEmail)
+			assert.Equal(t, tc.retryable, newman.IsRetryableError(err))
+
+			delay, ok := newman.RetryAfter(err)
+			assert.Equal(t, tc.delay != 0, ok)
+			assert.Equal(t, tc.delay, delay)
+		})
+	}
+}
+
+func TestSendGridEmailSender_SendEmailWithDisplayNames(t *testing.T) {
+	var bodies []mail.SGMailV3
+
+	ts := captureSendGridServer(t, &bodies)
+	defer ts.Close()
+
+	emailSender := NewMockSendGridEmailSender("test-api-key", ts.URL)
+
+	message := newman.NewEmailMessage("Newman <newman@usps.com>", []string{"Jerry Seinfeld <jerry@seinfeld.com>"}, "Test Email", "Hello, Jerry").
+		SetCC([]string{"elaine@seinfeld.com"}).
+		SetReplyTo("Postmaster <postmaster@usps.com>")
+
+	require.NoError(t, emailSender.SendEmail(message))
+	require.Len(t, bodies, 1)
+
+	assert.Equal(t, &mail.Email{Name: "Newman", Address: "newman@usps.com"}, bodies[0].From)
+	assert.Equal(t, &mail.Email{Name: "Postmaster", Address: "postmaster@usps.com"}, bodies[0].ReplyTo)
+	require.Len(t, bodies[0].Personalizations, 1)
+	assert.Equal(t, []*mail.Email{{Name: "Jerry Seinfeld", Address: "jerry@seinfeld.com"}}, bodies[0].Personalizations[0].To)
+	assert.Equal(t, []*mail.Email{{Address: "elaine@seinfeld.com"}}, bodies[0].Personalizations[0].CC)
+}
+
+func TestSendGridEmailSender_SendEmailWithInternationalizedDomain(t *testing.T) {
+	var bodies []mail.SGMailV3
+
+	ts := captureSendGridServer(t, &bodies)
+	defer ts.Close()
+
+	emailSender := NewMockSendGridEmailSender("test-api-key", ts.URL)
+
+	message := newman.NewEmailMessage("Newman <newman@usps.com>", []string{"Kramer <kramer@café.fr>"}, "Test Email", "Hello, Kramer")
+
+	require.NoError(t, emailSender.SendEmail(message))
+	require.Len(t, bodies, 1)
+	require.Len(t, bodies[0].Personalizations, 1)
+
+	assert.Equal(t, []*mail.Email{{Name: "Kramer", Address: "kramer@xn--caf-dma.fr"}}, bodies[0].Personalizations[0].To)
+}
+
+func TestSendGridEmailSender_SendEmailWithInlineAttachment(t *testing.T) {
+	var bodies []mail.SGMailV3
+
+	ts := captureSendGridServer(t, &bodies)
+	defer ts.Close()
+
+	emailSender := NewMockSendGridEmailSender("test-api-key", ts.URL)
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Newman").
+		SetHTML(`<img src="cid:logo">`).
+		AddAttachment(newman.NewInlineAttachment("logo.png", "logo", []byte("png"))).
+		AddAttachment(newman.NewAttachment("test.txt", []byte("When you control the mail, you control information")))
+
+	require.NoError(t, emailSender.SendEmail(message))
+	require.Len(t, bodies, 1)
+	require.Len(t, bodies[0].Attachments, 2)
+
+	assert.Equal(t, "inline", bodies[0].Attachments[0].Disposition)
+	assert.Equal(t, "logo", bodies[0].Attachments[0].ContentID)
+	assert.Equal(t, "attachment", bodies[0].Attachments[1].Disposition)
+	assert.Empty(t, bodies[0].Attachments[1].ContentID)
+}
@@ -0,0 +1,84 @@
+package smtp
+
+import (
+	"net/smtp"
+	"strings"
+)
+
+// loginAuth implements the LOGIN authentication mechanism, as used by Office 365 and other relays
+// that do not offer PLAIN. Like smtp.PlainAuth it only sends credentials over TLS or to localhost
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// Start satisfies the smtp.Auth interface
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if err := checkServer(server, a.host); err != nil {
+		return "", nil, err
+	}
+
+	return LOGINAuth, nil, nil
+}
+
+// Next satisfies the smtp.Auth interface
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:", "user name:", "username":
+		return []byte(a.username), nil
+	case "password:", "password":
+		return []byte(a.password), nil
+	default:
+		return nil, ErrUnexpectedServerChallenge
+	}
+}
+
+// xoauth2Auth implements the XOAUTH2 authentication mechanism used by Gmail and Office 365,
+// authenticating the user with an OAuth2 access token. It only sends the token over TLS or to localhost
+type xoauth2Auth struct {
+	username string
+	token    string
+	host     string
+}
+
+// Start satisfies the smtp.Auth interface
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if err := checkServer(server, a.host); err != nil {
+		return "", nil, err
+	}
+
+	return XOAUTH2Auth, []byte("user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+// Next satisfies the smtp.Auth interface. A challenge after the initial response carries the
+// error details, which must be acknowledged with an empty response before the server fails the AUTH
+func (a *xoauth2Auth) Next(_ []byte, more bool) ([]byte, error) {
+	if more {
+		return []byte{}, nil
+	}
+
+	return nil, nil
+}
+
+// checkServer ensures credentials are only sent over TLS or to localhost, and to the expected host
+func checkServer(server *smtp.ServerInfo, host string) error {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return ErrUnencryptedConnection
+	}
+
+	if server.Name != host {
+		return ErrWrongHost
+	}
+
+	return nil
+}
+
+// isLocalhost reports whether the name refers to the local machine
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,50 @@
+package smtp
+
+import (
+	"net/smtp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginAuth(t *testing.T) {
+	auth := &loginAuth{username: "newman@usps.com", password: expectedPassword, host: "smtp.usps.com"}
+
+	mechanism, initial, err := auth.Start(&smtp.ServerInfo{Name: "smtp.usps.com", TLS: true})
+	require.NoError(t, err)
+	assert.Equal(t, LOGINAuth, mechanism)
+	assert.Nil(t, initial)
+
+	response, err := auth.Next([]byte("Username:"), true)
+	require.NoError(t, err)
+	assert.Equal(t, "newman@usps.com", string(response))
+
+	response, err = auth.Next([]byte("Password:"), true)
+	require.NoError(t, err)
+	assert.Equal(t, expectedPassword, string(response))
+
+	_, err = auth.Next([]byte("Favorite stamp:"), true)
+	require.ErrorIs(t, err, ErrUnexpectedServerChallenge)
+
+	_, _, err = auth.Start(&smtp.ServerInfo{Name: "smtp.usps.com"})
+	require.ErrorIs(t, err, ErrUnencryptedConnection)
+
+	_, _, err = auth.Start(&smtp.ServerInfo{Name: "smtp.fedex.com", TLS: true})
+	require.ErrorIs(t, err, ErrWrongHost)
+}
+
+func TestXOAuth2Auth(t *testing.T) {
+	auth := &xoauth2Auth{username: "newman@usps.com", token: "ya29.token", host: "localhost"}
+
+	mechanism, initial, err := auth.Start(&smtp.ServerInfo{Name: "localhost"})
+	require.NoError(t, err)
+	assert.Equal(t, XOAUTH2Auth, mechanism)
+	assert.Equal(t, "user=newman@usps.com\x01auth=Bearer ya29.token\x01\x01", string(initial))
+
+	// the error challenge is acknowledged with an empty response so the server can fail the exchange
+	response, err := auth.Next([]byte(`{"status":"401"}`), true)
+	require.NoError(t, err)
+	assert.Empty(t, response)
+	assert.NotNil(t, response)
+}
@@ -0,0 +1,62 @@
+package smtp
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+
+	"github.com/theopenlane/newman"
+)
+
+var (
+	// ErrEmptyBatch is returned when an empty batch is provided
+	ErrEmptyBatch = errors.New("batch must contain at least one message")
+	// ErrStartTLSNotSupported is returned when STARTTLS is required but the server does not offer it
+	ErrStartTLSNotSupported = errors.New("server does not support STARTTLS")
+	// ErrAuthNotSupported is returned when credentials are configured but the server does not offer AUTH
+	ErrAuthNotSupported = errors.New("server does not support AUTH")
+	// ErrUnencryptedConnection is returned when credentials would be sent over an unencrypted connection to a remote host
+	ErrUnencryptedConnection = errors.New("refusing to authenticate over an unencrypted connection")
+	// ErrWrongHost is returned when the server name does not match the host credentials are meant for
+	ErrWrongHost = errors.New("wrong host name")
+	// ErrUnexpectedServerChallenge is returned when the server sends a challenge the auth mechanism does not expect
+	ErrUnexpectedServerChallenge = errors.New("unexpected server challenge")
+	// ErrSenderClosed is returned when sending through a sender that has been closed
+	ErrSenderClosed = errors.New("smtp sender is closed")
+	// ErrSMTPUTF8NotSupported is returned when an address has a UTF-8 local part but the server does not offer SMTPUTF8
+	ErrSMTPUTF8NotSupported = errors.New("server does not support SMTPUTF8")
+)
+
+// ReplyError is an error reply from the SMTP server
+type ReplyError struct {
+	// Code is the three digit SMTP reply code
+	Code int
+	// Message is the text of the reply
+	Message string
+}
+
+// Error satisfies the error interface
+func (e *ReplyError) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+// Temporary reports whether the reply is a transient (4xx) failure that may succeed if retried
+func (e *ReplyError) Temporary() bool {
+	return e.Code >= 400 && e.Code < 500
+}
+
+// replyError converts an error reply from the server into a ReplyError, which is wrapped as a
+// retryable error when the reply is transient. Other errors are returned unchanged
+func replyError(err error) error {
+	var protoErr *textproto.Error
+	if !errors.As(err, &protoErr) {
+		return err
+	}
+
+	reply := &ReplyError{Code: protoErr.Code, Message: protoErr.Msg}
+	if reply.Temporary() {
+		return newman.NewRetryableError(reply)
+	}
+
+	return reply
+}
@@ -0,0 +1,97 @@
+package smtp
+
+import (
+	"net"
+	"net/smtp"
+	"sync"
+	"time"
+)
+
+// quitTimeout bounds how long closing a session waits for the server to acknowledge QUIT
+const quitTimeout = 5 * time.Second
+
+// session is an open, authenticated connection to the SMTP server
+type session struct {
+	conn     net.Conn
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+// close ends the session, sending QUIT when the connection is still usable
+func (s *session) close() {
+	if s.client == nil {
+		_ = s.conn.Close()
+		return
+	}
+
+	_ = s.conn.SetDeadline(time.Now().Add(quitTimeout))
+
+	if err := s.client.Quit(); err != nil {
+		_ = s.client.Close()
+	}
+}
+
+// pool keeps idle sessions so consecutive sends can skip the connect, TLS and AUTH round trips
+type pool struct {
+	mu          sync.Mutex
+	idle        []*session
+	size        int
+	idleTimeout time.Duration
+	closed      bool
+}
+
+// get returns the most recently used idle session, or nil when there is none. Sessions that have
+// been idle longer than the idle timeout are closed
+func (p *pool) get() *session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.idle) > 0 {
+		sess := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if p.idleTimeout > 0 && time.Since(sess.lastUsed) > p.idleTimeout {
+			go sess.close()
+			continue
+		}
+
+		return sess
+	}
+
+	return nil
+}
+
+// put returns a session to the pool, closing it when the pool is full or closed
+func (p *pool) put(sess *session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || len(p.idle) >= p.size {
+		go sess.close()
+		return
+	}
+
+	sess.lastUsed = time.Now()
+	p.idle = append(p.idle, sess)
+}
+
+// isClosed reports whether the pool has been closed
+func (p *pool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.closed
+}
+
+// close closes every idle session; sessions in use are closed when they are returned
+func (p *pool) close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	for _, sess := range idle {
+		sess.close()
+	}
+}
@@ -3,16 +3,41 @@ package smtp
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
 
 	"github.com/theopenlane/newman"
+	"github.com/theopenlane/newman/shared"
 )
 
 const (
 	defaultConnectionMethod = "IMPLICIT"
 	TLSConnection           = "TLS"
-	CRAMMD5Auth             = "CRAM-MD5"
+	// StartTLSConnection connects in plain text and requires the server to upgrade the connection with STARTTLS
+	StartTLSConnection = "STARTTLS"
+	CRAMMD5Auth        = "CRAM-MD5"
+	// LOGINAuth authenticates with the LOGIN mechanism
+	LOGINAuth = "LOGIN"
+	// XOAUTH2Auth authenticates with an OAuth2 access token, used by Gmail and Office 365
+	XOAUTH2Auth  = "XOAUTH2"
+	providerName = "smtp"
+	// localName is the name the sender introduces itself with in EHLO
+	localName = "localhost"
+
+	defaultPoolSize    = 2
+	defaultIdleTimeout = 30 * time.Second
+	defaultDialTimeout = 30 * time.Second
+	// defaultCommandTimeout and defaultDataTimeout follow the minimums suggested by RFC 5321 section 4.5.3.2
+	defaultCommandTimeout = 5 * time.Minute
+	defaultDataTimeout    = 10 * time.Minute
 )
 
 // smtpEmailSender is responsible for sending emails using SMTP
@@ -31,16 +56,113 @@ type smtpEmailSender struct {
 	connectionMethod string
 	// tlsConfig allows custom TLS configuration for testing
 	tlsConfig *tls.Config
+	// tokenSource provides access tokens for XOAUTH2, the password is used as the token when unset
+	tokenSource oauth2.TokenSource
+	// dialTimeout bounds connecting to the server, including the greeting, TLS and AUTH
+	dialTimeout time.Duration
+	// commandTimeout bounds each command exchange
+	commandTimeout time.Duration
+	// dataTimeout bounds sending the message content
+	dataTimeout time.Duration
+	// pool holds idle authenticated sessions for reuse
+	pool *pool
+	// mimeOptions are applied when building the MIME message
+	mimeOptions []newman.MimeOption
+	// messageIDDomain is the domain of generated Message-IDs, the domain of the sender when empty
+	messageIDDomain string
+}
+
+// Option is a type representing a function that modifies a smtpEmailSender
+type Option func(*smtpEmailSender)
+
+// WithTLSConfig sets the TLS configuration used for implicit TLS and STARTTLS
+func WithTLSConfig(config *tls.Config) Option {
+	return func(s *smtpEmailSender) {
+		s.tlsConfig = config
+	}
+}
+
+// WithOAuth2TokenSource sets the source of access tokens for XOAUTH2 authentication, so tokens
+// are refreshed as they expire
+func WithOAuth2TokenSource(tokenSource oauth2.TokenSource) Option {
+	return func(s *smtpEmailSender) {
+		s.tokenSource = tokenSource
+	}
+}
+
+// WithMessageIDDomain sets the domain of generated Message-IDs, which defaults to the domain of the sender
+func WithMessageIDDomain(domain string) Option {
+	return func(s *smtpEmailSender) {
+		s.messageIDDomain = domain
+	}
+}
+
+// WithDKIMSigner signs every message with a DKIM signature before it is sent
+func WithDKIMSigner(signer *newman.DKIMSigner) Option {
+	return func(s *smtpEmailSender) {
+		s.mimeOptions = append(s.mimeOptions, newman.WithDKIMSigner(signer))
+	}
+}
+
+// WithSMIME signs and encrypts every message with S/MIME before it is sent
+func WithSMIME(smime *newman.SMIME) Option {
+	return func(s *smtpEmailSender) {
+		s.mimeOptions = append(s.mimeOptions, newman.WithSMIME(smime))
+	}
+}
+
+// WithPGPMIME signs and encrypts every message with PGP/MIME before it is sent
+func WithPGPMIME(pgp *newman.PGPMIME) Option {
+	return func(s *smtpEmailSender) {
+		s.mimeOptions = append(s.mimeOptions, newman.WithPGPMIME(pgp))
+	}
+}
+
+// WithPoolSize sets how many idle sessions are kept open for reuse; zero closes every session
+// after use. It does not limit how many sessions are open at once
+func WithPoolSize(size int) Option {
+	return func(s *smtpEmailSender) {
+		s.pool.size = max(size, 0)
+	}
+}
+
+// WithIdleTimeout sets how long an idle session is kept before it is closed instead of reused
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(s *smtpEmailSender) {
+		s.pool.idleTimeout = timeout
+	}
+}
+
+// WithDialTimeout sets the time allowed to connect, including the greeting, TLS and AUTH
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(s *smtpEmailSender) {
+		s.dialTimeout = timeout
+	}
+}
+
+// WithCommandTimeout sets the time allowed for each command to be answered
+func WithCommandTimeout(timeout time.Duration) Option {
+	return func(s *smtpEmailSender) {
+		s.commandTimeout = timeout
+	}
+}
+
+// WithDataTimeout sets the time allowed to send the message content and receive the reply
+func WithDataTimeout(timeout time.Duration) Option {
+	return func(s *smtpEmailSender) {
+		s.dataTimeout = timeout
+	}
 }
 
 // New creates a new instance of smtpEmailSender
-func New(host string, port int, user, password string, authMethod string) (newman.EmailSender, error) {
-	return NewWithConnMethod(host, port, user, password, authMethod, defaultConnectionMethod)
+func New(host string, port int, user, password string, authMethod string, opts ...Option) (newman.EmailSender, error) {
+	return NewWithConnMethod(host, port, user, password, authMethod, defaultConnectionMethod, opts...)
 }
 
-// NewWithConnMethod creates a new instance of smtpEmailSender with the specified connection method
-func NewWithConnMethod(host string, port int, user, password string, authMethod string, connectionMethod string) (newman.EmailSender, error) {
-	return &smtpEmailSender{
+// NewWithConnMethod creates a new instance of smtpEmailSender with the specified connection method.
+// The sender keeps idle sessions open for reuse; it implements io.Closer to close them
+func NewWithConnMethod(host string, port int, user, password string, authMethod string, connectionMethod string, opts ...Option) (newman.EmailSender, error) {
+	s := &smtpEmailSender{
 		host:             host,
 		port:             port,
 		user:             user,
@@ -48,7 +170,27 @@ func NewWithConnMethod(host string, port int, user, password string, authMethod
 		authMethod:       authMethod,
 		connectionMethod: connectionMethod,
 		tlsConfig:        nil,
-	}, nil
+		dialTimeout:      defaultDialTimeout,
+		commandTimeout:   defaultCommandTimeout,
+		dataTimeout:      defaultDataTimeout,
+		pool: &pool{
+			size:        defaultPoolSize,
+			idleTimeout: defaultIdleTimeout,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// Close closes the idle sessions held by the sender; sessions in use are closed when their send completes
+func (s *smtpEmailSender) Close() error {
+	s.pool.close()
+
+	return nil
 }
 
 // SendEmail satisfies the EmailSender interface
@@ -57,93 +199,447 @@ func (s *smtpEmailSender) SendEmail(message *newman.EmailMessage) error {
 }
 
 // SendBatchEmail satisfies the EmailSender interface
-func (s *smtpEmailSender) SendBatchEmail(_ []*newman.EmailMessage) error {
-	return newman.ErrBatchNotImplemented
+func (s *smtpEmailSender) SendBatchEmail(messages []*newman.EmailMessage) error {
+	return s.SendBatchEmailWithContext(context.Background(), messages)
 }
 
 // SendBatchEmailWithContext satisfies the EmailSender interface
-func (s *smtpEmailSender) SendBatchEmailWithContext(_ context.Context, _ []*newman.EmailMessage) error {
-	return newman.ErrBatchNotImplemented
+func (s *smtpEmailSender) SendBatchEmailWithContext(ctx context.Context, messages []*newman.EmailMessage) error {
+	result, err := s.SendBatchEmailWithResult(ctx, messages)
+	if err != nil {
+		return err
+	}
+
+	return result.Err()
+}
+
+// SendBatchEmailWithResult satisfies the newman.BatchResultSender interface. The messages are sent
+// in order over a single session, with the transaction reset between messages so a rejected
+// message does not affect the rest
+func (s *smtpEmailSender) SendBatchEmailWithResult(ctx context.Context, messages []*newman.EmailMessage) (*newman.BatchResult, error) {
+	if len(messages) == 0 {
+		return nil, ErrEmptyBatch
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	result := newman.NewBatchResult(providerName, len(messages))
+
+	var sess *session
+
+	for i, message := range messages {
+		if err := ctx.Err(); err != nil {
+			for j := i; j < len(messages); j++ {
+				result.SetSkipped(j, err)
+			}
+
+			break
+		}
+
+		if err := shared.ValidateEmailMessage(message); err != nil {
+			result.SetFailed(i, err)
+			continue
+		}
+
+		if err := newman.ValidateMimeMessage(message); err != nil {
+			result.SetFailed(i, err)
+			continue
+		}
+
+		message, err := message.ApplyAttachmentPolicy()
+		if err != nil {
+			result.SetFailed(i, err)
+			continue
+		}
+
+		message = s.withMessageID(message)
+
+		if sess == nil {
+			if sess, err = s.session(ctx); err != nil {
+				result.SetFailed(i, replyError(err))
+				continue
+			}
+		}
+
+		err = s.deliver(ctx, sess, message)
+		if err == nil {
+			result.SetSent(i, message.MessageID)
+		} else {
+			result.SetFailed(i, replyError(err))
+		}
+
+		if !s.reset(ctx, sess, err) {
+			sess = nil
+		}
+	}
+
+	if sess != nil {
+		s.pool.put(sess)
+	}
+
+	return result, nil
+}
+
+// ProviderName satisfies the newman.ProviderNamer interface
+func (s *smtpEmailSender) ProviderName() string {
+	return providerName
 }
 
 // SendEmailWithContext satisfies the EmailSender interface
 func (s *smtpEmailSender) SendEmailWithContext(ctx context.Context, message *newman.EmailMessage) error {
+	_, err := s.SendEmailWithResult(ctx, message)
+
+	return err
+}
+
+// SendEmailWithResult satisfies the newman.ResultSender interface
+func (s *smtpEmailSender) SendEmailWithResult(ctx context.Context, message *newman.EmailMessage) (*newman.SendResult, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
-	sendMailTo := message.GetTo()
-	sendMailTo = append(sendMailTo, message.GetCC()...)
-	sendMailTo = append(sendMailTo, message.GetBCC()...)
+	if err := shared.ValidateEmailMessage(message); err != nil {
+		return nil, err
+	}
+
+	if err := newman.ValidateMimeMessage(message); err != nil {
+		return nil, err
+	}
+
+	message, err := message.ApplyAttachmentPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	message = s.withMessageID(message)
 
-	msg, err := newman.BuildMimeMessage(message)
+	sess, err := s.session(ctx)
 	if err != nil {
-		return err
+		return nil, replyError(err)
 	}
 
-	auth := smtp.PlainAuth("", s.user, s.password, s.host)
-	if s.authMethod == CRAMMD5Auth {
-		auth = smtp.CRAMMD5Auth(s.user, s.password)
+	err = s.deliver(ctx, sess, message)
+
+	if s.reset(ctx, sess, err) {
+		s.pool.put(sess)
 	}
 
-	if s.connectionMethod == TLSConnection {
-		return s.secureSend(ctx, auth, message.GetFrom(), sendMailTo, msg)
+	if err != nil {
+		return nil, replyError(err)
 	}
 
-	return s.send(auth, message.GetFrom(), sendMailTo, msg)
+	return newman.NewSendResult(providerName, message.MessageID, message), nil
 }
 
-func (s *smtpEmailSender) send(auth smtp.Auth, from string, to []string, message []byte) error {
-	return smtp.SendMail(fmt.Sprintf("%s:%d", s.host, s.port), auth, from, to, message)
+// withMessageID returns the message with a Message-ID, generating one on a copy when it has none so the
+// ID written in the header is the one reported in the result
+func (s *smtpEmailSender) withMessageID(message *newman.EmailMessage) *newman.EmailMessage {
+	if strings.TrimSpace(message.MessageID) != "" {
+		return message
+	}
+
+	domain := s.messageIDDomain
+	if domain == "" {
+		from := message.GetFrom()
+		domain = from[strings.LastIndex(from, "@")+1:]
+	}
+
+	withID := *message
+	withID.MessageID = shared.NewMessageID(domain)
+
+	return &withID
 }
 
-func (s *smtpEmailSender) secureSend(ctx context.Context, auth smtp.Auth, from string, to []string, message []byte) error {
-	tlsConfig := s.tlsConfig
-	if tlsConfig == nil {
-		tlsConfig = &tls.Config{
-			ServerName: s.host,
-			MinVersion: tls.VersionTLS12,
+// session returns an idle session from the pool, or connects a new one. Idle sessions are checked with
+// NOOP first, since the server may have closed the connection while it was in the pool
+func (s *smtpEmailSender) session(ctx context.Context) (*session, error) {
+	if s.pool.isClosed() {
+		return nil, ErrSenderClosed
+	}
+
+	for sess := s.pool.get(); sess != nil; sess = s.pool.get() {
+		err := s.exchange(ctx, sess.conn, s.commandTimeout, sess.client.Noop)
+		if err == nil {
+			return sess, nil
+		}
+
+		sess.close()
+
+		if ctx.Err() != nil {
+			return nil, err
 		}
 	}
 
-	dialer := tls.Dialer{Config: tlsConfig}
+	return s.dial(ctx)
+}
+
+// dial connects to the server and prepares a session, upgrading the connection with STARTTLS and
+// authenticating as configured
+func (s *smtpEmailSender) dial(ctx context.Context) (*session, error) {
+	dialCtx := ctx
+
+	if s.dialTimeout > 0 {
+		var cancel context.CancelFunc
+
+		dialCtx, cancel = context.WithTimeout(ctx, s.dialTimeout)
+		defer cancel()
+	}
+
+	var (
+		conn net.Conn
+		err  error
+		addr = net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	)
+
+	if s.connectionMethod == TLSConnection {
+		conn, err = (&tls.Dialer{Config: s.tls()}).DialContext(dialCtx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(dialCtx, "tcp", addr)
+	}
 
-	conn, err := dialer.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", s.host, s.port))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	client, err := smtp.NewClient(conn, s.host)
+	sess := &session{conn: conn}
+
+	err = s.exchange(dialCtx, conn, s.dialTimeout, func() error {
+		client, err := smtp.NewClient(conn, s.host)
+		if err != nil {
+			return err
+		}
+
+		sess.client = client
+
+		return s.handshake(client)
+	})
 	if err != nil {
+		sess.close()
+
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// handshake greets the server, upgrades the connection with STARTTLS when required or offered,
+// then authenticates
+func (s *smtpEmailSender) handshake(client *smtp.Client) error {
+	if err := client.Hello(localName); err != nil {
 		return err
 	}
 
-	if err = client.Auth(auth); err != nil {
+	if s.connectionMethod != TLSConnection {
+		switch ok, _ := client.Extension("STARTTLS"); {
+		case ok:
+			if err := client.StartTLS(s.tls()); err != nil {
+				return err
+			}
+		case s.connectionMethod == StartTLSConnection:
+			return ErrStartTLSNotSupported
+		}
+	}
+
+	auth, err := s.auth()
+	if err != nil || auth == nil {
 		return err
 	}
 
-	if err = client.Mail(from); err != nil {
+	if ok, _ := client.Extension("AUTH"); !ok {
+		return ErrAuthNotSupported
+	}
+
+	return client.Auth(auth)
+}
+
+// auth returns the configured authentication mechanism, or nil when no credentials are set
+func (s *smtpEmailSender) auth() (smtp.Auth, error) {
+	switch s.authMethod {
+	case XOAUTH2Auth:
+		token := s.password
+
+		if s.tokenSource != nil {
+			t, err := s.tokenSource.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			token = t.AccessToken
+		}
+
+		return &xoauth2Auth{username: s.user, token: token, host: s.host}, nil
+	case CRAMMD5Auth:
+		if s.user == "" {
+			return nil, nil
+		}
+
+		return smtp.CRAMMD5Auth(s.user, s.password), nil
+	case LOGINAuth:
+		if s.user == "" {
+			return nil, nil
+		}
+
+		return &loginAuth{username: s.user, password: s.password, host: s.host}, nil
+	default:
+		if s.user == "" {
+			return nil, nil
+		}
+
+		return smtp.PlainAuth("", s.user, s.password, s.host), nil
+	}
+}
+
+// deliver sends one message over the session, streaming the MIME message into the DATA command. When
+// writing the message fails part way, DATA is left unterminated so the server discards the partial
+// message once the session is closed
+func (s *smtpEmailSender) deliver(ctx context.Context, sess *session, message *newman.EmailMessage) error {
+	from, to, err := envelope(sess.client, message)
+	if err != nil {
 		return err
 	}
 
-	for _, addr := range to {
-		if err = client.Rcpt(addr); err != nil {
+	err = s.exchange(ctx, sess.conn, s.commandTimeout, func() error {
+		if err := sess.client.Mail(from); err != nil {
 			return err
 		}
-	}
 
-	w, err := client.Data()
+		for _, addr := range to {
+			if err := sess.client.Rcpt(addr); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	if _, err = w.Write(message); err != nil {
+	return s.exchange(ctx, sess.conn, s.dataTimeout, func() error {
+		w, err := sess.client.Data()
+		if err != nil {
+			return err
+		}
+
+		if err := newman.WriteMimeMessage(w, message, s.mimeOptions...); err != nil {
+			// any further command would be read as message data, so drop the connection instead
+			_ = sess.conn.Close()
+
+			return err
+		}
+
+		return w.Close()
+	})
+}
+
+// reset ends the transaction on the session with RSET so it can carry the next message. It reports
+// whether the session is still usable; a session that failed with anything other than an error
+// reply from the server or an envelope the server cannot take, or that could not be reset, is closed
+func (s *smtpEmailSender) reset(ctx context.Context, sess *session, sendErr error) bool {
+	var protoErr *textproto.Error
+	if sendErr != nil && !errors.As(sendErr, &protoErr) && !errors.Is(sendErr, ErrSMTPUTF8NotSupported) {
+		sess.close()
+		return false
+	}
+
+	if err := s.exchange(ctx, sess.conn, s.commandTimeout, sess.client.Reset); err != nil {
+		sess.close()
+		return false
+	}
+
+	return true
+}
+
+// exchange runs fn with the connection deadline set from the timeout and the context deadline,
+// interrupting any blocked read or write when the context is canceled
+func (s *smtpEmailSender) exchange(ctx context.Context, conn net.Conn, timeout time.Duration, fn func() error) error {
+	var deadline time.Time
+
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	ctxDeadline, hasCtxDeadline := ctx.Deadline()
+	if hasCtxDeadline && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+
+	if err := conn.SetDeadline(deadline); err != nil {
 		return err
 	}
 
-	if err = w.Close(); err != nil {
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+
+	err := fn()
+
+	stop()
+
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return fmt.Errorf("%w: %w", context.Cause(ctx), err)
+	case hasCtxDeadline && !time.Now().Before(ctxDeadline):
+		// the connection deadline can fire just before the context reports it is done
+		return fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	default:
 		return err
 	}
+}
+
+// tls returns the TLS configuration for the server
+func (s *smtpEmailSender) tls() *tls.Config {
+	if s.tlsConfig != nil {
+		return s.tlsConfig
+	}
+
+	return &tls.Config{
+		ServerName: s.host,
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// envelope returns the envelope sender and recipients of the message. Servers that offer SMTPUTF8 take
+// the addresses as they are, with net/smtp adding the SMTPUTF8 parameter to MAIL FROM. Other servers
+// are sent internationalized domain names as punycode and cannot take addresses with a UTF-8 local part
+func envelope(client *smtp.Client, message *newman.EmailMessage) (string, []string, error) {
+	from, to := message.GetFrom(), recipients(message)
+
+	if ok, _ := client.Extension("SMTPUTF8"); ok {
+		return from, to, nil
+	}
+
+	ascii := func(address string) (string, error) {
+		converted := newman.NewAddress("", address).ToASCII()
+		if !converted.IsASCII() {
+			return "", fmt.Errorf("%w: %s", ErrSMTPUTF8NotSupported, address)
+		}
+
+		return converted.Address, nil
+	}
+
+	from, err := ascii(from)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for i, address := range to {
+		if to[i], err = ascii(address); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return from, to, nil
+}
+
+// recipients returns every envelope recipient of the message
+func recipients(message *newman.EmailMessage) []string {
+	to := message.GetTo()
+	to = append(to, message.GetCC()...)
 
-	return client.Quit()
+	return append(to, message.GetBCC()...)
 }
@@ -1,16 +1,34 @@
 package smtp
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math/big"
 	"net"
+	"net/textproto"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
 
 	"github.com/theopenlane/newman"
 )
@@ -109,6 +127,9 @@ func smtpHandler(conn net.Conn) {
 
 			fmt.Fprintln(conn, "250 OK")
 
+		case strings.HasPrefix(cmd, "RSET"):
+			fmt.Fprintln(conn, "250 OK")
+
 		case strings.HasPrefix(cmd, "QUIT"):
 			fmt.Fprintln(conn, "221 Bye")
 			conn.Close()
@@ -156,20 +177,17 @@ func decodeConnectionCommand(cmd, message string) []string {
 }
 
 // newTestSMTPSender creates an SMTP sender with InsecureSkipVerify for testing
-func newTestSMTPSender(host string, port int, user, password, authMethod, connMethod string) *smtpEmailSender {
-	return &smtpEmailSender{
-		host:             host,
-		port:             port,
-		user:             user,
-		password:         password,
-		authMethod:       authMethod,
-		connectionMethod: connMethod,
-		tlsConfig: &tls.Config{
-			InsecureSkipVerify: true,
-			MinVersion:         tls.VersionTLS12,
-		},
-	}
+func newTestSMTPSender(host string, port int, user, password, authMethod, connMethod string, opts ...Option) *smtpEmailSender {
+	opts = append([]Option{WithTLSConfig(&tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+	})}, opts...)
+
+	sender, _ := NewWithConnMethod(host, port, user, password, authMethod, connMethod, opts...)
+
+	return sender.(*smtpEmailSender)
 }
+
 func TestNewSMTPEmailSender(t *testing.T) {
 	emailSender, err := New("smtp.example.com", 587, "user", "We gotta find that rickshaw", "PLAIN")
 	assert.NoError(t, err)
@@ -197,6 +215,29 @@ func TestSendEmailPlainAuth(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSendEmailWithResult(t *testing.T) {
+	server := newMockSMTPServer(t, smtpHandler)
+	defer server.Close()
+
+	host, port, _ := net.SplitHostPort(server.addr)
+	portInt := 25 // nolint: mnd
+
+	_, err := fmt.Sscanf(port, "%d", &portInt)
+	require.NoError(t, err)
+
+	emailSender := newTestSMTPSender(host, portInt, "user", "We gotta find that rickshaw", "PLAIN", "")
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "The air is so dewy sweet you dont even have to lick the stamps").
+		SetBCC([]string{"kramer@seinfeld.com", "not-an-email"})
+
+	result, err := emailSender.SendEmailWithResult(context.Background(), message)
+	require.NoError(t, err)
+
+	assert.Equal(t, "smtp", result.Provider)
+	assert.Equal(t, []string{"jerry@seinfeld.com", "kramer@seinfeld.com"}, result.Accepted)
+	assert.Equal(t, []string{"not-an-email"}, result.Rejected)
+}
+
 func TestSendEmailCramMD5Auth(t *testing.T) {
 	server := newMockSMTPServer(t, smtpHandler)
 	defer server.Close()
@@ -713,6 +754,436 @@ func TestSendTLSEmailDataWriteError(t *testing.T) {
 	assert.Equal(t, "552 Message size exceeds fixed limit", err.Error())
 }
 
+// scriptedServer is a line based mock SMTP server that records every command it receives, for tests
+// where a session carries several messages
+type scriptedServer struct {
+	*mockSMTPServer
+	// extensions are advertised in reply to EHLO
+	extensions []string
+	// reply overrides the reply to a command; returning "" uses the default reply, "-" sends no reply and
+	// a reply starting with "!" is sent without the "!" before the connection is closed
+	reply func(cmd string) string
+
+	mu       sync.Mutex
+	conns    int
+	commands []string
+	auth     []string
+	data     [][]byte
+}
+
+// newScriptedServer starts a scriptedServer and returns it with its host and port
+func newScriptedServer(t *testing.T, extensions []string, reply func(cmd string) string) (*scriptedServer, string, int) {
+	server := &scriptedServer{extensions: extensions, reply: reply}
+	server.mockSMTPServer = newMockSMTPServer(t, server.handle)
+
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.addr)
+	require.NoError(t, err)
+
+	portInt, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	return server, host, portInt
+}
+
+// handle serves a single connection
+func (s *scriptedServer) handle(conn net.Conn) {
+	s.mu.Lock()
+	s.conns++
+	s.mu.Unlock()
+
+	tp := textproto.NewConn(conn)
+	defer tp.Close()
+
+	_ = tp.PrintfLine("220 Welcome to the Mock SMTP Server")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		if s.reply != nil {
+			if reply := s.reply(line); reply == "-" {
+				continue
+			} else if drop, ok := strings.CutPrefix(reply, "!"); ok {
+				_ = tp.PrintfLine("%s", drop)
+				return
+			} else if reply != "" {
+				_ = tp.PrintfLine("%s", reply)
+				continue
+			}
+		}
+
+		fields := strings.Fields(line)
+
+		switch strings.ToUpper(fields[0]) {
+		case "EHLO":
+			_ = tp.PrintfLine("250-Hello")
+
+			for _, ext := range s.extensions {
+				_ = tp.PrintfLine("250-%s", ext)
+			}
+
+			_ = tp.PrintfLine("250 8BITMIME")
+		case "STARTTLS":
+			_ = tp.PrintfLine("220 Ready to start TLS")
+
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{generateKeys()}, MinVersion: tls.VersionTLS12})
+			if tlsConn.Handshake() != nil {
+				return
+			}
+
+			tp = textproto.NewConn(tlsConn)
+		case "AUTH":
+			s.authenticate(tp, fields)
+		case "DATA":
+			_ = tp.PrintfLine("354 Start mail input; end with <CRLF>.<CRLF>")
+
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			s.data = append(s.data, data)
+			s.mu.Unlock()
+
+			_ = tp.PrintfLine("250 OK: queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 Bye")
+			return
+		default:
+			_ = tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+// authenticate records the credentials of an AUTH exchange and accepts them
+func (s *scriptedServer) authenticate(tp *textproto.Conn, fields []string) {
+	decode := func(value string) string {
+		decoded, _ := base64.StdEncoding.DecodeString(value)
+		return string(decoded)
+	}
+
+	var credentials string
+
+	switch strings.ToUpper(fields[1]) {
+	case "LOGIN":
+		_ = tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+		user, _ := tp.ReadLine()
+
+		_ = tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+		password, _ := tp.ReadLine()
+
+		credentials = "LOGIN " + decode(user) + " " + decode(password)
+	default:
+		credentials = fields[1] + " " + decode(fields[len(fields)-1])
+	}
+
+	s.mu.Lock()
+	s.auth = append(s.auth, credentials)
+	s.mu.Unlock()
+
+	_ = tp.PrintfLine("235 Authentication successful")
+}
+
+// connections returns the number of connections the server accepted
+func (s *scriptedServer) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conns
+}
+
+// received returns the commands received so far that start with prefix
+func (s *scriptedServer) received(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var commands []string
+
+	for _, cmd := range s.commands {
+		if strings.HasPrefix(cmd, prefix) {
+			commands = append(commands, cmd)
+		}
+	}
+
+	return commands
+}
+
+// messages returns the message data of every completed DATA command
+func (s *scriptedServer) messages() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([][]byte(nil), s.data...)
+}
+
+// credentials returns the credentials of every AUTH exchange
+func (s *scriptedServer) credentials() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.auth...)
+}
+
+func newTestMessage(to ...string) *newman.EmailMessage {
+	return newman.NewEmailMessage("newman@usps.com", to, "Test Email", "The air is so dewy sweet you dont even have to lick the stamps")
+}
+
+func TestSendEmailReusesSession(t *testing.T) {
+	server, host, port := newScriptedServer(t, []string{"AUTH PLAIN"}, nil)
+
+	emailSender := newTestSMTPSender(host, port, "user", expectedPassword, "PLAIN", "")
+
+	require.NoError(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com")))
+	require.NoError(t, emailSender.SendEmail(newTestMessage("george@seinfeld.com")))
+
+	assert.Equal(t, 1, server.connections())
+	assert.Len(t, server.credentials(), 1)
+	assert.Len(t, server.received("MAIL FROM"), 2)
+	assert.Len(t, server.received("RSET"), 2)
+
+	require.NoError(t, emailSender.Close())
+	assert.Eventually(t, func() bool { return len(server.received("QUIT")) == 1 }, time.Second, 10*time.Millisecond)
+
+	require.ErrorIs(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com")), ErrSenderClosed)
+}
+
+func TestSendEmailRedialsDroppedSession(t *testing.T) {
+	var resets atomic.Int32
+
+	// the server closes the first connection once the message is done, while it sits idle in the pool
+	server, host, port := newScriptedServer(t, nil, func(cmd string) string {
+		if cmd == "RSET" && resets.Add(1) == 1 {
+			return "!250 OK"
+		}
+
+		return ""
+	})
+
+	emailSender := newTestSMTPSender(host, port, "", "", "", "")
+
+	require.NoError(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com")))
+	require.NoError(t, emailSender.SendEmail(newTestMessage("george@seinfeld.com")))
+
+	assert.Equal(t, 2, server.connections())
+	assert.Len(t, server.messages(), 2)
+
+	// the session that was kept is checked and reused
+	require.NoError(t, emailSender.SendEmail(newTestMessage("elaine@seinfeld.com")))
+	assert.Equal(t, 2, server.connections())
+	assert.Len(t, server.received("NOOP"), 1)
+}
+
+func TestSendEmailWithoutPool(t *testing.T) {
+	server, host, port := newScriptedServer(t, []string{"AUTH PLAIN"}, nil)
+
+	emailSender := newTestSMTPSender(host, port, "user", expectedPassword, "PLAIN", "", WithPoolSize(0))
+
+	require.NoError(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com")))
+	require.NoError(t, emailSender.SendEmail(newTestMessage("george@seinfeld.com")))
+
+	assert.Equal(t, 2, server.connections())
+}
+
+func TestSendEmailWithoutCredentials(t *testing.T) {
+	server, host, port := newScriptedServer(t, nil, nil)
+
+	emailSender := newTestSMTPSender(host, port, "", "", "", "")
+
+	require.NoError(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com")))
+	assert.Empty(t, server.credentials())
+}
+
+func TestSendEmailAuthNotSupported(t *testing.T) {
+	_, host, port := newScriptedServer(t, nil, nil)
+
+	emailSender := newTestSMTPSender(host, port, "user", expectedPassword, "PLAIN", "")
+
+	require.ErrorIs(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com")), ErrAuthNotSupported)
+}
+
+func TestSendEmailTemporaryFailureIsRetryable(t *testing.T) {
+	_, host, port := newScriptedServer(t, nil, func(cmd string) string {
+		if strings.HasPrefix(cmd, "RCPT TO") {
+			return "451 Try again later"
+		}
+
+		return ""
+	})
+
+	emailSender := newTestSMTPSender(host, port, "", "", "", "")
+
+	err := emailSender.SendEmail(newTestMessage("jerry@seinfeld.com"))
+
+	var reply *ReplyError
+	require.ErrorAs(t, err, &reply)
+	assert.Equal(t, 451, reply.Code)
+	assert.True(t, newman.IsRetryableError(err))
+}
+
+func TestSendBatchEmailWithResult(t *testing.T) {
+	server, host, port := newScriptedServer(t, []string{"AUTH PLAIN"}, func(cmd string) string {
+		if cmd == "RCPT TO:<kramer@seinfeld.com>" {
+			return "550 No such user"
+		}
+
+		return ""
+	})
+
+	emailSender := newTestSMTPSender(host, port, "user", expectedPassword, "PLAIN", "")
+
+	messages := []*newman.EmailMessage{
+		newTestMessage("jerry@seinfeld.com"),
+		newTestMessage("kramer@seinfeld.com"),
+		newTestMessage("not-an-email"),
+		newTestMessage("george@seinfeld.com"),
+	}
+
+	result, err := emailSender.SendBatchEmailWithResult(context.Background(), messages)
+	require.NoError(t, err)
+
+	assert.Equal(t, newman.BatchStatusSent, result.Items[0].Status)
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[1].Status)
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[2].Status)
+	assert.Equal(t, newman.BatchStatusSent, result.Items[3].Status)
+
+	var reply *ReplyError
+	require.ErrorAs(t, result.Items[1].Err, &reply)
+	assert.Equal(t, 550, reply.Code)
+
+	// every message went over one session, reset after each transaction
+	assert.Equal(t, 1, server.connections())
+	assert.Len(t, server.credentials(), 1)
+	assert.Len(t, server.received("MAIL FROM"), 3)
+	assert.Len(t, server.received("RSET"), 3)
+
+	require.ErrorIs(t, emailSender.SendBatchEmail(messages), newman.ErrBatchIncomplete)
+
+	_, err = emailSender.SendBatchEmailWithResult(context.Background(), nil)
+	require.ErrorIs(t, err, ErrEmptyBatch)
+}
+
+func TestSendEmailWithResultMessageID(t *testing.T) {
+	server, host, port := newScriptedServer(t, []string{"AUTH PLAIN"}, nil)
+
+	emailSender := newTestSMTPSender(host, port, "user", expectedPassword, "PLAIN", "", WithMessageIDDomain("mail.usps.com"))
+
+	message := newTestMessage("jerry@seinfeld.com")
+
+	result, err := emailSender.SendEmailWithResult(context.Background(), message)
+	require.NoError(t, err)
+
+	// the generated Message-ID is the one written in the header, and the caller's message is left alone
+	assert.Regexp(t, `^<[0-9a-f]+@mail\.usps\.com>$`, result.MessageID)
+	assert.Contains(t, string(server.messages()[0]), "Message-ID: "+result.MessageID+"\n")
+	assert.Empty(t, message.MessageID)
+
+	result, err = emailSender.SendEmailWithResult(context.Background(), newTestMessage("george@seinfeld.com").SetMessageID("<hello@usps.com>"))
+	require.NoError(t, err)
+	assert.Equal(t, "<hello@usps.com>", result.MessageID)
+
+	batch, err := emailSender.SendBatchEmailWithResult(context.Background(), []*newman.EmailMessage{
+		newTestMessage("jerry@seinfeld.com"),
+		newTestMessage("george@seinfeld.com"),
+	})
+	require.NoError(t, err)
+	require.Len(t, server.messages(), 4)
+
+	for i, item := range batch.Items {
+		assert.Contains(t, string(server.messages()[i+2]), "Message-ID: "+item.MessageID+"\n")
+	}
+
+	assert.NotEqual(t, batch.Items[0].MessageID, batch.Items[1].MessageID)
+}
+
+func TestSendBatchEmailCanceled(t *testing.T) {
+	_, host, port := newScriptedServer(t, nil, nil)
+
+	emailSender := newTestSMTPSender(host, port, "", "", "", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := emailSender.SendBatchEmailWithResult(ctx, []*newman.EmailMessage{newTestMessage("jerry@seinfeld.com")})
+	require.NoError(t, err)
+	assert.Equal(t, newman.BatchStatusSkipped, result.Items[0].Status)
+	require.ErrorIs(t, result.Items[0].Err, context.Canceled)
+}
+
+func TestSendEmailStartTLSRequired(t *testing.T) {
+	_, host, port := newScriptedServer(t, []string{"AUTH PLAIN"}, nil)
+
+	emailSender := newTestSMTPSender(host, port, "user", expectedPassword, "PLAIN", StartTLSConnection)
+
+	require.ErrorIs(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com")), ErrStartTLSNotSupported)
+}
+
+func TestSendEmailStartTLSLoginAuth(t *testing.T) {
+	server, host, port := newScriptedServer(t, []string{"STARTTLS", "AUTH LOGIN"}, nil)
+
+	emailSender := newTestSMTPSender(host, port, "newman@usps.com", expectedPassword, LOGINAuth, StartTLSConnection)
+
+	require.NoError(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com")))
+
+	assert.Len(t, server.received("STARTTLS"), 1)
+	assert.Equal(t, []string{"LOGIN newman@usps.com " + expectedPassword}, server.credentials())
+}
+
+func TestSendEmailXOAuth2(t *testing.T) {
+	server, host, port := newScriptedServer(t, []string{"STARTTLS", "AUTH XOAUTH2"}, nil)
+
+	emailSender := newTestSMTPSender(host, port, "newman@usps.com", "", XOAUTH2Auth, StartTLSConnection,
+		WithOAuth2TokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "ya29.token"})))
+
+	require.NoError(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com")))
+
+	assert.Equal(t, []string{"XOAUTH2 user=newman@usps.com\x01auth=Bearer ya29.token\x01\x01"}, server.credentials())
+}
+
+func TestSendEmailContextDeadline(t *testing.T) {
+	_, host, port := newScriptedServer(t, nil, func(cmd string) string {
+		if strings.HasPrefix(cmd, "MAIL FROM") {
+			return "-"
+		}
+
+		return ""
+	})
+
+	emailSender := newTestSMTPSender(host, port, "", "", "", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := emailSender.SendEmailWithContext(ctx, newTestMessage("jerry@seinfeld.com"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestSendEmailCommandTimeout(t *testing.T) {
+	_, host, port := newScriptedServer(t, nil, func(cmd string) string {
+		if strings.HasPrefix(cmd, "RCPT TO") {
+			return "-"
+		}
+
+		return ""
+	})
+
+	emailSender := newTestSMTPSender(host, port, "", "", "", "", WithCommandTimeout(50*time.Millisecond))
+
+	err := emailSender.SendEmail(newTestMessage("jerry@seinfeld.com"))
+
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr))
+	assert.True(t, netErr.Timeout())
+}
+
 func generateKeys() tls.Certificate {
 	cert, err := tls.X509KeyPair([]byte(ecdsaCertPEM), []byte(ecdsaKeyPEM))
 	if err != nil {
@@ -752,3 +1223,139 @@ VQldyCXTXGgu7OC0AQCC/Y/+ODK3NFKlRi+AsG3VQDSV4tgHLqZBBus0S6pPcg1q
 kohxS/xfFg/TEwRSSws+roJr4JFKpO2t3/be5OdqmQ==
 -----END EC TESTING KEY-----
 `)
+
+func TestSendEmailStreamsAttachments(t *testing.T) {
+	server, host, port := newScriptedServer(t, nil, nil)
+
+	content := bytes.Repeat([]byte("When you control the mail, you control information. "), 20000)
+
+	fsys := fstest.MapFS{"routes/route-42.txt": &fstest.MapFile{Data: content}}
+
+	attachment, err := newman.NewAttachmentFromFS(fsys, "routes/route-42.txt")
+	require.NoError(t, err)
+
+	emailSender := newTestSMTPSender(host, port, "", "", "", "")
+
+	require.NoError(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com").AddAttachment(attachment)))
+
+	messages := server.messages()
+	require.Len(t, messages, 1)
+
+	parsed, err := newman.ParseMimeMessage(bytes.NewReader(messages[0]))
+	require.NoError(t, err)
+	require.Len(t, parsed.Attachments, 1)
+	assert.Equal(t, "route-42.txt", parsed.Attachments[0].GetFilename())
+	assert.Equal(t, content, parsed.Attachments[0].GetRawContent())
+}
+
+func TestSendEmailAttachmentReadError(t *testing.T) {
+	server, host, port := newScriptedServer(t, nil, nil)
+
+	readErr := errors.New("disk on fire")
+	reader := io.MultiReader(bytes.NewReader(bytes.Repeat([]byte("route"), 10000)), iotest.ErrReader(readErr))
+
+	emailSender := newTestSMTPSender(host, port, "", "", "", "")
+
+	err := emailSender.SendEmail(newTestMessage("jerry@seinfeld.com").AddAttachment(newman.NewAttachmentFromReader("route.txt", reader)))
+	require.ErrorIs(t, err, readErr)
+
+	// the partial message was never terminated, and the session was not reused
+	require.NoError(t, emailSender.SendEmail(newTestMessage("george@seinfeld.com")))
+	assert.Len(t, server.messages(), 1)
+	assert.Equal(t, 2, server.connections())
+}
+
+func TestSendEmailSMTPUTF8(t *testing.T) {
+	server, host, port := newScriptedServer(t, []string{"SMTPUTF8"}, nil)
+
+	emailSender := newTestSMTPSender(host, port, "", "", "", "")
+
+	require.NoError(t, emailSender.SendEmail(newTestMessage("用户@例子.广告")))
+
+	assert.Equal(t, []string{"MAIL FROM:<newman@usps.com> BODY=8BITMIME SMTPUTF8"}, server.received("MAIL FROM"))
+	assert.Equal(t, []string{"RCPT TO:<用户@例子.广告>"}, server.received("RCPT TO"))
+}
+
+func TestSendEmailWithoutSMTPUTF8(t *testing.T) {
+	server, host, port := newScriptedServer(t, nil, nil)
+
+	emailSender := newTestSMTPSender(host, port, "", "", "", "")
+
+	// internationalized domain names are sent as punycode
+	require.NoError(t, emailSender.SendEmail(newTestMessage("kramer@café.fr")))
+	assert.Equal(t, []string{"RCPT TO:<kramer@xn--caf-dma.fr>"}, server.received("RCPT TO"))
+
+	// a UTF-8 local part cannot be sent, and the session is kept for the next message
+	require.ErrorIs(t, emailSender.SendEmail(newTestMessage("用户@例子.广告")), ErrSMTPUTF8NotSupported)
+	require.NoError(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com")))
+
+	assert.Len(t, server.received("MAIL FROM"), 2)
+	assert.Equal(t, 1, server.connections())
+}
+
+func TestSendEmailWithDKIMSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	signer, err := newman.NewDKIMSigner("usps.com", "route", key)
+	require.NoError(t, err)
+
+	server, host, port := newScriptedServer(t, nil, nil)
+
+	emailSender := newTestSMTPSender(host, port, "", "", "", "", WithDKIMSigner(signer))
+
+	require.NoError(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com")))
+	require.Len(t, server.messages(), 1)
+
+	lookup := func(_, _ string) (crypto.PublicKey, error) {
+		return newman.ParseDKIMRecord(signer.DNSRecord())
+	}
+
+	// the server reads the message with LF line endings, so the CRLF endings that were signed are restored
+	sent := bytes.ReplaceAll(server.messages()[0], []byte("\n"), []byte("\r\n"))
+
+	assert.True(t, bytes.HasPrefix(sent, []byte("DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed; d=usps.com; s=route;")))
+	assert.NoError(t, newman.VerifyDKIM(sent, lookup))
+}
+
+func TestSendEmailWithSMIME(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: "newman@usps.com"},
+		EmailAddresses: []string{"newman@usps.com"},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	smime, err := newman.NewSMIME(newman.WithSMIMESigner(cert, key), newman.WithSMIMERecipients(cert))
+	require.NoError(t, err)
+
+	server, host, port := newScriptedServer(t, nil, nil)
+
+	emailSender := newTestSMTPSender(host, port, "", "", "", "", WithSMIME(smime))
+
+	require.NoError(t, emailSender.SendEmail(newTestMessage("jerry@seinfeld.com")))
+	require.Len(t, server.messages(), 1)
+
+	// the server reads the message with LF line endings, so the CRLF endings that were signed are restored
+	sent := bytes.ReplaceAll(server.messages()[0], []byte("\n"), []byte("\r\n"))
+
+	decrypted, err := newman.DecryptSMIME(sent, cert, key)
+	require.NoError(t, err)
+
+	verified, err := newman.VerifySMIME(decrypted, nil)
+	require.NoError(t, err)
+
+	message, err := newman.ParseMimeMessage(bytes.NewReader(verified))
+	require.NoError(t, err)
+	assert.Equal(t, newTestMessage("jerry@seinfeld.com").Text, message.Text)
+}
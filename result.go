@@ -0,0 +1,70 @@
+package newman
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/theopenlane/newman/shared"
+)
+
+// SendResult describes the outcome of a single accepted send
+type SendResult struct {
+	// Provider is the name of the provider that accepted the message
+	Provider string `json:"provider"`
+	// MessageID is the identifier the provider assigned to the message, used to correlate webhooks
+	MessageID string `json:"message_id,omitempty"`
+	// Accepted is the list of recipients handed off to the provider
+	Accepted []string `json:"accepted,omitempty"`
+	// Rejected is the list of recipients that were not sent to, such as invalid addresses
+	Rejected []string `json:"rejected,omitempty"`
+	// SentAt is the time the provider accepted the message
+	SentAt time.Time `json:"sent_at"`
+}
+
+// ResultSender is implemented by senders that report the provider result of a send
+// in addition to satisfying EmailSender
+type ResultSender interface {
+	// SendEmailWithResult sends an email with the given message and context and returns the provider result
+	SendEmailWithResult(ctx context.Context, message *EmailMessage) (*SendResult, error)
+}
+
+// NewSendResult creates a SendResult for the message, splitting its recipients into those
+// handed off to the provider and those dropped as invalid
+func NewSendResult(provider, messageID string, message *EmailMessage) *SendResult {
+	result := &SendResult{
+		Provider:  provider,
+		MessageID: messageID,
+		SentAt:    time.Now().UTC(),
+	}
+
+	if message == nil {
+		return result
+	}
+
+	for _, recipients := range [][]string{message.To, message.Cc, message.Bcc} {
+		for _, recipient := range recipients {
+			if valid := shared.ValidateEmailAddress(recipient); valid != "" {
+				result.Accepted = append(result.Accepted, valid)
+			} else if trimmed := strings.TrimSpace(recipient); trimmed != "" {
+				result.Rejected = append(result.Rejected, trimmed)
+			}
+		}
+	}
+
+	return result
+}
+
+// SendEmailWithResult sends the message through the sender, returning the provider result when the
+// sender implements ResultSender. Otherwise the result carries no message ID
+func SendEmailWithResult(ctx context.Context, sender EmailSender, message *EmailMessage) (*SendResult, error) {
+	if rs, ok := sender.(ResultSender); ok {
+		return rs.SendEmailWithResult(ctx, message)
+	}
+
+	if err := sender.SendEmailWithContext(ctx, message); err != nil {
+		return nil, err
+	}
+
+	return NewSendResult(providerName(sender), "", message), nil
+}
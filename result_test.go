@@ -0,0 +1,64 @@
+package newman_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/newman"
+)
+
+// plainSender only satisfies EmailSender, it does not report results
+type plainSender struct {
+	newman.EmailSender
+}
+
+func TestNewSendResult(t *testing.T) {
+	message := newman.NewEmailMessageWithOptions(
+		newman.WithFrom("newman@usps.com"),
+		newman.WithTo([]string{"jerry@seinfeld.com", "not-an-email"}),
+		newman.WithCc([]string{"elaine@seinfeld.com"}),
+		newman.WithBcc([]string{" kramer@seinfeld.com ", ""}),
+	)
+
+	result := newman.NewSendResult("resend", "abc-123", message)
+
+	assert.Equal(t, "resend", result.Provider)
+	assert.Equal(t, "abc-123", result.MessageID)
+	assert.Equal(t, []string{"jerry@seinfeld.com", "elaine@seinfeld.com", "kramer@seinfeld.com"}, result.Accepted)
+	assert.Equal(t, []string{"not-an-email"}, result.Rejected)
+	assert.False(t, result.SentAt.IsZero())
+}
+
+func TestSendEmailWithResult(t *testing.T) {
+	sender := newRetryTestSender(t)
+	ctx := context.Background()
+
+	result, err := newman.SendEmailWithResult(ctx, sender, newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "mock", result.Provider)
+	assert.Equal(t, "mock-1", result.MessageID)
+
+	// senders that do not implement ResultSender still produce a result, without a message ID
+	result, err = newman.SendEmailWithResult(ctx, plainSender{sender}, newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+	assert.Empty(t, result.MessageID)
+	assert.Equal(t, []string{"jerry@seinfeld.com"}, result.Accepted)
+
+	_, err = newman.SendEmailWithResult(ctx, sender, newRetryTestMessage("not-an-email"))
+	require.Error(t, err)
+}
+
+func TestSendEmailWithResultThroughDecorators(t *testing.T) {
+	primary, secondary := newFailoverSenders(t)
+	primary.FailWith(newman.NewRetryableError(errRateLimited))
+
+	sender := newman.WithRetry(newman.Failover(newman.Named("resend", primary), newman.Named("smtp", secondary)))
+
+	result, err := newman.SendEmailWithResult(context.Background(), sender, newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "smtp", result.Provider)
+	assert.Equal(t, "mock-1", result.MessageID)
+}
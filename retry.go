@@ -0,0 +1,269 @@
+package newman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseDelay   = 500 * time.Millisecond
+	defaultRetryMaxDelay    = 30 * time.Second
+)
+
+// retrySender wraps an EmailSender and retries sends that fail with a retryable error
+type retrySender struct {
+	next        EmailSender
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// RetryOption configures the EmailSender returned by WithRetry
+type RetryOption func(*retrySender)
+
+// WithRetryMaxAttempts sets the total number of attempts, including the first send
+func WithRetryMaxAttempts(attempts int) RetryOption {
+	return func(r *retrySender) {
+		if attempts > 0 {
+			r.maxAttempts = attempts
+		}
+	}
+}
+
+// WithRetryBaseDelay sets the delay before the first retry; each later retry doubles it
+func WithRetryBaseDelay(delay time.Duration) RetryOption {
+	return func(r *retrySender) {
+		if delay > 0 {
+			r.baseDelay = delay
+		}
+	}
+}
+
+// WithRetryMaxDelay caps the delay between attempts. A send whose Retry-After hint asks for a longer wait is
+// not retried
+func WithRetryMaxDelay(delay time.Duration) RetryOption {
+	return func(r *retrySender) {
+		if delay > 0 {
+			r.maxDelay = delay
+		}
+	}
+}
+
+// WithRetry wraps an EmailSender so that sends failing with a retryable error (see IsRetryableError)
+// are retried with exponential backoff and jitter. A Retry-After hint carried on the error takes
+// precedence over the computed backoff, and no retry is attempted if the hint is longer than the
+// maximum delay or waiting would overrun the context deadline. Non-retryable errors are returned immediately
+func WithRetry(sender EmailSender, opts ...RetryOption) EmailSender {
+	r := &retrySender{
+		next:        sender,
+		maxAttempts: defaultRetryMaxAttempts,
+		baseDelay:   defaultRetryBaseDelay,
+		maxDelay:    defaultRetryMaxDelay,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// SendEmail satisfies the EmailSender interface
+func (r *retrySender) SendEmail(message *EmailMessage) error {
+	return r.SendEmailWithContext(context.Background(), message)
+}
+
+// SendEmailWithContext satisfies the EmailSender interface
+func (r *retrySender) SendEmailWithContext(ctx context.Context, message *EmailMessage) error {
+	_, err := r.SendEmailWithResult(ctx, message)
+
+	return err
+}
+
+// SendEmailWithResult satisfies the ResultSender interface
+func (r *retrySender) SendEmailWithResult(ctx context.Context, message *EmailMessage) (*SendResult, error) {
+	var result *SendResult
+
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+
+		result, err = SendEmailWithResult(ctx, r.next, message)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ProviderName satisfies the ProviderNamer interface by reporting the wrapped sender's name
+func (r *retrySender) ProviderName() string {
+	return providerName(r.next)
+}
+
+// SendBatchEmail satisfies the EmailSender interface
+func (r *retrySender) SendBatchEmail(messages []*EmailMessage) error {
+	return r.SendBatchEmailWithContext(context.Background(), messages)
+}
+
+// SendBatchEmailWithContext satisfies the EmailSender interface
+func (r *retrySender) SendBatchEmailWithContext(ctx context.Context, messages []*EmailMessage) error {
+	result, err := r.SendBatchEmailWithResult(ctx, messages)
+	if err != nil {
+		return err
+	}
+
+	return result.Err()
+}
+
+// SendBatchEmailWithResult satisfies the BatchResultSender interface. Only the messages that failed with a
+// retryable error are sent again, so messages already accepted are never sent twice. A retryable error for the
+// batch as a whole retries every message not yet accepted
+func (r *retrySender) SendBatchEmailWithResult(ctx context.Context, messages []*EmailMessage) (*BatchResult, error) {
+	var result *BatchResult
+
+	pending := make([]int, len(messages))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	for attempt := 1; ; attempt++ {
+		batch := make([]*EmailMessage, len(pending))
+		for j, i := range pending {
+			batch[j] = messages[i]
+		}
+
+		sent, err := SendBatchEmailWithResult(ctx, r.next, batch)
+		if err != nil {
+			if IsRetryableError(err) {
+				stop := r.wait(ctx, attempt, err)
+				if stop == nil {
+					continue
+				}
+
+				err = stop(err)
+			}
+
+			if result == nil {
+				return nil, err
+			}
+
+			for _, i := range pending {
+				result.SetFailed(i, err)
+			}
+
+			return result, nil
+		}
+
+		if result == nil {
+			result = NewBatchResult(sent.Provider, len(messages))
+		}
+
+		var (
+			retry []int
+			errs  []error
+		)
+
+		for j, item := range sent.Items {
+			i := pending[j]
+
+			switch {
+			case item.Status == BatchStatusSent:
+				result.SetSent(i, item.MessageID)
+				result.Items[i].Rejected = item.Rejected
+			case item.Status == BatchStatusSkipped:
+				result.SetSkipped(i, item.Err)
+			default:
+				result.SetFailed(i, item.Err)
+
+				if IsRetryableError(item.Err) {
+					retry = append(retry, i)
+					errs = append(errs, item.Err)
+				}
+			}
+		}
+
+		if pending = retry; len(pending) == 0 {
+			return result, nil
+		}
+
+		if stop := r.wait(ctx, attempt, errors.Join(errs...)); stop != nil {
+			for _, i := range pending {
+				result.SetFailed(i, stop(result.Items[i].Err))
+			}
+
+			return result, nil
+		}
+	}
+}
+
+// do runs send until it succeeds, fails with a non-retryable error, or attempts run out
+func (r *retrySender) do(ctx context.Context, send func(context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := send(ctx)
+		if err == nil || !IsRetryableError(err) {
+			return err
+		}
+
+		if stop := r.wait(ctx, attempt, err); stop != nil {
+			return stop(err)
+		}
+	}
+}
+
+// wait sleeps before the attempt that follows one failing with the retryable err, honoring its Retry-After hint.
+// When no further attempt should be made it returns a function wrapping an error with the reason for giving up
+func (r *retrySender) wait(ctx context.Context, attempt int, err error) func(error) error {
+	if attempt >= r.maxAttempts {
+		return func(err error) error {
+			return fmt.Errorf("%w after %d attempts: %w", ErrRetryAttemptsExhausted, attempt, err)
+		}
+	}
+
+	delay := r.backoff(attempt)
+	if hint, ok := RetryAfter(err); ok {
+		delay = hint
+	}
+
+	// a hint longer than the maximum delay is left to the caller rather than blocking the send
+	if delay > r.maxDelay {
+		return func(err error) error { return err }
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return func(err error) error { return err }
+	}
+
+	timer := time.NewTimer(delay)
+
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+
+		return func(err error) error {
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff returns the exponential delay for the given attempt with equal jitter applied
+func (r *retrySender) backoff(attempt int) time.Duration {
+	delay := r.baseDelay
+	for i := 1; i < attempt && delay < r.maxDelay; i++ {
+		delay *= 2
+	}
+
+	delay = min(delay, r.maxDelay)
+
+	half := delay / 2 //nolint:mnd
+
+	return half + rand.N(half+1) // #nosec G404 -- jitter does not need a secure source
+}
@@ -0,0 +1,206 @@
+package newman_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/newman"
+	"github.com/theopenlane/newman/providers/mock"
+)
+
+var errRateLimited = errors.New("too many requests")
+
+func newRetryTestMessage(to string) *newman.EmailMessage {
+	return newman.NewEmailMessage("newman@usps.com", []string{to}, "Retry", "Hello, Newman")
+}
+
+func newRetryTestSender(t *testing.T) *mock.EmailSender {
+	sender, err := mock.New("")
+	require.NoError(t, err)
+
+	return sender
+}
+
+func TestWithRetrySucceedsAfterRetryableErrors(t *testing.T) {
+	sender := newRetryTestSender(t)
+	sender.FailWith(newman.NewRetryableError(errRateLimited), newman.NewRetryableError(errRateLimited))
+
+	retrying := newman.WithRetry(sender, newman.WithRetryBaseDelay(time.Millisecond))
+
+	err := retrying.SendEmail(newRetryTestMessage("jerry@seinfeld.com"))
+	require.NoError(t, err)
+	assert.Len(t, sender.Messages(), 1)
+}
+
+func TestWithRetryStopsOnNonRetryableError(t *testing.T) {
+	sender := newRetryTestSender(t)
+
+	permanent := errors.New("invalid api key")
+	sender.FailWith(permanent, nil)
+
+	retrying := newman.WithRetry(sender, newman.WithRetryBaseDelay(time.Millisecond))
+
+	err := retrying.SendEmail(newRetryTestMessage("jerry@seinfeld.com"))
+	require.ErrorIs(t, err, permanent)
+	assert.Empty(t, sender.Messages())
+}
+
+func TestWithRetryCapsAttempts(t *testing.T) {
+	sender := newRetryTestSender(t)
+	sender.FailWith(
+		newman.NewRetryableError(errRateLimited),
+		newman.NewRetryableError(errRateLimited),
+		newman.NewRetryableError(errRateLimited),
+	)
+
+	retrying := newman.WithRetry(sender,
+		newman.WithRetryMaxAttempts(2),
+		newman.WithRetryBaseDelay(time.Millisecond),
+	)
+
+	err := retrying.SendEmail(newRetryTestMessage("jerry@seinfeld.com"))
+	require.ErrorIs(t, err, newman.ErrRetryAttemptsExhausted)
+	assert.ErrorIs(t, err, errRateLimited)
+	assert.True(t, newman.IsRetryableError(err))
+	assert.Empty(t, sender.Messages())
+
+	// one injected failure is left over since only two attempts were made
+	require.NoError(t, retrying.SendEmail(newRetryTestMessage("jerry@seinfeld.com")))
+}
+
+func TestWithRetryHonorsRetryAfter(t *testing.T) {
+	sender := newRetryTestSender(t)
+	sender.FailWith(newman.NewRetryableErrorWithDelay(errRateLimited, 50*time.Millisecond))
+
+	retrying := newman.WithRetry(sender, newman.WithRetryBaseDelay(time.Millisecond))
+
+	start := time.Now()
+
+	require.NoError(t, retrying.SendEmail(newRetryTestMessage("jerry@seinfeld.com")))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestWithRetryRetryAfterOverMaxDelay(t *testing.T) {
+	sender := newRetryTestSender(t)
+	sender.FailWith(newman.NewRetryableErrorWithDelay(errRateLimited, 3*time.Hour))
+
+	retrying := newman.WithRetry(sender, newman.WithRetryMaxDelay(time.Second))
+
+	start := time.Now()
+
+	// the send gives up at once instead of waiting hours, and stays retryable for the caller
+	err := retrying.SendEmail(newRetryTestMessage("jerry@seinfeld.com"))
+	require.ErrorIs(t, err, errRateLimited)
+	assert.True(t, newman.IsRetryableError(err))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Empty(t, sender.Messages())
+}
+
+func TestWithRetryRespectsContextDeadline(t *testing.T) {
+	sender := newRetryTestSender(t)
+	sender.FailWith(newman.NewRetryableErrorWithDelay(errRateLimited, 10*time.Second))
+
+	retrying := newman.WithRetry(sender)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+
+	err := retrying.SendEmailWithContext(ctx, newRetryTestMessage("jerry@seinfeld.com"))
+	require.ErrorIs(t, err, errRateLimited)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestWithRetryContextCanceledWhileWaiting(t *testing.T) {
+	sender := newRetryTestSender(t)
+	sender.FailWith(newman.NewRetryableError(errRateLimited))
+
+	retrying := newman.WithRetry(sender, newman.WithRetryBaseDelay(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	err := retrying.SendEmailWithContext(ctx, newRetryTestMessage("jerry@seinfeld.com"))
+	require.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, errRateLimited)
+}
+
+func TestWithRetryBatch(t *testing.T) {
+	sender := newRetryTestSender(t)
+	sender.FailWith(nil, newman.NewRetryableError(errRateLimited))
+
+	retrying := newman.WithRetry(sender, newman.WithRetryBaseDelay(time.Millisecond))
+
+	messages := []*newman.EmailMessage{
+		newRetryTestMessage("jerry@seinfeld.com"),
+		newRetryTestMessage("george@seinfeld.com"),
+	}
+
+	require.NoError(t, retrying.SendBatchEmail(messages))
+
+	// only the message that failed was sent again, so each message went out once
+	require.Len(t, sender.Messages(), 2)
+	assert.Equal(t, messages[0], sender.Messages()[0])
+	assert.Equal(t, messages[1], sender.Messages()[1])
+}
+
+func TestWithRetryBatchResult(t *testing.T) {
+	sender := newRetryTestSender(t)
+
+	permanent := errors.New("invalid recipient")
+	sender.FailWith(
+		nil,
+		newman.NewRetryableError(errRateLimited),
+		permanent,
+		newman.NewRetryableError(errRateLimited),
+	)
+
+	retrying := newman.WithRetry(sender,
+		newman.WithRetryMaxAttempts(2),
+		newman.WithRetryBaseDelay(time.Millisecond),
+	)
+
+	messages := []*newman.EmailMessage{
+		newRetryTestMessage("jerry@seinfeld.com"),
+		newRetryTestMessage("george@seinfeld.com"),
+		newRetryTestMessage("kramer@seinfeld.com"),
+	}
+
+	result, err := newman.SendBatchEmailWithResult(context.Background(), retrying, messages)
+	require.NoError(t, err)
+
+	assert.Equal(t, "mock", result.Provider)
+	assert.Equal(t, newman.BatchStatusSent, result.Items[0].Status)
+	assert.Equal(t, "mock-1", result.Items[0].MessageID)
+
+	// the second message failed on both attempts, the third was not retried
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[1].Status)
+	require.ErrorIs(t, result.Items[1].Err, newman.ErrRetryAttemptsExhausted)
+	require.ErrorIs(t, result.Items[1].Err, errRateLimited)
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[2].Status)
+	require.ErrorIs(t, result.Items[2].Err, permanent)
+
+	assert.Len(t, sender.Messages(), 1)
+}
+
+func TestRetryAfter(t *testing.T) {
+	_, ok := newman.RetryAfter(newman.NewRetryableError(errRateLimited))
+	assert.False(t, ok)
+
+	_, ok = newman.RetryAfter(errRateLimited)
+	assert.False(t, ok)
+
+	delay, ok := newman.RetryAfter(newman.NewRetryableErrorWithDelay(errRateLimited, time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, delay)
+}
@@ -0,0 +1,139 @@
+package shared
+
+import (
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+// Address is an RFC 5322 mailbox: an email address with an optional display name
+type Address struct {
+	// Name is the display name, such as Jane Doe
+	Name string `json:"name,omitempty"`
+	// Address is the email address, such as jane@example.com
+	Address string `json:"address"`
+}
+
+// NewAddress creates a new Address with the given display name and email address
+func NewAddress(name, address string) Address {
+	return Address{Name: strings.TrimSpace(name), Address: strings.TrimSpace(address)}
+}
+
+// ParseAddress parses a single address, either a bare email address or a mailbox with a display name
+// such as "Jane Doe <jane@example.com>". RFC 2047 encoded display names are decoded
+func ParseAddress(address string) (Address, error) {
+	trimmed := strings.TrimSpace(address)
+
+	if validAddress(trimmed) {
+		return Address{Address: trimmed}, nil
+	}
+
+	parsed, err := mail.ParseAddress(trimmed)
+	if err != nil {
+		return Address{}, fmt.Errorf("%w: %q: %w", ErrInvalidAddress, address, err)
+	}
+
+	if !validAddress(parsed.Address) {
+		return Address{}, fmt.Errorf("%w: %q", ErrInvalidAddress, address)
+	}
+
+	return Address{Name: parsed.Name, Address: parsed.Address}, nil
+}
+
+// ParseAddressList parses a comma separated list of addresses, as found in a To or Cc header
+func ParseAddressList(list string) ([]Address, error) {
+	parsed, err := mail.ParseAddressList(list)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrInvalidAddress, list, err)
+	}
+
+	addresses := make([]Address, 0, len(parsed))
+
+	for _, address := range parsed {
+		if !validAddress(address.Address) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidAddress, address.Address)
+		}
+
+		addresses = append(addresses, Address{Name: address.Name, Address: address.Address})
+	}
+
+	return addresses, nil
+}
+
+// String formats the address as "Name" <address>, or the bare email address when there is no display
+// name. The name is quoted but not encoded, as accepted by provider APIs and RFC 6532
+func (a Address) String() string {
+	if a.Name == "" {
+		return a.Address
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", "").Replace(a.Name) + `" <` + a.Address + `>`
+}
+
+// Encode formats the address for a MIME header, RFC 2047 encoding display names that are not ASCII and
+// writing internationalized domain names as punycode
+func (a Address) Encode() string {
+	address := a.ToASCII().Address
+
+	if a.Name == "" {
+		return address
+	}
+
+	// mail.Address quotes the local part itself
+	if at := strings.LastIndexByte(address, '@'); at > 1 && address[0] == '"' && address[at-1] == '"' {
+		if local, err := strconv.Unquote(address[:at]); err == nil {
+			address = local + address[at:]
+		}
+	}
+
+	return (&mail.Address{Name: strings.NewReplacer("\r", "", "\n", "").Replace(a.Name), Address: address}).String()
+}
+
+// ToASCII returns the address with an internationalized domain name converted to punycode, for providers
+// and servers that only accept ASCII domains. The local part is left unchanged
+func (a Address) ToASCII() Address {
+	at := strings.LastIndexByte(a.Address, '@')
+	if at < 0 {
+		return a
+	}
+
+	a.Address = a.Address[:at+1] + domainToASCII(a.Address[at+1:])
+
+	return a
+}
+
+// IsASCII reports whether the email address is ASCII, so it can be sent to servers that do not support
+// SMTPUTF8. Convert internationalized domain names with ToASCII first
+func (a Address) IsASCII() bool {
+	return isASCII(a.Address)
+}
+
+// IsZero reports whether the address is empty
+func (a Address) IsZero() bool {
+	return a.Address == ""
+}
+
+// parseAddresses parses each address of a recipient list, leaving out those that are not valid
+func parseAddresses(list []string) []Address {
+	addresses := make([]Address, 0, len(list))
+
+	for _, entry := range list {
+		if address, err := ParseAddress(entry); err == nil {
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+// formatAddresses formats each address of a list with format
+func formatAddresses(addresses []Address, format func(Address) string) []string {
+	formatted := make([]string, 0, len(addresses))
+
+	for _, address := range addresses {
+		formatted = append(formatted, format(address))
+	}
+
+	return formatted
+}
@@ -0,0 +1,137 @@
+package shared
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Address
+	}{
+		{"jane@example.com", Address{Address: "jane@example.com"}},
+		{"  jane@example.com ", Address{Address: "jane@example.com"}},
+		{"Jane Doe <jane@example.com>", Address{Name: "Jane Doe", Address: "jane@example.com"}},
+		{`"Doe, Jane" <jane@example.com>`, Address{Name: "Doe, Jane", Address: "jane@example.com"}},
+		{"<jane@example.com>", Address{Address: "jane@example.com"}},
+		{"=?UTF-8?Q?Zo=C3=AB?= <zoe@example.com>", Address{Name: "Zoë", Address: "zoe@example.com"}},
+		{`"Zoë Café" <zoe@example.com>`, Address{Name: "Zoë Café", Address: "zoe@example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			address, err := ParseAddress(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, address)
+		})
+	}
+
+	for _, invalid := range []string{"", "jane", "Jane Doe", "Jane <jane@com>", "Jane <jane@example.com", "jane@example.com, joe@example.com"} {
+		_, err := ParseAddress(invalid)
+		assert.ErrorIs(t, err, ErrInvalidAddress, invalid)
+	}
+}
+
+func TestParseAddressList(t *testing.T) {
+	addresses, err := ParseAddressList(`"Seinfeld, Jerry" <jerry@seinfeld.com>, elaine@seinfeld.com`)
+	require.NoError(t, err)
+	assert.Equal(t, []Address{{Name: "Seinfeld, Jerry", Address: "jerry@seinfeld.com"}, {Address: "elaine@seinfeld.com"}}, addresses)
+
+	_, err = ParseAddressList("jerry@seinfeld.com, kramer")
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func TestAddressFormatting(t *testing.T) {
+	assert.Equal(t, "jane@example.com", NewAddress("", "jane@example.com").String())
+	assert.Equal(t, `"Jane Doe" <jane@example.com>`, NewAddress("Jane Doe", "jane@example.com").String())
+	assert.Equal(t, `"Cosmo \"Kramer\"" <kramer@seinfeld.com>`, NewAddress(`Cosmo "Kramer"`, "kramer@seinfeld.com").String())
+	assert.Equal(t, `"Zoë" <zoe@example.com>`, NewAddress("Zoë", "zoe@example.com").String())
+
+	assert.Equal(t, `"Jane Doe" <jane@example.com>`, NewAddress("Jane Doe", "jane@example.com").Encode())
+	assert.Equal(t, "=?utf-8?q?Zo=C3=AB?= <zoe@example.com>", NewAddress("Zoë", "zoe@example.com").Encode())
+
+	// every format parses back to the same address
+	for _, address := range []Address{NewAddress("Jane Doe", "jane@example.com"), NewAddress(`Cosmo "Kramer"`, "kramer@seinfeld.com"), NewAddress("Zoë", "zoe@example.com")} {
+		for _, formatted := range []string{address.String(), address.Encode()} {
+			parsed, err := ParseAddress(formatted)
+			require.NoError(t, err)
+			assert.Equal(t, address, parsed)
+		}
+	}
+
+	// line breaks cannot be used to inject headers through the display name
+	assert.NotContains(t, NewAddress("Jane\r\nBcc: kramer@seinfeld.com", "jane@example.com").Encode(), "\n")
+}
+
+func TestAddressToASCII(t *testing.T) {
+	address := NewAddress("用户", "用户@例子.广告")
+
+	assert.Equal(t, NewAddress("用户", "用户@xn--fsqu00a.xn--4rr70v"), address.ToASCII())
+	assert.False(t, address.ToASCII().IsASCII())
+
+	address = NewAddress("Zoë", "zoe@café.fr")
+
+	assert.Equal(t, "zoe@xn--caf-dma.fr", address.ToASCII().Address)
+	assert.True(t, address.ToASCII().IsASCII())
+	assert.Equal(t, "=?utf-8?q?Zo=C3=AB?= <zoe@xn--caf-dma.fr>", address.Encode())
+
+	// ASCII addresses and address literals are left as they are
+	assert.Equal(t, NewAddress("", "Jane@Example.com"), NewAddress("", "Jane@Example.com").ToASCII())
+	assert.Equal(t, NewAddress("", "jane@[192.0.2.1]"), NewAddress("", "jane@[192.0.2.1]").ToASCII())
+
+	// a quoted local part is not quoted twice
+	assert.Equal(t, `"Jane Doe" <"jane doe"@example.com>`, NewAddress("Jane Doe", `"jane doe"@example.com`).Encode())
+}
+
+func TestEmailMessageAddresses(t *testing.T) {
+	message := NewEmailMessage("", nil, "Hello", "Hello, Jerry").
+		SetFromAddress(NewAddress("Newman", "newman@usps.com")).
+		SetReplyToAddress(NewAddress("Postmaster", "postmaster@usps.com")).
+		AddToAddress(NewAddress("Jerry Seinfeld", "jerry@seinfeld.com")).
+		AddToRecipient("elaine@seinfeld.com").
+		AddToRecipient("not an address").
+		AddCCAddress(NewAddress("Cosmo Kramer", "kramer@seinfeld.com")).
+		AddBCCAddress(NewAddress("George Costanza", "george@seinfeld.com"))
+
+	// the display names are kept alongside the legacy string fields
+	assert.Equal(t, `"Newman" <newman@usps.com>`, message.From)
+	assert.Equal(t, NewAddress("Newman", "newman@usps.com"), message.GetFromAddress())
+	assert.Equal(t, NewAddress("Postmaster", "postmaster@usps.com"), message.GetReplyToAddress())
+	assert.Equal(t, []Address{NewAddress("Jerry Seinfeld", "jerry@seinfeld.com"), NewAddress("", "elaine@seinfeld.com")}, message.GetToAddresses())
+	assert.Equal(t, []Address{NewAddress("Cosmo Kramer", "kramer@seinfeld.com")}, message.GetCCAddresses())
+	assert.Equal(t, []Address{NewAddress("George Costanza", "george@seinfeld.com")}, message.GetBCCAddresses())
+
+	// the legacy getters return the bare addresses used for the SMTP envelope
+	assert.Equal(t, "newman@usps.com", message.GetFrom())
+	assert.Equal(t, []string{"jerry@seinfeld.com", "elaine@seinfeld.com"}, message.GetTo())
+	require.NoError(t, ValidateEmailMessage(message))
+
+	var nilMessage *EmailMessage
+
+	assert.True(t, nilMessage.GetFromAddress().IsZero())
+	assert.Empty(t, nilMessage.GetToAddresses())
+}
+
+func TestBuildMimeMessageAddresses(t *testing.T) {
+	message := NewEmailMessage(`"Newman" <newman@usps.com>`, []string{"Jerry Seinfeld <jerry@seinfeld.com>", "elaine@seinfeld.com"}, "Hello", "Hello, Jerry").
+		SetCC([]string{"Zoë <zoe@example.com>"}).
+		SetBCC([]string{"George <george@seinfeld.com>"}).
+		SetReplyTo("Postmaster <postmaster@usps.com>")
+
+	raw, err := BuildMimeMessage(message)
+	require.NoError(t, err)
+
+	header := string(raw[:strings.Index(string(raw), "\r\n\r\n")])
+
+	assert.Contains(t, header, "From: \"Newman\" <newman@usps.com>\r\n")
+	assert.Contains(t, header, "To: \"Jerry Seinfeld\" <jerry@seinfeld.com>, elaine@seinfeld.com\r\n")
+	assert.Contains(t, header, "Cc: =?utf-8?q?Zo=C3=AB?= <zoe@example.com>\r\n")
+	assert.Contains(t, header, "Reply-To: \"Postmaster\" <postmaster@usps.com>\r\n")
+	assert.NotContains(t, header, "george")
+	// the Message-ID domain comes from the bare sender address
+	assert.Regexp(t, "Message-ID: <[^>@]+@usps.com>\r\n", header)
+}
@@ -1,10 +1,14 @@
 package shared
 
 import (
+	"bytes"
 	"encoding/base64"
-	"encoding/json"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"strings"
+	"sync"
 )
 
 // Attachment represents an email attachment with its filename and content
@@ -17,6 +21,14 @@ type Attachment struct {
 	ContentType string
 	// Filepath is the path to the attachment file
 	FilePath string
+	// ContentID identifies an inline attachment so HTML content can reference it with a cid: URL
+	ContentID string
+	// Inline marks the attachment for display within the message body rather than as a download
+	Inline bool
+	// open opens the content of an attachment backed by a reader or file system instead of Content
+	open func() (io.ReadCloser, error)
+	// size is the length of the content behind open, or -1 when it is not known
+	size int64
 }
 
 // NewAttachment creates a new Attachment instance with the specified filename and content
@@ -27,7 +39,61 @@ func NewAttachment(filename string, content []byte) *Attachment {
 	}
 }
 
-// NewAttachmentFromFile creates a new Attachment instance from the specified file path
+// NewInlineAttachment creates a new inline Attachment that HTML content can reference as cid:contentID
+func NewInlineAttachment(filename, contentID string, content []byte) *Attachment {
+	return &Attachment{
+		Filename:  filename,
+		Content:   content,
+		ContentID: contentID,
+		Inline:    true,
+	}
+}
+
+// NewAttachmentFromReader creates a new Attachment whose content is streamed from r when the message is
+// written. The reader can only be consumed once, so the attachment cannot be sent again once it has been read
+func NewAttachmentFromReader(filename string, r io.Reader) *Attachment {
+	var once sync.Once
+
+	return &Attachment{
+		Filename: filename,
+		size:     -1,
+		open: func() (io.ReadCloser, error) {
+			err := ErrAttachmentConsumed
+
+			once.Do(func() { err = nil })
+
+			if err != nil {
+				return nil, err
+			}
+
+			if rc, ok := r.(io.ReadCloser); ok {
+				return rc, nil
+			}
+
+			return io.NopCloser(r), nil
+		},
+	}
+}
+
+// NewAttachmentFromFS creates a new Attachment whose content is streamed from the named file in fsys each
+// time the message is written, rather than being held in memory
+func NewAttachmentFromFS(fsys fs.FS, name string) (*Attachment, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Attachment{
+		Filename: path.Base(name),
+		size:     info.Size(),
+		open: func() (io.ReadCloser, error) {
+			return fsys.Open(name)
+		},
+	}, nil
+}
+
+// NewAttachmentFromFile creates a new Attachment instance from the specified file path, reading the whole
+// file into memory; use NewAttachmentFromFS to stream large files instead
 func NewAttachmentFromFile(filePath string) (*Attachment, error) {
 	content, err := os.ReadFile(filePath)
 	if err != nil {
@@ -62,66 +128,82 @@ func (a *Attachment) GetFilename() string {
 	return strings.TrimSpace(a.Filename)
 }
 
-// GetBase64StringContent returns the content of the attachment as a base64-encoded string
-func (a *Attachment) GetBase64StringContent() string {
+// SetContentID sets the content ID of the attachment and marks it inline
+func (a *Attachment) SetContentID(contentID string) {
+	a.ContentID = contentID
+	a.Inline = true
+}
+
+// GetContentID returns the content ID of the attachment without surrounding whitespace or angle brackets
+func (a *Attachment) GetContentID() string {
 	if a == nil {
 		return ""
 	}
 
-	return string(a.GetBase64Content())
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(a.ContentID), "<"), ">")
 }
 
-// SetContent sets the content of the attachment
-func (a *Attachment) SetContent(content []byte) {
-	a.Content = content
+// IsInline reports whether the attachment is displayed inline and can be referenced by its content ID
+func (a *Attachment) IsInline() bool {
+	return a != nil && a.Inline && a.GetContentID() != ""
 }
 
-// GetBase64Content returns the content of the attachment as a base64-encoded byte slice
-func (a *Attachment) GetBase64Content() []byte {
-	if a == nil || len(a.Content) == 0 {
-		return []byte{}
+// GetContentType returns the MIME type of the attachment, determined from the filename when it is not set
+func (a *Attachment) GetContentType() string {
+	if a == nil {
+		return ""
 	}
 
-	buf := make([]byte, base64.StdEncoding.EncodedLen(len(a.Content)))
+	if contentType := strings.TrimSpace(a.ContentType); contentType != "" {
+		return contentType
+	}
 
-	base64.StdEncoding.Encode(buf, a.Content)
+	if contentType := GetMimeType(a.GetFilename()); contentType != "" {
+		return contentType
+	}
 
-	return buf
+	return defaultContentType
 }
 
-// GetRawContent returns the content of the attachment as its raw byte slice
-func (a *Attachment) GetRawContent() []byte {
-	if a == nil || len(a.Content) == 0 {
-		return []byte{}
+// GetBase64StringContent returns the content of the attachment as a base64-encoded string
+func (a *Attachment) GetBase64StringContent() string {
+	if a == nil {
+		return ""
 	}
 
-	return a.Content
+	return string(a.GetBase64Content())
 }
 
-// jsonAttachment represents the JSON structure for an email attachment
-type jsonAttachment struct {
-	Filename string `json:"filename"`
-	Content  string `json:"content"`
+// SetContent sets the content of the attachment, replacing any reader or file it was backed by
+func (a *Attachment) SetContent(content []byte) {
+	a.Content = content
+	a.open = nil
 }
 
-// MarshalJSON custom marshaler for Attachment
-func (a Attachment) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&jsonAttachment{
-		Filename: a.Filename,
-		Content:  base64.StdEncoding.EncodeToString(a.Content),
-	})
+// Open returns a reader over the content of the attachment, opening the reader or file backing it
+func (a *Attachment) Open() (io.ReadCloser, error) {
+	if a == nil || a.open == nil || a.Content != nil {
+		return io.NopCloser(bytes.NewReader(a.GetRawContent())), nil
+	}
+
+	return a.open()
 }
 
-// UnmarshalJSON custom unmarshaler for Attachment
-func (a *Attachment) UnmarshalJSON(data []byte) error {
-	aux := &jsonAttachment{}
-	if err := json.Unmarshal(data, aux); err != nil {
+// Load reads the content of an attachment backed by a reader or file into Content, for providers that
+// need the whole attachment in memory. It does nothing for attachments that already hold their content
+func (a *Attachment) Load() error {
+	if a == nil || a.open == nil || a.Content != nil {
+		return nil
+	}
+
+	rc, err := a.open()
+	if err != nil {
 		return err
 	}
 
-	a.Filename = aux.Filename
+	defer rc.Close()
 
-	content, err := base64.StdEncoding.DecodeString(aux.Content)
+	content, err := io.ReadAll(rc)
 	if err != nil {
 		return err
 	}
@@ -130,3 +212,44 @@ func (a *Attachment) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+// Size returns the length of the attachment content in bytes, or -1 when it is streamed from a reader of unknown length
+func (a *Attachment) Size() int64 {
+	if a == nil {
+		return 0
+	}
+
+	if a.open == nil || a.Content != nil {
+		return int64(len(a.Content))
+	}
+
+	return a.size
+}
+
+// GetBase64Content returns the content of the attachment as a base64-encoded byte slice
+func (a *Attachment) GetBase64Content() []byte {
+	content := a.GetRawContent()
+	if len(content) == 0 {
+		return []byte{}
+	}
+
+	buf := make([]byte, base64.StdEncoding.EncodedLen(len(content)))
+
+	base64.StdEncoding.Encode(buf, content)
+
+	return buf
+}
+
+// GetRawContent returns the content of the attachment as its raw byte slice. Attachments backed by a reader
+// or file are loaded into memory first; call Load beforehand to handle read errors
+func (a *Attachment) GetRawContent() []byte {
+	if a == nil {
+		return []byte{}
+	}
+
+	if err := a.Load(); err != nil || len(a.Content) == 0 {
+		return []byte{}
+	}
+
+	return a.Content
+}
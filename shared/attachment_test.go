@@ -2,9 +2,15 @@ package shared
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -226,3 +232,97 @@ func TestGetFilename_Trimming(t *testing.T) {
 		assert.Equal(t, "report & summary.pdf", attachment.GetFilename())
 	})
 }
+
+func TestInlineAttachment(t *testing.T) {
+	attachment := NewInlineAttachment("logo.png", " <logo@usps.com> ", []byte("png"))
+
+	assert.True(t, attachment.IsInline())
+	assert.Equal(t, "logo@usps.com", attachment.GetContentID())
+
+	assert.False(t, NewAttachment("logo.png", []byte("png")).IsInline())
+	assert.False(t, (&Attachment{Inline: true}).IsInline())
+	assert.False(t, (*Attachment)(nil).IsInline())
+
+	regular := NewAttachment("logo.png", []byte("png"))
+	regular.SetContentID("logo")
+	assert.True(t, regular.IsInline())
+
+	data, err := json.Marshal(attachment)
+	require.NoError(t, err)
+
+	decoded := &Attachment{}
+	require.NoError(t, json.Unmarshal(data, decoded))
+	assert.True(t, decoded.IsInline())
+	assert.Equal(t, "logo@usps.com", decoded.GetContentID())
+}
+
+func TestNewAttachmentFromFS(t *testing.T) {
+	fsys := os.DirFS("../testdata")
+
+	attachment, err := NewAttachmentFromFS(fsys, "testfile.txt")
+	require.NoError(t, err)
+
+	expected, err := os.ReadFile("../testdata/testfile.txt")
+	require.NoError(t, err)
+
+	assert.Equal(t, "testfile.txt", attachment.GetFilename())
+	assert.Equal(t, int64(len(expected)), attachment.Size())
+	assert.Nil(t, attachment.Content)
+
+	// the file is opened again for every read
+	for range 2 {
+		rc, err := attachment.Open()
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		assert.Equal(t, expected, content)
+	}
+
+	require.NoError(t, attachment.Load())
+	assert.Equal(t, expected, attachment.Content)
+
+	_, err = NewAttachmentFromFS(fsys, "nonexistentfile.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestNewAttachmentFromReader(t *testing.T) {
+	attachment := NewAttachmentFromReader("route.txt", strings.NewReader("route 42"))
+
+	assert.Equal(t, int64(-1), attachment.Size())
+
+	rc, err := attachment.Open()
+	require.NoError(t, err)
+
+	content, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "route 42", string(content))
+
+	_, err = attachment.Open()
+	assert.ErrorIs(t, err, ErrAttachmentConsumed)
+	assert.ErrorIs(t, attachment.Load(), ErrAttachmentConsumed)
+
+	// loading keeps the content so it can be read again
+	loaded := NewAttachmentFromReader("route.txt", strings.NewReader("route 42"))
+	require.NoError(t, loaded.Load())
+	assert.Equal(t, int64(8), loaded.Size())
+	assert.Equal(t, "route 42", string(loaded.GetRawContent()))
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("route 42")), loaded.GetBase64StringContent())
+}
+
+func TestLoadAttachments(t *testing.T) {
+	readErr := errors.New("disk on fire")
+
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry").
+		AddAttachment(NewAttachmentFromReader("route.txt", strings.NewReader("route 42")))
+
+	require.NoError(t, message.LoadAttachments())
+	assert.Equal(t, "route 42", string(message.Attachments[0].Content))
+
+	message.AddAttachment(NewAttachmentFromReader("broken.txt", iotest.ErrReader(readErr)))
+
+	err := message.LoadAttachments()
+	assert.ErrorIs(t, err, ErrAttachmentLoad)
+	assert.ErrorIs(t, err, readErr)
+}
@@ -0,0 +1,411 @@
+package shared
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CalendarMethod is the iTIP (RFC 5546) method of a calendar invite
+type CalendarMethod string
+
+const (
+	// CalendarMethodRequest invites the attendees to an event, or updates an event they were invited to
+	CalendarMethodRequest CalendarMethod = "REQUEST"
+	// CalendarMethodCancel cancels an event the attendees were invited to
+	CalendarMethodCancel CalendarMethod = "CANCEL"
+)
+
+const (
+	// calendarFilename is the name of the .ics attachment carrying the invite
+	calendarFilename = "invite.ics"
+	// calendarProductID identifies newman as the producer of the iCalendar object
+	calendarProductID = "-//theopenlane//newman//EN"
+	// calendarLineLength is the longest content line, in octets, before it is folded
+	calendarLineLength = 75
+	// calendarUTCFormat formats a UTC date-time
+	calendarUTCFormat = "20060102T150405Z"
+	// calendarLocalFormat formats a date-time that is local to a TZID
+	calendarLocalFormat = "20060102T150405"
+)
+
+// CalendarAttendee is the organizer or an attendee of a calendar event
+type CalendarAttendee struct {
+	// Email is the calendar address of the attendee
+	Email string `json:"email"`
+	// Name is the display name of the attendee
+	Name string `json:"name,omitempty"`
+	// Optional marks the attendee's participation as optional rather than required
+	Optional bool `json:"optional,omitempty"`
+}
+
+// CalendarEvent is a single VEVENT sent as a calendar invite with an EmailMessage
+type CalendarEvent struct {
+	// UID identifies the event across updates and cancellations
+	UID string `json:"uid"`
+	// Method is the iTIP method of the invite, REQUEST when empty
+	Method CalendarMethod `json:"method,omitempty"`
+	// Sequence is the revision of the event, which must increase with every update or cancellation
+	Sequence int `json:"sequence,omitempty"`
+	// Summary is the title of the event
+	Summary string `json:"summary"`
+	// Description is the long form description of the event
+	Description string `json:"description,omitempty"`
+	// Location is where the event takes place
+	Location string `json:"location,omitempty"`
+	// Start is when the event begins; its location sets the time zone of the event
+	Start time.Time `json:"start"`
+	// End is when the event ends
+	End time.Time `json:"end"`
+	// TimeZone overrides the time zone the start and end are written in
+	TimeZone *time.Location `json:"-"`
+	// Stamp is when the invite was created, written as DTSTAMP
+	Stamp time.Time `json:"stamp"`
+	// Organizer is the attendee organizing the event
+	Organizer CalendarAttendee `json:"organizer"`
+	// Attendees is the list of attendees invited to the event
+	Attendees []CalendarAttendee `json:"attendees,omitempty"`
+}
+
+// NewCalendarEvent creates a new CalendarEvent requesting attendance with a generated UID
+func NewCalendarEvent(summary string, start, end time.Time) *CalendarEvent {
+	b := make([]byte, messageIDRandomBytes)
+	_, _ = rand.Read(b)
+
+	return &CalendarEvent{
+		UID:     hex.EncodeToString(b),
+		Method:  CalendarMethodRequest,
+		Summary: summary,
+		Start:   start,
+		End:     end,
+		Stamp:   time.Now().UTC(),
+	}
+}
+
+// SetUID sets the UID of the event, used to update or cancel an event sent earlier
+func (c *CalendarEvent) SetUID(uid string) *CalendarEvent {
+	c.UID = uid
+	return c
+}
+
+// SetSequence sets the revision of the event
+func (c *CalendarEvent) SetSequence(sequence int) *CalendarEvent {
+	c.Sequence = sequence
+	return c
+}
+
+// SetDescription sets the description of the event
+func (c *CalendarEvent) SetDescription(description string) *CalendarEvent {
+	c.Description = description
+	return c
+}
+
+// SetLocation sets where the event takes place
+func (c *CalendarEvent) SetLocation(location string) *CalendarEvent {
+	c.Location = location
+	return c
+}
+
+// SetTimeZone sets the time zone the start and end are written in
+func (c *CalendarEvent) SetTimeZone(loc *time.Location) *CalendarEvent {
+	c.TimeZone = loc
+	return c
+}
+
+// SetOrganizer sets the organizer of the event
+func (c *CalendarEvent) SetOrganizer(email, name string) *CalendarEvent {
+	c.Organizer = CalendarAttendee{Email: email, Name: name}
+	return c
+}
+
+// AddAttendee adds a required attendee to the event
+func (c *CalendarEvent) AddAttendee(email, name string) *CalendarEvent {
+	c.Attendees = append(c.Attendees, CalendarAttendee{Email: email, Name: name})
+	return c
+}
+
+// AddOptionalAttendee adds an optional attendee to the event
+func (c *CalendarEvent) AddOptionalAttendee(email, name string) *CalendarEvent {
+	c.Attendees = append(c.Attendees, CalendarAttendee{Email: email, Name: name, Optional: true})
+	return c
+}
+
+// Cancel turns the event into a cancellation of the event with the same UID, bumping its sequence
+func (c *CalendarEvent) Cancel() *CalendarEvent {
+	c.Method = CalendarMethodCancel
+	c.Sequence++
+	c.Stamp = time.Now().UTC()
+
+	return c
+}
+
+// GetMethod returns the iTIP method of the event, defaulting to REQUEST
+func (c *CalendarEvent) GetMethod() CalendarMethod {
+	if c == nil || c.Method == "" {
+		return CalendarMethodRequest
+	}
+
+	return c.Method
+}
+
+// Validate checks that the event can be sent as an invite
+func (c *CalendarEvent) Validate() error {
+	switch {
+	case c.GetMethod() != CalendarMethodRequest && c.GetMethod() != CalendarMethodCancel:
+		return fmt.Errorf("%w: unsupported method %q", ErrInvalidCalendarEvent, c.Method)
+	case strings.TrimSpace(c.UID) == "":
+		return fmt.Errorf("%w: uid is required", ErrInvalidCalendarEvent)
+	case ValidateEmailAddress(c.Organizer.Email) == "":
+		return fmt.Errorf("%w: organizer is required", ErrInvalidCalendarEvent)
+	case c.Start.IsZero() || c.End.IsZero():
+		return fmt.Errorf("%w: start and end are required", ErrInvalidCalendarEvent)
+	case !c.End.After(c.Start):
+		return fmt.Errorf("%w: end must be after start", ErrInvalidCalendarEvent)
+	}
+
+	for _, attendee := range c.Attendees {
+		if ValidateEmailAddress(attendee.Email) == "" {
+			return fmt.Errorf("%w: invalid attendee %q", ErrInvalidCalendarEvent, attendee.Email)
+		}
+	}
+
+	return nil
+}
+
+// ContentType returns the text/calendar media type of the invite, including its method
+func (c *CalendarEvent) ContentType() string {
+	return "text/calendar; charset=UTF-8; method=" + string(c.GetMethod())
+}
+
+// Attachment returns the invite as an .ics attachment
+func (c *CalendarEvent) Attachment() *Attachment {
+	return &Attachment{
+		Filename:    calendarFilename,
+		Content:     c.Bytes(),
+		ContentType: c.ContentType(),
+	}
+}
+
+// Bytes renders the event as an RFC 5545 iCalendar object
+func (c *CalendarEvent) Bytes() []byte {
+	var b strings.Builder
+
+	line := func(name, value string) {
+		writeCalendarLine(&b, name+":"+value)
+	}
+
+	loc := c.location()
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", calendarProductID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", string(c.GetMethod()))
+
+	if loc != time.UTC {
+		writeTimeZone(&b, loc, c.Start, c.End)
+	}
+
+	stamp := c.Stamp
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+
+	status := "CONFIRMED"
+	if c.GetMethod() == CalendarMethodCancel {
+		status = "CANCELLED"
+	}
+
+	line("BEGIN", "VEVENT")
+	line("UID", escapeCalendarText(c.UID))
+	line("DTSTAMP", stamp.UTC().Format(calendarUTCFormat))
+	writeCalendarLine(&b, "DTSTART"+formatCalendarTime(c.Start, loc))
+	writeCalendarLine(&b, "DTEND"+formatCalendarTime(c.End, loc))
+	line("SEQUENCE", fmt.Sprint(c.Sequence))
+	line("STATUS", status)
+	line("SUMMARY", escapeCalendarText(c.Summary))
+
+	if c.Description != "" {
+		line("DESCRIPTION", escapeCalendarText(c.Description))
+	}
+
+	if c.Location != "" {
+		line("LOCATION", escapeCalendarText(c.Location))
+	}
+
+	writeCalendarLine(&b, "ORGANIZER"+formatCalendarName(c.Organizer.Name)+":mailto:"+strings.TrimSpace(c.Organizer.Email))
+
+	for _, attendee := range c.Attendees {
+		role := "REQ-PARTICIPANT"
+		if attendee.Optional {
+			role = "OPT-PARTICIPANT"
+		}
+
+		writeCalendarLine(&b, "ATTENDEE;CUTYPE=INDIVIDUAL;ROLE="+role+";PARTSTAT=NEEDS-ACTION;RSVP=TRUE"+
+			formatCalendarName(attendee.Name)+":mailto:"+strings.TrimSpace(attendee.Email))
+	}
+
+	line("END", "VEVENT")
+	line("END", "VCALENDAR")
+
+	return []byte(b.String())
+}
+
+// location returns the time zone the event is written in; the process local zone has no TZID
+// recipients could resolve, so it is written as UTC
+func (c *CalendarEvent) location() *time.Location {
+	loc := c.TimeZone
+	if loc == nil {
+		loc = c.Start.Location()
+	}
+
+	if loc == time.Local || loc.String() == "" || loc.String() == "Local" || loc.String() == "UTC" {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// formatCalendarTime formats a DTSTART or DTEND value, including the separating parameter or colon
+func formatCalendarTime(t time.Time, loc *time.Location) string {
+	if loc == time.UTC {
+		return ":" + t.UTC().Format(calendarUTCFormat)
+	}
+
+	return ";TZID=" + loc.String() + ":" + t.In(loc).Format(calendarLocalFormat)
+}
+
+// formatCalendarName formats the CN parameter of an organizer or attendee
+func formatCalendarName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '"' || r == '\r' || r == '\n' {
+			return -1
+		}
+
+		return r
+	}, strings.TrimSpace(name))
+
+	if name == "" {
+		return ""
+	}
+
+	return `;CN="` + name + `"`
+}
+
+// writeTimeZone writes a VTIMEZONE for loc describing the offset transitions around the event
+func writeTimeZone(b *strings.Builder, loc *time.Location, start, end time.Time) {
+	from := time.Date(start.In(loc).Year()-1, time.January, 1, 0, 0, 0, 0, loc)
+	until := time.Date(end.In(loc).Year()+1, time.January, 1, 0, 0, 0, 0, loc)
+
+	writeCalendarLine(b, "BEGIN:VTIMEZONE")
+	writeCalendarLine(b, "TZID:"+loc.String())
+
+	transitions := zoneTransitions(from, until)
+	if len(transitions) == 0 {
+		writeObservance(b, from, time.Unix(0, 0).UTC(), zoneOffset(from))
+	}
+
+	for _, t := range transitions {
+		before := zoneOffset(t.Add(-time.Second))
+		writeObservance(b, t, t.UTC().Add(time.Duration(before)*time.Second), before)
+	}
+
+	writeCalendarLine(b, "END:VTIMEZONE")
+}
+
+// writeObservance writes a STANDARD or DAYLIGHT observance taking effect at onset, given as the local
+// time before the change, when the offset changes from offsetFrom to the offset in effect at t
+func writeObservance(b *strings.Builder, t, onset time.Time, offsetFrom int) {
+	name, offsetTo := t.Zone()
+
+	kind := "STANDARD"
+	if t.IsDST() {
+		kind = "DAYLIGHT"
+	}
+
+	writeCalendarLine(b, "BEGIN:"+kind)
+	writeCalendarLine(b, "DTSTART:"+onset.Format(calendarLocalFormat))
+	writeCalendarLine(b, "TZOFFSETFROM:"+formatUTCOffset(offsetFrom))
+	writeCalendarLine(b, "TZOFFSETTO:"+formatUTCOffset(offsetTo))
+
+	if name != "" {
+		writeCalendarLine(b, "TZNAME:"+escapeCalendarText(name))
+	}
+
+	writeCalendarLine(b, "END:"+kind)
+}
+
+// zoneTransitions returns the instants between from and until at which the UTC offset of their
+// location changes
+func zoneTransitions(from, until time.Time) []time.Time {
+	var transitions []time.Time
+
+	for t := from; t.Before(until); t = t.Add(24 * time.Hour) {
+		next := t.Add(24 * time.Hour)
+
+		if zoneOffset(t) == zoneOffset(next) {
+			continue
+		}
+
+		// binary search for the first second of the new offset
+		lo, hi := t, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+
+			if zoneOffset(mid) == zoneOffset(lo) {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+
+		transitions = append(transitions, hi)
+	}
+
+	return transitions
+}
+
+// zoneOffset returns the offset of t from UTC in seconds
+func zoneOffset(t time.Time) int {
+	_, offset := t.Zone()
+	return offset
+}
+
+// formatUTCOffset formats an offset in seconds east of UTC as +HHMM
+func formatUTCOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+
+	return fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+}
+
+// escapeCalendarText escapes a TEXT property value
+func escapeCalendarText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(value)
+}
+
+// writeCalendarLine writes a content line folded at 75 octets without splitting UTF-8 sequences
+func writeCalendarLine(b *strings.Builder, line string) {
+	limit := calendarLineLength
+
+	for len(line) > limit {
+		n := limit
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+
+		b.WriteString(line[:n] + "\r\n ")
+		line = line[n:]
+
+		// continuation lines start with a space, leaving one octet less for content
+		limit = calendarLineLength - 1
+	}
+
+	b.WriteString(line + "\r\n")
+}
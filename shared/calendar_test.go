@@ -0,0 +1,220 @@
+package shared
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unfoldCalendar joins folded iCalendar content lines
+func unfoldCalendar(ics []byte) []string {
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(ics), "\r\n ", ""), "\r\n"), "\r\n")
+}
+
+func newTestCalendarEvent(t *testing.T) *CalendarEvent {
+	t.Helper()
+
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	return NewCalendarEvent("Mail route review", time.Date(2026, time.March, 20, 9, 0, 0, 0, loc), time.Date(2026, time.March, 20, 10, 0, 0, 0, loc)).
+		SetUID("route-review@usps.com").
+		SetDescription("Bring the route maps; we are reviewing Kramer's, Jerry's and Elaine's buildings\nSee you there").
+		SetLocation("Post office, room 3").
+		SetOrganizer("newman@usps.com", "Newman").
+		AddAttendee("jerry@seinfeld.com", "Jerry Seinfeld").
+		AddOptionalAttendee("kramer@seinfeld.com", `Cosmo "Kramer"`)
+}
+
+func TestCalendarEventBytes(t *testing.T) {
+	event := newTestCalendarEvent(t)
+	event.Stamp = time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	ics := event.Bytes()
+
+	for line := range strings.SplitSeq(string(ics), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+
+	lines := unfoldCalendar(ics)
+
+	assert.Equal(t, "BEGIN:VCALENDAR", lines[0])
+	assert.Equal(t, "END:VCALENDAR", lines[len(lines)-1])
+	assert.Contains(t, lines, "METHOD:REQUEST")
+	assert.Contains(t, lines, "UID:route-review@usps.com")
+	assert.Contains(t, lines, "DTSTAMP:20260301T120000Z")
+	assert.Contains(t, lines, "DTSTART;TZID=America/New_York:20260320T090000")
+	assert.Contains(t, lines, "DTEND;TZID=America/New_York:20260320T100000")
+	assert.Contains(t, lines, "STATUS:CONFIRMED")
+	assert.Contains(t, lines, `DESCRIPTION:Bring the route maps\; we are reviewing Kramer's\, Jerry's and Elaine's buildings\nSee you there`)
+	assert.Contains(t, lines, `ORGANIZER;CN="Newman":mailto:newman@usps.com`)
+	assert.Contains(t, lines, `ATTENDEE;CUTYPE=INDIVIDUAL;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE;CN="Jerry Seinfeld":mailto:jerry@seinfeld.com`)
+	assert.Contains(t, lines, `ATTENDEE;CUTYPE=INDIVIDUAL;ROLE=OPT-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE;CN="Cosmo Kramer":mailto:kramer@seinfeld.com`)
+
+	// the time zone describes the daylight saving transitions around the event
+	assert.Contains(t, lines, "TZID:America/New_York")
+	assert.Contains(t, lines, "BEGIN:DAYLIGHT")
+	assert.Contains(t, lines, "DTSTART:20260308T020000")
+	assert.Contains(t, lines, "TZOFFSETFROM:-0500")
+	assert.Contains(t, lines, "TZOFFSETTO:-0400")
+	assert.Contains(t, lines, "TZNAME:EDT")
+	assert.Contains(t, lines, "BEGIN:STANDARD")
+	assert.Contains(t, lines, "DTSTART:20261101T020000")
+}
+
+func TestCalendarEventUTC(t *testing.T) {
+	start := time.Date(2026, time.March, 20, 13, 0, 0, 0, time.UTC)
+
+	event := NewCalendarEvent("Mail route review", start, start.Add(time.Hour)).SetOrganizer("newman@usps.com", "")
+
+	lines := unfoldCalendar(event.Bytes())
+
+	assert.Contains(t, lines, "DTSTART:20260320T130000Z")
+	assert.Contains(t, lines, "DTEND:20260320T140000Z")
+	assert.Contains(t, lines, "ORGANIZER:mailto:newman@usps.com")
+	assert.NotContains(t, lines, "BEGIN:VTIMEZONE")
+}
+
+func TestCalendarEventTimeZoneOverride(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	start := time.Date(2026, time.July, 1, 8, 0, 0, 0, time.UTC)
+
+	event := NewCalendarEvent("Mail route review", start, start.Add(time.Hour)).
+		SetOrganizer("newman@usps.com", "Newman").
+		SetTimeZone(loc)
+
+	lines := unfoldCalendar(event.Bytes())
+
+	assert.Contains(t, lines, "DTSTART;TZID=Europe/Berlin:20260701T100000")
+	assert.Contains(t, lines, "TZOFFSETTO:+0200")
+}
+
+func TestCalendarEventCancel(t *testing.T) {
+	event := newTestCalendarEvent(t).SetSequence(1).Cancel()
+
+	assert.Equal(t, CalendarMethodCancel, event.GetMethod())
+	assert.Equal(t, 2, event.Sequence)
+	assert.Equal(t, "text/calendar; charset=UTF-8; method=CANCEL", event.ContentType())
+
+	lines := unfoldCalendar(event.Bytes())
+
+	assert.Contains(t, lines, "METHOD:CANCEL")
+	assert.Contains(t, lines, "STATUS:CANCELLED")
+	assert.Contains(t, lines, "SEQUENCE:2")
+	assert.Contains(t, lines, "UID:route-review@usps.com")
+}
+
+func TestCalendarEventValidate(t *testing.T) {
+	start := time.Date(2026, time.March, 20, 13, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		event *CalendarEvent
+	}{
+		{
+			name:  "missing organizer",
+			event: NewCalendarEvent("Review", start, start.Add(time.Hour)),
+		},
+		{
+			name:  "end before start",
+			event: NewCalendarEvent("Review", start, start.Add(-time.Hour)).SetOrganizer("newman@usps.com", ""),
+		},
+		{
+			name:  "missing uid",
+			event: NewCalendarEvent("Review", start, start.Add(time.Hour)).SetOrganizer("newman@usps.com", "").SetUID(""),
+		},
+		{
+			name:  "invalid attendee",
+			event: NewCalendarEvent("Review", start, start.Add(time.Hour)).SetOrganizer("newman@usps.com", "").AddAttendee("jerry", ""),
+		},
+		{
+			name:  "unsupported method",
+			event: &CalendarEvent{UID: "review", Method: "PUBLISH", Start: start, End: start.Add(time.Hour), Organizer: CalendarAttendee{Email: "newman@usps.com"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.event.Validate(), ErrInvalidCalendarEvent)
+		})
+	}
+
+	require.NoError(t, newTestCalendarEvent(t).Validate())
+}
+
+func TestCalendarLineFolding(t *testing.T) {
+	event := newTestCalendarEvent(t).SetDescription(strings.Repeat("Grüße aus dem Postamt ", 20))
+
+	ics := event.Bytes()
+
+	for line := range strings.SplitSeq(string(ics), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+		assert.True(t, strings.ToValidUTF8(line, "") == line, "folding split a UTF-8 sequence")
+	}
+
+	assert.Contains(t, unfoldCalendar(ics), "DESCRIPTION:"+strings.Repeat("Grüße aus dem Postamt ", 20))
+}
+
+func TestEmailMessageCalendar(t *testing.T) {
+	event := newTestCalendarEvent(t)
+
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello, Jerry").
+		SetCalendar(event)
+
+	attachments := message.GetAttachments()
+	require.Len(t, attachments, 1)
+	assert.Equal(t, "invite.ics", attachments[0].GetFilename())
+	assert.Equal(t, "text/calendar; charset=UTF-8; method=REQUEST", attachments[0].GetContentType())
+	assert.Equal(t, event.Bytes(), attachments[0].GetRawContent())
+
+	require.NoError(t, ValidateEmailMessage(message))
+
+	event.SetOrganizer("", "")
+	assert.ErrorIs(t, ValidateEmailMessage(message), ErrInvalidCalendarEvent)
+}
+
+func TestBuildMimeMessageCalendar(t *testing.T) {
+	event := newTestCalendarEvent(t)
+
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello, Jerry").
+		SetHTML("<p>Hello, Jerry</p>").
+		SetCalendar(event)
+
+	raw, err := BuildMimeMessage(message)
+	require.NoError(t, err)
+
+	parsed, mediaType, params := parseMimeMessage(t, raw)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	parts, contents := readParts(t, parsed.Body, params["boundary"])
+	require.Len(t, parts, 2)
+
+	// the invite is both an alternative body and an .ics attachment
+	assert.Equal(t, "invite.ics", parts[1].FileName())
+	assert.True(t, strings.HasPrefix(parts[1].Header.Get("Content-Type"), "text/calendar; charset=UTF-8; method=REQUEST"))
+
+	_, params, err = mime.ParseMediaType(parts[0].Header.Get("Content-Type"))
+	require.NoError(t, err)
+
+	alternatives, altContents := readParts(t, bytes.NewReader(contents[0]), params["boundary"])
+	require.Len(t, alternatives, 3)
+
+	mediaType, params, err = mime.ParseMediaType(alternatives[2].Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "text/calendar", mediaType)
+	assert.Equal(t, "REQUEST", params["method"])
+	assert.Equal(t, string(event.Bytes()), string(altContents[2]))
+
+	event.SetOrganizer("", "")
+
+	_, err = BuildMimeMessage(message)
+	assert.ErrorIs(t, err, ErrInvalidCalendarEvent)
+}
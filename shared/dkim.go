@@ -0,0 +1,469 @@
+package shared
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dkimSignatureHeader is the name of the header a DKIM signature is written to
+	dkimSignatureHeader = "DKIM-Signature"
+	// dkimMinRSABits is the smallest RSA key RFC 8301 allows for signing
+	dkimMinRSABits = 1024
+	// dkimSignatureLineLength is the number of signature characters written on each folded line
+	dkimSignatureLineLength = 72
+)
+
+// defaultDKIMHeaders are the headers written by BuildMimeMessage that are signed unless WithDKIMHeaders is used
+var defaultDKIMHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID", "In-Reply-To", "References", "MIME-Version", "Content-Type",
+	// RFC 8058 section 4 requires the one-click unsubscribe headers to be signed
+	"List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// DKIMSigner signs MIME messages with a DKIM signature (RFC 6376) using relaxed/relaxed canonicalization,
+// with an RSA key as rsa-sha256 or an Ed25519 key as ed25519-sha256 (RFC 8463)
+type DKIMSigner struct {
+	domain    string
+	selector  string
+	key       crypto.Signer
+	algorithm string
+	headers   []string
+}
+
+// DKIMOption configures a DKIMSigner
+type DKIMOption func(*DKIMSigner)
+
+// WithDKIMHeaders sets the headers to sign, in addition to From which is always signed. Headers missing from a
+// message are left out of its signature
+func WithDKIMHeaders(headers ...string) DKIMOption {
+	return func(s *DKIMSigner) {
+		s.headers = headers
+	}
+}
+
+// NewDKIMSigner creates a DKIMSigner for the domain, publishing its public key under the selector as
+// <selector>._domainkey.<domain>. The key must be an *rsa.PrivateKey of at least 1024 bits or an ed25519.PrivateKey
+func NewDKIMSigner(domain, selector string, key crypto.Signer, opts ...DKIMOption) (*DKIMSigner, error) {
+	s := &DKIMSigner{
+		domain:   strings.TrimSpace(domain),
+		selector: strings.TrimSpace(selector),
+		key:      key,
+		headers:  defaultDKIMHeaders,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.domain == "" || s.selector == "" {
+		return nil, fmt.Errorf("%w: domain and selector are required", ErrInvalidDKIMSigner)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < dkimMinRSABits {
+			return nil, fmt.Errorf("%w: RSA keys must be at least %d bits", ErrInvalidDKIMSigner, dkimMinRSABits)
+		}
+
+		s.algorithm = "rsa-sha256"
+	case ed25519.PrivateKey:
+		s.algorithm = "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidDKIMSigner, key)
+	}
+
+	if !slices.ContainsFunc(s.headers, func(header string) bool { return strings.EqualFold(header, "From") }) {
+		s.headers = append([]string{"From"}, s.headers...)
+	}
+
+	return s, nil
+}
+
+// WithDKIMSigner signs the message with the DKIM signer. The message is built in memory, since the signature
+// covers the whole body but is written ahead of it
+func WithDKIMSigner(signer *DKIMSigner) MimeOption {
+	return func(o *mimeOptions) {
+		o.dkimSigner = signer
+	}
+}
+
+// Sign returns the message with a DKIM-Signature header added ahead of its headers
+func (s *DKIMSigner) Sign(message []byte) ([]byte, error) {
+	signature, err := s.Signature(message)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(signature), message...), nil
+}
+
+// Signature returns the DKIM-Signature header for the message, including the trailing CRLF
+func (s *DKIMSigner) Signature(message []byte) (string, error) {
+	header, body, err := splitMessage(message)
+	if err != nil {
+		return "", err
+	}
+
+	fields := headerFields(header)
+
+	var names []string
+
+	signed := selectHeaders(fields, s.headers, func(name string) { names = append(names, strings.ToLower(name)) })
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	field := fmt.Sprintf("%s: v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s;\r\n\tt=%d; h=%s;\r\n\tbh=%s;\r\n\tb=",
+		dkimSignatureHeader, s.algorithm, s.domain, s.selector, time.Now().Unix(), strings.Join(names, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]))
+
+	hash := headerHash(signed, field)
+
+	opts := crypto.SignerOpts(crypto.SHA256)
+	if s.algorithm == "ed25519-sha256" {
+		// Ed25519 signs the hash itself rather than a digest of it, RFC 8463 section 3
+		opts = crypto.Hash(0)
+	}
+
+	sig, err := s.key.Sign(rand.Reader, hash, opts)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidDKIMSigner, err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(sig)
+
+	var b strings.Builder
+
+	b.WriteString(field)
+
+	for len(encoded) > dkimSignatureLineLength {
+		b.WriteString(encoded[:dkimSignatureLineLength] + "\r\n\t")
+		encoded = encoded[dkimSignatureLineLength:]
+	}
+
+	b.WriteString(encoded + "\r\n")
+
+	return b.String(), nil
+}
+
+// DNSRecord returns the TXT record publishing the public key, to be served at <selector>._domainkey.<domain>
+func (s *DKIMSigner) DNSRecord() string {
+	if k, ok := s.key.Public().(ed25519.PublicKey); ok {
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(k)
+	}
+
+	der, _ := x509.MarshalPKIXPublicKey(s.key.Public())
+
+	return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)
+}
+
+// DKIMKeyLookup returns the public key published for a DKIM selector of a domain
+type DKIMKeyLookup func(domain, selector string) (crypto.PublicKey, error)
+
+// LookupDKIMKey looks up the public key of a DKIM selector in DNS
+func LookupDKIMKey(domain, selector string) (crypto.PublicKey, error) {
+	records, err := net.LookupTXT(selector + "._domainkey." + domain)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDKIMVerification, err)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: no key record for %s._domainkey.%s", ErrDKIMVerification, selector, domain)
+	}
+
+	return ParseDKIMRecord(records[0])
+}
+
+// ParseDKIMRecord parses the public key from a DKIM TXT record such as "v=DKIM1; k=ed25519; p=..."
+func ParseDKIMRecord(record string) (crypto.PublicKey, error) {
+	tags := parseDKIMTags(record)
+
+	p := strings.Join(strings.Fields(tags["p"]), "")
+	if p == "" {
+		return nil, fmt.Errorf("%w: key record has no public key", ErrDKIMVerification)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDKIMVerification, err)
+	}
+
+	switch tags["k"] {
+	case "ed25519":
+		if len(der) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid Ed25519 public key", ErrDKIMVerification)
+		}
+
+		return ed25519.PublicKey(der), nil
+	case "", "rsa":
+		if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+			return key, nil
+		}
+
+		// some records publish the bare PKCS #1 key
+		key, err := x509.ParsePKCS1PublicKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDKIMVerification, err)
+		}
+
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %q", ErrDKIMVerification, tags["k"])
+	}
+}
+
+// VerifyDKIM checks every relaxed/relaxed DKIM signature of the message, looking up the public keys with
+// lookup, which defaults to LookupDKIMKey. It fails when the message has no signature or any signature
+// does not verify
+func VerifyDKIM(message []byte, lookup DKIMKeyLookup) error {
+	if lookup == nil {
+		lookup = LookupDKIMKey
+	}
+
+	header, body, err := splitMessage(message)
+	if err != nil {
+		return err
+	}
+
+	fields := headerFields(header)
+	verified := 0
+
+	for _, field := range fields {
+		if name, _, _ := strings.Cut(field, ":"); !strings.EqualFold(strings.TrimSpace(name), dkimSignatureHeader) {
+			continue
+		}
+
+		if err := verifyDKIMSignature(field, fields, body, lookup); err != nil {
+			return err
+		}
+
+		verified++
+	}
+
+	if verified == 0 {
+		return fmt.Errorf("%w: no %s header", ErrDKIMVerification, dkimSignatureHeader)
+	}
+
+	return nil
+}
+
+// verifyDKIMSignature checks a single DKIM-Signature header against the headers and body of the message
+func verifyDKIMSignature(field string, fields []string, body []byte, lookup DKIMKeyLookup) error {
+	_, value, _ := strings.Cut(field, ":")
+	tags := parseDKIMTags(value)
+
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s=%s: %s", ErrDKIMVerification, tags["d"], tags["s"], fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case tags["v"] != "1":
+		return fail("unsupported version %q", tags["v"])
+	case tags["c"] != "relaxed/relaxed" && tags["c"] != "relaxed":
+		return fail("unsupported canonicalization %q", tags["c"])
+	case tags["l"] != "":
+		return fail("body length limits are not supported")
+	}
+
+	if expires, err := strconv.ParseInt(tags["x"], 10, 64); err == nil && time.Now().Unix() > expires {
+		return fail("signature expired")
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	expected, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(tags["bh"]), ""))
+	if err != nil || subtle.ConstantTimeCompare(expected, bodyHash[:]) != 1 {
+		return fail("body hash does not match")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(tags["b"]), ""))
+	if err != nil {
+		return fail("invalid signature encoding")
+	}
+
+	var names []string
+
+	for name := range strings.SplitSeq(tags["h"], ":") {
+		names = append(names, strings.TrimSpace(name))
+	}
+
+	// the signature field itself is signed with an empty b= tag, and is never one of the signed headers
+	others := slices.DeleteFunc(slices.Clone(fields), func(f string) bool { return f == field })
+	hash := headerHash(selectHeaders(others, names, nil), stripSignature(field))
+
+	key, err := lookup(tags["d"], tags["s"])
+	if err != nil {
+		return err
+	}
+
+	switch tags["a"] {
+	case "rsa-sha256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash, sig) != nil {
+			return fail("signature does not verify")
+		}
+	case "ed25519-sha256":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(pub, hash, sig) {
+			return fail("signature does not verify")
+		}
+	default:
+		return fail("unsupported algorithm %q", tags["a"])
+	}
+
+	return nil
+}
+
+// splitMessage splits a message into its header, including the CRLF ending the last field, and its body
+func splitMessage(message []byte) ([]byte, []byte, error) {
+	end := bytes.Index(message, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil, nil, fmt.Errorf("%w: no blank line after the headers", ErrInvalidMimeMessage)
+	}
+
+	return message[:end+2], message[end+4:], nil
+}
+
+// headerFields splits a message header into its fields, each with its folded lines but without the final CRLF
+func headerFields(header []byte) []string {
+	var fields []string
+
+	for line := range strings.SplitSeq(strings.TrimSuffix(string(header), "\r\n"), "\r\n") {
+		if len(fields) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			fields[len(fields)-1] += "\r\n" + line
+			continue
+		}
+
+		fields = append(fields, line)
+	}
+
+	return fields
+}
+
+// selectHeaders picks the fields to sign for the header names, taking repeated headers from the bottom up
+// as RFC 6376 section 5.4.2 describes. Names without a matching field are skipped, and found is called
+// with the name of each field picked
+func selectHeaders(fields, names []string, found func(name string)) []string {
+	used := make([]bool, len(fields))
+
+	var selected []string
+
+	for _, name := range names {
+		for i := len(fields) - 1; i >= 0; i-- {
+			fieldName, _, _ := strings.Cut(fields[i], ":")
+			if used[i] || !strings.EqualFold(strings.TrimSpace(fieldName), name) {
+				continue
+			}
+
+			used[i] = true
+			selected = append(selected, fields[i])
+
+			if found != nil {
+				found(name)
+			}
+
+			break
+		}
+	}
+
+	return selected
+}
+
+// headerHash returns the SHA-256 hash of the relaxed canonical signed headers followed by the signature
+// field with an empty b= tag and no trailing CRLF
+func headerHash(signed []string, signature string) []byte {
+	h := sha256.New()
+
+	for _, field := range signed {
+		h.Write([]byte(relaxedHeader(field) + "\r\n"))
+	}
+
+	h.Write([]byte(relaxedHeader(signature)))
+
+	return h.Sum(nil)
+}
+
+// stripSignature empties the b= tag of a DKIM-Signature field
+func stripSignature(field string) string {
+	tags := strings.Split(field, ";")
+
+	for i, tag := range tags {
+		if key, _, ok := strings.Cut(tag, "="); ok && strings.TrimSpace(key) == "b" {
+			tags[i] = tag[:strings.Index(tag, "=")+1]
+		}
+	}
+
+	return strings.Join(tags, ";")
+}
+
+// relaxedHeader canonicalizes a header field with the relaxed algorithm of RFC 6376 section 3.4.2: the name
+// is lowercased, the value unfolded with runs of whitespace reduced to a single space and trimmed
+func relaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+
+	value = strings.Join(strings.FieldsFunc(strings.ReplaceAll(value, "\r\n", ""), isWSP), " ")
+
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + value
+}
+
+// relaxedBody canonicalizes a body with the relaxed algorithm of RFC 6376 section 3.4.4: runs of whitespace
+// are reduced to a single space, whitespace at the end of lines and empty lines at the end of the body are
+// removed, and a non-empty body ends with CRLF
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		lines[i] = strings.Join(strings.FieldsFunc(line, isWSP), " ")
+
+		// keep leading whitespace, reduced to a single space
+		if line != "" && isWSP(rune(line[0])) {
+			lines[i] = " " + lines[i]
+		}
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// isWSP reports whether r is whitespace as RFC 5322 defines it, a space or a horizontal tab
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// parseDKIMTags parses a tag list such as "v=1; a=rsa-sha256; d=example.com" into its tags, with the
+// whitespace around each tag and value removed
+func parseDKIMTags(list string) map[string]string {
+	tags := map[string]string{}
+
+	for tag := range strings.SplitSeq(list, ";") {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			continue
+		}
+
+		tags[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return tags
+}
@@ -0,0 +1,164 @@
+package shared
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc8463Message is the example message of RFC 8463 appendix A.3 with its RSA signature
+var rfc8463Message = strings.ReplaceAll(`DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed;
+ d=football.example.com; i=@football.example.com;
+ q=dns/txt; s=test; t=1528637909; h=from : to : subject :
+ date : message-id : from : subject : date;
+ bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;
+ b=F45dVWDfMbQDGHJFlXUNB2HKfbCeLRyhDXgFpEL8GwpsRe0IeIixNTe3
+ DhCVlUrSjV4BwcVcOF6+FF3Zo9Rpo1tFOeS9mPYQTnGdaSGsgeefOsk2Jz
+ dA+L10TeYt9BgDfQNZtKdN1WO//KgIqXP7OdEFE4LjFYNcUxZQ4FADY+8=
+From: Joe SixPack <joe@football.example.com>
+To: Suzie Q <suzie@shopping.example.net>
+Subject: Is dinner ready?
+Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)
+Message-ID: <20030712040037.46341.5F8J@football.example.com>
+
+Hi.
+
+We lost the game.  Are you hungry yet?
+
+Joe.
+`, "\n", "\r\n")
+
+// rfc8463Record is the RSA key record of RFC 8463 appendix A.2
+const rfc8463Record = "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDkHlOQoBTzWRiGs5V6NpP3idY6Wk08a5qhdR6wy5bdOKb2jLQiY/J16JYi0Qvx/byYzCNb3W91y3FutACDfzwQ/BC/e/8uBsCR+yz1Lxj+PL6lHvqMKrM3rG4hstT5QjvHO9PzoxZyVYLzBfO2EeC3Ip3G+2kryOTIKT+l/K4w3QIDAQAB"
+
+// recordLookup returns a key lookup serving the DNS record of the signer
+func recordLookup(t *testing.T, record string) DKIMKeyLookup {
+	t.Helper()
+
+	return func(_, _ string) (crypto.PublicKey, error) {
+		return ParseDKIMRecord(record)
+	}
+}
+
+func TestVerifyDKIMRFC8463(t *testing.T) {
+	lookup := recordLookup(t, rfc8463Record)
+
+	require.NoError(t, VerifyDKIM([]byte(rfc8463Message), lookup))
+
+	tampered := strings.Replace(rfc8463Message, "We lost the game", "We won the game", 1)
+	assert.ErrorIs(t, VerifyDKIM([]byte(tampered), lookup), ErrDKIMVerification)
+
+	tampered = strings.Replace(rfc8463Message, "Subject: Is dinner ready?", "Subject: Is lunch ready?", 1)
+	assert.ErrorIs(t, VerifyDKIM([]byte(tampered), lookup), ErrDKIMVerification)
+
+	assert.ErrorIs(t, VerifyDKIM([]byte("From: joe@football.example.com\r\n\r\nHi.\r\n"), lookup), ErrDKIMVerification)
+}
+
+func TestDKIMSigner(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		algorithm string
+		key       crypto.Signer
+	}{
+		{"rsa-sha256", rsaKey},
+		{"ed25519-sha256", edKey},
+	} {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			signer, err := NewDKIMSigner("usps.com", "route42", tt.key)
+			require.NoError(t, err)
+
+			message := NewEmailMessage("Newman <newman@usps.com>", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello,  Jerry\n\n").
+				SetHTML("<p>Hello, Jerry</p>").
+				AddAttachment(NewAttachment("route.csv", []byte("42,Kramer")))
+
+			signed, err := BuildMimeMessage(message, WithDKIMSigner(signer))
+			require.NoError(t, err)
+
+			require.True(t, bytes.HasPrefix(signed, []byte("DKIM-Signature: v=1; a="+tt.algorithm+"; c=relaxed/relaxed; d=usps.com; s=route42;")))
+			assert.Contains(t, string(signed), "h=from:subject:date:to:message-id:mime-version:content-type;")
+
+			lookup := recordLookup(t, signer.DNSRecord())
+
+			require.NoError(t, VerifyDKIM(signed, lookup))
+
+			// relaxed canonicalization survives refolding and trailing whitespace
+			relaxed := bytes.Replace(signed, []byte("Subject: Mail route review"), []byte("Subject:  Mail route\r\n review  "), 1)
+			relaxed = append(relaxed, "\r\n\r\n"...)
+			require.NoError(t, VerifyDKIM(relaxed, lookup))
+
+			tampered := bytes.Replace(signed, []byte("Subject: Mail route review"), []byte("Subject: Mail route revue"), 1)
+			assert.ErrorIs(t, VerifyDKIM(tampered, lookup), ErrDKIMVerification)
+
+			// a header the signer adds after signing, such as Gmail's Bcc, does not break the signature
+			require.NoError(t, VerifyDKIM(append([]byte("Bcc: george@seinfeld.com\r\n"), signed...), lookup))
+		})
+	}
+}
+
+func TestDKIMSignerHeaders(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signer, err := NewDKIMSigner("usps.com", "route42", key, WithDKIMHeaders("Subject", "X-Route"))
+	require.NoError(t, err)
+
+	signed, err := signer.Sign([]byte("From: newman@usps.com\r\nSubject: Hello\r\nX-Route: 42\r\nTo: jerry@seinfeld.com\r\n\r\nHello, Jerry\r\n"))
+	require.NoError(t, err)
+
+	// From is always signed, and To is not
+	assert.Contains(t, string(signed), "h=from:subject:x-route;")
+	require.NoError(t, VerifyDKIM(signed, recordLookup(t, signer.DNSRecord())))
+
+	_, err = signer.Sign([]byte("From: newman@usps.com"))
+	assert.ErrorIs(t, err, ErrInvalidMimeMessage)
+}
+
+func TestNewDKIMSignerInvalid(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	_, err = NewDKIMSigner("usps.com", "", edKey)
+	assert.ErrorIs(t, err, ErrInvalidDKIMSigner)
+
+	// RFC 8301 requires at least 1024 bits
+	smallKey := &rsa.PrivateKey{PublicKey: rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 511), E: 65537}}
+
+	_, err = NewDKIMSigner("usps.com", "route42", smallKey)
+	assert.ErrorIs(t, err, ErrInvalidDKIMSigner)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, err = NewDKIMSigner("usps.com", "route42", ecKey)
+	assert.ErrorIs(t, err, ErrInvalidDKIMSigner)
+}
+
+func TestParseDKIMRecord(t *testing.T) {
+	key, err := ParseDKIMRecord(rfc8463Record)
+	require.NoError(t, err)
+	assert.IsType(t, &rsa.PublicKey{}, key)
+
+	key, err = ParseDKIMRecord("v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=")
+	require.NoError(t, err)
+	assert.Len(t, key, ed25519.PublicKeySize)
+
+	for _, record := range []string{"v=DKIM1; k=rsa; p=", "v=DKIM1; k=ed25519; p=AAAA", "v=DKIM1; k=dsa; p=AAAA"} {
+		_, err := ParseDKIMRecord(record)
+		assert.ErrorIs(t, err, ErrDKIMVerification, record)
+	}
+}
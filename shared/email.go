@@ -1,12 +1,6 @@
 package shared
 
-import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"strings"
-	"time"
-)
+import "fmt"
 
 const DefaultMaxAttachmentSize = 25 * 1024 * 1024 // 25 MB
 
@@ -34,8 +28,29 @@ type EmailMessage struct {
 	Attachments []*Attachment `json:"attachments,omitempty"`
 	// Headers is the list of headers associated with the email
 	Headers map[string]string `json:"headers,omitempty"`
+	// MessageID is the Message-ID of the email; one is generated when building the MIME message if it is empty
+	MessageID string `json:"message_id,omitempty"`
+	// InReplyTo is the Message-ID of the email this one replies to
+	InReplyTo string `json:"in_reply_to,omitempty"`
+	// References is the list of Message-IDs of the thread this email belongs to, oldest first
+	References []string `json:"references,omitempty"`
+	// Substitutions are per-message template variables used by providers that merge a batch of messages
+	// sharing one body into a single request; SendGrid replaces each key in the body as written, while
+	// Mailgun exposes them as recipient variables referenced as %recipient.<key>%
+	Substitutions map[string]string `json:"substitutions,omitempty"`
+	// Calendar is a calendar invite sent as a text/calendar alternative and an .ics attachment
+	Calendar *CalendarEvent `json:"calendar,omitempty"`
 	// Maximum size for attachments
 	maxAttachmentSize int
+	// attachmentPolicy controls what happens to attachments over the maximum size
+	attachmentPolicy AttachmentPolicy
+	// dropHook is called for attachments dropped under AttachmentPolicyDrop
+	dropHook AttachmentDropHook
+	// validationMode controls which problems ValidateEmailMessage reports
+	validationMode ValidationMode
+	// unsubscriber generates the one-click unsubscribe headers, scoped to unsubscribeList
+	unsubscriber    *Unsubscriber
+	unsubscribeList string
 }
 
 // Tag is used to define custom metadata for message
@@ -134,6 +149,45 @@ func (e *EmailMessage) SetAttachments(attachments []*Attachment) *EmailMessage {
 	return e
 }
 
+// SetMessageID sets the Message-ID of the email
+func (e *EmailMessage) SetMessageID(messageID string) *EmailMessage {
+	e.MessageID = messageID
+	return e
+}
+
+// SetInReplyTo sets the Message-ID of the email this one replies to
+func (e *EmailMessage) SetInReplyTo(messageID string) *EmailMessage {
+	e.InReplyTo = messageID
+	return e
+}
+
+// SetReferences sets the Message-IDs of the thread this email belongs to
+func (e *EmailMessage) SetReferences(references []string) *EmailMessage {
+	e.References = references
+	return e
+}
+
+// AddReference adds a Message-ID to the References of the email
+func (e *EmailMessage) AddReference(messageID string) *EmailMessage {
+	e.References = append(e.References, messageID)
+	return e
+}
+
+// SetCalendar sets the calendar invite sent with the email
+func (e *EmailMessage) SetCalendar(event *CalendarEvent) *EmailMessage {
+	e.Calendar = event
+	return e
+}
+
+// GetCalendar returns the calendar invite sent with the email, if any
+func (e *EmailMessage) GetCalendar() *CalendarEvent {
+	if e == nil {
+		return nil
+	}
+
+	return e.Calendar
+}
+
 // AddToRecipient adds a recipient email address to the To field
 func (e *EmailMessage) AddToRecipient(recipient string) *EmailMessage {
 	e.To = append(e.To, recipient)
@@ -158,7 +212,7 @@ func (e *EmailMessage) AddAttachment(attachment *Attachment) *EmailMessage {
 	return e
 }
 
-// GetFrom returns the trimmed and validated sender email address
+// GetFrom returns the trimmed and validated sender email address, without its display name
 func (e *EmailMessage) GetFrom() string {
 	if e == nil {
 		return ""
@@ -167,7 +221,7 @@ func (e *EmailMessage) GetFrom() string {
 	return ValidateEmailAddress(e.From)
 }
 
-// GetTo returns a slice of trimmed and validated recipient email addresses
+// GetTo returns a slice of trimmed and validated recipient email addresses, without their display names
 func (e *EmailMessage) GetTo() []string {
 	if e == nil {
 		return []string{}
@@ -203,6 +257,85 @@ func (e *EmailMessage) GetReplyTo() string {
 	return ValidateEmailAddress(e.ReplyTo)
 }
 
+// SetFromAddress sets the sender, including its display name
+func (e *EmailMessage) SetFromAddress(from Address) *EmailMessage {
+	e.From = from.String()
+	return e
+}
+
+// SetReplyToAddress sets the reply-to address, including its display name
+func (e *EmailMessage) SetReplyToAddress(replyTo Address) *EmailMessage {
+	e.ReplyTo = replyTo.String()
+	return e
+}
+
+// AddToAddress adds a recipient, including its display name, to the To field
+func (e *EmailMessage) AddToAddress(recipient Address) *EmailMessage {
+	e.To = append(e.To, recipient.String())
+	return e
+}
+
+// AddCCAddress adds a recipient, including its display name, to the CC field
+func (e *EmailMessage) AddCCAddress(recipient Address) *EmailMessage {
+	e.Cc = append(e.Cc, recipient.String())
+	return e
+}
+
+// AddBCCAddress adds a recipient, including its display name, to the BCC field
+func (e *EmailMessage) AddBCCAddress(recipient Address) *EmailMessage {
+	e.Bcc = append(e.Bcc, recipient.String())
+	return e
+}
+
+// GetFromAddress returns the sender with its display name, or the zero Address when it is not valid
+func (e *EmailMessage) GetFromAddress() Address {
+	if e == nil {
+		return Address{}
+	}
+
+	address, _ := ParseAddress(e.From)
+
+	return address
+}
+
+// GetToAddresses returns the valid recipients with their display names
+func (e *EmailMessage) GetToAddresses() []Address {
+	if e == nil {
+		return []Address{}
+	}
+
+	return parseAddresses(e.To)
+}
+
+// GetCCAddresses returns the valid CC recipients with their display names
+func (e *EmailMessage) GetCCAddresses() []Address {
+	if e == nil {
+		return []Address{}
+	}
+
+	return parseAddresses(e.Cc)
+}
+
+// GetBCCAddresses returns the valid BCC recipients with their display names
+func (e *EmailMessage) GetBCCAddresses() []Address {
+	if e == nil {
+		return []Address{}
+	}
+
+	return parseAddresses(e.Bcc)
+}
+
+// GetReplyToAddress returns the reply-to address with its display name, or the zero Address when it is not valid
+func (e *EmailMessage) GetReplyToAddress() Address {
+	if e == nil {
+		return Address{}
+	}
+
+	address, _ := ParseAddress(e.ReplyTo)
+
+	return address
+}
+
 // GetSubject returns the email subject
 func (e *EmailMessage) GetSubject() string {
 	if e == nil {
@@ -236,164 +369,74 @@ func (e *EmailMessage) SetMaxAttachmentSize(size int) *EmailMessage {
 	return e
 }
 
-// GetAttachments returns the attachments to be included in the email, filtering out those that exceed the maximum size
-func (e *EmailMessage) GetAttachments() []*Attachment {
-	if e == nil {
-		return []*Attachment{}
-	}
-
-	if e.maxAttachmentSize < 0 {
-		return e.Attachments
-	}
-
-	var validAttachments []*Attachment
+// SetAttachmentPolicy sets what happens to attachments over the maximum attachment size
+func (e *EmailMessage) SetAttachmentPolicy(policy AttachmentPolicy) *EmailMessage {
+	e.attachmentPolicy = policy
+	return e
+}
 
-	for _, attachment := range e.Attachments {
-		if len(attachment.Content) <= e.maxAttachmentSize {
-			validAttachments = append(validAttachments, attachment)
-		}
+// GetAttachmentPolicy returns the attachment policy, defaulting to AttachmentPolicyReject
+func (e *EmailMessage) GetAttachmentPolicy() AttachmentPolicy {
+	if e == nil || e.attachmentPolicy == "" {
+		return AttachmentPolicyReject
 	}
 
-	return validAttachments
+	return e.attachmentPolicy
 }
 
-// jsonEmailMessage represents the JSON structure for an email message.
-type jsonEmailMessage struct {
-	From        string        `json:"from"`
-	To          []string      `json:"to"`
-	CC          []string      `json:"cc,omitempty"`
-	BCC         []string      `json:"bcc,omitempty"`
-	ReplyTo     string        `json:"replyTo,omitempty"`
-	Subject     string        `json:"subject"`
-	Text        string        `json:"text"`
-	HTML        string        `json:"html,omitempty"`
-	Attachments []*Attachment `json:"attachments,omitempty"`
+// SetAttachmentDropHook sets the hook called for attachments dropped under AttachmentPolicyDrop
+func (e *EmailMessage) SetAttachmentDropHook(hook AttachmentDropHook) *EmailMessage {
+	e.dropHook = hook
+	return e
 }
 
-// MarshalJSON is a custom marshaler for EmailMessage
-func (e *EmailMessage) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&jsonEmailMessage{
-		From:        e.From,
-		To:          e.To,
-		CC:          e.Cc,
-		BCC:         e.Bcc,
-		ReplyTo:     e.ReplyTo,
-		Subject:     e.Subject,
-		Text:        e.Text,
-		HTML:        e.HTML,
-		Attachments: e.Attachments,
-	})
-}
-
-// UnmarshalJSON is a custom unmarshaler for EmailMessage
-func (e *EmailMessage) UnmarshalJSON(data []byte) error {
-	aux := &jsonEmailMessage{}
-	if err := json.Unmarshal(data, aux); err != nil {
-		return err
-	}
-
-	e.maxAttachmentSize = DefaultMaxAttachmentSize
-
-	e.From = aux.From
-	e.To = aux.To
-	e.Cc = aux.CC
-	e.Bcc = aux.BCC
-	e.ReplyTo = aux.ReplyTo
-	e.Subject = aux.Subject
-	e.Text = aux.Text
-	e.HTML = aux.HTML
-	e.Attachments = aux.Attachments
-
-	return nil
+// SetValidationMode sets which problems ValidateEmailMessage reports for the message
+func (e *EmailMessage) SetValidationMode(mode ValidationMode) *EmailMessage {
+	e.validationMode = mode
+	return e
 }
 
-// BuildMimeMessage constructs the MIME message for the email, including text, HTML, and attachments
-func BuildMimeMessage(message *EmailMessage) ([]byte, error) {
-	var msg bytes.Buffer
-
-	// Determine boundaries
-	mixedBoundary := fmt.Sprintf("mixed-boundary-%d", time.Now().UnixNano())
-	altBoundary := fmt.Sprintf("alt-boundary-%d", time.Now().UnixNano())
-
-	// Basic headers
-	fmt.Fprintf(&msg, "From: %s\r\n", message.GetFrom())
-
-	// Add To recipients
-	toRecipients := message.GetTo()
-	if len(toRecipients) > 0 {
-		fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(toRecipients, ","))
+// GetValidationMode returns the validation mode, defaulting to ValidationLenient
+func (e *EmailMessage) GetValidationMode() ValidationMode {
+	if e == nil || e.validationMode == "" {
+		return ValidationLenient
 	}
 
-	ccRecipients := message.GetCC()
-
-	if len(ccRecipients) > 0 {
-		fmt.Fprintf(&msg, "Cc: %s\r\n", strings.Join(ccRecipients, ","))
-	}
+	return e.validationMode
+}
 
-	if message.GetReplyTo() != "" {
-		fmt.Fprintf(&msg, "Reply-To: %s\r\n", message.GetReplyTo())
+// GetAttachments returns the attachments to be included in the email, filtering out those that exceed the maximum size.
+// Providers apply the attachment policy first so oversized attachments are never dropped silently.
+// A calendar invite is included as an .ics attachment
+func (e *EmailMessage) GetAttachments() []*Attachment {
+	if e == nil {
+		return []*Attachment{}
 	}
 
-	fmt.Fprintf(&msg, "Subject: %s\r\n", message.GetSubject())
-
-	msg.WriteString("MIME-Version: 1.0\r\n")
-
-	// Use multipart/mixed if there are attachments, otherwise multipart/alternative
-	attachments := message.GetAttachments()
-	if len(attachments) > 0 {
-		fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n", mixedBoundary)
-		msg.WriteString("\r\n")
-		// Start multipart/alternative
-		fmt.Fprintf(&msg, "--%s\r\n", mixedBoundary)
-		fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n", altBoundary)
-		msg.WriteString("\r\n")
-	} else {
-		fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n", altBoundary)
-		msg.WriteString("\r\n")
-	}
+	var validAttachments []*Attachment
 
-	// Plain text part
-	textMessage := message.GetText()
-	if textMessage != "" {
-		fmt.Fprintf(&msg, "--%s\r\n", altBoundary)
-		msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-		msg.WriteString("\r\n")
-		msg.WriteString(textMessage)
-		msg.WriteString("\r\n")
+	for _, attachment := range e.Attachments {
+		// attachments streamed from a reader of unknown length cannot be checked until they are read
+		if e.maxAttachmentSize < 0 || attachment.Size() <= e.attachmentLimit() {
+			validAttachments = append(validAttachments, attachment)
+		}
 	}
 
-	// HTML part
-	htmlMessage := message.GetHTML()
-	if htmlMessage != "" {
-		fmt.Fprintf(&msg, "--%s\r\n", altBoundary)
-		msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-		msg.WriteString("\r\n")
-		msg.WriteString(htmlMessage)
-		msg.WriteString("\r\n")
+	if e.Calendar != nil {
+		validAttachments = append(validAttachments, e.Calendar.Attachment())
 	}
 
-	// End multipart/alternative
-	fmt.Fprintf(&msg, "--%s--\r\n", altBoundary)
-
-	// Attachments
-	if len(attachments) > 0 {
-		for _, attachment := range attachments {
-			fileName := attachment.GetFilename()
-
-			mimeType := GetMimeType(fileName)
+	return validAttachments
+}
 
-			fmt.Fprintf(&msg, "--%s\r\n", mixedBoundary)
-			fmt.Fprintf(&msg, "Content-Type: %s\r\n", mimeType)
-			msg.WriteString("Content-Transfer-Encoding: base64\r\n")
-			fmt.Fprintf(&msg, "Content-Disposition: attachment; filename=\"%s\"\r\n", fileName)
-			msg.WriteString("\r\n")
-			msg.Write(attachment.GetBase64Content())
-			msg.WriteString("\r\n")
+// LoadAttachments reads every attachment backed by a reader or file into memory, for providers that
+// send the whole attachment in a request body
+func (e *EmailMessage) LoadAttachments() error {
+	for _, attachment := range e.GetAttachments() {
+		if err := attachment.Load(); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrAttachmentLoad, attachment.GetFilename(), err)
 		}
-
-		// End multipart/mixed
-		fmt.Fprintf(&msg, "--%s--\r\n", mixedBoundary)
 	}
 
-	return msg.Bytes(), nil
+	return nil
 }
@@ -26,7 +26,7 @@ func TestMarshalJSONCustom(t *testing.T) {
 		jsonData, err := json.Marshal(email)
 		assert.Nil(t, err)
 
-		expected := `{"from":"newman@usps.com","to":["jerry@seinfeld.com"],"cc":["cc@example.com"],"bcc":["bcc@example.com"],"replyTo":"replyto@example.com","subject":"Subject","text":"This is the email content.","html":"<p>This is the email content.</p>","attachments":[{"filename":"attachment1.txt","content":"ZmlsZSBjb250ZW50"}]}`
+		expected := `{"version":2,"from":"newman@usps.com","to":["jerry@seinfeld.com"],"cc":["cc@example.com"],"bcc":["bcc@example.com"],"reply_to":"replyto@example.com","subject":"Subject","text":"This is the email content.","html":"<p>This is the email content.</p>","attachments":[{"filename":"attachment1.txt","content":"ZmlsZSBjb250ZW50"}],"max_attachment_size":26214400}`
 
 		assert.JSONEq(t, expected, string(jsonData))
 	})
@@ -46,7 +46,7 @@ func TestMarshalJSONCustom(t *testing.T) {
 		jsonData, err := json.Marshal(email)
 		assert.Nil(t, err)
 
-		expected := `{"from":"newman@usps.com","to":["jerry@seinfeld.com"],"cc":["cc@example.com"],"bcc":["bcc@example.com"],"replyTo":"replyto@example.com","subject":"Subject","text":"This is the email content.","html":"<p>This is the email content.</p>"}`
+		expected := `{"version":2,"from":"newman@usps.com","to":["jerry@seinfeld.com"],"cc":["cc@example.com"],"bcc":["bcc@example.com"],"reply_to":"replyto@example.com","subject":"Subject","text":"This is the email content.","html":"<p>This is the email content.</p>","max_attachment_size":26214400}`
 
 		assert.JSONEq(t, expected, string(jsonData))
 	})
@@ -215,7 +215,7 @@ func ExampleEmailMessage_MarshalJSON() {
 	fmt.Println("JSON output:", string(jsonData))
 
 	// Output:
-	// JSON output: {"from":"newman@usps.com","to":["jerry@seinfeld.com"],"cc":["cc@example.com"],"bcc":["bcc@example.com"],"replyTo":"replyto@example.com","subject":"Subject","text":"This is the email content.","html":"\u003cp\u003eThis is the email content.\u003c/p\u003e","attachments":[{"filename":"attachment1.txt","content":"ZmlsZSBjb250ZW50"}]}
+	// JSON output: {"version":2,"from":"newman@usps.com","to":["jerry@seinfeld.com"],"cc":["cc@example.com"],"bcc":["bcc@example.com"],"reply_to":"replyto@example.com","subject":"Subject","text":"This is the email content.","html":"\u003cp\u003eThis is the email content.\u003c/p\u003e","attachments":[{"filename":"attachment1.txt","content":"ZmlsZSBjb250ZW50"}],"max_attachment_size":26214400}
 }
 
 func ExampleEmailMessage_UnmarshalJSON() {
@@ -248,5 +248,5 @@ func ExampleEmailMessage_UnmarshalJSON() {
 	fmt.Println("JSON output:", string(jsonData))
 
 	// Output:
-	// JSON output: {"from":"newman@usps.com","to":["jerry@seinfeld.com"],"cc":["cc@example.com"],"bcc":["bcc@example.com"],"replyTo":"replyto@example.com","subject":"Subject","text":"This is the email content.","html":"\u003cp\u003eThis is the email content.\u003c/p\u003e","attachments":[{"filename":"attachment1.txt","content":"ZmlsZSBjb250ZW50"}]}
+	// JSON output: {"version":2,"from":"newman@usps.com","to":["jerry@seinfeld.com"],"cc":["cc@example.com"],"bcc":["bcc@example.com"],"reply_to":"replyto@example.com","subject":"Subject","text":"This is the email content.","html":"\u003cp\u003eThis is the email content.\u003c/p\u003e","attachments":[{"filename":"attachment1.txt","content":"ZmlsZSBjb250ZW50"}],"max_attachment_size":26214400}
 }
@@ -1,8 +1,11 @@
 package shared
 
 import (
+	"bytes"
 	"encoding/base64"
+	"net/mail"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -575,3 +578,55 @@ func TestGetAttachmentsWithEdgeCases(t *testing.T) {
 	})
 }
 
+
+func TestBuildMimeMessageHeaders(t *testing.T) {
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Re: The mail\r\nBcc: kramer@seinfeld.com", "Hello, Jerry").
+		SetInReplyTo("<parent@usps.com>").
+		SetReferences([]string{"<root@usps.com>", "<parent@usps.com>"})
+	message.Headers["X-Route"] = "upstairs"
+
+	result, err := BuildMimeMessage(message)
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(result))
+	require.NoError(t, err)
+
+	date, err := parsed.Header.Date()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), date, time.Minute)
+
+	assert.Regexp(t, `^<[0-9a-f]+@usps\.com>$`, parsed.Header.Get("Message-ID"))
+	assert.Equal(t, "<parent@usps.com>", parsed.Header.Get("In-Reply-To"))
+	assert.Equal(t, "<root@usps.com> <parent@usps.com>", parsed.Header.Get("References"))
+	assert.Equal(t, "upstairs", parsed.Header.Get("X-Route"))
+
+	// the line break in the subject does not start a new header
+	assert.Equal(t, "Re: The mail  Bcc: kramer@seinfeld.com", parsed.Header.Get("Subject"))
+	assert.Empty(t, parsed.Header.Get("Bcc"))
+}
+
+func TestBuildMimeMessageMessageID(t *testing.T) {
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry")
+
+	result, err := BuildMimeMessage(message, WithMessageIDDomain("mail.usps.com"))
+	require.NoError(t, err)
+	assert.Regexp(t, `Message-ID: <[0-9a-f]+@mail\.usps\.com>\r\n`, string(result))
+
+	// a message ID set on the message is used as is
+	result, err = BuildMimeMessage(message.SetMessageID("route-66@usps.com"))
+	require.NoError(t, err)
+	assert.Contains(t, string(result), "Message-ID: <route-66@usps.com>\r\n")
+}
+
+func TestBuildMimeMessageHeaderInjection(t *testing.T) {
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry")
+	message.Headers["X-Route"] = "upstairs\r\nBcc: kramer@seinfeld.com"
+
+	_, err := BuildMimeMessage(message)
+	require.ErrorIs(t, err, ErrInvalidHeader)
+
+	message.Headers = map[string]string{"Subject": "Something else"}
+
+	_, err = BuildMimeMessage(message)
+	require.ErrorIs(t, err, ErrInvalidHeader)
+}
@@ -1,6 +1,55 @@
 package shared
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalidHeader is returned when a custom header cannot be written safely into a MIME message
+	ErrInvalidHeader = errors.New("invalid header")
+	// ErrInvalidCalendarEvent is returned when a calendar invite is missing required fields or has an invalid schedule
+	ErrInvalidCalendarEvent = errors.New("invalid calendar event")
+	// ErrInvalidMimeMessage is returned when a MIME message cannot be parsed
+	ErrInvalidMimeMessage = errors.New("invalid MIME message")
+	// ErrAttachmentConsumed is returned when an attachment streamed from a reader is read a second time
+	ErrAttachmentConsumed = errors.New("attachment reader has already been consumed")
+	// ErrAttachmentLoad is returned when the reader or file backing an attachment cannot be read
+	ErrAttachmentLoad = errors.New("unable to load attachment")
+	// ErrAttachmentTooLarge is returned when an attachment exceeds the maximum attachment size
+	ErrAttachmentTooLarge = errors.New("attachment too large")
+	// ErrMessageTooLarge is returned when a message exceeds the maximum message size of a provider
+	ErrMessageTooLarge = errors.New("message too large")
+	// ErrUnsupportedWireFormat is returned when a JSON message was written in a newer wire format version than this package reads
+	ErrUnsupportedWireFormat = errors.New("unsupported wire format version")
+	// ErrInvalidAddress is returned when an address cannot be parsed as an RFC 5322 mailbox
+	ErrInvalidAddress = errors.New("invalid email address")
+	// ErrEmptySubject is returned by strict validation when the message has no subject
+	ErrEmptySubject = errors.New("subject is empty")
+	// ErrMissingBody is returned by strict validation when the message has no text, HTML or calendar body
+	ErrMissingBody = errors.New("text or HTML body is required")
+	// ErrTooManyRecipients is returned when a message has more recipients than a provider accepts
+	ErrTooManyRecipients = errors.New("too many recipients")
+	// ErrInvalidDKIMSigner is returned when a DKIM signer is missing its domain or selector, or cannot use its key
+	ErrInvalidDKIMSigner = errors.New("invalid DKIM signer")
+	// ErrDKIMVerification is returned when a DKIM signature is missing or does not verify
+	ErrDKIMVerification = errors.New("DKIM verification failed")
+	// ErrInvalidSMIME is returned when S/MIME has neither a signer nor recipients, or cannot use a key or certificate
+	ErrInvalidSMIME = errors.New("invalid S/MIME configuration")
+	// ErrInvalidPGPMIME is returned when PGP/MIME has neither a signer nor recipients, or cannot use a key
+	ErrInvalidPGPMIME = errors.New("invalid PGP/MIME configuration")
+	// ErrSignatureVerification is returned when an S/MIME or PGP/MIME message is not signed or its signature does not verify
+	ErrSignatureVerification = errors.New("signature verification failed")
+	// ErrDecryption is returned when an S/MIME or PGP/MIME message is not encrypted or cannot be decrypted with the key
+	ErrDecryption = errors.New("unable to decrypt message")
+	// ErrInvalidUnsubscriber is returned when an Unsubscriber has a short secret, an endpoint that is not HTTPS or an invalid mailto address
+	ErrInvalidUnsubscriber = errors.New("invalid unsubscriber")
+	// ErrUnsubscribeRecipients is returned by validation when a message with unsubscribe headers has more than one recipient
+	ErrUnsubscribeRecipients = errors.New("unsubscribe headers need a single recipient")
+	// ErrInvalidUnsubscribeToken is returned when an unsubscribe token is malformed, was not signed with the secret or has expired
+	ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+)
 
 // MissingRequiredFieldError is returned when a required field was not provided in a request
 type MissingRequiredFieldError struct {
@@ -19,3 +68,60 @@ func newMissingRequiredFieldError(field string) *MissingRequiredFieldError {
 		RequiredField: field,
 	}
 }
+
+// ValidationIssue is a single problem found by ValidateEmailMessage
+type ValidationIssue struct {
+	// Field of the message the problem is with, such as to, subject or headers
+	Field string `json:"field"`
+	// Value that was rejected, such as an invalid address
+	Value string `json:"value,omitempty"`
+	// Err is the reason the field was rejected
+	Err error `json:"-"`
+}
+
+// Error returns the ValidationIssue in string format
+func (i *ValidationIssue) Error() string {
+	if i.Value == "" {
+		return i.Err.Error()
+	}
+
+	return fmt.Sprintf("%s %q: %s", i.Field, i.Value, i.Err)
+}
+
+// Unwrap returns the reason so the issue can be matched with errors.Is and errors.As
+func (i *ValidationIssue) Unwrap() error {
+	return i.Err
+}
+
+// ValidationError is returned by ValidateEmailMessage with every problem found in the message
+type ValidationError struct {
+	// Issues found in the message, in the order the fields were checked
+	Issues []*ValidationIssue `json:"issues"`
+}
+
+// Error returns the ValidationError in string format
+func (e *ValidationError) Error() string {
+	issues := make([]string, 0, len(e.Issues))
+
+	for _, issue := range e.Issues {
+		issues = append(issues, issue.Error())
+	}
+
+	return "invalid email message: " + strings.Join(issues, "; ")
+}
+
+// Unwrap returns the issues so the reason for any of them can be matched with errors.Is and errors.As
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Issues))
+
+	for _, issue := range e.Issues {
+		errs = append(errs, issue)
+	}
+
+	return errs
+}
+
+// add records an issue with the field
+func (e *ValidationError) add(field, value string, err error) {
+	e.Issues = append(e.Issues, &ValidationIssue{Field: field, Value: value, Err: err})
+}
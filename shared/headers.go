@@ -0,0 +1,158 @@
+package shared
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/textproto"
+	"strings"
+)
+
+const (
+	// defaultMessageIDDomain is used for generated Message-IDs when the sender has no usable domain
+	defaultMessageIDDomain = "localhost"
+	// messageIDRandomBytes is the number of random bytes in the local part of a generated Message-ID
+	messageIDRandomBytes = 16
+)
+
+// reservedHeaders are written by BuildMimeMessage from the message fields and cannot be set as custom headers
+var reservedHeaders = map[string]bool{
+	"From":                      true,
+	"To":                        true,
+	"Cc":                        true,
+	"Bcc":                       true,
+	"Reply-To":                  true,
+	"Subject":                   true,
+	"Date":                      true,
+	"Message-Id":                true,
+	"In-Reply-To":               true,
+	"References":                true,
+	"Mime-Version":              true,
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+}
+
+// MimeOption configures how BuildMimeMessage renders a message
+type MimeOption func(*mimeOptions)
+
+// mimeOptions holds the settings applied by MimeOptions
+type mimeOptions struct {
+	messageIDDomain string
+	dkimSigner      *DKIMSigner
+	wrapper         mimeWrapper
+}
+
+// WithMessageIDDomain sets the domain of generated Message-IDs, which defaults to the domain of the sender
+func WithMessageIDDomain(domain string) MimeOption {
+	return func(o *mimeOptions) {
+		o.messageIDDomain = domain
+	}
+}
+
+// NewMessageID generates a unique Message-ID, including the angle brackets, for the given domain
+func NewMessageID(domain string) string {
+	if domain == "" {
+		domain = defaultMessageIDDomain
+	}
+
+	b := make([]byte, messageIDRandomBytes)
+	_, _ = rand.Read(b)
+
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+// formatMessageID wraps a message ID in angle brackets if it is not already
+func formatMessageID(id string) string {
+	id = strings.TrimSpace(id)
+	if id == "" || strings.HasPrefix(id, "<") {
+		return id
+	}
+
+	return "<" + id + ">"
+}
+
+// formatReferences formats message IDs as the value of a References header
+func formatReferences(ids []string) string {
+	formatted := make([]string, 0, len(ids))
+
+	for _, id := range ids {
+		if id = formatMessageID(id); id != "" {
+			formatted = append(formatted, id)
+		}
+	}
+
+	return strings.Join(formatted, " ")
+}
+
+// domainOf returns the domain of an email address
+func domainOf(address string) string {
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		return address[at+1:]
+	}
+
+	return ""
+}
+
+// validateHeader checks that a custom header has a valid field name, is not one the MIME builder
+// writes itself, and that neither the name nor the value can inject additional header lines
+func validateHeader(key, value string) error {
+	if err := checkHeaderField(key, value); err != nil {
+		return err
+	}
+
+	if reservedHeaders[textproto.CanonicalMIMEHeaderKey(key)] {
+		return fmt.Errorf("%w: %s is set from the message fields", ErrInvalidHeader, key)
+	}
+
+	return nil
+}
+
+// checkHeaderField checks that a header has a valid field name and that its value cannot inject
+// additional header lines
+func checkHeaderField(key, value string) error {
+	if key == "" {
+		return fmt.Errorf("%w: empty header name", ErrInvalidHeader)
+	}
+
+	for _, c := range key {
+		// field names are printable US-ASCII other than colon, RFC 5322 section 3.6.8
+		if c < '!' || c > '~' || c == ':' {
+			return fmt.Errorf("%w: %q is not a valid header name", ErrInvalidHeader, key)
+		}
+	}
+
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("%w: value of %s contains a line break", ErrInvalidHeader, key)
+	}
+
+	return nil
+}
+
+// GetHeaders returns the custom headers of the message together with the In-Reply-To and References
+// threading headers and the unsubscribe headers, for providers that accept headers rather than a full MIME message
+func (e *EmailMessage) GetHeaders() map[string]string {
+	if e == nil {
+		return map[string]string{}
+	}
+
+	headers := e.customHeaders()
+
+	if inReplyTo := formatMessageID(e.InReplyTo); inReplyTo != "" {
+		headers["In-Reply-To"] = inReplyTo
+	}
+
+	if references := formatReferences(e.threadReferences()); references != "" {
+		headers["References"] = references
+	}
+
+	return headers
+}
+
+// threadReferences returns the References of the message, falling back to the message it replies to
+func (e *EmailMessage) threadReferences() []string {
+	if len(e.References) == 0 && e.InReplyTo != "" {
+		return []string{e.InReplyTo}
+	}
+
+	return e.References
+}
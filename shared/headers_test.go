@@ -0,0 +1,67 @@
+package shared
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMessageID(t *testing.T) {
+	id := NewMessageID("usps.com")
+	assert.Regexp(t, regexp.MustCompile(`^<[0-9a-f]{32}@usps\.com>$`), id)
+	assert.NotEqual(t, id, NewMessageID("usps.com"))
+
+	assert.Regexp(t, regexp.MustCompile(`@localhost>$`), NewMessageID(""))
+}
+
+func TestGetHeaders(t *testing.T) {
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Re: Mail", "Hello, Jerry").
+		SetInReplyTo("parent@usps.com")
+	message.Headers["X-Route"] = "upstairs"
+
+	assert.Equal(t, map[string]string{
+		"X-Route":     "upstairs",
+		"In-Reply-To": "<parent@usps.com>",
+		"References":  "<parent@usps.com>",
+	}, message.GetHeaders())
+
+	message.SetReferences([]string{"<root@usps.com>"}).AddReference("parent@usps.com")
+	assert.Equal(t, "<root@usps.com> <parent@usps.com>", message.GetHeaders()["References"])
+
+	// the custom headers of the message are not modified
+	assert.Equal(t, map[string]string{"X-Route": "upstairs"}, message.Headers)
+}
+
+func TestValidateHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		valid bool
+	}{
+		{name: "custom header", key: "X-Campaign", value: "summer", valid: true},
+		{name: "list unsubscribe", key: "List-Unsubscribe", value: "<mailto:unsubscribe@usps.com>", valid: true},
+		{name: "empty name", key: "", value: "value"},
+		{name: "space in name", key: "X Campaign", value: "summer"},
+		{name: "colon in name", key: "X-Campaign:", value: "summer"},
+		{name: "line break in name", key: "X-Campaign\r\nBcc", value: "kramer@seinfeld.com"},
+		{name: "line break in value", key: "X-Campaign", value: "summer\r\nBcc: kramer@seinfeld.com"},
+		{name: "bare line feed in value", key: "X-Campaign", value: "summer\nBcc: kramer@seinfeld.com"},
+		{name: "reserved header", key: "bcc", value: "kramer@seinfeld.com"},
+		{name: "reserved content type", key: "Content-Type", value: "text/plain"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateHeader(tc.key, tc.value)
+			if tc.valid {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, ErrInvalidHeader)
+		})
+	}
+}
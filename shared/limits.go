@@ -0,0 +1,237 @@
+package shared
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"time"
+)
+
+// AttachmentPolicy controls what happens to an attachment larger than the maximum attachment size
+type AttachmentPolicy string
+
+const (
+	// AttachmentPolicyReject fails the send with an AttachmentTooLargeError, and is the default
+	AttachmentPolicyReject AttachmentPolicy = "reject"
+	// AttachmentPolicyDrop removes the attachment and reports it to the drop hook
+	AttachmentPolicyDrop AttachmentPolicy = "drop"
+	// AttachmentPolicyCompress replaces the attachment with a zip archive, failing the send when the archive is still too large
+	AttachmentPolicyCompress AttachmentPolicy = "compress"
+)
+
+// AttachmentDropHook is called for every attachment removed from a message under AttachmentPolicyDrop
+type AttachmentDropHook func(message *EmailMessage, err *AttachmentTooLargeError)
+
+// AttachmentTooLargeError is returned when an attachment exceeds the maximum attachment size
+type AttachmentTooLargeError struct {
+	// Filename of the attachment
+	Filename string `json:"filename"`
+	// Size of the attachment in bytes
+	Size int64 `json:"size"`
+	// Limit is the maximum attachment size in bytes
+	Limit int64 `json:"limit"`
+}
+
+// Error returns the AttachmentTooLargeError in string format
+func (e *AttachmentTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %q is %d bytes, over the %d byte limit", ErrAttachmentTooLarge, e.Filename, e.Size, e.Limit)
+}
+
+// Unwrap returns ErrAttachmentTooLarge so the error can be matched with errors.Is
+func (e *AttachmentTooLargeError) Unwrap() error {
+	return ErrAttachmentTooLarge
+}
+
+// MessageTooLargeError is returned before sending when a message exceeds the size a provider accepts
+type MessageTooLargeError struct {
+	// Size is the estimated size of the message in bytes
+	Size int64 `json:"size"`
+	// Limit is the maximum message size in bytes
+	Limit int64 `json:"limit"`
+}
+
+// Error returns the MessageTooLargeError in string format
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %d bytes, over the %d byte limit", ErrMessageTooLarge, e.Size, e.Limit)
+}
+
+// Unwrap returns ErrMessageTooLarge so the error can be matched with errors.Is
+func (e *MessageTooLargeError) Unwrap() error {
+	return ErrMessageTooLarge
+}
+
+// ApplyAttachmentPolicy returns a copy of the message with the maximum attachment size enforced on its
+// attachments according to its attachment policy, or the message itself when every attachment fits. The
+// message is never changed, so a send that is retried or failed over applies the policy again. Attachments streamed from a reader of unknown length are
+// checked once they have been loaded, or while they are written by WriteMimeMessage
+func (e *EmailMessage) ApplyAttachmentPolicy() (*EmailMessage, error) {
+	if e == nil || e.maxAttachmentSize < 0 {
+		return e, nil
+	}
+
+	limit := e.attachmentLimit()
+	attachments := e.Attachments[:0:0]
+	changed := false
+
+	for _, attachment := range e.Attachments {
+		size := attachment.Size()
+		if size <= limit {
+			attachments = append(attachments, attachment)
+			continue
+		}
+
+		changed = true
+
+		tooLarge := &AttachmentTooLargeError{Filename: attachment.GetFilename(), Size: size, Limit: limit}
+
+		switch e.GetAttachmentPolicy() {
+		case AttachmentPolicyDrop:
+			if e.dropHook != nil {
+				e.dropHook(e, tooLarge)
+			}
+		case AttachmentPolicyCompress:
+			compressed, err := compressAttachment(attachment)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrAttachmentLoad, attachment.GetFilename(), err)
+			}
+
+			if compressed.Size() > limit || attachment.IsInline() {
+				// an archive cannot be referenced from the HTML body, so inline attachments are never compressed
+				return nil, tooLarge
+			}
+
+			attachments = append(attachments, compressed)
+		default:
+			return nil, tooLarge
+		}
+	}
+
+	if !changed {
+		return e, nil
+	}
+
+	applied := *e
+	applied.Attachments = attachments
+
+	return &applied, nil
+}
+
+// PrepareAttachments loads the attachments of the message and returns a copy with its attachment policy
+// applied. When maxMessageSize is positive it returns a MessageTooLargeError if the copy is still larger than
+// that. Providers sending the whole message in a request body call it before making any request
+func (e *EmailMessage) PrepareAttachments(maxMessageSize int64) (*EmailMessage, error) {
+	if err := e.LoadAttachments(); err != nil {
+		return nil, err
+	}
+
+	prepared, err := e.ApplyAttachmentPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	if size := prepared.EstimatedSize(); maxMessageSize > 0 && size > maxMessageSize {
+		return nil, &MessageTooLargeError{Size: size, Limit: maxMessageSize}
+	}
+
+	return prepared, nil
+}
+
+// EstimatedSize returns the approximate size of the message as sent to a provider in bytes, counting the
+// subject, bodies, headers and base64 encoded attachments. Attachments of unknown length are not counted
+func (e *EmailMessage) EstimatedSize() int64 {
+	if e == nil {
+		return 0
+	}
+
+	size := int64(len(e.Subject) + len(e.Text) + len(e.HTML))
+
+	for key, value := range e.Headers {
+		size += int64(len(key) + len(value))
+	}
+
+	for _, attachment := range e.GetAttachments() {
+		if n := attachment.Size(); n > 0 {
+			size += int64(base64.StdEncoding.EncodedLen(int(n)))
+		}
+	}
+
+	return size
+}
+
+// streamLimit returns the maximum size of an attachment written by WriteMimeMessage, or -1 when there is none
+func (e *EmailMessage) streamLimit() int64 {
+	if e == nil || e.maxAttachmentSize < 0 {
+		return -1
+	}
+
+	return e.attachmentLimit()
+}
+
+// limitedReader reads an attachment of unknown length, failing with an AttachmentTooLargeError once more
+// than limit bytes have been read
+type limitedReader struct {
+	r        io.Reader
+	filename string
+	read     int64
+	limit    int64
+}
+
+// Read satisfies the io.Reader interface
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+
+	if l.read > l.limit {
+		return n, &AttachmentTooLargeError{Filename: l.filename, Size: l.read, Limit: l.limit}
+	}
+
+	return n, err
+}
+
+// attachmentLimit returns the maximum attachment size, treating an unset size as the default
+func (e *EmailMessage) attachmentLimit() int64 {
+	if e.maxAttachmentSize == 0 {
+		return DefaultMaxAttachmentSize
+	}
+
+	return int64(e.maxAttachmentSize)
+}
+
+// compressAttachment returns a zip archive holding the attachment
+func compressAttachment(attachment *Attachment) (*Attachment, error) {
+	r, err := attachment.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	var buf bytes.Buffer
+
+	archive := zip.NewWriter(&buf)
+
+	w, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     attachment.GetFilename(),
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return &Attachment{
+		Filename:    attachment.GetFilename() + ".zip",
+		Content:     buf.Bytes(),
+		ContentType: "application/zip",
+	}, nil
+}
@@ -0,0 +1,187 @@
+package shared
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLimitTestMessage(attachments ...*Attachment) *EmailMessage {
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Route report", "Hello, Jerry").
+		SetMaxAttachmentSize(1024)
+
+	for _, attachment := range attachments {
+		message.AddAttachment(attachment)
+	}
+
+	return message
+}
+
+func TestApplyAttachmentPolicyReject(t *testing.T) {
+	message := newLimitTestMessage(
+		NewAttachment("notes.txt", []byte("small")),
+		NewAttachment("report.pdf", make([]byte, 2048)),
+	)
+
+	assert.Equal(t, AttachmentPolicyReject, message.GetAttachmentPolicy())
+
+	_, err := message.ApplyAttachmentPolicy()
+	require.ErrorIs(t, err, ErrAttachmentTooLarge)
+
+	var tooLarge *AttachmentTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, "report.pdf", tooLarge.Filename)
+	assert.Equal(t, int64(2048), tooLarge.Size)
+	assert.Equal(t, int64(1024), tooLarge.Limit)
+
+	// the message is left untouched
+	assert.Len(t, message.Attachments, 2)
+}
+
+func TestApplyAttachmentPolicyDrop(t *testing.T) {
+	var dropped []*AttachmentTooLargeError
+
+	message := newLimitTestMessage(
+		NewAttachment("notes.txt", []byte("small")),
+		NewAttachment("report.pdf", make([]byte, 2048)),
+	).
+		SetAttachmentPolicy(AttachmentPolicyDrop).
+		SetAttachmentDropHook(func(_ *EmailMessage, err *AttachmentTooLargeError) {
+			dropped = append(dropped, err)
+		})
+
+	applied, err := message.ApplyAttachmentPolicy()
+	require.NoError(t, err)
+
+	require.Len(t, applied.Attachments, 1)
+	assert.Equal(t, "notes.txt", applied.Attachments[0].GetFilename())
+
+	require.Len(t, dropped, 1)
+	assert.Equal(t, "report.pdf", dropped[0].Filename)
+
+	// the policy is applied to a copy, so a retried send drops and reports the attachment again
+	assert.Len(t, message.Attachments, 2)
+
+	_, err = message.ApplyAttachmentPolicy()
+	require.NoError(t, err)
+	assert.Len(t, dropped, 2)
+}
+
+func TestApplyAttachmentPolicyCompress(t *testing.T) {
+	content := []byte(strings.Repeat("When you control the mail, you control information. ", 100))
+
+	message := newLimitTestMessage(NewAttachment("report.txt", content)).
+		SetAttachmentPolicy(AttachmentPolicyCompress)
+
+	applied, err := message.ApplyAttachmentPolicy()
+	require.NoError(t, err)
+	require.Len(t, applied.Attachments, 1)
+	assert.Equal(t, "report.txt", message.Attachments[0].GetFilename())
+
+	compressed := applied.Attachments[0]
+	assert.Equal(t, "report.txt.zip", compressed.GetFilename())
+	assert.Equal(t, "application/zip", compressed.GetContentType())
+	assert.LessOrEqual(t, compressed.Size(), int64(1024))
+
+	archive, err := zip.NewReader(bytes.NewReader(compressed.GetRawContent()), compressed.Size())
+	require.NoError(t, err)
+	require.Len(t, archive.File, 1)
+	assert.Equal(t, "report.txt", archive.File[0].Name)
+
+	f, err := archive.File[0].Open()
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	extracted, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, content, extracted)
+}
+
+func TestApplyAttachmentPolicyCompressStillTooLarge(t *testing.T) {
+	random := make([]byte, 4096)
+	_, err := rand.Read(random)
+	require.NoError(t, err)
+
+	message := newLimitTestMessage(NewAttachment("photo.jpg", random)).
+		SetAttachmentPolicy(AttachmentPolicyCompress)
+
+	_, err = message.ApplyAttachmentPolicy()
+	require.ErrorIs(t, err, ErrAttachmentTooLarge)
+
+	// inline attachments are referenced by the HTML body and cannot be replaced by an archive
+	message = newLimitTestMessage(NewInlineAttachment("logo.png", "logo@usps.com", make([]byte, 2048))).
+		SetHTML(`<img src="cid:logo@usps.com">`).
+		SetAttachmentPolicy(AttachmentPolicyCompress)
+
+	_, err = message.ApplyAttachmentPolicy()
+	assert.ErrorIs(t, err, ErrAttachmentTooLarge)
+}
+
+func TestApplyAttachmentPolicyLimits(t *testing.T) {
+	// no limit
+	message := newLimitTestMessage(NewAttachment("report.pdf", make([]byte, 2048))).SetMaxAttachmentSize(-1)
+	applied, err := message.ApplyAttachmentPolicy()
+	require.NoError(t, err)
+	assert.Len(t, applied.Attachments, 1)
+
+	// an unset limit falls back to the default rather than filtering every attachment
+	message = &EmailMessage{Attachments: []*Attachment{NewAttachment("report.pdf", make([]byte, 2048))}}
+	applied, err = message.ApplyAttachmentPolicy()
+	require.NoError(t, err)
+	assert.Len(t, applied.GetAttachments(), 1)
+
+	// attachments of unknown length are checked once loaded
+	message = newLimitTestMessage(NewAttachmentFromReader("report.pdf", bytes.NewReader(make([]byte, 2048))))
+	_, err = message.ApplyAttachmentPolicy()
+	require.NoError(t, err)
+
+	_, err = message.PrepareAttachments(0)
+	assert.ErrorIs(t, err, ErrAttachmentTooLarge)
+}
+
+func TestWriteMimeMessageAttachmentLimit(t *testing.T) {
+	// an attachment of unknown length is checked while it is streamed
+	message := newLimitTestMessage(NewAttachmentFromReader("report.pdf", bytes.NewReader(make([]byte, 2048))))
+
+	err := WriteMimeMessage(io.Discard, message)
+	require.ErrorIs(t, err, ErrAttachmentTooLarge)
+
+	var tooLarge *AttachmentTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, "report.pdf", tooLarge.Filename)
+	assert.Equal(t, int64(1024), tooLarge.Limit)
+
+	message = newLimitTestMessage(NewAttachmentFromReader("report.pdf", bytes.NewReader(make([]byte, 512))))
+	require.NoError(t, WriteMimeMessage(io.Discard, message))
+
+	message = newLimitTestMessage(NewAttachmentFromReader("report.pdf", bytes.NewReader(make([]byte, 2048)))).SetMaxAttachmentSize(-1)
+	require.NoError(t, WriteMimeMessage(io.Discard, message))
+}
+
+func TestPrepareAttachmentsMessageTooLarge(t *testing.T) {
+	message := newLimitTestMessage(NewAttachment("report.pdf", make([]byte, 900)))
+
+	// base64 encoding grows the 900 byte attachment to 1200 bytes
+	assert.Equal(t, int64(len("Route report")+len("Hello, Jerry")+1200), message.EstimatedSize())
+
+	_, err := message.PrepareAttachments(1024)
+	require.ErrorIs(t, err, ErrMessageTooLarge)
+
+	var tooLarge *MessageTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, message.EstimatedSize(), tooLarge.Size)
+	assert.Equal(t, int64(1024), tooLarge.Limit)
+
+	_, err = message.PrepareAttachments(2048)
+	require.NoError(t, err)
+
+	_, err = message.PrepareAttachments(0)
+	require.NoError(t, err)
+}
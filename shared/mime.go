@@ -0,0 +1,560 @@
+package shared
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// maxLineLength is the line length RFC 5322 recommends, used when folding headers and wrapping base64
+	maxLineLength = 76
+	// maxHeaderLineLength is the length past which a header line is folded
+	maxHeaderLineLength = 78
+	// maxParamSegment is the longest RFC 2231 parameter continuation segment written on one line
+	maxParamSegment = 60
+	// defaultContentType is used for attachments whose type cannot be determined from the filename
+	defaultContentType = "application/octet-stream"
+)
+
+// mimeEntity is a node of a MIME message: either a multipart container of other entities, or a
+// leaf part with a header and a body
+type mimeEntity struct {
+	// header holds the content headers of the entity; for multipart entities the Content-Type is added when writing
+	header textproto.MIMEHeader
+	// multipart is the multipart subtype, such as mixed or alternative, and is empty for leaf parts
+	multipart string
+	// parts are the children of a multipart entity
+	parts []*mimeEntity
+	// body writes the encoded body of a leaf part
+	body func(w io.Writer) error
+}
+
+// contentHeader returns the header of the entity, with the Content-Type and boundary set for multipart entities
+func (e *mimeEntity) contentHeader() (textproto.MIMEHeader, string) {
+	header := textproto.MIMEHeader{}
+	maps.Copy(header, e.header)
+
+	if e.multipart == "" {
+		return header, ""
+	}
+
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	params := map[string]string{"boundary": boundary}
+
+	// RFC 2387 requires multipart/related to name the type of its root part
+	if e.multipart == "related" && len(e.parts) > 0 {
+		params["type"] = e.parts[0].mediaType()
+	}
+
+	header.Set("Content-Type", mime.FormatMediaType("multipart/"+e.multipart, params))
+
+	return header, boundary
+}
+
+// mediaType returns the media type of the entity without its parameters
+func (e *mimeEntity) mediaType() string {
+	if e.multipart != "" {
+		return "multipart/" + e.multipart
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(e.header.Get("Content-Type"))
+
+	return mediaType
+}
+
+// writeBody writes the body of the entity, using boundary to separate the parts of a multipart entity
+func (e *mimeEntity) writeBody(w io.Writer, boundary string) error {
+	if e.multipart == "" {
+		return e.body(w)
+	}
+
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	for _, part := range e.parts {
+		header, partBoundary := part.contentHeader()
+
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+
+		if err := part.writeBody(pw, partBoundary); err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
+
+// render returns the entity, its content headers followed by its body, as it is written into a message
+func (e *mimeEntity) render() ([]byte, error) {
+	var b bytes.Buffer
+
+	header, boundary := e.contentHeader()
+
+	for _, key := range slices.Sorted(maps.Keys(header)) {
+		writeHeader(&b, key, header.Get(key))
+	}
+
+	b.WriteString("\r\n")
+
+	if err := e.writeBody(&b, boundary); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// newMultipart creates a multipart entity of the given subtype, collapsing to the only part when there is one
+func newMultipart(subtype string, parts ...*mimeEntity) *mimeEntity {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	return &mimeEntity{multipart: subtype, parts: parts}
+}
+
+// newTextPart creates a UTF-8 text part encoded as quoted-printable, keeping any parameters of contentType
+func newTextPart(contentType, content string) *mimeEntity {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = contentType, map[string]string{}
+	}
+
+	params["charset"] = "UTF-8"
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	return &mimeEntity{
+		header: header,
+		body: func(w io.Writer) error {
+			qp := quotedprintable.NewWriter(w)
+			if _, err := io.WriteString(qp, content); err != nil {
+				return err
+			}
+
+			return qp.Close()
+		},
+	}
+}
+
+// newAttachmentPart creates a base64 encoded attachment part. Inline attachments carry a Content-ID
+// so the HTML part can reference them with cid: URLs. An attachment of unknown length fails with an
+// AttachmentTooLargeError once more than limit bytes are read from it, unless limit is negative
+func newAttachmentPart(attachment *Attachment, limit int64) *mimeEntity {
+	filename := attachment.GetFilename()
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", attachment.GetContentType()+"; "+formatParam("name", filename))
+	header.Set("Content-Transfer-Encoding", "base64")
+
+	disposition := "attachment"
+	if attachment.IsInline() {
+		disposition = "inline"
+		header.Set("Content-ID", "<"+attachment.GetContentID()+">")
+	}
+
+	header.Set("Content-Disposition", disposition+"; "+formatParam("filename", filename))
+
+	return &mimeEntity{
+		header: header,
+		body: func(w io.Writer) error {
+			rc, err := attachment.Open()
+			if err != nil {
+				return err
+			}
+
+			defer rc.Close()
+
+			var r io.Reader = rc
+			if limit >= 0 && attachment.Size() < 0 {
+				r = &limitedReader{r: rc, filename: filename, limit: limit}
+			}
+
+			return writeBase64(w, r)
+		},
+	}
+}
+
+// BuildMimeMessage constructs the MIME message for the email, including text, HTML, and attachments.
+// A Date header is always written, along with the Message-ID of the message or a generated one.
+// Headers are RFC 2047 encoded, attachment filenames RFC 2231 encoded, bodies quoted-printable and
+// attachments base64 wrapped at 76 columns. A calendar invite is written as a text/calendar
+// alternative as well as an .ics attachment. Inline attachments are grouped with the HTML body in a
+// multipart/related part so the HTML can reference them with cid: URLs
+func BuildMimeMessage(message *EmailMessage, opts ...MimeOption) ([]byte, error) {
+	var msg bytes.Buffer
+
+	if err := WriteMimeMessage(&msg, message, opts...); err != nil {
+		return nil, err
+	}
+
+	return msg.Bytes(), nil
+}
+
+// WriteMimeMessage writes the MIME message built by BuildMimeMessage to w, streaming attachments from
+// the readers or files backing them rather than holding the encoded message in memory. The message is
+// validated before anything is written, so an error after writing has begun comes from w or from
+// reading an attachment
+func WriteMimeMessage(w io.Writer, message *EmailMessage, opts ...MimeOption) error {
+	options := &mimeOptions{
+		messageIDDomain: domainOf(message.GetFrom()),
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if err := ValidateMimeMessage(message); err != nil {
+		return err
+	}
+
+	if options.dkimSigner == nil {
+		return writeMimeMessage(w, message, options)
+	}
+
+	var unsigned bytes.Buffer
+
+	if err := writeMimeMessage(&unsigned, message, options); err != nil {
+		return err
+	}
+
+	signature, err := options.dkimSigner.Signature(unsigned.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, signature); err != nil {
+		return err
+	}
+
+	_, err = unsigned.WriteTo(w)
+
+	return err
+}
+
+// writeMimeMessage writes the validated message to w
+func writeMimeMessage(w io.Writer, message *EmailMessage, options *mimeOptions) error {
+	bw := bufio.NewWriter(w)
+
+	writeMessageHeader(bw, message, options)
+
+	root := newMimeTree(message)
+
+	if options.wrapper != nil {
+		entity, err := root.render()
+		if err != nil {
+			return err
+		}
+
+		wrapped, err := options.wrapper.wrap(entity)
+		if err != nil {
+			return err
+		}
+
+		writeHeader(bw, "MIME-Version", "1.0")
+
+		if _, err := bw.Write(wrapped); err != nil {
+			return err
+		}
+
+		return bw.Flush()
+	}
+
+	header, boundary := root.contentHeader()
+	header.Set("MIME-Version", "1.0")
+
+	for _, key := range slices.Sorted(maps.Keys(header)) {
+		writeHeader(bw, key, header.Get(key))
+	}
+
+	if _, err := bw.WriteString("\r\n"); err != nil {
+		return err
+	}
+
+	if err := root.writeBody(bw, boundary); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// ValidateMimeMessage checks that the custom headers, inline attachment content IDs and calendar
+// invite of the message can be written safely into a MIME message
+func ValidateMimeMessage(message *EmailMessage) error {
+	for key, value := range message.Headers {
+		if err := validateHeader(key, value); err != nil {
+			return err
+		}
+	}
+
+	for _, attachment := range message.GetAttachments() {
+		if attachment.IsInline() {
+			if err := validateHeader("Content-ID", attachment.GetContentID()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if calendar := message.GetCalendar(); calendar != nil {
+		return calendar.Validate()
+	}
+
+	return nil
+}
+
+// newMimeTree arranges the bodies and attachments of the message into MIME entities:
+// mixed { alternative { text, related { html, inline... }, calendar }, attachments... }, where
+// containers holding a single part collapse to that part
+func newMimeTree(message *EmailMessage) *mimeEntity {
+	var (
+		bodies      []*mimeEntity
+		inline      []*mimeEntity
+		attachments []*mimeEntity
+	)
+
+	html := message.GetHTML()
+	calendar := message.GetCalendar()
+	limit := message.streamLimit()
+
+	for _, attachment := range message.GetAttachments() {
+		// inline attachments can only be referenced from an HTML body
+		if !attachment.IsInline() || html == "" {
+			attachments = append(attachments, newAttachmentPart(attachment, limit))
+			continue
+		}
+
+		inline = append(inline, newAttachmentPart(attachment, limit))
+	}
+
+	if text := message.GetText(); text != "" {
+		bodies = append(bodies, newTextPart("text/plain", text))
+	}
+
+	if html != "" {
+		bodies = append(bodies, newMultipart("related", append([]*mimeEntity{newTextPart("text/html", html)}, inline...)...))
+	}
+
+	if len(bodies) == 0 {
+		bodies = append(bodies, newTextPart("text/plain", ""))
+	}
+
+	// calendar clients pick up the invite from the text/calendar alternative
+	if calendar != nil {
+		bodies = append(bodies, newTextPart(calendar.ContentType(), string(calendar.Bytes())))
+	}
+
+	parts := append([]*mimeEntity{newMultipart("alternative", bodies...)}, attachments...)
+
+	return newMultipart("mixed", parts...)
+}
+
+// writeMessageHeader writes the RFC 5322 header fields of the message, which must have been validated
+func writeMessageHeader(w io.Writer, message *EmailMessage, options *mimeOptions) {
+	writeHeader(w, "From", message.GetFromAddress().Encode())
+
+	if to := message.GetToAddresses(); len(to) > 0 {
+		writeHeader(w, "To", strings.Join(formatAddresses(to, Address.Encode), ", "))
+	}
+
+	if cc := message.GetCCAddresses(); len(cc) > 0 {
+		writeHeader(w, "Cc", strings.Join(formatAddresses(cc, Address.Encode), ", "))
+	}
+
+	if replyTo := message.GetReplyToAddress(); !replyTo.IsZero() {
+		writeHeader(w, "Reply-To", replyTo.Encode())
+	}
+
+	// line breaks in the subject would start a new header
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(message.GetSubject())
+	writeHeader(w, "Subject", encodeHeaderValue(subject))
+
+	writeHeader(w, "Date", time.Now().Format(time.RFC1123Z))
+
+	messageID := formatMessageID(message.MessageID)
+	if messageID == "" {
+		messageID = NewMessageID(options.messageIDDomain)
+	}
+
+	writeHeader(w, "Message-ID", messageID)
+
+	if inReplyTo := formatMessageID(message.InReplyTo); inReplyTo != "" {
+		writeHeader(w, "In-Reply-To", inReplyTo)
+	}
+
+	if references := formatReferences(message.threadReferences()); references != "" {
+		writeHeader(w, "References", references)
+	}
+
+	// Custom and unsubscribe headers, sorted so the output is stable
+	headers := message.customHeaders()
+	for _, key := range slices.Sorted(maps.Keys(headers)) {
+		writeHeader(w, key, encodeHeaderValue(headers[key]))
+	}
+}
+
+// writeHeader writes a header field, folding it at whitespace so lines stay within 78 characters where possible
+func writeHeader(w io.Writer, key, value string) {
+	line := key + ":"
+	length := len(line)
+
+	for i, word := range strings.Split(value, " ") {
+		if i > 0 && length+1+len(word) > maxHeaderLineLength {
+			line += "\r\n"
+			length = 0
+		}
+
+		line += " " + word
+		length += 1 + len(word)
+	}
+
+	fmt.Fprintf(w, "%s\r\n", line)
+}
+
+// encodeHeaderValue RFC 2047 encodes a header value when it contains non-ASCII characters
+func encodeHeaderValue(value string) string {
+	return mime.QEncoding.Encode("UTF-8", value)
+}
+
+// formatParam formats a MIME header parameter, quoting ASCII values and RFC 2231 encoding others,
+// split into continuations so long values do not overflow the line
+func formatParam(name, value string) string {
+	if isPrintableASCII(value) {
+		return name + `="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	}
+
+	encoded := rfc2231Encode(value)
+	if len(encoded) <= maxParamSegment {
+		return name + "*=UTF-8''" + encoded
+	}
+
+	var segments []string
+
+	for i := 0; len(encoded) > 0; i++ {
+		n := min(maxParamSegment, len(encoded))
+
+		// never split a percent encoded octet
+		if n < len(encoded) {
+			if pct := strings.LastIndexByte(encoded[n-2:n], '%'); pct >= 0 {
+				n = n - 2 + pct
+			}
+		}
+
+		prefix := ""
+		if i == 0 {
+			prefix = "UTF-8''"
+		}
+
+		segments = append(segments, fmt.Sprintf("%s*%d*=%s%s", name, i, prefix, encoded[:n]))
+		encoded = encoded[n:]
+	}
+
+	return strings.Join(segments, ";\r\n ")
+}
+
+// rfc2231Encode percent encodes every octet of value that is not an RFC 2231 attribute-char
+func rfc2231Encode(value string) string {
+	var b strings.Builder
+
+	for i := range len(value) {
+		c := value[i]
+
+		if c > ' ' && c < 0x7f && !strings.ContainsRune(`*'%()<>@,;:\"/[]?=`, rune(c)) {
+			b.WriteByte(c)
+			continue
+		}
+
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
+
+// isPrintableASCII reports whether value only contains printable US-ASCII characters
+func isPrintableASCII(value string) bool {
+	for i := range len(value) {
+		if value[i] < ' ' || value[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// writeBase64 streams r to w base64 encoded, wrapped at 76 columns
+func writeBase64(w io.Writer, r io.Reader) error {
+	lw := &lineWriter{w: w}
+	encoder := base64.NewEncoder(base64.StdEncoding, lw)
+
+	if _, err := io.Copy(encoder, r); err != nil {
+		return err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	return lw.Close()
+}
+
+// lineWriter breaks what is written to it into CRLF terminated lines of at most 76 characters
+type lineWriter struct {
+	w      io.Writer
+	column int
+}
+
+// Write satisfies the io.Writer interface
+func (l *lineWriter) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		n := min(maxLineLength-l.column, len(p))
+
+		if _, err := l.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+
+		written += n
+		l.column += n
+		p = p[n:]
+
+		if l.column == maxLineLength {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return written, err
+			}
+
+			l.column = 0
+		}
+	}
+
+	return written, nil
+}
+
+// Close terminates the last line
+func (l *lineWriter) Close() error {
+	if l.column == 0 {
+		return nil
+	}
+
+	l.column = 0
+
+	_, err := io.WriteString(l.w, "\r\n")
+
+	return err
+}
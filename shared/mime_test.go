@@ -0,0 +1,296 @@
+package shared
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseMimeMessage parses raw with net/mail and returns the message and the parsed Content-Type
+func parseMimeMessage(t *testing.T, raw []byte) (*mail.Message, string, map[string]string) {
+	t.Helper()
+
+	for line := range strings.SplitSeq(string(raw), "\r\n") {
+		require.LessOrEqual(t, len(line), 998, "line exceeds the RFC 5322 limit")
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+
+	return parsed, mediaType, params
+}
+
+// readParts reads every part of a multipart body, decoding quoted-printable parts
+func readParts(t *testing.T, body io.Reader, boundary string) ([]*multipart.Part, [][]byte) {
+	t.Helper()
+
+	var (
+		parts    []*multipart.Part
+		contents [][]byte
+	)
+
+	reader := multipart.NewReader(body, boundary)
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts, contents
+		}
+
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(part)
+		require.NoError(t, err)
+
+		parts = append(parts, part)
+		contents = append(contents, content)
+	}
+}
+
+func TestBuildMimeMessageEncodedHeaders(t *testing.T) {
+	subject := "Grüße from Zoë — your café ☕ order " + strings.Repeat("is on its way ", 20)
+
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com", "elaine@seinfeld.com"}, subject, "Hello")
+	message.Headers["X-Customer"] = "Kramer Café"
+
+	raw, err := BuildMimeMessage(message)
+	require.NoError(t, err)
+
+	header, _, _ := bytes.Cut(raw, []byte("\r\n\r\n"))
+	for line := range strings.SplitSeq(string(header), "\r\n") {
+		assert.LessOrEqual(t, len(line), 78)
+	}
+
+	parsed, _, _ := parseMimeMessage(t, raw)
+
+	decoder := new(mime.WordDecoder)
+
+	decoded, err := decoder.DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, subject, decoded)
+
+	decoded, err = decoder.DecodeHeader(parsed.Header.Get("X-Customer"))
+	require.NoError(t, err)
+	assert.Equal(t, "Kramer Café", decoded)
+
+	to, err := parsed.Header.AddressList("To")
+	require.NoError(t, err)
+	assert.Len(t, to, 2)
+}
+
+func TestBuildMimeMessageQuotedPrintableBodies(t *testing.T) {
+	text := "Grüße, Jerry! " + strings.Repeat("The air is so dewy sweet you dont even have to lick the stamps. ", 40)
+	html := "<p>Grüße, Jerry!</p><p>" + strings.Repeat("When you control the mail, you control information. ", 40) + "</p>"
+
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", text).SetHTML(html)
+
+	raw, err := BuildMimeMessage(message)
+	require.NoError(t, err)
+
+	parsed, mediaType, params := parseMimeMessage(t, raw)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	parts, contents := readParts(t, parsed.Body, params["boundary"])
+	require.Len(t, parts, 2)
+
+	assert.Equal(t, "text/plain; charset=UTF-8", parts[0].Header.Get("Content-Type"))
+	assert.Equal(t, text, string(contents[0]))
+	assert.Equal(t, "text/html; charset=UTF-8", parts[1].Header.Get("Content-Type"))
+	assert.Equal(t, html, string(contents[1]))
+
+	// the encoded body lines respect the quoted-printable limit
+	for line := range strings.SplitSeq(string(raw), "\r\n") {
+		assert.LessOrEqual(t, len(line), 78)
+	}
+}
+
+func TestBuildMimeMessageSingleBody(t *testing.T) {
+	raw, err := BuildMimeMessage(NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry"))
+	require.NoError(t, err)
+
+	parsed, mediaType, _ := parseMimeMessage(t, raw)
+	assert.Equal(t, "text/plain", mediaType)
+	assert.Equal(t, "quoted-printable", parsed.Header.Get("Content-Transfer-Encoding"))
+}
+
+func TestBuildMimeMessageAttachments(t *testing.T) {
+	binary := make([]byte, 4096)
+	_, err := rand.Read(binary)
+	require.NoError(t, err)
+
+	longName := strings.Repeat("Größenübersicht ", 8) + ".pdf"
+
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry").
+		AddAttachment(NewAttachment(`notes "final".txt`, []byte("When you control the mail, you control information"))).
+		AddAttachment(NewAttachment("résumé.bin", binary)).
+		AddAttachment(NewAttachment(longName, []byte("%PDF-1.7")))
+
+	raw, err := BuildMimeMessage(message)
+	require.NoError(t, err)
+
+	parsed, mediaType, params := parseMimeMessage(t, raw)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	parts, contents := readParts(t, parsed.Body, params["boundary"])
+	require.Len(t, parts, 4)
+
+	assert.Equal(t, "Hello, Jerry", string(contents[0]))
+
+	expected := []struct {
+		filename string
+		content  []byte
+	}{
+		{filename: `notes "final".txt`, content: []byte("When you control the mail, you control information")},
+		{filename: "résumé.bin", content: binary},
+		{filename: longName, content: []byte("%PDF-1.7")},
+	}
+
+	for i, attachment := range expected {
+		part := parts[i+1]
+
+		assert.Equal(t, attachment.filename, part.FileName())
+		assert.Equal(t, "base64", part.Header.Get("Content-Transfer-Encoding"))
+
+		for line := range strings.SplitSeq(strings.TrimSpace(string(contents[i+1])), "\r\n") {
+			assert.LessOrEqual(t, len(line), 76)
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(contents[i+1]), "\r\n", ""))
+		require.NoError(t, err)
+		assert.Equal(t, attachment.content, decoded)
+	}
+}
+
+func TestBuildMimeMessageInlineAttachments(t *testing.T) {
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry").
+		SetHTML(`<p>Hello, Jerry</p><img src="cid:logo@usps.com">`).
+		AddAttachment(NewInlineAttachment("logo.png", "logo@usps.com", []byte("png"))).
+		AddAttachment(NewAttachment("notes.txt", []byte("When you control the mail, you control information")))
+
+	raw, err := BuildMimeMessage(message)
+	require.NoError(t, err)
+
+	parsed, mediaType, params := parseMimeMessage(t, raw)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	parts, contents := readParts(t, parsed.Body, params["boundary"])
+	require.Len(t, parts, 2)
+	assert.Equal(t, "notes.txt", parts[1].FileName())
+
+	// the alternative part holds the text body and the related HTML
+	mediaType, params, err = mime.ParseMediaType(parts[0].Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	alternatives, altContents := readParts(t, bytes.NewReader(contents[0]), params["boundary"])
+	require.Len(t, alternatives, 2)
+
+	mediaType, params, err = mime.ParseMediaType(alternatives[1].Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/related", mediaType)
+	assert.Equal(t, "text/html", params["type"])
+
+	related, relatedContents := readParts(t, bytes.NewReader(altContents[1]), params["boundary"])
+	require.Len(t, related, 2)
+
+	assert.Equal(t, `<p>Hello, Jerry</p><img src="cid:logo@usps.com">`, string(relatedContents[0]))
+	assert.Equal(t, "<logo@usps.com>", related[1].Header.Get("Content-ID"))
+	assert.True(t, strings.HasPrefix(related[1].Header.Get("Content-Disposition"), "inline;"))
+	assert.Equal(t, "logo.png", related[1].FileName())
+}
+
+func TestBuildMimeMessageInlineWithoutHTML(t *testing.T) {
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry").
+		AddAttachment(NewInlineAttachment("logo.png", "logo@usps.com", []byte("png")))
+
+	raw, err := BuildMimeMessage(message)
+	require.NoError(t, err)
+
+	parsed, mediaType, params := parseMimeMessage(t, raw)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	parts, _ := readParts(t, parsed.Body, params["boundary"])
+	require.Len(t, parts, 2)
+	assert.Equal(t, "logo.png", parts[1].FileName())
+}
+
+func TestBuildMimeMessageInvalidContentID(t *testing.T) {
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry").
+		SetHTML(`<img src="cid:logo">`).
+		AddAttachment(NewInlineAttachment("logo.png", "logo\r\nBcc: kramer@seinfeld.com", []byte("png")))
+
+	_, err := BuildMimeMessage(message)
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+}
+
+func TestWriteMimeMessageStreamsAttachments(t *testing.T) {
+	content := bytes.Repeat([]byte("When you control the mail, you control information. "), 1000)
+
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry").
+		AddAttachment(NewAttachmentFromReader("route.txt", bytes.NewReader(content)))
+
+	var buf bytes.Buffer
+
+	require.NoError(t, WriteMimeMessage(&buf, message))
+
+	parsed, mediaType, params := parseMimeMessage(t, buf.Bytes())
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	parts, contents := readParts(t, parsed.Body, params["boundary"])
+	require.Len(t, parts, 2)
+	assert.Equal(t, "route.txt", parts[1].FileName())
+
+	for line := range strings.SplitSeq(strings.TrimSuffix(string(contents[1]), "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 76)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(contents[1]), "\r\n", ""))
+	require.NoError(t, err)
+	assert.Equal(t, content, decoded)
+
+	// the reader was streamed rather than loaded, so it cannot be written again
+	assert.ErrorIs(t, WriteMimeMessage(io.Discard, message), ErrAttachmentConsumed)
+}
+
+func TestWriteMimeMessageValidatesFirst(t *testing.T) {
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "Hello, Jerry")
+	message.Headers["X-Bad"] = "value\r\nBcc: kramer@seinfeld.com"
+
+	var buf bytes.Buffer
+
+	assert.ErrorIs(t, WriteMimeMessage(&buf, message), ErrInvalidHeader)
+	assert.Zero(t, buf.Len())
+}
+
+func TestWriteBase64LineLength(t *testing.T) {
+	for _, size := range []int{0, 1, 56, 57, 58, 4096} {
+		content := bytes.Repeat([]byte{0xff}, size)
+
+		var buf bytes.Buffer
+
+		require.NoError(t, writeBase64(&buf, bytes.NewReader(content)))
+
+		expected := base64.StdEncoding.EncodeToString(content)
+
+		var wrapped strings.Builder
+		for len(expected) > 0 {
+			n := min(76, len(expected))
+			wrapped.WriteString(expected[:n] + "\r\n")
+			expected = expected[n:]
+		}
+
+		assert.Equal(t, wrapped.String(), buf.String(), "size %d", size)
+	}
+}
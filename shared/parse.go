@@ -0,0 +1,223 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// maxMimeDepth is how deeply multipart entities may be nested before a message is rejected
+const maxMimeDepth = 16
+
+// parsedHeaders are read into the fields of the EmailMessage, or describe the MIME structure,
+// rather than being restored as custom headers
+var parsedHeaders = map[string]bool{
+	"Date":                      true,
+	"Mime-Version":              true,
+	"Content-Id":                true,
+	"Content-Disposition":       true,
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+}
+
+// ParseMimeMessage reads a MIME message, such as one written by BuildMimeMessage or stored by the mock
+// provider, back into an EmailMessage. RFC 2047 headers, transfer encodings and nested multipart/mixed,
+// alternative and related parts are decoded. Headers that do not map onto a field are restored as custom
+// headers, and a calendar invite is returned as its .ics attachment. Bcc recipients are never written
+// into a message and so cannot be recovered
+func ParseMimeMessage(r io.Reader) (*EmailMessage, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMimeMessage, err)
+	}
+
+	decoder := new(mime.WordDecoder)
+
+	message := &EmailMessage{
+		From:              parseAddress(decoder, msg.Header.Get("From")),
+		To:                parseAddressList(decoder, msg.Header.Get("To")),
+		Cc:                parseAddressList(decoder, msg.Header.Get("Cc")),
+		ReplyTo:           parseAddress(decoder, msg.Header.Get("Reply-To")),
+		Subject:           decodeHeaderValue(decoder, msg.Header.Get("Subject")),
+		MessageID:         strings.TrimSpace(msg.Header.Get("Message-Id")),
+		InReplyTo:         strings.TrimSpace(msg.Header.Get("In-Reply-To")),
+		References:        strings.Fields(msg.Header.Get("References")),
+		Headers:           map[string]string{},
+		maxAttachmentSize: DefaultMaxAttachmentSize,
+	}
+
+	for key, values := range msg.Header {
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		if reservedHeaders[key] || parsedHeaders[key] || len(values) == 0 {
+			continue
+		}
+
+		message.Headers[key] = decodeHeaderValue(decoder, values[0])
+	}
+
+	if err := parseEntity(message, textproto.MIMEHeader(msg.Header), msg.Body, 0); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMimeMessage, err)
+	}
+
+	return message, nil
+}
+
+// parseEntity reads an entity into the message, descending into multipart entities
+func parseEntity(message *EmailMessage, header textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > maxMimeDepth {
+		return fmt.Errorf("multipart nested deeper than %d levels", maxMimeDepth)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		// RFC 2045 defaults entities without a usable Content-Type to US-ASCII text
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+
+		for {
+			// raw parts keep their Content-Transfer-Encoding so every part is decoded the same way
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if err := parseEntity(message, part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := io.ReadAll(decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return err
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dispositionParams["filename"]
+
+	if filename == "" {
+		filename = params["name"]
+	}
+
+	isBody := disposition != "attachment" && filename == "" && header.Get("Content-Id") == ""
+
+	switch {
+	case isBody && mediaType == "text/plain" && message.Text == "":
+		message.Text = decodeText(content, params["charset"])
+		return nil
+	case isBody && mediaType == "text/html" && message.HTML == "":
+		message.HTML = decodeText(content, params["charset"])
+		return nil
+	case isBody && mediaType == "text/calendar":
+		// the invite is also carried as an .ics attachment, which is what the message keeps
+		return nil
+	}
+
+	delete(params, "name")
+
+	attachment := &Attachment{
+		Filename:    decodeHeaderValue(new(mime.WordDecoder), filename),
+		Content:     content,
+		ContentType: mime.FormatMediaType(mediaType, params),
+	}
+
+	if contentID := header.Get("Content-Id"); contentID != "" {
+		attachment.ContentID = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(contentID), "<"), ">")
+		attachment.Inline = disposition != "attachment"
+	}
+
+	message.Attachments = append(message.Attachments, attachment)
+
+	return nil
+}
+
+// decodeTransferEncoding returns a reader decoding body according to its Content-Transfer-Encoding
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// decodeText converts a text body to UTF-8 with LF line endings; Latin-1 is converted, other
+// charsets are returned as they are
+func decodeText(content []byte, charset string) string {
+	if strings.EqualFold(charset, "iso-8859-1") || strings.EqualFold(charset, "latin1") {
+		runes := make([]rune, len(content))
+		for i, b := range content {
+			runes[i] = rune(b)
+		}
+
+		content = []byte(string(runes))
+	}
+
+	return string(bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n")))
+}
+
+// decodeHeaderValue decodes RFC 2047 encoded words, returning the value unchanged when it is not valid
+func decodeHeaderValue(decoder *mime.WordDecoder, value string) string {
+	decoded, err := decoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+
+	return decoded
+}
+
+// parseAddress parses a single address header, keeping the display name when there is one
+func parseAddress(decoder *mime.WordDecoder, value string) string {
+	addresses := parseAddressList(decoder, value)
+	if len(addresses) == 0 {
+		return ""
+	}
+
+	return addresses[0]
+}
+
+// parseAddressList parses an address list header, falling back to splitting on commas when the list is not valid RFC 5322
+func parseAddressList(decoder *mime.WordDecoder, value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	parser := mail.AddressParser{WordDecoder: decoder}
+
+	list, err := parser.ParseList(value)
+	if err != nil {
+		var addresses []string
+
+		for address := range strings.SplitSeq(decodeHeaderValue(decoder, value), ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+
+		return addresses
+	}
+
+	addresses := make([]string, 0, len(list))
+
+	for _, address := range list {
+		addresses = append(addresses, Address{Name: address.Name, Address: address.Address}.String())
+	}
+
+	return addresses
+}
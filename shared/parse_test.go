@@ -0,0 +1,164 @@
+package shared
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMimeMessageRoundTrip(t *testing.T) {
+	binary := make([]byte, 4096)
+	_, err := rand.Read(binary)
+	require.NoError(t, err)
+
+	longName := strings.Repeat("Größenübersicht ", 8) + ".pdf"
+
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com", "elaine@seinfeld.com"}, "Grüße from Zoë — your café ☕ order "+strings.Repeat("is on its way ", 10), "").
+		SetCC([]string{"kramer@seinfeld.com"}).
+		SetReplyTo("postmaster@usps.com").
+		SetText("Hello, Jerry\nThe air is so dewy sweet you dont even have to lick the stamps. " + strings.Repeat("Grüße ", 30)).
+		SetHTML(`<p>Hello, Jerry</p><img src="cid:logo@usps.com">`).
+		SetMessageID("<route-42@usps.com>").
+		SetInReplyTo("<route-41@usps.com>").
+		SetReferences([]string{"<route-40@usps.com>", "<route-41@usps.com>"}).
+		AddAttachment(NewInlineAttachment("logo.png", "logo@usps.com", []byte("png"))).
+		AddAttachment(NewAttachment(`notes "final".txt`, []byte("When you control the mail, you control information"))).
+		AddAttachment(NewAttachment("résumé.bin", binary)).
+		AddAttachment(NewAttachment(longName, []byte("%PDF-1.7")))
+
+	message.Headers["X-Customer"] = "Kramer Café"
+	message.Headers["X-Route"] = "42"
+
+	raw, err := BuildMimeMessage(message)
+	require.NoError(t, err)
+
+	parsed, err := ParseMimeMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	assert.Equal(t, message.From, parsed.From)
+	assert.Equal(t, message.To, parsed.To)
+	assert.Equal(t, message.Cc, parsed.Cc)
+	assert.Equal(t, message.ReplyTo, parsed.ReplyTo)
+	assert.Equal(t, message.Subject, parsed.Subject)
+	assert.Equal(t, message.Text, parsed.Text)
+	assert.Equal(t, message.HTML, parsed.HTML)
+	assert.Equal(t, message.MessageID, parsed.MessageID)
+	assert.Equal(t, message.InReplyTo, parsed.InReplyTo)
+	assert.Equal(t, message.References, parsed.References)
+	assert.Equal(t, message.Headers, parsed.Headers)
+
+	require.Len(t, parsed.Attachments, len(message.Attachments))
+
+	for i, attachment := range message.Attachments {
+		assert.Equal(t, attachment.GetFilename(), parsed.Attachments[i].GetFilename())
+		assert.Equal(t, attachment.GetRawContent(), parsed.Attachments[i].GetRawContent())
+		assert.Equal(t, attachment.IsInline(), parsed.Attachments[i].IsInline())
+		assert.Equal(t, attachment.GetContentID(), parsed.Attachments[i].GetContentID())
+	}
+
+	// the parsed message builds the same structure again
+	rebuilt, err := BuildMimeMessage(parsed)
+	require.NoError(t, err)
+
+	reparsed, err := ParseMimeMessage(bytes.NewReader(rebuilt))
+	require.NoError(t, err)
+	assert.Equal(t, parsed.Text, reparsed.Text)
+	assert.Equal(t, parsed.Attachments, reparsed.Attachments)
+}
+
+func TestParseMimeMessageSingleBody(t *testing.T) {
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Test Email", "<p>Hello, Jerry</p>")
+
+	raw, err := BuildMimeMessage(message)
+	require.NoError(t, err)
+
+	parsed, err := ParseMimeMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	assert.Equal(t, "<p>Hello, Jerry</p>", parsed.HTML)
+	assert.Empty(t, parsed.Text)
+	assert.Empty(t, parsed.Attachments)
+	assert.NotEmpty(t, parsed.MessageID)
+	assert.Empty(t, parsed.Headers)
+}
+
+func TestParseMimeMessageCalendar(t *testing.T) {
+	start := time.Date(2026, time.March, 20, 13, 0, 0, 0, time.UTC)
+	event := NewCalendarEvent("Mail route review", start, start.Add(time.Hour)).SetOrganizer("newman@usps.com", "Newman")
+
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello, Jerry").SetCalendar(event)
+
+	raw, err := BuildMimeMessage(message)
+	require.NoError(t, err)
+
+	parsed, err := ParseMimeMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello, Jerry", parsed.Text)
+	require.Len(t, parsed.Attachments, 1)
+	assert.Equal(t, "invite.ics", parsed.Attachments[0].GetFilename())
+	assert.Equal(t, event.Bytes(), parsed.Attachments[0].GetRawContent())
+}
+
+func TestParseMimeMessageExternal(t *testing.T) {
+	raw := strings.Join([]string{
+		`From: =?ISO-8859-1?Q?Jos=E9?= <jose@example.com>`,
+		`To: "Seinfeld, Jerry" <jerry@seinfeld.com>, elaine@seinfeld.com`,
+		`Subject: =?UTF-8?B?R3LDvMOfZQ==?=`,
+		`X-Mailer: Outlook`,
+		`MIME-Version: 1.0`,
+		`Content-Type: multipart/mixed; boundary="outer"`,
+		``,
+		`--outer`,
+		`Content-Type: text/plain; charset=ISO-8859-1`,
+		`Content-Transfer-Encoding: quoted-printable`,
+		``,
+		`Caf=E9 soon=`,
+		`, Jerry`,
+		`--outer`,
+		`Content-Type: application/octet-stream; name="=?UTF-8?Q?r=C3=A9sum=C3=A9.txt?="`,
+		`Content-Transfer-Encoding: base64`,
+		``,
+		`SGVsbG8s`,
+		`IEplcnJ5`,
+		`--outer--`,
+		``,
+	}, "\r\n")
+
+	parsed, err := ParseMimeMessage(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	assert.Equal(t, `"José" <jose@example.com>`, parsed.From)
+	assert.Equal(t, []string{`"Seinfeld, Jerry" <jerry@seinfeld.com>`, "elaine@seinfeld.com"}, parsed.To)
+	assert.Equal(t, "Grüße", parsed.Subject)
+	assert.Equal(t, map[string]string{"X-Mailer": "Outlook"}, parsed.Headers)
+	assert.Equal(t, "Café soon, Jerry", parsed.Text)
+
+	require.Len(t, parsed.Attachments, 1)
+	assert.Equal(t, "résumé.txt", parsed.Attachments[0].GetFilename())
+	assert.Equal(t, "Hello, Jerry", string(parsed.Attachments[0].GetRawContent()))
+	assert.False(t, parsed.Attachments[0].IsInline())
+}
+
+func TestParseMimeMessageInvalid(t *testing.T) {
+	_, err := ParseMimeMessage(strings.NewReader("not a message"))
+	assert.ErrorIs(t, err, ErrInvalidMimeMessage)
+
+	var nested strings.Builder
+
+	nested.WriteString("From: newman@usps.com\r\n")
+
+	for i := range maxMimeDepth + 2 {
+		fmt.Fprintf(&nested, "Content-Type: multipart/mixed; boundary=b%d\r\n\r\n--b%d\r\n", i, i)
+	}
+
+	_, err = ParseMimeMessage(strings.NewReader(nested.String()))
+	assert.ErrorIs(t, err, ErrInvalidMimeMessage)
+	assert.ErrorContains(t, err, "nested deeper")
+}
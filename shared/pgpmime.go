@@ -0,0 +1,312 @@
+package shared
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+const (
+	// pgpSignatureType is the media type of a detached PGP/MIME signature
+	pgpSignatureType = "application/pgp-signature"
+	// pgpEncryptedType is the media type of the control part of a PGP/MIME encrypted message
+	pgpEncryptedType = "application/pgp-encrypted"
+)
+
+// PGPMIME signs and encrypts MIME messages with OpenPGP as PGP/MIME (RFC 3156). A signed message is
+// written as multipart/signed with a detached signature, and an encrypted message as multipart/encrypted.
+// A message that is both is signed and encrypted in one OpenPGP message, as RFC 3156 section 6.2 allows
+type PGPMIME struct {
+	signer     *openpgp.Entity
+	recipients []*openpgp.Entity
+	config     *packet.Config
+}
+
+// PGPOption configures a PGPMIME
+type PGPOption func(*PGPMIME)
+
+// WithPGPSigner signs messages with the entity, which must hold a decrypted private signing key
+func WithPGPSigner(signer *openpgp.Entity) PGPOption {
+	return func(p *PGPMIME) {
+		p.signer = signer
+	}
+}
+
+// WithPGPRecipients encrypts messages to the public keys of the entities. Include the entity of the
+// sender to be able to read the sent message
+func WithPGPRecipients(recipients ...*openpgp.Entity) PGPOption {
+	return func(p *PGPMIME) {
+		p.recipients = append(p.recipients, recipients...)
+	}
+}
+
+// NewPGPMIME creates a PGPMIME that signs, encrypts, or signs and encrypts messages
+func NewPGPMIME(opts ...PGPOption) (*PGPMIME, error) {
+	p := &PGPMIME{config: &packet.Config{DefaultHash: crypto.SHA256}}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.signer == nil && len(p.recipients) == 0 {
+		return nil, fmt.Errorf("%w: a signer or recipients are required", ErrInvalidPGPMIME)
+	}
+
+	now := time.Now()
+
+	if p.signer != nil {
+		key, ok := p.signer.SigningKey(now)
+		if !ok || key.PrivateKey == nil || key.PrivateKey.Encrypted {
+			return nil, fmt.Errorf("%w: the signer has no usable private signing key", ErrInvalidPGPMIME)
+		}
+	}
+
+	for _, recipient := range p.recipients {
+		if recipient == nil {
+			return nil, fmt.Errorf("%w: nil recipient", ErrInvalidPGPMIME)
+		}
+
+		if _, ok := recipient.EncryptionKey(now); !ok {
+			return nil, fmt.Errorf("%w: recipient %X has no usable encryption key", ErrInvalidPGPMIME, recipient.PrimaryKey.Fingerprint)
+		}
+	}
+
+	return p, nil
+}
+
+// WithPGPMIME signs and encrypts the message with PGP/MIME. The message is built in memory, since the
+// whole content is signed or encrypted before it is written. It replaces S/MIME set with WithSMIME
+func WithPGPMIME(p *PGPMIME) MimeOption {
+	return func(o *mimeOptions) {
+		o.wrapper = p
+	}
+}
+
+// wrap encrypts the entity when there are recipients, signing it too when there is a signer, or signs it
+func (p *PGPMIME) wrap(entity []byte) ([]byte, error) {
+	if len(p.recipients) > 0 {
+		return p.encrypt(entity)
+	}
+
+	return p.sign(entity)
+}
+
+// sign returns a multipart/signed entity holding the entity and its detached signature
+func (p *PGPMIME) sign(entity []byte) ([]byte, error) {
+	var signature bytes.Buffer
+
+	if err := openpgp.DetachSignText(&signature, p.signer, bytes.NewReader(entity), p.config); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPGPMIME, err)
+	}
+
+	// the signing key may prefer another hash than the configured one, and micalg must name the one used
+	parsed, err := packet.Read(bytes.NewReader(signature.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+
+	sig, ok := parsed.(*packet.Signature)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected signature packet %T", ErrInvalidPGPMIME, parsed)
+	}
+
+	armored, err := armorMessage(signature.Bytes(), "PGP SIGNATURE")
+	if err != nil {
+		return nil, err
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", pgpSignatureType+`; name="signature.asc"`)
+	header.Set("Content-Description", "OpenPGP digital signature")
+	header.Set("Content-Disposition", `attachment; filename="signature.asc"`)
+
+	part, err := newRawPart(header, armored).render()
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]string{"protocol": pgpSignatureType, "micalg": pgpMicalg(sig.Hash)}
+
+	return formatMultipart("signed", params, entity, part), nil
+}
+
+// encrypt returns a multipart/encrypted entity holding the entity encrypted to the recipients, and signed
+// when there is a signer
+func (p *PGPMIME) encrypt(entity []byte) ([]byte, error) {
+	var encrypted bytes.Buffer
+
+	plaintext, err := openpgp.EncryptText(&encrypted, p.recipients, p.signer, &openpgp.FileHints{}, p.config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPGPMIME, err)
+	}
+
+	if _, err := plaintext.Write(entity); err != nil {
+		return nil, err
+	}
+
+	if err := plaintext.Close(); err != nil {
+		return nil, err
+	}
+
+	armored, err := armorMessage(encrypted.Bytes(), "PGP MESSAGE")
+	if err != nil {
+		return nil, err
+	}
+
+	control := textproto.MIMEHeader{}
+	control.Set("Content-Type", pgpEncryptedType)
+	control.Set("Content-Description", "PGP/MIME version identification")
+
+	controlPart, err := newRawPart(control, []byte("Version: 1\r\n")).render()
+	if err != nil {
+		return nil, err
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", `application/octet-stream; name="encrypted.asc"`)
+	header.Set("Content-Description", "OpenPGP encrypted message")
+	header.Set("Content-Disposition", `inline; filename="encrypted.asc"`)
+
+	encryptedPart, err := newRawPart(header, armored).render()
+	if err != nil {
+		return nil, err
+	}
+
+	return formatMultipart("encrypted", map[string]string{"protocol": pgpEncryptedType}, controlPart, encryptedPart), nil
+}
+
+// VerifyPGPMIME checks the signature of a PGP/MIME multipart/signed message against the keyring and
+// returns the message with the signed content in place of the signature
+func VerifyPGPMIME(message []byte, keyring openpgp.KeyRing) ([]byte, error) {
+	wrapped, err := parseWrapped(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if !wrapped.is("multipart/signed", pgpSignatureType) {
+		return nil, fmt.Errorf("%w: not a PGP/MIME signed message", ErrSignatureVerification)
+	}
+
+	parts, err := wrapped.parts()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%w: a signed message has 2 parts, not %d", ErrSignatureVerification, len(parts))
+	}
+
+	signaturePart, err := parseWrapped(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(parts[0]), bytes.NewReader(signaturePart.body), nil); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignatureVerification, err)
+	}
+
+	return wrapped.unwrap(parts[0]), nil
+}
+
+// DecryptPGPMIME decrypts a PGP/MIME multipart/encrypted message with the private keys of the keyring and
+// returns the message with the decrypted content. A signature made when the message was encrypted must be
+// from a key of the keyring and verify
+func DecryptPGPMIME(message []byte, keyring openpgp.KeyRing) ([]byte, error) {
+	wrapped, err := parseWrapped(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if !wrapped.is("multipart/encrypted", pgpEncryptedType) {
+		return nil, fmt.Errorf("%w: not a PGP/MIME encrypted message", ErrDecryption)
+	}
+
+	parts, err := wrapped.parts()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%w: an encrypted message has 2 parts, not %d", ErrDecryption, len(parts))
+	}
+
+	encryptedPart, err := parseWrapped(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := armor.Decode(bytes.NewReader(encryptedPart.body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+
+	details, err := openpgp.ReadMessage(block.Body, keyring, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+
+	// the signature is checked once the whole body has been read
+	entity, err := io.ReadAll(details.UnverifiedBody)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+
+	if details.IsSigned {
+		if details.SignedBy == nil {
+			return nil, fmt.Errorf("%w: signed by unknown key %X", ErrSignatureVerification, details.SignedByKeyId)
+		}
+
+		if details.SignatureError != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSignatureVerification, details.SignatureError)
+		}
+	}
+
+	return wrapped.unwrap(entity), nil
+}
+
+// newRawPart creates a leaf part whose body is written as it is
+func newRawPart(header textproto.MIMEHeader, body []byte) *mimeEntity {
+	return &mimeEntity{
+		header: header,
+		body: func(w io.Writer) error {
+			_, err := w.Write(body)
+
+			return err
+		},
+	}
+}
+
+// armorMessage ASCII armors an OpenPGP packet sequence with CRLF line endings
+func armorMessage(data []byte, blockType string) ([]byte, error) {
+	var armored bytes.Buffer
+
+	w, err := armor.Encode(&armored, blockType, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	armored.WriteString("\n")
+
+	return []byte(strings.ReplaceAll(armored.String(), "\n", "\r\n")), nil
+}
+
+// pgpMicalg returns the micalg parameter naming the hash of a PGP/MIME signature, such as pgp-sha256
+func pgpMicalg(hash crypto.Hash) string {
+	return "pgp-" + strings.ToLower(strings.ReplaceAll(hash.String(), "-", ""))
+}
@@ -0,0 +1,117 @@
+package shared
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestEntity creates an OpenPGP key for the address
+func newTestEntity(t *testing.T, name, address string) *openpgp.Entity {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity(name, "", address, &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	require.NoError(t, err)
+
+	return entity
+}
+
+func TestPGPMIMESign(t *testing.T) {
+	newman := newTestEntity(t, "Newman", "newman@usps.com")
+
+	pgp, err := NewPGPMIME(WithPGPSigner(newman))
+	require.NoError(t, err)
+
+	raw, err := BuildMimeMessage(newProtectedTestMessage(), WithPGPMIME(pgp))
+	require.NoError(t, err)
+
+	header := string(raw[:bytes.Index(raw, []byte("\r\n\r\n"))])
+	assert.Contains(t, header, `Content-Type: multipart/signed;`)
+	assert.Contains(t, header, `micalg=pgp-sha256;`)
+	assert.Contains(t, header, `protocol="application/pgp-signature"`)
+	assert.Contains(t, string(raw), "-----BEGIN PGP SIGNATURE-----\r\n")
+
+	unwrapped, err := VerifyPGPMIME(raw, openpgp.EntityList{newman})
+	require.NoError(t, err)
+	assertProtectedTestMessage(t, unwrapped)
+
+	// a signature from a key outside the keyring does not verify
+	_, err = VerifyPGPMIME(raw, openpgp.EntityList{newTestEntity(t, "Kramer", "kramer@seinfeld.com")})
+	assert.ErrorIs(t, err, ErrSignatureVerification)
+
+	tampered := bytes.Replace(raw, []byte("Hello, Jerry"), []byte("Hello, Newman"), 1)
+
+	_, err = VerifyPGPMIME(tampered, openpgp.EntityList{newman})
+	assert.ErrorIs(t, err, ErrSignatureVerification)
+}
+
+func TestPGPMIMEEncrypt(t *testing.T) {
+	newman := newTestEntity(t, "Newman", "newman@usps.com")
+	jerry := newTestEntity(t, "Jerry", "jerry@seinfeld.com")
+
+	pgp, err := NewPGPMIME(WithPGPRecipients(jerry))
+	require.NoError(t, err)
+
+	raw, err := BuildMimeMessage(newProtectedTestMessage(), WithPGPMIME(pgp))
+	require.NoError(t, err)
+
+	assert.Contains(t, string(raw), `protocol="application/pgp-encrypted"`)
+	assert.Contains(t, string(raw), "Version: 1\r\n")
+	assert.NotContains(t, string(raw), "Hello, Jerry")
+
+	decrypted, err := DecryptPGPMIME(raw, openpgp.EntityList{jerry})
+	require.NoError(t, err)
+	assertProtectedTestMessage(t, decrypted)
+
+	_, err = DecryptPGPMIME(raw, openpgp.EntityList{newman})
+	assert.ErrorIs(t, err, ErrDecryption)
+
+	_, err = VerifyPGPMIME(raw, openpgp.EntityList{jerry})
+	assert.ErrorIs(t, err, ErrSignatureVerification)
+}
+
+func TestPGPMIMESignAndEncrypt(t *testing.T) {
+	newman := newTestEntity(t, "Newman", "newman@usps.com")
+	jerry := newTestEntity(t, "Jerry", "jerry@seinfeld.com")
+
+	pgp, err := NewPGPMIME(WithPGPSigner(newman), WithPGPRecipients(jerry, newman))
+	require.NoError(t, err)
+
+	raw, err := BuildMimeMessage(newProtectedTestMessage(), WithPGPMIME(pgp))
+	require.NoError(t, err)
+
+	decrypted, err := DecryptPGPMIME(raw, openpgp.EntityList{jerry, newman})
+	require.NoError(t, err)
+	assertProtectedTestMessage(t, decrypted)
+
+	// the sender can read the sent message too
+	_, err = DecryptPGPMIME(raw, openpgp.EntityList{newman})
+	require.NoError(t, err)
+
+	// the signature cannot be checked without the key of the sender
+	_, err = DecryptPGPMIME(raw, openpgp.EntityList{jerry})
+	assert.ErrorIs(t, err, ErrSignatureVerification)
+}
+
+func TestNewPGPMIMEInvalid(t *testing.T) {
+	newman := newTestEntity(t, "Newman", "newman@usps.com")
+
+	locked := newTestEntity(t, "Kramer", "kramer@seinfeld.com")
+	require.NoError(t, locked.EncryptPrivateKeys([]byte("giddy up"), nil))
+
+	for name, opts := range map[string][]PGPOption{
+		"no signer or recipients": nil,
+		"encrypted signing key":   {WithPGPSigner(locked)},
+		"nil recipient":           {WithPGPRecipients(nil)},
+	} {
+		_, err := NewPGPMIME(opts...)
+		assert.ErrorIs(t, err, ErrInvalidPGPMIME, name)
+	}
+
+	_, err := NewPGPMIME(WithPGPSigner(newman), WithPGPRecipients(locked))
+	assert.NoError(t, err)
+}
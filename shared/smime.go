@@ -0,0 +1,258 @@
+package shared
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"sync"
+
+	"github.com/smallstep/pkcs7"
+)
+
+const (
+	// smimeSignatureType is the media type of a detached S/MIME signature
+	smimeSignatureType = "application/pkcs7-signature"
+	// smimeEnvelopedType is the media type of an S/MIME encrypted entity
+	smimeEnvelopedType = "application/pkcs7-mime"
+	// smimeMicalg names the digest of S/MIME signatures in the micalg parameter of multipart/signed
+	smimeMicalg = "sha-256"
+)
+
+// smimeEncryptMu serializes S/MIME encryption, since pkcs7 reads the content encryption algorithm from a
+// package variable and has no per-call option. It only orders encryption done by this package: other code
+// in the process that calls pkcs7.Encrypt or sets pkcs7.ContentEncryptionAlgorithm races with it, and either
+// side may end up encrypting with the other's cipher
+var smimeEncryptMu sync.Mutex
+
+// SMIME signs and encrypts MIME messages with S/MIME (RFC 8551). A signed message is written as
+// multipart/signed with a detached SHA-256 signature, an encrypted message as application/pkcs7-mime
+// enveloped-data with AES-256-CBC, and a message that is both is signed before it is encrypted.
+// Encryption sets the package-global pkcs7.ContentEncryptionAlgorithm for the duration of each call, so
+// it must not run alongside other users of github.com/smallstep/pkcs7 encryption in the same process
+type SMIME struct {
+	cert          *x509.Certificate
+	key           crypto.Signer
+	intermediates []*x509.Certificate
+	recipients    []*x509.Certificate
+}
+
+// SMIMEOption configures an SMIME
+type SMIMEOption func(*SMIME)
+
+// WithSMIMESigner signs messages with the key of the certificate. The intermediates, from the issuer of the
+// certificate up, are included in the signature so recipients can build the chain to a trusted root
+func WithSMIMESigner(cert *x509.Certificate, key crypto.Signer, intermediates ...*x509.Certificate) SMIMEOption {
+	return func(s *SMIME) {
+		s.cert = cert
+		s.key = key
+		s.intermediates = intermediates
+	}
+}
+
+// WithSMIMERecipients encrypts messages to the certificates, which must hold RSA keys. Include the
+// certificate of the sender to be able to read the sent message
+func WithSMIMERecipients(recipients ...*x509.Certificate) SMIMEOption {
+	return func(s *SMIME) {
+		s.recipients = append(s.recipients, recipients...)
+	}
+}
+
+// NewSMIME creates an SMIME that signs, encrypts, or signs and encrypts messages
+func NewSMIME(opts ...SMIMEOption) (*SMIME, error) {
+	s := &SMIME{}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.cert == nil && len(s.recipients) == 0 {
+		return nil, fmt.Errorf("%w: a signer or recipients are required", ErrInvalidSMIME)
+	}
+
+	if s.cert != nil {
+		if s.key == nil {
+			return nil, fmt.Errorf("%w: the signer has no private key", ErrInvalidSMIME)
+		}
+
+		switch s.key.Public().(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+		default:
+			return nil, fmt.Errorf("%w: unsupported signing key %T", ErrInvalidSMIME, s.key)
+		}
+
+		public, ok := s.key.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !public.Equal(s.cert.PublicKey) {
+			return nil, fmt.Errorf("%w: the private key does not match the signer certificate", ErrInvalidSMIME)
+		}
+	}
+
+	for _, recipient := range s.recipients {
+		if recipient == nil {
+			return nil, fmt.Errorf("%w: nil recipient certificate", ErrInvalidSMIME)
+		}
+
+		if _, ok := recipient.PublicKey.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("%w: recipient %q does not have an RSA key", ErrInvalidSMIME, recipient.Subject.CommonName)
+		}
+	}
+
+	return s, nil
+}
+
+// WithSMIME signs and encrypts the message with S/MIME. The message is built in memory, since the whole
+// content is signed or encrypted before it is written. It replaces PGP/MIME set with WithPGPMIME
+func WithSMIME(s *SMIME) MimeOption {
+	return func(o *mimeOptions) {
+		o.wrapper = s
+	}
+}
+
+// wrap signs and then encrypts the entity, as the SMIME is configured to
+func (s *SMIME) wrap(entity []byte) ([]byte, error) {
+	var err error
+
+	if s.cert != nil {
+		if entity, err = s.sign(entity); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(s.recipients) > 0 {
+		if entity, err = s.encrypt(entity); err != nil {
+			return nil, err
+		}
+	}
+
+	return entity, nil
+}
+
+// sign returns a multipart/signed entity holding the entity and its detached signature
+func (s *SMIME) sign(entity []byte) ([]byte, error) {
+	signedData, err := pkcs7.NewSignedData(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	signedData.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+
+	if err := signedData.AddSignerChain(s.cert, s.key, s.intermediates, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSMIME, err)
+	}
+
+	signedData.Detach()
+
+	signature, err := signedData.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	part, err := newAttachmentPart(&Attachment{Filename: "smime.p7s", Content: signature, ContentType: smimeSignatureType}, -1).render()
+	if err != nil {
+		return nil, err
+	}
+
+	return formatMultipart("signed", map[string]string{"protocol": smimeSignatureType, "micalg": smimeMicalg}, entity, part), nil
+}
+
+// encrypt returns an application/pkcs7-mime entity holding the entity encrypted to the recipients
+func (s *SMIME) encrypt(entity []byte) ([]byte, error) {
+	smimeEncryptMu.Lock()
+
+	algorithm := pkcs7.ContentEncryptionAlgorithm
+	pkcs7.ContentEncryptionAlgorithm = pkcs7.EncryptionAlgorithmAES256CBC
+
+	enveloped, err := pkcs7.Encrypt(entity, s.recipients)
+
+	pkcs7.ContentEncryptionAlgorithm = algorithm
+
+	smimeEncryptMu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newAttachmentPart(&Attachment{
+		Filename:    "smime.p7m",
+		Content:     enveloped,
+		ContentType: smimeEnvelopedType + "; smime-type=enveloped-data",
+	}, -1).render()
+}
+
+// VerifySMIME checks the signature of an S/MIME multipart/signed message and returns the message with
+// the signed content in place of the signature. When roots is nil the signature is checked against the
+// certificate it carries without building a chain, which suits self-signed test certificates
+func VerifySMIME(message []byte, roots *x509.CertPool) ([]byte, error) {
+	wrapped, err := parseWrapped(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if !wrapped.is("multipart/signed", smimeSignatureType) {
+		return nil, fmt.Errorf("%w: not an S/MIME signed message", ErrSignatureVerification)
+	}
+
+	parts, err := wrapped.parts()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%w: a signed message has 2 parts, not %d", ErrSignatureVerification, len(parts))
+	}
+
+	signaturePart, err := parseWrapped(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := signaturePart.decodedBody()
+	if err != nil {
+		return nil, err
+	}
+
+	p7, err := pkcs7.Parse(signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignatureVerification, err)
+	}
+
+	p7.Content = parts[0]
+
+	if err := p7.VerifyWithChain(roots); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignatureVerification, err)
+	}
+
+	return wrapped.unwrap(parts[0]), nil
+}
+
+// DecryptSMIME decrypts an S/MIME enveloped-data message with the certificate and private key of a
+// recipient and returns the message with the decrypted content, which is itself signed when the message
+// was signed and encrypted
+func DecryptSMIME(message []byte, cert *x509.Certificate, key crypto.PrivateKey) ([]byte, error) {
+	wrapped, err := parseWrapped(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if !wrapped.is(smimeEnvelopedType, "") || wrapped.params["smime-type"] != "enveloped-data" {
+		return nil, fmt.Errorf("%w: not an S/MIME encrypted message", ErrDecryption)
+	}
+
+	enveloped, err := wrapped.decodedBody()
+	if err != nil {
+		return nil, err
+	}
+
+	p7, err := pkcs7.Parse(enveloped)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+
+	entity, err := p7.Decrypt(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+
+	return wrapped.unwrap(entity), nil
+}
@@ -0,0 +1,210 @@
+package shared
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCertificate creates a self-signed S/MIME certificate for the address
+func newTestCertificate(t *testing.T, address string) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(time.Now().UnixNano()),
+		Subject:        pkix.Name{CommonName: address},
+		EmailAddresses: []string{address},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert, key
+}
+
+// newProtectedTestMessage returns a message with a text and HTML body and an attachment
+func newProtectedTestMessage() *EmailMessage {
+	return NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello, Jerry").
+		SetHTML("<p>Hello, Jerry</p>").
+		AddAttachment(NewAttachment("route.csv", []byte("42,Kramer")))
+}
+
+// assertProtectedTestMessage checks that the unwrapped message holds the content of newProtectedTestMessage
+func assertProtectedTestMessage(t *testing.T, unwrapped []byte) {
+	t.Helper()
+
+	parsed, err := ParseMimeMessage(bytes.NewReader(unwrapped))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Mail route review", parsed.Subject)
+	assert.Equal(t, "Hello, Jerry", parsed.Text)
+	assert.Equal(t, "<p>Hello, Jerry</p>", parsed.HTML)
+	require.Len(t, parsed.Attachments, 1)
+	assert.Equal(t, []byte("42,Kramer"), parsed.Attachments[0].GetRawContent())
+}
+
+func TestSMIMESign(t *testing.T) {
+	cert, key := newTestCertificate(t, "newman@usps.com")
+
+	smime, err := NewSMIME(WithSMIMESigner(cert, key))
+	require.NoError(t, err)
+
+	raw, err := BuildMimeMessage(newProtectedTestMessage(), WithSMIME(smime))
+	require.NoError(t, err)
+
+	header := string(raw[:bytes.Index(raw, []byte("\r\n\r\n"))])
+	assert.Contains(t, header, "Subject: Mail route review\r\n")
+	assert.Contains(t, header, "MIME-Version: 1.0\r\n")
+	assert.Contains(t, header, `Content-Type: multipart/signed;`)
+	assert.Contains(t, header, `micalg=sha-256;`)
+	assert.Contains(t, header, `protocol="application/pkcs7-signature"`)
+
+	unwrapped, err := VerifySMIME(raw, nil)
+	require.NoError(t, err)
+	assertProtectedTestMessage(t, unwrapped)
+
+	// the certificate chains to a trusted root
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	_, err = VerifySMIME(raw, roots)
+	require.NoError(t, err)
+
+	other, _ := newTestCertificate(t, "kramer@seinfeld.com")
+	untrusted := x509.NewCertPool()
+	untrusted.AddCert(other)
+
+	_, err = VerifySMIME(raw, untrusted)
+	assert.ErrorIs(t, err, ErrSignatureVerification)
+
+	// the signed content cannot be changed
+	tampered := bytes.Replace(raw, []byte("Hello, Jerry"), []byte("Hello, Newman"), 1)
+
+	_, err = VerifySMIME(tampered, nil)
+	assert.ErrorIs(t, err, ErrSignatureVerification)
+
+	unsigned, err := BuildMimeMessage(newProtectedTestMessage())
+	require.NoError(t, err)
+
+	_, err = VerifySMIME(unsigned, nil)
+	assert.ErrorIs(t, err, ErrSignatureVerification)
+}
+
+func TestSMIMEEncrypt(t *testing.T) {
+	cert, key := newTestCertificate(t, "jerry@seinfeld.com")
+
+	smime, err := NewSMIME(WithSMIMERecipients(cert))
+	require.NoError(t, err)
+
+	raw, err := BuildMimeMessage(newProtectedTestMessage(), WithSMIME(smime))
+	require.NoError(t, err)
+
+	assert.Contains(t, string(raw), "Content-Type: application/pkcs7-mime; smime-type=enveloped-data;")
+	assert.Contains(t, string(raw), "Content-Disposition: attachment; filename=\"smime.p7m\"\r\n")
+	assert.NotContains(t, string(raw), "Hello, Jerry")
+	// the message headers stay readable
+	assert.Contains(t, string(raw), "Subject: Mail route review\r\n")
+
+	decrypted, err := DecryptSMIME(raw, cert, key)
+	require.NoError(t, err)
+	assertProtectedTestMessage(t, decrypted)
+
+	other, otherKey := newTestCertificate(t, "kramer@seinfeld.com")
+
+	_, err = DecryptSMIME(raw, other, otherKey)
+	assert.ErrorIs(t, err, ErrDecryption)
+
+	_, err = VerifySMIME(raw, nil)
+	assert.ErrorIs(t, err, ErrSignatureVerification)
+}
+
+func TestSMIMESignAndEncrypt(t *testing.T) {
+	senderCert, senderKey := newTestCertificate(t, "newman@usps.com")
+	recipientCert, recipientKey := newTestCertificate(t, "jerry@seinfeld.com")
+
+	smime, err := NewSMIME(WithSMIMESigner(senderCert, senderKey), WithSMIMERecipients(recipientCert))
+	require.NoError(t, err)
+
+	dkimSigner, err := NewDKIMSigner("usps.com", "route", senderKey)
+	require.NoError(t, err)
+
+	// DKIM signs the encrypted message, whichever order the options are given in
+	raw, err := BuildMimeMessage(newProtectedTestMessage(), WithDKIMSigner(dkimSigner), WithSMIME(smime))
+	require.NoError(t, err)
+
+	require.NoError(t, VerifyDKIM(raw, recordLookup(t, dkimSigner.DNSRecord())))
+
+	decrypted, err := DecryptSMIME(raw, recipientCert, recipientKey)
+	require.NoError(t, err)
+
+	// the decrypted content is the signed message
+	unwrapped, err := VerifySMIME(decrypted, nil)
+	require.NoError(t, err)
+	assertProtectedTestMessage(t, unwrapped)
+}
+
+func TestNewSMIMEInvalid(t *testing.T) {
+	cert, _ := newTestCertificate(t, "newman@usps.com")
+	_, otherKey := newTestCertificate(t, "kramer@seinfeld.com")
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	ecTemplate := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	ecDER, err := x509.CreateCertificate(rand.Reader, ecTemplate, ecTemplate, &ecKey.PublicKey, ecKey)
+	require.NoError(t, err)
+
+	ecCert, err := x509.ParseCertificate(ecDER)
+	require.NoError(t, err)
+
+	for name, opts := range map[string][]SMIMEOption{
+		"no signer or recipients": nil,
+		"mismatched key":          {WithSMIMESigner(cert, otherKey)},
+		"missing key":             {WithSMIMESigner(cert, nil)},
+		"ecdsa recipient":         {WithSMIMERecipients(ecCert)},
+	} {
+		_, err := NewSMIME(opts...)
+		assert.ErrorIs(t, err, ErrInvalidSMIME, name)
+	}
+
+	// ECDSA keys can sign
+	_, err = NewSMIME(WithSMIMESigner(ecCert, ecKey))
+	assert.NoError(t, err)
+}
+
+func TestWrappedMessageParts(t *testing.T) {
+	body := "preamble\r\n--b\r\nContent-Type: text/plain\r\n\r\none\r\n--b  \r\nContent-Type: text/plain\r\n\r\ntwo\r\n\r\n--b--\r\nepilogue"
+
+	wrapped, err := parseWrapped([]byte("Content-Type: multipart/mixed; boundary=b\r\n\r\n" + body))
+	require.NoError(t, err)
+
+	parts, err := wrapped.parts()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("Content-Type: text/plain\r\n\r\none"), []byte("Content-Type: text/plain\r\n\r\ntwo\r\n")}, parts)
+
+	wrapped.body = []byte(strings.TrimSuffix(body, "--b--\r\nepilogue"))
+
+	_, err = wrapped.parts()
+	assert.ErrorIs(t, err, ErrInvalidMimeMessage)
+}
@@ -0,0 +1,285 @@
+package shared
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// ListUnsubscribeHeader carries the unsubscribe URL and mailto address of a message (RFC 2369)
+	ListUnsubscribeHeader = "List-Unsubscribe"
+	// ListUnsubscribePostHeader marks the unsubscribe URL of a message as one-click (RFC 8058)
+	ListUnsubscribePostHeader = "List-Unsubscribe-Post"
+	// listUnsubscribeOneClick is the value of List-Unsubscribe-Post and the body of a one-click request
+	listUnsubscribeOneClick = "List-Unsubscribe=One-Click"
+	// unsubscribeTokenParam is the query parameter of the unsubscribe URL holding the token
+	unsubscribeTokenParam = "token"
+	// minUnsubscribeSecretLength is the smallest HMAC secret accepted, matching the SHA-256 output size
+	minUnsubscribeSecretLength = 32
+	// maxUnsubscribeBodySize bounds the body read from a one-click request
+	maxUnsubscribeBodySize = 64 * 1024
+)
+
+// Unsubscriber generates per-recipient one-click unsubscribe links (RFC 8058) signed with HMAC-SHA256, and
+// verifies the tokens they carry when they are followed
+type Unsubscriber struct {
+	secret   []byte
+	endpoint *url.URL
+	mailto   string
+	ttl      time.Duration
+}
+
+// UnsubscribeOption configures an Unsubscriber
+type UnsubscribeOption func(*Unsubscriber)
+
+// WithUnsubscribeMailto adds a mailto address to List-Unsubscribe for mail clients that do not support
+// one-click, with the token as the subject so inbound mail can be checked with Verify
+func WithUnsubscribeMailto(address string) UnsubscribeOption {
+	return func(u *Unsubscriber) {
+		u.mailto = address
+	}
+}
+
+// WithUnsubscribeTTL expires tokens the duration after the message is built. Tokens do not expire by default,
+// since a recipient may unsubscribe from a message long after it was received
+func WithUnsubscribeTTL(ttl time.Duration) UnsubscribeOption {
+	return func(u *Unsubscriber) {
+		u.ttl = ttl
+	}
+}
+
+// NewUnsubscriber creates an Unsubscriber signing tokens with the secret, which must be at least 32 bytes, and
+// linking to the HTTPS endpoint served by its Handler
+func NewUnsubscriber(secret []byte, endpoint string, opts ...UnsubscribeOption) (*Unsubscriber, error) {
+	if len(secret) < minUnsubscribeSecretLength {
+		return nil, fmt.Errorf("%w: the secret must be at least %d bytes", ErrInvalidUnsubscriber, minUnsubscribeSecretLength)
+	}
+
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidUnsubscriber, err)
+	}
+
+	// RFC 8058 section 3.1 requires the one-click URL to be HTTPS
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: %q is not an absolute https URL", ErrInvalidUnsubscriber, endpoint)
+	}
+
+	u := &Unsubscriber{secret: append([]byte(nil), secret...), endpoint: parsed}
+
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	if u.mailto != "" {
+		address, err := ParseAddress(u.mailto)
+		if err != nil {
+			return nil, fmt.Errorf("%w: mailto %w", ErrInvalidUnsubscriber, err)
+		}
+
+		u.mailto = address.ToASCII().Address
+	}
+
+	if u.ttl < 0 {
+		return nil, fmt.Errorf("%w: negative token lifetime", ErrInvalidUnsubscriber)
+	}
+
+	return u, nil
+}
+
+// UnsubscribeRequest is the recipient and list an unsubscribe token was issued for
+type UnsubscribeRequest struct {
+	// Recipient is the address the message was sent to
+	Recipient string `json:"r"`
+	// List scopes the request to a mailing list or category, and is empty when the token was issued without one
+	List string `json:"l,omitempty"`
+	// ExpiresAt is when the token stops being accepted, and is zero when it does not expire
+	ExpiresAt int64 `json:"x,omitempty"`
+}
+
+// UnsubscribeCallback is called by the Handler with every verified unsubscribe request
+type UnsubscribeCallback func(ctx context.Context, request *UnsubscribeRequest) error
+
+// Token returns a token for the recipient and list, as the base64url encoded request and its HMAC joined by a dot.
+// The token is signed but not encrypted, so anyone holding the link can read the recipient address and list
+func (u *Unsubscriber) Token(recipient, list string) string {
+	request := &UnsubscribeRequest{Recipient: recipient, List: list}
+	if u.ttl > 0 {
+		request.ExpiresAt = time.Now().Add(u.ttl).Unix()
+	}
+
+	payload, _ := json.Marshal(request)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(u.sign(payload))
+}
+
+// URL returns the one-click unsubscribe URL for the recipient and list
+func (u *Unsubscriber) URL(recipient, list string) string {
+	return u.url(u.Token(recipient, list))
+}
+
+// Headers returns the List-Unsubscribe and List-Unsubscribe-Post headers for the recipient and list, with the
+// HTTPS URL ahead of the mailto address so clients prefer one-click
+func (u *Unsubscriber) Headers(recipient, list string) map[string]string {
+	token := u.Token(recipient, list)
+
+	value := "<" + u.url(token) + ">"
+	if u.mailto != "" {
+		value += ", <mailto:" + u.mailto + "?subject=" + token + ">"
+	}
+
+	return map[string]string{
+		ListUnsubscribeHeader:     value,
+		ListUnsubscribePostHeader: listUnsubscribeOneClick,
+	}
+}
+
+// Verify checks the HMAC and expiry of a token and returns the request it was issued for
+func (u *Unsubscriber) Verify(token string) (*UnsubscribeRequest, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidUnsubscribeToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidUnsubscribeToken, err)
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidUnsubscribeToken, err)
+	}
+
+	if !hmac.Equal(mac, u.sign(payload)) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidUnsubscribeToken)
+	}
+
+	request := &UnsubscribeRequest{}
+	if err := json.Unmarshal(payload, request); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidUnsubscribeToken, err)
+	}
+
+	if request.Recipient == "" {
+		return nil, fmt.Errorf("%w: missing recipient", ErrInvalidUnsubscribeToken)
+	}
+
+	if request.ExpiresAt != 0 && time.Now().Unix() > request.ExpiresAt {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidUnsubscribeToken)
+	}
+
+	return request, nil
+}
+
+// Handler returns an http.Handler serving the one-click unsubscribe endpoint. It accepts the POST of RFC 8058
+// with a List-Unsubscribe=One-Click body, verifies the token of the URL and calls the callback, answering
+// 200 once the callback succeeds. Other methods are refused, so link scanners following the URL with GET
+// cannot unsubscribe anyone; mount a page of your own for GET to let people unsubscribe from a browser
+func (u *Unsubscriber) Handler(callback UnsubscribeCallback) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxUnsubscribeBodySize)
+
+		if r.PostFormValue(ListUnsubscribeHeader) != "One-Click" {
+			http.Error(w, "missing "+listUnsubscribeOneClick, http.StatusBadRequest)
+			return
+		}
+
+		request, err := u.Verify(r.URL.Query().Get(unsubscribeTokenParam))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		if err := callback(r.Context(), request); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// url returns the endpoint with the token added to its query
+func (u *Unsubscriber) url(token string) string {
+	endpoint := *u.endpoint
+
+	query := endpoint.Query()
+	query.Set(unsubscribeTokenParam, token)
+	endpoint.RawQuery = query.Encode()
+
+	return endpoint.String()
+}
+
+// sign returns the HMAC-SHA256 of the payload
+func (u *Unsubscriber) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, u.secret)
+	mac.Write(payload)
+
+	return mac.Sum(nil)
+}
+
+// SetUnsubscribe adds one-click unsubscribe headers, generated for the recipient and the list when the message is
+// sent. Every copy carries the same link, so a message with more than one To, Cc or Bcc recipient fails
+// validation with ErrUnsubscribeRecipients; send one message per recipient, as a batch, instead. The headers
+// replace custom List-Unsubscribe headers, and the Unsubscriber is not part of the JSON wire format since it
+// holds the secret
+func (e *EmailMessage) SetUnsubscribe(unsubscriber *Unsubscriber, list string) *EmailMessage {
+	e.unsubscriber = unsubscriber
+	e.unsubscribeList = list
+
+	return e
+}
+
+// unsubscribeHeaders returns the unsubscribe headers of the message, or nil when it has no Unsubscriber or does not
+// have exactly one recipient, so a link is never shared with someone it would not unsubscribe. Validation reports
+// a message with more than one recipient
+func (e *EmailMessage) unsubscribeHeaders() map[string]string {
+	if e.unsubscriber == nil {
+		return nil
+	}
+
+	to := e.GetToAddresses()
+	if len(to) != 1 || len(e.GetCCAddresses())+len(e.GetBCCAddresses()) > 0 {
+		return nil
+	}
+
+	return e.unsubscriber.Headers(to[0].Address, e.unsubscribeList)
+}
+
+// customHeaders returns the custom headers of the message with its unsubscribe headers in place of any
+// custom header of the same name
+func (e *EmailMessage) customHeaders() map[string]string {
+	headers := make(map[string]string, len(e.Headers)+2)
+
+	unsubscribe := e.unsubscribeHeaders()
+
+	for key, value := range e.Headers {
+		if _, ok := unsubscribe[textproto.CanonicalMIMEHeaderKey(key)]; ok {
+			continue
+		}
+
+		headers[key] = value
+	}
+
+	for key, value := range unsubscribe {
+		headers[key] = value
+	}
+
+	return headers
+}
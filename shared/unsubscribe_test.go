@@ -0,0 +1,218 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unsubscribeSecret is a test HMAC secret of the minimum length
+var unsubscribeSecret = []byte("when you control the mail you control information")
+
+// newTestUnsubscriber creates an Unsubscriber with a mailto address and the options
+func newTestUnsubscriber(t *testing.T, opts ...UnsubscribeOption) *Unsubscriber {
+	t.Helper()
+
+	u, err := NewUnsubscriber(unsubscribeSecret, "https://usps.com/unsubscribe?source=newsletter", append([]UnsubscribeOption{WithUnsubscribeMailto("unsubscribe@usps.com")}, opts...)...)
+	require.NoError(t, err)
+
+	return u
+}
+
+// unsubscribeToken returns the token of an unsubscribe URL
+func unsubscribeToken(t *testing.T, link string) string {
+	t.Helper()
+
+	parsed, err := url.Parse(link)
+	require.NoError(t, err)
+	assert.Equal(t, "newsletter", parsed.Query().Get("source"))
+
+	return parsed.Query().Get(unsubscribeTokenParam)
+}
+
+func TestUnsubscriberToken(t *testing.T) {
+	u := newTestUnsubscriber(t)
+
+	request, err := u.Verify(unsubscribeToken(t, u.URL("jerry@seinfeld.com", "newsletter")))
+	require.NoError(t, err)
+	assert.Equal(t, &UnsubscribeRequest{Recipient: "jerry@seinfeld.com", List: "newsletter"}, request)
+
+	// a token signed with another secret does not verify
+	other, err := NewUnsubscriber(bytes.Repeat([]byte("k"), 32), "https://usps.com/unsubscribe")
+	require.NoError(t, err)
+
+	_, err = u.Verify(other.Token("jerry@seinfeld.com", ""))
+	assert.ErrorIs(t, err, ErrInvalidUnsubscribeToken)
+
+	// the recipient cannot be changed without the secret
+	payload, mac, _ := strings.Cut(u.Token("jerry@seinfeld.com", ""), ".")
+	forged, _, _ := strings.Cut(u.Token("kramer@seinfeld.com", ""), ".")
+
+	_, err = u.Verify(forged + "." + mac)
+	assert.ErrorIs(t, err, ErrInvalidUnsubscribeToken)
+
+	for _, token := range []string{"", "token", payload, payload + ".!!", "!!." + mac} {
+		_, err = u.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidUnsubscribeToken, token)
+	}
+}
+
+func TestUnsubscriberTTL(t *testing.T) {
+	u := newTestUnsubscriber(t, WithUnsubscribeTTL(time.Hour))
+
+	request, err := u.Verify(u.Token("jerry@seinfeld.com", ""))
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), request.ExpiresAt, 5)
+
+	payload, err := json.Marshal(&UnsubscribeRequest{Recipient: "jerry@seinfeld.com", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	require.NoError(t, err)
+
+	expired := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(u.sign(payload))
+
+	_, err = u.Verify(expired)
+	assert.ErrorIs(t, err, ErrInvalidUnsubscribeToken)
+}
+
+func TestNewUnsubscriberInvalid(t *testing.T) {
+	for name, tc := range map[string]struct {
+		secret   []byte
+		endpoint string
+		opts     []UnsubscribeOption
+	}{
+		"short secret":   {secret: []byte("bania"), endpoint: "https://usps.com/unsubscribe"},
+		"http endpoint":  {secret: unsubscribeSecret, endpoint: "http://usps.com/unsubscribe"},
+		"relative URL":   {secret: unsubscribeSecret, endpoint: "/unsubscribe"},
+		"invalid mailto": {secret: unsubscribeSecret, endpoint: "https://usps.com/unsubscribe", opts: []UnsubscribeOption{WithUnsubscribeMailto("newman")}},
+		"negative TTL":   {secret: unsubscribeSecret, endpoint: "https://usps.com/unsubscribe", opts: []UnsubscribeOption{WithUnsubscribeTTL(-time.Hour)}},
+	} {
+		_, err := NewUnsubscriber(tc.secret, tc.endpoint, tc.opts...)
+		assert.ErrorIs(t, err, ErrInvalidUnsubscriber, name)
+	}
+}
+
+func TestUnsubscribeHeaders(t *testing.T) {
+	u := newTestUnsubscriber(t)
+
+	message := NewEmailMessage("newman@usps.com", []string{"Jerry Seinfeld <jerry@seinfeld.com>", "elaine"}, "Mail route review", "Hello, Jerry").
+		SetUnsubscribe(u, "newsletter")
+	message.Headers["list-unsubscribe"] = "<https://example.com>"
+	message.Headers["X-Route"] = "42"
+
+	require.NoError(t, ValidateEmailMessage(message))
+
+	headers := message.GetHeaders()
+	assert.Equal(t, "42", headers["X-Route"])
+	assert.Equal(t, "List-Unsubscribe=One-Click", headers[ListUnsubscribePostHeader])
+	assert.NotContains(t, headers, "list-unsubscribe")
+
+	// the URL comes first, followed by the mailto address carrying the same token
+	links := strings.Split(headers[ListUnsubscribeHeader], ", ")
+	require.Len(t, links, 2)
+
+	token := unsubscribeToken(t, strings.Trim(links[0], "<>"))
+	assert.Equal(t, "<mailto:unsubscribe@usps.com?subject="+token+">", links[1])
+
+	request, err := u.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "jerry@seinfeld.com", request.Recipient)
+
+	raw, err := BuildMimeMessage(message)
+	require.NoError(t, err)
+
+	parsed, err := ParseMimeMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.Equal(t, headers[ListUnsubscribeHeader], parsed.Headers[ListUnsubscribeHeader])
+	assert.Equal(t, "List-Unsubscribe=One-Click", parsed.Headers[ListUnsubscribePostHeader])
+	assert.Equal(t, 1, strings.Count(strings.ToLower(string(raw)), "list-unsubscribe:"))
+
+	// the headers are covered by the DKIM signature
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	dkimSigner, err := NewDKIMSigner("usps.com", "route", key)
+	require.NoError(t, err)
+
+	signed, err := BuildMimeMessage(message, WithDKIMSigner(dkimSigner))
+	require.NoError(t, err)
+	assert.Contains(t, string(signed), "list-unsubscribe:list-unsubscribe-post")
+
+	assert.Empty(t, NewEmailMessage("newman@usps.com", nil, "Mail route review", "Hello").SetUnsubscribe(u, "").GetHeaders())
+}
+
+func TestUnsubscribeHeadersMultipleRecipients(t *testing.T) {
+	u := newTestUnsubscriber(t)
+
+	// every copy carries the same headers, so a link naming one recipient is not sent to the others
+	for name, message := range map[string]*EmailMessage{
+		"to":  NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com", "elaine@seinfeld.com"}, "Mail route review", "Hello"),
+		"cc":  NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello").SetCC([]string{"elaine@seinfeld.com"}),
+		"bcc": NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello").SetBCC([]string{"kramer@seinfeld.com"}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			message.SetUnsubscribe(u, "newsletter")
+			message.Headers["X-Route"] = "42"
+
+			headers := message.GetHeaders()
+			assert.Equal(t, map[string]string{"X-Route": "42"}, headers)
+
+			// the send fails rather than going out without the headers
+			err := ValidateEmailMessage(message)
+			require.ErrorIs(t, err, ErrUnsubscribeRecipients)
+			assert.ErrorContains(t, err, "2 recipients")
+
+			raw, err := BuildMimeMessage(message)
+			require.NoError(t, err)
+			assert.NotContains(t, strings.ToLower(string(raw)), "list-unsubscribe")
+		})
+	}
+}
+
+func TestUnsubscribeHandler(t *testing.T) {
+	u := newTestUnsubscriber(t)
+
+	var requests []*UnsubscribeRequest
+
+	handler := u.Handler(func(_ context.Context, request *UnsubscribeRequest) error {
+		if request.Recipient == "kramer@seinfeld.com" {
+			return errors.New("giddy up")
+		}
+
+		requests = append(requests, request)
+
+		return nil
+	})
+
+	serve := func(method, target, body string) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	link := u.URL("jerry@seinfeld.com", "newsletter")
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, link, "List-Unsubscribe=One-Click"))
+	assert.Equal(t, []*UnsubscribeRequest{{Recipient: "jerry@seinfeld.com", List: "newsletter"}}, requests)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodGet, link, ""))
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, link, ""))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "https://usps.com/unsubscribe?token=forged", "List-Unsubscribe=One-Click"))
+	assert.Equal(t, http.StatusInternalServerError, serve(http.MethodPost, u.URL("kramer@seinfeld.com", ""), "List-Unsubscribe=One-Click"))
+	assert.Len(t, requests, 1)
+}
@@ -1,36 +1,160 @@
 package shared
 
 import (
-	"regexp"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// maximum lengths of an email address and its parts, from RFC 5321 section 4.5.3.1
+const (
+	maxAddressLength   = 254
+	maxLocalPartLength = 64
+	maxDomainLength    = 255
+	maxLabelLength     = 63
+)
+
+// idnaProfile converts internationalized domain names to punycode. Underscores are allowed, as
+// found in the host names of real world mail domains
+var idnaProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.BidiRule())
+
+// ValidationMode controls which problems ValidateEmailMessage reports
+type ValidationMode string
+
+const (
+	// ValidationLenient reports the problems that stop a message from being sent, leaving invalid Cc, Bcc
+	// and additional To addresses out of the send. It is the default
+	ValidationLenient ValidationMode = "lenient"
+	// ValidationStrict also reports every invalid address, an empty subject and a message without a body
+	ValidationStrict ValidationMode = "strict"
 )
 
-// regex for validating email addresses
-var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9._\-]+\.[a-zA-Z]{2,}$`)
+// ValidationOption configures the limits ValidateEmailMessage checks a message against
+type ValidationOption func(*validationOptions)
+
+// validationOptions holds the settings applied by ValidationOptions
+type validationOptions struct {
+	maxRecipients int
+}
+
+// WithMaxRecipients sets the maximum number of To, Cc and Bcc recipients, for providers that limit it
+func WithMaxRecipients(limit int) ValidationOption {
+	return func(o *validationOptions) {
+		o.maxRecipients = limit
+	}
+}
+
+// ValidateEmailMessage checks the message according to its validation mode and returns a ValidationError
+// listing every problem found. A missing sender or To recipient is reported as a MissingRequiredFieldError,
+// which can be matched with errors.As like the reason of any other issue
+func ValidateEmailMessage(msg *EmailMessage, opts ...ValidationOption) error {
+	options := &validationOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	strict := msg.GetValidationMode() == ValidationStrict
+	validationErr := &ValidationError{}
+
+	// an invalid sender is reported once, as invalid rather than missing
+	switch {
+	case strings.TrimSpace(msg.From) == "":
+		validationErr.add("from", "", newMissingRequiredFieldError("from"))
+	case ValidateEmailAddress(msg.From) == "":
+		validationErr.add("from", msg.From, ErrInvalidAddress)
+	}
+
+	if strict && strings.TrimSpace(msg.ReplyTo) != "" && ValidateEmailAddress(msg.ReplyTo) == "" {
+		validationErr.add("reply_to", msg.ReplyTo, ErrInvalidAddress)
+	}
+
+	recipients := 0
+
+	for _, field := range []struct {
+		name      string
+		addresses []string
+	}{{"to", msg.To}, {"cc", msg.Cc}, {"bcc", msg.Bcc}} {
+		valid := len(ValidateEmailAddresses(field.addresses))
+		recipients += valid
+
+		// without a valid To recipient the rejected addresses explain why, so they are reported in either mode
+		if strict || (field.name == "to" && valid == 0) {
+			for _, address := range field.addresses {
+				if strings.TrimSpace(address) != "" && ValidateEmailAddress(address) == "" {
+					validationErr.add(field.name, address, ErrInvalidAddress)
+				}
+			}
+		}
+
+		if field.name == "to" && valid == 0 {
+			validationErr.add("to", "", newMissingRequiredFieldError("to"))
+		}
+	}
+
+	// every copy carries the same unsubscribe link, so it must name the only recipient
+	if msg.unsubscriber != nil && recipients > 1 {
+		validationErr.add("unsubscribe", "", fmt.Errorf("%w: %d recipients", ErrUnsubscribeRecipients, recipients))
+	}
+
+	if options.maxRecipients > 0 && recipients > options.maxRecipients {
+		validationErr.add("recipients", "", fmt.Errorf("%w: %d recipients, at most %d allowed", ErrTooManyRecipients, recipients, options.maxRecipients))
+	}
+
+	if strict && strings.TrimSpace(msg.Subject) == "" {
+		validationErr.add("subject", "", ErrEmptySubject)
+	}
 
-// ValidateEmailMessage checks that the required fields of an EmailMessage are present and valid
-func ValidateEmailMessage(msg *EmailMessage) error {
-	from := ValidateEmailAddress(msg.From)
-	if from == "" {
-		return newMissingRequiredFieldError("from")
+	if strict && msg.Text == "" && msg.HTML == "" && msg.Calendar == nil {
+		validationErr.add("body", "", ErrMissingBody)
 	}
 
-	to := ValidateEmailAddresses(msg.To)
-	if len(to) == 0 {
-		return newMissingRequiredFieldError("to")
+	headers := msg.GetHeaders()
+
+	for _, key := range slices.Sorted(maps.Keys(headers)) {
+		if err := checkHeaderField(key, headers[key]); err != nil {
+			validationErr.add("headers", "", err)
+		}
+	}
+
+	// under the other policies oversized attachments are dropped or compressed when the message is sent
+	if msg.GetAttachmentPolicy() == AttachmentPolicyReject && msg.maxAttachmentSize >= 0 {
+		limit := msg.attachmentLimit()
+
+		for _, attachment := range msg.Attachments {
+			if size := attachment.Size(); size > limit {
+				validationErr.add("attachments", "", &AttachmentTooLargeError{Filename: attachment.GetFilename(), Size: size, Limit: limit})
+			}
+		}
 	}
 
-	return nil
+	if msg.Calendar != nil {
+		if err := msg.Calendar.Validate(); err != nil {
+			validationErr.add("calendar", "", err)
+		}
+	}
+
+	if len(validationErr.Issues) == 0 {
+		return nil
+	}
+
+	return validationErr
 }
 
-// ValidateEmailAddress trims the email and checks if it is a valid email address
+// ValidateEmailAddress trims the email and checks if it is a valid email address. A mailbox with a display
+// name, such as "Jane Doe <jane@example.com>", is valid and its bare email address is returned
 func ValidateEmailAddress(email string) string {
-	trimmed := strings.TrimSpace(email)
-	if !emailRegex.MatchString(trimmed) {
+	address, err := ParseAddress(email)
+	if err != nil {
 		return ""
 	}
 
-	return trimmed
+	return address.Address
 }
 
 // ValidateEmailAddresses trims and validates each email in the slice
@@ -45,3 +169,149 @@ func ValidateEmailAddresses(emails []string) []string {
 
 	return validEmails
 }
+
+// validAddress reports whether address is a valid RFC 5321 mailbox, allowing the UTF-8 local parts of
+// RFC 6531 and internationalized domain names. The domain must have at least two labels
+func validAddress(address string) bool {
+	at := strings.LastIndexByte(address, '@')
+	if at <= 0 || len(address) > maxAddressLength || !utf8.ValidString(address) {
+		return false
+	}
+
+	return validLocalPart(address[:at]) && validDomain(address[at+1:])
+}
+
+// validLocalPart reports whether local is a dot-atom or a quoted string
+func validLocalPart(local string) bool {
+	if len(local) > maxLocalPartLength {
+		return false
+	}
+
+	if len(local) >= 2 && local[0] == '"' && local[len(local)-1] == '"' {
+		return validQuotedString(local[1 : len(local)-1])
+	}
+
+	for atom := range strings.SplitSeq(local, ".") {
+		if atom == "" || strings.IndexFunc(atom, func(r rune) bool { return !isAtext(r) }) >= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isAtext reports whether r may appear in an atom: the atext of RFC 5322 or a printable UTF-8 character
+func isAtext(r rune) bool {
+	switch {
+	case r >= utf8.RuneSelf:
+		return unicode.IsPrint(r)
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return true
+	default:
+		return strings.ContainsRune("!#$%&'*+-/=?^_`{|}~", r)
+	}
+}
+
+// validQuotedString reports whether the content of a quoted string only has printable characters,
+// with quotes and backslashes escaped
+func validQuotedString(content string) bool {
+	escaped := false
+
+	for _, r := range content {
+		switch {
+		case r < ' ' || r == 0x7f:
+			return false
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			return false
+		}
+	}
+
+	return !escaped
+}
+
+// validDomain reports whether domain is an address literal or a host name, converting internationalized
+// domain names to punycode before checking their labels
+func validDomain(domain string) bool {
+	if strings.HasPrefix(domain, "[") && strings.HasSuffix(domain, "]") {
+		return validAddressLiteral(domain[1 : len(domain)-1])
+	}
+
+	ascii, err := idnaProfile.ToASCII(domain)
+	if err != nil || len(ascii) > maxDomainLength {
+		return false
+	}
+
+	labels := strings.Split(ascii, ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	for _, label := range labels {
+		if !validLabel(label) {
+			return false
+		}
+	}
+
+	// the top level domain is never numeric, so a dotted IP address is not mistaken for a host name
+	tld := labels[len(labels)-1]
+
+	return len(tld) >= 2 && strings.IndexFunc(tld, func(r rune) bool { return r < '0' || r > '9' }) >= 0
+}
+
+// validLabel reports whether label is an ASCII host name label of letters, digits, hyphens and underscores
+// that does not start or end with a hyphen
+func validLabel(label string) bool {
+	if label == "" || len(label) > maxLabelLength || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+
+	for _, r := range label {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validAddressLiteral reports whether literal is an IPv4 address or an IPv6 address prefixed with IPv6:
+func validAddressLiteral(literal string) bool {
+	if v6, ok := strings.CutPrefix(literal, "IPv6:"); ok {
+		addr, err := netip.ParseAddr(v6)
+		return err == nil && addr.Is6() && addr.Zone() == ""
+	}
+
+	addr, err := netip.ParseAddr(literal)
+
+	return err == nil && addr.Is4()
+}
+
+// domainToASCII converts an internationalized domain name to punycode, returning ASCII domains and
+// address literals unchanged
+func domainToASCII(domain string) string {
+	if isASCII(domain) {
+		return domain
+	}
+
+	ascii, err := idnaProfile.ToASCII(domain)
+	if err != nil {
+		return domain
+	}
+
+	return ascii
+}
+
+// isASCII reports whether s only has ASCII characters
+func isASCII(s string) bool {
+	for i := range len(s) {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
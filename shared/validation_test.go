@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/theopenlane/newman/shared"
 )
@@ -29,8 +30,8 @@ func TestValidateValidateEmailMessage(t *testing.T) {
 			msg: &shared.EmailMessage{
 				To: []string{"funky@funk.com"},
 			},
-			err: &shared.MissingRequiredFieldError{
-				RequiredField: "from",
+			err: &shared.ValidationError{
+				Issues: []*shared.ValidationIssue{{Field: "from", Err: &shared.MissingRequiredFieldError{RequiredField: "from"}}},
 			},
 		},
 		{
@@ -38,8 +39,8 @@ func TestValidateValidateEmailMessage(t *testing.T) {
 			msg: &shared.EmailMessage{
 				From: "mitb@example.com",
 			},
-			err: &shared.MissingRequiredFieldError{
-				RequiredField: "to",
+			err: &shared.ValidationError{
+				Issues: []*shared.ValidationIssue{{Field: "to", Err: &shared.MissingRequiredFieldError{RequiredField: "to"}}},
 			},
 		},
 	}
@@ -72,6 +73,25 @@ func TestValidateEmailAddress(t *testing.T) {
 		{"test+alias@mitbindustries.com", "test+alias@mitbindustries.com"},
 		{"test.email@mitbindustries.com", "test.email@mitbindustries.com"},
 		{"test-email@mitbindustries.com", "test-email@mitbindustries.com"},
+		{"Newman <newman@usps.com>", "newman@usps.com"},
+		{`"Postmaster, USPS" <newman@usps.com>`, "newman@usps.com"},
+		{"Newman <newman@com>", ""},
+		{"用户@例子.广告", "用户@例子.广告"},
+		{"Zoë <zoë@café.fr>", "zoë@café.fr"},
+		{"newman@почта.xn--p1ai", "newman@почта.xn--p1ai"},
+		{"newman@xn--80a1acny.xn--p1ai", "newman@xn--80a1acny.xn--p1ai"},
+		{`"kramer the hipster"@seinfeld.com`, `"kramer the hipster"@seinfeld.com`},
+		{"newman@[192.0.2.1]", "newman@[192.0.2.1]"},
+		{"newman@[IPv6:2001:db8::1]", "newman@[IPv6:2001:db8::1]"},
+		{"newman@[2001:db8::1]", ""},
+		{"newman@192.0.2.1", ""},
+		{"new..man@usps.com", ""},
+		{".newman@usps.com", ""},
+		{"new man@usps.com", ""},
+		{"newman@-usps.com", ""},
+		{"newman@usps.c", ""},
+		{strings.Repeat("n", 65) + "@usps.com", ""},
+		{"newman@" + strings.Repeat("u", 64) + ".com", ""},
 	}
 
 	for _, test := range tests {
@@ -82,6 +102,76 @@ func TestValidateEmailAddress(t *testing.T) {
 	}
 }
 
+func TestValidateEmailMessageLenient(t *testing.T) {
+	msg := shared.NewEmailMessage("Newman", []string{"kramer", "jerry"}, "", "").
+		SetCC([]string{"elaine"}).
+		AddAttachment(shared.NewAttachment("route.csv", make([]byte, 2048))).
+		SetMaxAttachmentSize(1024)
+	msg.Headers["X-Route"] = "42\r\nBcc: kramer@seinfeld.com"
+
+	err := shared.ValidateEmailMessage(msg, shared.WithMaxRecipients(1))
+
+	var validationErr *shared.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+
+	// every problem is reported at once, but an invalid Cc alone does not stop the send
+	fields := make([]string, 0, len(validationErr.Issues))
+	for _, issue := range validationErr.Issues {
+		fields = append(fields, issue.Field)
+	}
+
+	assert.Equal(t, []string{"from", "to", "to", "to", "headers", "attachments"}, fields)
+	assert.Equal(t, &shared.ValidationIssue{Field: "from", Value: "Newman", Err: shared.ErrInvalidAddress}, validationErr.Issues[0])
+	assert.Equal(t, &shared.ValidationIssue{Field: "to", Value: "kramer", Err: shared.ErrInvalidAddress}, validationErr.Issues[1])
+	assert.ErrorIs(t, err, shared.ErrInvalidHeader)
+	assert.ErrorIs(t, err, shared.ErrAttachmentTooLarge)
+	assert.ErrorContains(t, err, `invalid email message: from "Newman": invalid email address; to "kramer": invalid email address`)
+
+	var missing *shared.MissingRequiredFieldError
+	require.ErrorAs(t, err, &missing)
+	assert.Equal(t, "to", missing.RequiredField)
+
+	// oversized attachments are left to the drop and compress policies
+	msg = shared.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com", "george"}, "", "").
+		SetCC([]string{"elaine"}).
+		AddAttachment(shared.NewAttachment("route.csv", make([]byte, 2048))).
+		SetMaxAttachmentSize(1024).
+		SetAttachmentPolicy(shared.AttachmentPolicyDrop)
+
+	require.NoError(t, shared.ValidateEmailMessage(msg))
+	require.NoError(t, shared.ValidateEmailMessage(msg, shared.WithMaxRecipients(1)))
+
+	msg.AddToRecipient("elaine@seinfeld.com")
+	assert.ErrorIs(t, shared.ValidateEmailMessage(msg, shared.WithMaxRecipients(1)), shared.ErrTooManyRecipients)
+}
+
+func TestValidateEmailMessageStrict(t *testing.T) {
+	msg := shared.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com", "george"}, " ", "").
+		SetCC([]string{"elaine"}).
+		SetBCC([]string{"kramer@seinfeld.com", "newman"}).
+		SetReplyTo("postmaster").
+		SetValidationMode(shared.ValidationStrict)
+
+	err := shared.ValidateEmailMessage(msg)
+
+	var validationErr *shared.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+
+	assert.Equal(t, []*shared.ValidationIssue{
+		{Field: "reply_to", Value: "postmaster", Err: shared.ErrInvalidAddress},
+		{Field: "to", Value: "george", Err: shared.ErrInvalidAddress},
+		{Field: "cc", Value: "elaine", Err: shared.ErrInvalidAddress},
+		{Field: "bcc", Value: "newman", Err: shared.ErrInvalidAddress},
+		{Field: "subject", Err: shared.ErrEmptySubject},
+		{Field: "body", Err: shared.ErrMissingBody},
+	}, validationErr.Issues)
+
+	msg = shared.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Hello", "Hello, Jerry").
+		SetValidationMode(shared.ValidationStrict)
+
+	require.NoError(t, shared.ValidateEmailMessage(msg))
+}
+
 func TestValidateEmailAddresses(t *testing.T) {
 	tests := []struct {
 		emails   []string
@@ -91,6 +181,7 @@ func TestValidateEmailAddresses(t *testing.T) {
 		{[]string{"newman@usps.com", "invalid-email"}, []string{"newman@usps.com"}},
 		{[]string{" newman@usps.com ", "test2@mitbindustries.com"}, []string{"newman@usps.com", "test2@mitbindustries.com"}},
 		{[]string{"invalid-email", "@mitbindustries.com"}, []string{}},
+		{[]string{"Newman <newman@usps.com>", "Jerry Seinfeld <jerry@seinfeld.com>"}, []string{"newman@usps.com", "jerry@seinfeld.com"}},
 		{[]string{"newman@usps.com", "test2@sub.mitbindustries.com"}, []string{"newman@usps.com", "test2@sub.mitbindustries.com"}},
 	}
 
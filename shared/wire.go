@@ -0,0 +1,270 @@
+package shared
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// WireFormatVersion is the version of the JSON wire format written by EmailMessage.MarshalJSON
+const WireFormatVersion = 2
+
+// emailMessageSchema is the JSON Schema of the current wire format
+//
+//go:embed email_message.schema.json
+var emailMessageSchema []byte
+
+// EmailMessageJSONSchema returns the JSON Schema (draft 2020-12) of the wire format, for services that
+// enqueue messages without using this package
+func EmailMessageJSONSchema() []byte {
+	return append([]byte(nil), emailMessageSchema...)
+}
+
+// jsonEmailMessage represents the JSON structure for an email message
+type jsonEmailMessage struct {
+	Version           int               `json:"version"`
+	From              string            `json:"from"`
+	To                []string          `json:"to"`
+	CC                []string          `json:"cc,omitempty"`
+	BCC               []string          `json:"bcc,omitempty"`
+	ReplyTo           string            `json:"reply_to,omitempty"`
+	Subject           string            `json:"subject"`
+	Text              string            `json:"text,omitempty"`
+	HTML              string            `json:"html,omitempty"`
+	Tags              []Tag             `json:"tags,omitempty"`
+	Headers           map[string]string `json:"headers,omitempty"`
+	Attachments       []*Attachment     `json:"attachments,omitempty"`
+	MessageID         string            `json:"message_id,omitempty"`
+	InReplyTo         string            `json:"in_reply_to,omitempty"`
+	References        []string          `json:"references,omitempty"`
+	Substitutions     map[string]string `json:"substitutions,omitempty"`
+	Calendar          *CalendarEvent    `json:"calendar,omitempty"`
+	MaxAttachmentSize *int              `json:"max_attachment_size,omitempty"`
+	AttachmentPolicy  AttachmentPolicy  `json:"attachment_policy,omitempty"`
+	ValidationMode    ValidationMode    `json:"validation_mode,omitempty"`
+}
+
+// legacyEmailMessage represents the unversioned JSON structure written before the wire format was versioned
+type legacyEmailMessage struct {
+	From        string        `json:"from"`
+	To          []string      `json:"to"`
+	CC          []string      `json:"cc,omitempty"`
+	BCC         []string      `json:"bcc,omitempty"`
+	ReplyTo     string        `json:"replyTo,omitempty"`
+	Subject     string        `json:"subject"`
+	Text        string        `json:"text"`
+	HTML        string        `json:"html,omitempty"`
+	Attachments []*Attachment `json:"attachments,omitempty"`
+}
+
+// MarshalJSON is a custom marshaler for EmailMessage, writing the current version of the wire format.
+// The attachment drop hook and the Unsubscriber are the only state that is not written
+func (e *EmailMessage) MarshalJSON() ([]byte, error) {
+	maxAttachmentSize := e.maxAttachmentSize
+
+	// the schema requires to as an array, so a message sent only to Cc or Bcc writes an empty one
+	to := e.To
+	if to == nil {
+		to = []string{}
+	}
+
+	return json.Marshal(&jsonEmailMessage{
+		Version:           WireFormatVersion,
+		From:              e.From,
+		To:                to,
+		CC:                e.Cc,
+		BCC:               e.Bcc,
+		ReplyTo:           e.ReplyTo,
+		Subject:           e.Subject,
+		Text:              e.Text,
+		HTML:              e.HTML,
+		Tags:              e.Tags,
+		Headers:           e.Headers,
+		Attachments:       e.Attachments,
+		MessageID:         e.MessageID,
+		InReplyTo:         e.InReplyTo,
+		References:        e.References,
+		Substitutions:     e.Substitutions,
+		Calendar:          e.Calendar,
+		MaxAttachmentSize: &maxAttachmentSize,
+		AttachmentPolicy:  e.attachmentPolicy,
+		ValidationMode:    e.validationMode,
+	})
+}
+
+// UnmarshalJSON is a custom unmarshaler for EmailMessage, reading the current wire format as well as
+// the unversioned format written by earlier releases
+func (e *EmailMessage) UnmarshalJSON(data []byte) error {
+	var header struct {
+		Version int `json:"version"`
+	}
+
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+
+	switch header.Version {
+	case 0, 1:
+		return e.unmarshalLegacyJSON(data)
+	case WireFormatVersion:
+	default:
+		return fmt.Errorf("%w: version %d", ErrUnsupportedWireFormat, header.Version)
+	}
+
+	aux := &jsonEmailMessage{}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+
+	*e = EmailMessage{
+		From:              aux.From,
+		To:                aux.To,
+		Cc:                aux.CC,
+		Bcc:               aux.BCC,
+		ReplyTo:           aux.ReplyTo,
+		Subject:           aux.Subject,
+		Text:              aux.Text,
+		HTML:              aux.HTML,
+		Tags:              aux.Tags,
+		Headers:           aux.Headers,
+		Attachments:       aux.Attachments,
+		MessageID:         aux.MessageID,
+		InReplyTo:         aux.InReplyTo,
+		References:        aux.References,
+		Substitutions:     aux.Substitutions,
+		Calendar:          aux.Calendar,
+		maxAttachmentSize: DefaultMaxAttachmentSize,
+		attachmentPolicy:  aux.AttachmentPolicy,
+		validationMode:    aux.ValidationMode,
+	}
+
+	if aux.MaxAttachmentSize != nil {
+		e.maxAttachmentSize = *aux.MaxAttachmentSize
+	}
+
+	if e.Headers == nil {
+		e.Headers = map[string]string{}
+	}
+
+	return nil
+}
+
+// unmarshalLegacyJSON reads the unversioned format written by earlier releases
+func (e *EmailMessage) unmarshalLegacyJSON(data []byte) error {
+	aux := &legacyEmailMessage{}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+
+	*e = EmailMessage{
+		From:              aux.From,
+		To:                aux.To,
+		Cc:                aux.CC,
+		Bcc:               aux.BCC,
+		ReplyTo:           aux.ReplyTo,
+		Subject:           aux.Subject,
+		Text:              aux.Text,
+		HTML:              aux.HTML,
+		Attachments:       aux.Attachments,
+		Headers:           map[string]string{},
+		maxAttachmentSize: DefaultMaxAttachmentSize,
+	}
+
+	return nil
+}
+
+// jsonAttachment represents the JSON structure for an email attachment
+type jsonAttachment struct {
+	Filename    string `json:"filename"`
+	Content     string `json:"content"`
+	ContentType string `json:"content_type,omitempty"`
+	FilePath    string `json:"file_path,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+	Inline      bool   `json:"inline,omitempty"`
+}
+
+// MarshalJSON custom marshaler for Attachment. Attachments backed by a reader or file are loaded into
+// Content first, so a one-shot reader can still be sent after the attachment is written
+func (a *Attachment) MarshalJSON() ([]byte, error) {
+	if err := a.Load(); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&jsonAttachment{
+		Filename:    a.Filename,
+		Content:     base64.StdEncoding.EncodeToString(a.GetRawContent()),
+		ContentType: a.ContentType,
+		FilePath:    a.FilePath,
+		ContentID:   a.ContentID,
+		Inline:      a.Inline,
+	})
+}
+
+// UnmarshalJSON custom unmarshaler for Attachment
+func (a *Attachment) UnmarshalJSON(data []byte) error {
+	aux := &jsonAttachment{}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+
+	a.Filename = aux.Filename
+	a.ContentType = aux.ContentType
+	a.FilePath = aux.FilePath
+	a.ContentID = aux.ContentID
+	a.Inline = aux.Inline
+
+	content, err := base64.StdEncoding.DecodeString(aux.Content)
+	if err != nil {
+		return err
+	}
+
+	a.Content = content
+
+	return nil
+}
+
+// calendarEventFields has the fields of CalendarEvent without its JSON methods
+type calendarEventFields CalendarEvent
+
+// jsonCalendarEvent represents the JSON structure for a calendar event, naming the time zone the
+// event is written in so it survives the round trip
+type jsonCalendarEvent struct {
+	*calendarEventFields
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// MarshalJSON custom marshaler for CalendarEvent
+func (c *CalendarEvent) MarshalJSON() ([]byte, error) {
+	aux := &jsonCalendarEvent{calendarEventFields: (*calendarEventFields)(c)}
+
+	if loc := c.location(); loc != time.UTC {
+		aux.TimeZone = loc.String()
+	}
+
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON custom unmarshaler for CalendarEvent. Times are moved into the named time zone,
+// which must be known to the time package
+func (c *CalendarEvent) UnmarshalJSON(data []byte) error {
+	aux := &jsonCalendarEvent{calendarEventFields: (*calendarEventFields)(c)}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+
+	if aux.TimeZone == "" {
+		return nil
+	}
+
+	loc, err := time.LoadLocation(aux.TimeZone)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidCalendarEvent, err)
+	}
+
+	c.Start = c.Start.In(loc)
+	c.End = c.End.In(loc)
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package shared
+
+import (
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWireTestMessage(t *testing.T) *EmailMessage {
+	t.Helper()
+
+	message := NewFullEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review",
+		[]string{"kramer@seinfeld.com"}, []string{"elaine@seinfeld.com"}, "postmaster@usps.com",
+		"Hello, Jerry", `<p>Hello, Jerry</p><img src="cid:logo@usps.com">`,
+		[]*Attachment{
+			NewInlineAttachment("logo.png", "logo@usps.com", []byte("png")),
+			{Filename: "route.csv", Content: []byte("42,Kramer"), ContentType: "text/csv; charset=UTF-8"},
+			{Filename: "manual.pdf", Content: []byte{}, FilePath: "https://usps.com/manual.pdf"},
+		}).
+		SetMessageID("<route-42@usps.com>").
+		SetInReplyTo("<route-41@usps.com>").
+		SetReferences([]string{"<route-40@usps.com>", "<route-41@usps.com>"}).
+		SetCalendar(newTestCalendarEvent(t)).
+		SetMaxAttachmentSize(-1).
+		SetAttachmentPolicy(AttachmentPolicyCompress).
+		SetValidationMode(ValidationStrict)
+
+	message.Tags = []Tag{{Name: "category", Value: "route"}}
+	message.Headers["X-Route"] = "42"
+	message.Substitutions = map[string]string{"-name-": "Jerry"}
+
+	return message
+}
+
+func TestEmailMessageJSONRoundTrip(t *testing.T) {
+	message := newWireTestMessage(t)
+
+	data, err := json.Marshal(message)
+	require.NoError(t, err)
+
+	var decoded EmailMessage
+
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	// the calendar times come back in the same zone, but as a different *time.Location
+	require.NotNil(t, decoded.Calendar)
+	assert.Equal(t, message.Calendar.Bytes(), decoded.Calendar.Bytes())
+	assert.True(t, message.Calendar.Start.Equal(decoded.Calendar.Start))
+	assert.Equal(t, "America/New_York", decoded.Calendar.Start.Location().String())
+
+	message.Calendar, decoded.Calendar = nil, nil
+
+	assert.Equal(t, message, &decoded)
+	assert.Equal(t, -1, decoded.maxAttachmentSize)
+	assert.Equal(t, AttachmentPolicyCompress, decoded.GetAttachmentPolicy())
+}
+
+func TestEmailMessageJSONDefaults(t *testing.T) {
+	var decoded EmailMessage
+
+	require.NoError(t, json.Unmarshal([]byte(`{"version":2,"from":"newman@usps.com","to":["jerry@seinfeld.com"],"subject":"Hello"}`), &decoded))
+
+	assert.Equal(t, DefaultMaxAttachmentSize, decoded.maxAttachmentSize)
+	assert.Equal(t, AttachmentPolicyReject, decoded.GetAttachmentPolicy())
+	assert.NotNil(t, decoded.Headers)
+}
+
+func TestEmailMessageJSONWithoutTo(t *testing.T) {
+	message := NewEmailMessage("newman@usps.com", nil, "Hello", "Hello, Kramer").SetBCC([]string{"kramer@seinfeld.com"})
+
+	data, err := json.Marshal(message)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"to":[]`)
+
+	var decoded EmailMessage
+
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Empty(t, decoded.To)
+	assert.Equal(t, []string{"kramer@seinfeld.com"}, decoded.Bcc)
+}
+
+func TestEmailMessageJSONLegacy(t *testing.T) {
+	legacy := `{"from":"newman@usps.com","to":["jerry@seinfeld.com"],"replyTo":"postmaster@usps.com","subject":"Hello","text":"Hello, Jerry","attachments":[{"filename":"route.csv","content":"NDIsS3JhbWVy"}]}`
+
+	for _, data := range []string{legacy, `{"version":1,` + legacy[1:]} {
+		var decoded EmailMessage
+
+		require.NoError(t, json.Unmarshal([]byte(data), &decoded))
+
+		assert.Equal(t, "postmaster@usps.com", decoded.ReplyTo)
+		assert.Equal(t, "Hello, Jerry", decoded.Text)
+		assert.Equal(t, []byte("42,Kramer"), decoded.Attachments[0].GetRawContent())
+		assert.Equal(t, DefaultMaxAttachmentSize, decoded.maxAttachmentSize)
+		assert.NotNil(t, decoded.Headers)
+	}
+}
+
+func TestEmailMessageJSONUnsupportedVersion(t *testing.T) {
+	var decoded EmailMessage
+
+	err := json.Unmarshal([]byte(`{"version":3,"from":"newman@usps.com"}`), &decoded)
+	assert.ErrorIs(t, err, ErrUnsupportedWireFormat)
+}
+
+func TestCalendarEventJSON(t *testing.T) {
+	start := time.Date(2026, time.March, 20, 13, 0, 0, 0, time.UTC)
+	event := NewCalendarEvent("Mail route review", start, start.Add(time.Hour)).SetOrganizer("newman@usps.com", "Newman")
+
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "time_zone")
+
+	var decoded CalendarEvent
+
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, event.Bytes(), decoded.Bytes())
+
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"uid":"review","time_zone":"Mars/Olympus_Mons"}`), &decoded), ErrInvalidCalendarEvent)
+}
+
+// schemaProperties returns the property names of an object schema
+func schemaProperties(t *testing.T, schema map[string]any) []string {
+	t.Helper()
+
+	properties, ok := schema["properties"].(map[string]any)
+	require.True(t, ok)
+
+	return slices.Sorted(maps.Keys(properties))
+}
+
+// objectKeys returns the keys of a JSON object
+func objectKeys(t *testing.T, value any) []string {
+	t.Helper()
+
+	object, ok := value.(map[string]any)
+	require.True(t, ok)
+
+	return slices.Sorted(maps.Keys(object))
+}
+
+func TestAttachmentJSONReader(t *testing.T) {
+	// writing an attachment backed by a one-shot reader keeps its content for the send
+	message := NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello, Jerry").
+		AddAttachment(NewAttachmentFromReader("route.csv", strings.NewReader("42,Kramer")))
+
+	data, err := json.Marshal(message)
+	require.NoError(t, err)
+
+	var decoded EmailMessage
+
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, []byte("42,Kramer"), decoded.Attachments[0].Content)
+
+	assert.Equal(t, []byte("42,Kramer"), message.Attachments[0].Content)
+	require.NoError(t, WriteMimeMessage(io.Discard, message))
+
+	// a reader that was already consumed fails rather than writing an empty attachment
+	consumed := NewAttachmentFromReader("route.csv", strings.NewReader("42,Kramer"))
+	rc, err := consumed.Open()
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+
+	_, err = json.Marshal(consumed)
+	assert.ErrorIs(t, err, ErrAttachmentConsumed)
+}
+
+func TestEmailMessageJSONSchema(t *testing.T) {
+	var schema map[string]any
+
+	require.NoError(t, json.Unmarshal(EmailMessageJSONSchema(), &schema))
+
+	defs, ok := schema["$defs"].(map[string]any)
+	require.True(t, ok)
+
+	// a message with every field set writes exactly the properties the schema describes
+	message := newWireTestMessage(t)
+	message.Attachments[0].ContentType = "image/png"
+	message.Attachments[0].FilePath = "logo.png"
+	message.Calendar.SetSequence(1)
+
+	data, err := json.Marshal(message)
+	require.NoError(t, err)
+
+	var written map[string]any
+
+	require.NoError(t, json.Unmarshal(data, &written))
+
+	assert.Equal(t, schemaProperties(t, schema), objectKeys(t, written))
+	assert.Equal(t, schemaProperties(t, defs["attachment"].(map[string]any)), objectKeys(t, written["attachments"].([]any)[0].(map[string]any)))
+	assert.Equal(t, schemaProperties(t, defs["calendar_event"].(map[string]any)), objectKeys(t, written["calendar"]))
+}
@@ -0,0 +1,158 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"strings"
+)
+
+// mimeWrapper wraps the content entity of a message, its content headers followed by its body, in a signed
+// or encrypted entity. Only one wrapper applies to a message, and a DKIM signature is added after it
+type mimeWrapper interface {
+	wrap(entity []byte) ([]byte, error)
+}
+
+// formatMultipart formats a multipart entity from parts that are already rendered, so each part is written
+// exactly as it was signed or encrypted
+func formatMultipart(subtype string, params map[string]string, parts ...[]byte) []byte {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	params = maps.Clone(params)
+	params["boundary"] = boundary
+
+	var b bytes.Buffer
+
+	writeHeader(&b, "Content-Type", mime.FormatMediaType("multipart/"+subtype, params))
+	b.WriteString("\r\n")
+
+	for _, part := range parts {
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		b.Write(part)
+		b.WriteString("\r\n")
+	}
+
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+
+	return b.Bytes()
+}
+
+// wrappedMessage is a message whose content is a signed or encrypted entity
+type wrappedMessage struct {
+	// fields are the header fields of the message
+	fields []string
+	// mediaType and params are parsed from the Content-Type of the message
+	mediaType string
+	params    map[string]string
+	// body is the body of the message
+	body []byte
+}
+
+// parseWrapped splits a message into its header fields and body and parses its Content-Type
+func parseWrapped(message []byte) (*wrappedMessage, error) {
+	header, body, err := splitMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := headerFields(header)
+
+	mediaType, params, err := mime.ParseMediaType(headerValue(fields, "Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMimeMessage, err)
+	}
+
+	return &wrappedMessage{fields: fields, mediaType: mediaType, params: params, body: body}, nil
+}
+
+// is reports whether the message has the media type, and a protocol parameter when protocol is not empty
+func (m *wrappedMessage) is(mediaType, protocol string) bool {
+	return m.mediaType == mediaType && (protocol == "" || strings.EqualFold(m.params["protocol"], protocol))
+}
+
+// parts splits the body of a multipart message into its parts, exactly as they were written
+func (m *wrappedMessage) parts() ([][]byte, error) {
+	delimiter := []byte("\r\n--" + m.params["boundary"])
+
+	// the first delimiter may start the body, without a line break ahead of it
+	rest := append([]byte("\r\n"), m.body...)
+
+	start := bytes.Index(rest, delimiter)
+	if m.params["boundary"] == "" || start < 0 {
+		return nil, fmt.Errorf("%w: missing multipart boundary", ErrInvalidMimeMessage)
+	}
+
+	var parts [][]byte
+
+	for {
+		rest = rest[start+len(delimiter):]
+		if bytes.HasPrefix(rest, []byte("--")) {
+			return parts, nil
+		}
+
+		// skip the transport padding and line break ending the delimiter line
+		eol := bytes.Index(rest, []byte("\r\n"))
+		if eol < 0 {
+			return nil, fmt.Errorf("%w: unterminated multipart body", ErrInvalidMimeMessage)
+		}
+
+		rest = rest[eol:]
+
+		end := bytes.Index(rest[2:], delimiter)
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unterminated multipart body", ErrInvalidMimeMessage)
+		}
+
+		parts = append(parts, rest[2:end+2])
+		start = end + 2
+	}
+}
+
+// decodedBody returns the body of the message, base64 decoded when its Content-Transfer-Encoding is base64
+func (m *wrappedMessage) decodedBody() ([]byte, error) {
+	if !strings.EqualFold(headerValue(m.fields, "Content-Transfer-Encoding"), "base64") {
+		return m.body, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(m.body)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMimeMessage, err)
+	}
+
+	return decoded, nil
+}
+
+// unwrap returns the message with its content replaced by the entity, keeping the header fields that are
+// not content headers
+func (m *wrappedMessage) unwrap(entity []byte) []byte {
+	var b bytes.Buffer
+
+	for _, field := range m.fields {
+		name, _, _ := strings.Cut(field, ":")
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(name)), "content-") {
+			continue
+		}
+
+		b.WriteString(field + "\r\n")
+	}
+
+	b.Write(entity)
+
+	return b.Bytes()
+}
+
+// headerValue returns the unfolded value of the first header field with the name, or an empty string
+func headerValue(fields []string, name string) string {
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.TrimSpace(strings.ReplaceAll(value, "\r\n", ""))
+		}
+	}
+
+	return ""
+}
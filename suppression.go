@@ -0,0 +1,258 @@
+package newman
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SuppressionReason is why an address is suppressed
+type SuppressionReason string
+
+const (
+	// SuppressionBounce suppresses an address that hard bounced
+	SuppressionBounce SuppressionReason = "bounce"
+	// SuppressionComplaint suppresses an address whose owner marked a message as spam
+	SuppressionComplaint SuppressionReason = "complaint"
+	// SuppressionUnsubscribe suppresses an address whose owner unsubscribed
+	SuppressionUnsubscribe SuppressionReason = "unsubscribe"
+	// SuppressionManual suppresses an address added by hand
+	SuppressionManual SuppressionReason = "manual"
+)
+
+// valid reports whether the reason is one of the known reasons
+func (r SuppressionReason) valid() bool {
+	switch r {
+	case SuppressionBounce, SuppressionComplaint, SuppressionUnsubscribe, SuppressionManual:
+		return true
+	default:
+		return false
+	}
+}
+
+// Suppression blocks sends to an address, for every message or only those carrying a tag
+type Suppression struct {
+	// Address is the suppressed email address
+	Address string `json:"address"`
+	// Reason is why the address is suppressed
+	Reason SuppressionReason `json:"reason"`
+	// Tag scopes the suppression to messages with a tag of the same name, and the same value when it has one.
+	// A suppression without a tag applies to every message
+	Tag Tag `json:"tag,omitzero"`
+	// CreatedAt is when the address was suppressed
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is when the suppression lapses, and is zero when it does not
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// Applies reports whether the suppression blocks a message with the tags at the given time
+func (s *Suppression) Applies(tags []Tag, now time.Time) bool {
+	if !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt) {
+		return false
+	}
+
+	if s.Tag.Name == "" {
+		return true
+	}
+
+	for _, tag := range tags {
+		if tag.Name == s.Tag.Name && (s.Tag.Value == "" || tag.Value == s.Tag.Value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Suppressor looks up whether an address is suppressed
+type Suppressor interface {
+	// Suppressed returns the suppression blocking sends to the address for a message with the tags, or nil
+	// when the address can be sent to
+	Suppressed(ctx context.Context, address string, tags []Tag) (*Suppression, error)
+}
+
+// suppressionSender wraps an EmailSender and removes suppressed recipients before sending
+type suppressionSender struct {
+	next       EmailSender
+	suppressor Suppressor
+	hook       func(message *EmailMessage, address string, suppression *Suppression)
+}
+
+// SuppressionOption configures the EmailSender returned by WithSuppression
+type SuppressionOption func(*suppressionSender)
+
+// WithSuppressionHook sets a hook called for every recipient removed from a message, such as for logging
+func WithSuppressionHook(hook func(message *EmailMessage, address string, suppression *Suppression)) SuppressionOption {
+	return func(s *suppressionSender) {
+		s.hook = hook
+	}
+}
+
+// WithSuppression wraps an EmailSender so that To, Cc and Bcc recipients suppressed by the suppressor are
+// removed before the message is handed to the provider. The message passed in is left as it is. A message
+// whose To recipients, or all of whose recipients, are suppressed is not sent and fails with
+// ErrRecipientsSuppressed, and an error
+// looking up a recipient fails the send rather than risk mailing a suppressed address
+func WithSuppression(sender EmailSender, suppressor Suppressor, opts ...SuppressionOption) EmailSender {
+	s := &suppressionSender{
+		next:       sender,
+		suppressor: suppressor,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// ProviderName satisfies the ProviderNamer interface by reporting the wrapped sender's name
+func (s *suppressionSender) ProviderName() string {
+	return providerName(s.next)
+}
+
+// SendEmail satisfies the EmailSender interface
+func (s *suppressionSender) SendEmail(message *EmailMessage) error {
+	return s.SendEmailWithContext(context.Background(), message)
+}
+
+// SendEmailWithContext satisfies the EmailSender interface
+func (s *suppressionSender) SendEmailWithContext(ctx context.Context, message *EmailMessage) error {
+	_, err := s.SendEmailWithResult(ctx, message)
+
+	return err
+}
+
+// SendEmailWithResult satisfies the ResultSender interface, reporting the suppressed recipients as rejected
+func (s *suppressionSender) SendEmailWithResult(ctx context.Context, message *EmailMessage) (*SendResult, error) {
+	filtered, suppressed, err := s.filter(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := SendEmailWithResult(ctx, s.next, filtered)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Rejected = append(result.Rejected, suppressed...)
+
+	return result, nil
+}
+
+// SendBatchEmail satisfies the EmailSender interface
+func (s *suppressionSender) SendBatchEmail(messages []*EmailMessage) error {
+	return s.SendBatchEmailWithContext(context.Background(), messages)
+}
+
+// SendBatchEmailWithContext satisfies the EmailSender interface
+func (s *suppressionSender) SendBatchEmailWithContext(ctx context.Context, messages []*EmailMessage) error {
+	result, err := s.SendBatchEmailWithResult(ctx, messages)
+	if err != nil {
+		return err
+	}
+
+	return result.Err()
+}
+
+// SendBatchEmailWithResult satisfies the BatchResultSender interface, reporting the suppressed recipients of each
+// message as rejected. Messages left without a To recipient are marked as failed and the rest are sent as one
+// batch; when that batch fails as a whole the result is returned with the error, so those failures are kept
+func (s *suppressionSender) SendBatchEmailWithResult(ctx context.Context, messages []*EmailMessage) (*BatchResult, error) {
+	if len(messages) == 0 {
+		return SendBatchEmailWithResult(ctx, s.next, messages)
+	}
+
+	result := NewBatchResult(providerName(s.next), len(messages))
+
+	var (
+		pending []*EmailMessage
+		indexes []int
+	)
+
+	for i, message := range messages {
+		filtered, suppressed, err := s.filter(ctx, message)
+
+		result.Items[i].Rejected = suppressed
+
+		if err != nil {
+			result.SetFailed(i, err)
+			continue
+		}
+
+		pending = append(pending, filtered)
+		indexes = append(indexes, i)
+	}
+
+	if len(pending) == 0 {
+		return result, nil
+	}
+
+	sent, err := SendBatchEmailWithResult(ctx, s.next, pending)
+	if err != nil {
+		for _, i := range indexes {
+			result.SetFailed(i, err)
+		}
+
+		return result, err
+	}
+
+	for pos, item := range sent.Items {
+		item.Index = indexes[pos]
+		item.Rejected = append(item.Rejected, result.Items[item.Index].Rejected...)
+		result.Items[item.Index] = item
+	}
+
+	return result, nil
+}
+
+// filter returns a copy of the message without its suppressed recipients, together with the recipients removed
+func (s *suppressionSender) filter(ctx context.Context, message *EmailMessage) (*EmailMessage, []string, error) {
+	if message == nil {
+		return nil, nil, nil
+	}
+
+	filtered := *message
+
+	var removed []string
+
+	for _, recipients := range []*[]string{&filtered.To, &filtered.Cc, &filtered.Bcc} {
+		kept := make([]string, 0, len(*recipients))
+
+		for _, recipient := range *recipients {
+			// addresses that do not parse are left for validation to report
+			address, err := ParseAddress(recipient)
+			if err != nil {
+				kept = append(kept, recipient)
+				continue
+			}
+
+			suppression, err := s.suppressor.Suppressed(ctx, address.Address, message.Tags)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if suppression == nil {
+				kept = append(kept, recipient)
+				continue
+			}
+
+			removed = append(removed, address.Address)
+
+			if s.hook != nil {
+				s.hook(message, address.Address, suppression)
+			}
+		}
+
+		*recipients = kept
+	}
+
+	// a message is not sent once its To recipients, or all of its recipients, have been removed
+	left := len(filtered.To) + len(filtered.Cc) + len(filtered.Bcc)
+	if len(removed) > 0 && (len(filtered.To) == 0 && len(message.To) > 0 || left == 0) {
+		return nil, removed, fmt.Errorf("%w: %s", ErrRecipientsSuppressed, strings.Join(removed, ", "))
+	}
+
+	return &filtered, removed, nil
+}
@@ -0,0 +1,299 @@
+package newman
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// suppressionFileMode is the permission of a suppression file created by FileSuppressionStore
+const suppressionFileMode = 0o600
+
+// MemorySuppressionStore is a Suppressor holding suppressions in memory
+type MemorySuppressionStore struct {
+	mu      sync.RWMutex
+	entries map[string][]Suppression
+}
+
+// NewMemorySuppressionStore creates an empty MemorySuppressionStore
+func NewMemorySuppressionStore() *MemorySuppressionStore {
+	return &MemorySuppressionStore{entries: map[string][]Suppression{}}
+}
+
+// Add suppresses an address, replacing a suppression of the address with the same tag. CreatedAt defaults to now
+func (m *MemorySuppressionStore) Add(_ context.Context, suppression Suppression) error {
+	suppression, err := normalizeSuppression(suppression)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.add(suppression)
+
+	return nil
+}
+
+// Remove lifts the suppression of the address with the tag, reporting whether there was one
+func (m *MemorySuppressionStore) Remove(_ context.Context, address string, tag Tag) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.remove(suppressionKey(address), tag), nil
+}
+
+// Suppressed satisfies the Suppressor interface
+func (m *MemorySuppressionStore) Suppressed(_ context.Context, address string, tags []Tag) (*Suppression, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+
+	for _, suppression := range m.entries[suppressionKey(address)] {
+		if suppression.Applies(tags, now) {
+			return &suppression, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// List returns the suppressions that have not expired, ordered by address
+func (m *MemorySuppressionStore) List(_ context.Context) ([]Suppression, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.list(time.Now()), nil
+}
+
+// add stores a normalized suppression in place of one of the same address and tag
+func (m *MemorySuppressionStore) add(suppression Suppression) {
+	key := suppressionKey(suppression.Address)
+
+	entries := m.entries[key]
+	for i := range entries {
+		if entries[i].Tag == suppression.Tag {
+			entries[i] = suppression
+			return
+		}
+	}
+
+	m.entries[key] = append(entries, suppression)
+}
+
+// remove deletes the suppression of the key with the tag
+func (m *MemorySuppressionStore) remove(key string, tag Tag) bool {
+	entries := m.entries[key]
+
+	i := slices.IndexFunc(entries, func(s Suppression) bool { return s.Tag == tag })
+	if i < 0 {
+		return false
+	}
+
+	if entries = slices.Delete(entries, i, i+1); len(entries) == 0 {
+		delete(m.entries, key)
+	} else {
+		m.entries[key] = entries
+	}
+
+	return true
+}
+
+// list returns the suppressions that have not expired at now, ordered by address
+func (m *MemorySuppressionStore) list(now time.Time) []Suppression {
+	suppressions := []Suppression{}
+
+	for _, key := range slices.Sorted(maps.Keys(m.entries)) {
+		for _, suppression := range m.entries[key] {
+			if suppression.ExpiresAt.IsZero() || now.Before(suppression.ExpiresAt) {
+				suppressions = append(suppressions, suppression)
+			}
+		}
+	}
+
+	return suppressions
+}
+
+// FileSuppressionStore is a Suppressor kept in memory and persisted to a JSON lines file, with one suppression
+// per line. Adding appends a line and removing rewrites the file without the removed and expired suppressions.
+// The file belongs to a single store, so do not share it between processes
+type FileSuppressionStore struct {
+	mu     sync.Mutex
+	path   string
+	memory *MemorySuppressionStore
+}
+
+// NewFileSuppressionStore opens the suppressions in the file at path, which is created on the first Add if it
+// does not exist. When an address appears more than once with the same tag the last line wins
+func NewFileSuppressionStore(path string) (*FileSuppressionStore, error) {
+	f := &FileSuppressionStore{path: path, memory: NewMemorySuppressionStore()}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var suppression Suppression
+		if err := json.Unmarshal(line, &suppression); err != nil {
+			return nil, fmt.Errorf("%w: %s line %d: %w", ErrInvalidSuppression, path, i+1, err)
+		}
+
+		if suppression, err = normalizeSuppression(suppression); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, err)
+		}
+
+		f.memory.add(suppression)
+	}
+
+	return f, nil
+}
+
+// Add suppresses an address, replacing a suppression of the address with the same tag, and appends it to the file
+func (f *FileSuppressionStore) Add(_ context.Context, suppression Suppression) error {
+	suppression, err := normalizeSuppression(suppression)
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(suppression)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, suppressionFileMode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	f.memory.mu.Lock()
+	f.memory.add(suppression)
+	f.memory.mu.Unlock()
+
+	return nil
+}
+
+// Remove lifts the suppression of the address with the tag and rewrites the file, reporting whether there was one
+func (f *FileSuppressionStore) Remove(_ context.Context, address string, tag Tag) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.memory.mu.Lock()
+	defer f.memory.mu.Unlock()
+
+	key := suppressionKey(address)
+	if !slices.ContainsFunc(f.memory.entries[key], func(s Suppression) bool { return s.Tag == tag }) {
+		return false, nil
+	}
+
+	// the file is rewritten first so a failed write leaves the suppression in place, matching the file
+	remaining := slices.DeleteFunc(f.memory.list(time.Now()), func(s Suppression) bool {
+		return suppressionKey(s.Address) == key && s.Tag == tag
+	})
+
+	if err := f.rewrite(remaining); err != nil {
+		return false, err
+	}
+
+	return f.memory.remove(key, tag), nil
+}
+
+// Suppressed satisfies the Suppressor interface
+func (f *FileSuppressionStore) Suppressed(ctx context.Context, address string, tags []Tag) (*Suppression, error) {
+	return f.memory.Suppressed(ctx, address, tags)
+}
+
+// List returns the suppressions that have not expired, ordered by address
+func (f *FileSuppressionStore) List(ctx context.Context) ([]Suppression, error) {
+	return f.memory.List(ctx)
+}
+
+// rewrite replaces the file with the suppressions, writing a temporary file first so a failed write leaves the
+// previous file in place
+func (f *FileSuppressionStore) rewrite(suppressions []Suppression) error {
+	temp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temp.Name())
+
+	encoder := json.NewEncoder(temp)
+
+	for _, suppression := range suppressions {
+		if err := encoder.Encode(suppression); err != nil {
+			temp.Close()
+
+			return err
+		}
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), f.path)
+}
+
+// normalizeSuppression checks the address and reason of a suppression and defaults CreatedAt to now
+func normalizeSuppression(suppression Suppression) (Suppression, error) {
+	address, err := ParseAddress(suppression.Address)
+	if err != nil {
+		return suppression, fmt.Errorf("%w: %w", ErrInvalidSuppression, err)
+	}
+
+	if !suppression.Reason.valid() {
+		return suppression, fmt.Errorf("%w: unknown reason %q", ErrInvalidSuppression, suppression.Reason)
+	}
+
+	suppression.Address = address.Address
+
+	if suppression.CreatedAt.IsZero() {
+		suppression.CreatedAt = time.Now().UTC()
+	}
+
+	return suppression, nil
+}
+
+// suppressionKey returns the key an address is stored under, matching addresses regardless of case and
+// display name, and internationalized domains in either form
+func suppressionKey(address string) string {
+	parsed, err := ParseAddress(address)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(address))
+	}
+
+	return strings.ToLower(parsed.ToASCII().Address)
+}
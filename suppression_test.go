@@ -0,0 +1,240 @@
+package newman_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/newman"
+	"github.com/theopenlane/newman/providers/mock"
+)
+
+// failingSuppressor fails every lookup
+type failingSuppressor struct{}
+
+func (failingSuppressor) Suppressed(context.Context, string, []newman.Tag) (*newman.Suppression, error) {
+	return nil, errors.New("suppression list unavailable")
+}
+
+// newSuppressionTestStore returns a store suppressing kramer and, for newsletters, george
+func newSuppressionTestStore(t *testing.T) *newman.MemorySuppressionStore {
+	t.Helper()
+
+	store := newman.NewMemorySuppressionStore()
+	require.NoError(t, store.Add(context.Background(), newman.Suppression{Address: "Kramer@Seinfeld.com", Reason: newman.SuppressionBounce}))
+	require.NoError(t, store.Add(context.Background(), newman.Suppression{
+		Address: "george@seinfeld.com",
+		Reason:  newman.SuppressionUnsubscribe,
+		Tag:     newman.Tag{Name: "category", Value: "newsletter"},
+	}))
+
+	return store
+}
+
+func TestWithSuppressionRemovesRecipients(t *testing.T) {
+	sender, err := mock.New("")
+	require.NoError(t, err)
+
+	var hooked []string
+
+	suppressed := newman.WithSuppression(sender, newSuppressionTestStore(t), newman.WithSuppressionHook(func(_ *newman.EmailMessage, address string, suppression *newman.Suppression) {
+		hooked = append(hooked, address+":"+string(suppression.Reason))
+	}))
+
+	message := newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com", "Cosmo Kramer <kramer@seinfeld.com>"}, "Mail route review", "Hello").
+		SetCC([]string{"george@seinfeld.com"}).
+		SetBCC([]string{"kramer@seinfeld.com"})
+
+	result, err := newman.SendEmailWithResult(context.Background(), suppressed, message)
+	require.NoError(t, err)
+
+	sent := sender.Messages()
+	require.Len(t, sent, 1)
+	assert.Equal(t, []string{"jerry@seinfeld.com"}, sent[0].To)
+	assert.Equal(t, []string{"george@seinfeld.com"}, sent[0].Cc)
+	assert.Empty(t, sent[0].Bcc)
+
+	assert.Equal(t, []string{"kramer@seinfeld.com", "kramer@seinfeld.com"}, result.Rejected)
+	assert.Equal(t, []string{"kramer@seinfeld.com:bounce", "kramer@seinfeld.com:bounce"}, hooked)
+
+	// the message passed in is left as it is
+	assert.Len(t, message.To, 2)
+
+	// the george suppression only applies to newsletters
+	message.Tags = []newman.Tag{{Name: "category", Value: "newsletter"}}
+
+	require.NoError(t, suppressed.SendEmail(message))
+	assert.Empty(t, sender.Messages()[1].Cc)
+}
+
+func TestWithSuppressionAllRecipientsSuppressed(t *testing.T) {
+	sender, err := mock.New("")
+	require.NoError(t, err)
+
+	suppressed := newman.WithSuppression(sender, newSuppressionTestStore(t))
+
+	err = suppressed.SendEmail(newman.NewEmailMessage("newman@usps.com", []string{"kramer@seinfeld.com"}, "Mail route review", "Hello").SetCC([]string{"jerry@seinfeld.com"}))
+	require.ErrorIs(t, err, newman.ErrRecipientsSuppressed)
+	assert.Empty(t, sender.Messages())
+
+	// a message with only Cc and Bcc recipients, all suppressed, is not sent either
+	err = suppressed.SendEmail(newman.NewEmailMessage("newman@usps.com", nil, "Mail route review", "Hello").
+		SetCC([]string{"kramer@seinfeld.com"}).
+		SetBCC([]string{"Kramer <KRAMER@seinfeld.com>"}))
+	require.ErrorIs(t, err, newman.ErrRecipientsSuppressed)
+	assert.Empty(t, sender.Messages())
+
+	err = newman.WithSuppression(sender, failingSuppressor{}).SendEmail(newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello"))
+	require.Error(t, err)
+	assert.Empty(t, sender.Messages())
+}
+
+func TestWithSuppressionBatch(t *testing.T) {
+	sender, err := mock.New("")
+	require.NoError(t, err)
+
+	suppressed := newman.WithSuppression(sender, newSuppressionTestStore(t))
+
+	messages := []*newman.EmailMessage{
+		newman.NewEmailMessage("newman@usps.com", []string{"kramer@seinfeld.com"}, "Mail route review", "Hello"),
+		newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello").SetCC([]string{"kramer@seinfeld.com"}),
+		newman.NewEmailMessage("newman@usps.com", []string{"george@seinfeld.com"}, "Mail route review", "Hello"),
+	}
+
+	result, err := newman.SendBatchEmailWithResult(context.Background(), suppressed, messages)
+	require.NoError(t, err)
+
+	assert.Equal(t, "mock", result.Provider)
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[0].Status)
+	require.ErrorIs(t, result.Items[0].Err, newman.ErrRecipientsSuppressed)
+	assert.Equal(t, []string{"kramer@seinfeld.com"}, result.Items[0].Rejected)
+	assert.Equal(t, newman.BatchItem{Index: 1, Status: newman.BatchStatusSent, MessageID: "mock-1", Rejected: []string{"kramer@seinfeld.com"}}, result.Items[1])
+	assert.Equal(t, newman.BatchItem{Index: 2, Status: newman.BatchStatusSent, MessageID: "mock-2"}, result.Items[2])
+
+	require.ErrorIs(t, suppressed.SendBatchEmail(messages[:1]), newman.ErrBatchIncomplete)
+}
+
+func TestWithSuppressionBatchRequestError(t *testing.T) {
+	sender, err := mock.New("")
+	require.NoError(t, err)
+
+	suppressed := newman.WithSuppression(noBatchSender{sender}, newSuppressionTestStore(t))
+
+	messages := []*newman.EmailMessage{
+		newman.NewEmailMessage("newman@usps.com", []string{"kramer@seinfeld.com"}, "Mail route review", "Hello"),
+		newman.NewEmailMessage("newman@usps.com", []string{"jerry@seinfeld.com"}, "Mail route review", "Hello"),
+	}
+
+	// the messages filtered out keep their own failure when the rest of the batch cannot be sent
+	result, err := newman.SendBatchEmailWithResult(context.Background(), suppressed, messages)
+	require.ErrorIs(t, err, newman.ErrBatchNotImplemented)
+	require.NotNil(t, result)
+
+	require.ErrorIs(t, result.Items[0].Err, newman.ErrRecipientsSuppressed)
+	assert.Equal(t, []string{"kramer@seinfeld.com"}, result.Items[0].Rejected)
+	assert.Equal(t, newman.BatchStatusFailed, result.Items[1].Status)
+	require.ErrorIs(t, result.Items[1].Err, newman.ErrBatchNotImplemented)
+	assert.Empty(t, sender.Messages())
+}
+
+func TestMemorySuppressionStore(t *testing.T) {
+	ctx := context.Background()
+	store := newman.NewMemorySuppressionStore()
+
+	require.ErrorIs(t, store.Add(ctx, newman.Suppression{Address: "newman", Reason: newman.SuppressionManual}), newman.ErrInvalidSuppression)
+	require.ErrorIs(t, store.Add(ctx, newman.Suppression{Address: "newman@usps.com", Reason: "vacation"}), newman.ErrInvalidSuppression)
+
+	require.NoError(t, store.Add(ctx, newman.Suppression{Address: "jerry@seinfeld.com", Reason: newman.SuppressionComplaint, ExpiresAt: time.Now().Add(-time.Minute)}))
+	require.NoError(t, store.Add(ctx, newman.Suppression{Address: "newman@usps.com", Reason: newman.SuppressionManual, Tag: newman.Tag{Name: "route"}}))
+
+	// expired suppressions no longer apply
+	suppression, err := store.Suppressed(ctx, "jerry@seinfeld.com", nil)
+	require.NoError(t, err)
+	assert.Nil(t, suppression)
+
+	// a tag without a value matches the tag name with any value
+	suppression, err = store.Suppressed(ctx, "NEWMAN@usps.com", []newman.Tag{{Name: "route", Value: "42"}})
+	require.NoError(t, err)
+	require.NotNil(t, suppression)
+	assert.Equal(t, newman.SuppressionManual, suppression.Reason)
+	assert.False(t, suppression.CreatedAt.IsZero())
+
+	suppression, err = store.Suppressed(ctx, "newman@usps.com", nil)
+	require.NoError(t, err)
+	assert.Nil(t, suppression)
+
+	list, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "newman@usps.com", list[0].Address)
+
+	removed, err := store.Remove(ctx, "newman@usps.com", newman.Tag{})
+	require.NoError(t, err)
+	assert.False(t, removed)
+
+	removed, err = store.Remove(ctx, "newman@usps.com", newman.Tag{Name: "route"})
+	require.NoError(t, err)
+	assert.True(t, removed)
+}
+
+func TestFileSuppressionStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "suppressions.jsonl")
+
+	store, err := newman.NewFileSuppressionStore(path)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Add(ctx, newman.Suppression{Address: "kramer@seinfeld.com", Reason: newman.SuppressionBounce}))
+	require.NoError(t, store.Add(ctx, newman.Suppression{Address: "george@seinfeld.com", Reason: newman.SuppressionManual}))
+	require.NoError(t, store.Add(ctx, newman.Suppression{Address: "george@seinfeld.com", Reason: newman.SuppressionComplaint}))
+
+	// the suppressions are read back, with the last line for an address winning
+	reopened, err := newman.NewFileSuppressionStore(path)
+	require.NoError(t, err)
+
+	suppression, err := reopened.Suppressed(ctx, "george@seinfeld.com", nil)
+	require.NoError(t, err)
+	require.NotNil(t, suppression)
+	assert.Equal(t, newman.SuppressionComplaint, suppression.Reason)
+
+	removed, err := reopened.Remove(ctx, "george@seinfeld.com", newman.Tag{})
+	require.NoError(t, err)
+	assert.True(t, removed)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "george")
+	assert.Contains(t, string(data), `"address":"kramer@seinfeld.com","reason":"bounce"`)
+
+	reopened, err = newman.NewFileSuppressionStore(path)
+	require.NoError(t, err)
+
+	list, err := reopened.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "kramer@seinfeld.com", list[0].Address)
+
+	// a failed rewrite leaves the suppression in place, as it is still in the file
+	require.NoError(t, os.RemoveAll(filepath.Dir(path)))
+
+	removed, err = reopened.Remove(ctx, "kramer@seinfeld.com", newman.Tag{})
+	require.Error(t, err)
+	assert.False(t, removed)
+
+	suppression, err = reopened.Suppressed(ctx, "kramer@seinfeld.com", nil)
+	require.NoError(t, err)
+	assert.NotNil(t, suppression)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+	require.NoError(t, os.WriteFile(path, []byte("{\"address\":\"kramer@seinfeld.com\",\"reason\":\"bounce\"}\nnot json\n"), 0o600))
+
+	_, err = newman.NewFileSuppressionStore(path)
+	require.ErrorIs(t, err, newman.ErrInvalidSuppression)
+	assert.Contains(t, err.Error(), "line 2")
+}
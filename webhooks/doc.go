@@ -0,0 +1,2 @@
+// Package webhooks verifies and parses the delivery event webhooks of the providers supported by newman into a common Event type
+package webhooks
@@ -0,0 +1,13 @@
+package webhooks
+
+import "errors"
+
+var (
+	// ErrInvalidSignature is returned when a webhook request is not signed, its signature does not verify or its
+	// timestamp is outside the tolerance
+	ErrInvalidSignature = errors.New("webhook signature verification failed")
+	// ErrInvalidPayload is returned when the body of a webhook request cannot be parsed
+	ErrInvalidPayload = errors.New("invalid webhook payload")
+	// ErrInvalidKey is returned when the secret, key or credentials given to a parser cannot be used
+	ErrInvalidKey = errors.New("invalid webhook key")
+)
@@ -0,0 +1,159 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mailgunProvider is the name of the Mailgun provider, matching the provider package
+const mailgunProvider = "mailgun"
+
+// mailgunParser verifies the HMAC signatures of Mailgun webhooks
+type mailgunParser struct {
+	signingKey []byte
+	options    *parserOptions
+}
+
+// mailgunPayload is the body of a Mailgun webhook
+type mailgunPayload struct {
+	Signature struct {
+		Timestamp string `json:"timestamp"`
+		Token     string `json:"token"`
+		Signature string `json:"signature"`
+	} `json:"signature"`
+	EventData json.RawMessage `json:"event-data"`
+}
+
+// mailgunEvent is the event data of a Mailgun webhook
+type mailgunEvent struct {
+	Event          string  `json:"event"`
+	Timestamp      float64 `json:"timestamp"`
+	Recipient      string  `json:"recipient"`
+	Severity       string  `json:"severity"`
+	Reason         string  `json:"reason"`
+	URL            string  `json:"url"`
+	DeliveryStatus struct {
+		Message     string `json:"message"`
+		Description string `json:"description"`
+	} `json:"delivery-status"`
+	Message struct {
+		Headers struct {
+			MessageID string `json:"message-id"`
+		} `json:"headers"`
+	} `json:"message"`
+}
+
+// mailgunEventTypes maps Mailgun event types to normalized types, other than failed which depends on its severity
+var mailgunEventTypes = map[string]EventType{
+	"accepted":     EventSent,
+	"delivered":    EventDelivered,
+	"rejected":     EventDropped,
+	"complained":   EventComplained,
+	"opened":       EventOpened,
+	"clicked":      EventClicked,
+	"unsubscribed": EventUnsubscribed,
+}
+
+// NewMailgunParser creates a Parser for Mailgun webhooks with the webhook signing key of the account
+func NewMailgunParser(signingKey string, opts ...ParserOption) (Parser, error) {
+	if signingKey == "" {
+		return nil, fmt.Errorf("%w: the signing key is empty", ErrInvalidKey)
+	}
+
+	return &mailgunParser{signingKey: []byte(signingKey), options: newParserOptions(opts)}, nil
+}
+
+// Provider satisfies the Parser interface
+func (p *mailgunParser) Provider() string {
+	return mailgunProvider
+}
+
+// Parse satisfies the Parser interface. Mailgun signs the body rather than the request, so the signature is
+// checked once the body has been decoded
+func (p *mailgunParser) Parse(_ http.Header, body []byte) ([]Event, error) {
+	var payload mailgunPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+
+	if err := p.verify(payload.Signature.Timestamp, payload.Signature.Token, payload.Signature.Signature); err != nil {
+		return nil, err
+	}
+
+	var e mailgunEvent
+	if err := json.Unmarshal(payload.EventData, &e); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+
+	seconds, fraction := math.Modf(e.Timestamp)
+
+	event := Event{
+		Provider:     mailgunProvider,
+		MessageID:    strings.Trim(e.Message.Headers.MessageID, "<>"),
+		Recipient:    e.Recipient,
+		Type:         eventType(mailgunEventTypes, e.Event),
+		ProviderType: e.Event,
+		Timestamp:    time.Unix(int64(seconds), int64(fraction*float64(time.Second))).UTC(),
+		URL:          e.URL,
+		Raw:          payload.EventData,
+	}
+
+	if e.Event == "failed" {
+		event.Reason = e.DeliveryStatus.Description
+		if event.Reason == "" {
+			event.Reason = e.DeliveryStatus.Message
+		}
+
+		switch {
+		// Mailgun does not attempt delivery to the addresses it suppresses, and reports them as failed
+		case strings.HasPrefix(e.Reason, "suppress-"):
+			event.Type = EventDropped
+			event.Reason = e.Reason
+		case e.Severity == "temporary":
+			event.Type = EventDeferred
+		default:
+			event.Type = EventBounced
+			event.Bounce = BounceHard
+		}
+	}
+
+	return []Event{event}, nil
+}
+
+// verify checks the signature of the webhook, the hex HMAC-SHA256 of its timestamp and token
+func (p *mailgunParser) verify(timestamp, token, signature string) error {
+	if timestamp == "" || token == "" || signature == "" {
+		return fmt.Errorf("%w: missing Mailgun signature", ErrInvalidSignature)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp %q", ErrInvalidSignature, timestamp)
+	}
+
+	if err := p.options.checkTimestamp(time.Unix(seconds, 0)); err != nil {
+		return err
+	}
+
+	decoded, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	mac := hmac.New(sha256.New, p.signingKey)
+	mac.Write([]byte(timestamp + token))
+
+	if !hmac.Equal(decoded, mac.Sum(nil)) {
+		return fmt.Errorf("%w: the HMAC signature does not match", ErrInvalidSignature)
+	}
+
+	return nil
+}
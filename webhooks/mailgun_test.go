@@ -0,0 +1,107 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mailgunTestKey = "key-newman-signing"
+
+// mailgunBody wraps the event data in a signature made with the key at the time
+func mailgunBody(key, eventData string, at time.Time) []byte {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	token := "a8ce0edb2dd8301dee6c2405235584e45aa91d1e9f979f3de0"
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp + token))
+
+	return []byte(`{"signature":{"timestamp":"` + timestamp + `","token":"` + token + `","signature":"` +
+		hex.EncodeToString(mac.Sum(nil)) + `"},"event-data":` + eventData + `}`)
+}
+
+func TestMailgunParser(t *testing.T) {
+	parser, err := NewMailgunParser(mailgunTestKey)
+	require.NoError(t, err)
+	assert.Equal(t, "mailgun", parser.Provider())
+
+	eventData := `{
+		"event": "failed",
+		"timestamp": 1792238400.5,
+		"recipient": "newman@usps.com",
+		"severity": "permanent",
+		"reason": "bounce",
+		"delivery-status": {"message": "", "description": "No such mailbox"},
+		"message": {"headers": {"message-id": "<20261017120000.1.ABC@mg.seinfeld.com>"}}
+	}`
+
+	events, err := parser.Parse(nil, mailgunBody(mailgunTestKey, eventData, time.Now()))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	event := events[0]
+	assert.Equal(t, "20261017120000.1.ABC@mg.seinfeld.com", event.MessageID)
+	assert.Equal(t, "newman@usps.com", event.Recipient)
+	assert.Equal(t, EventBounced, event.Type)
+	assert.Equal(t, "failed", event.ProviderType)
+	assert.Equal(t, BounceHard, event.Bounce)
+	assert.Equal(t, "No such mailbox", event.Reason)
+	assert.Equal(t, time.Unix(1792238400, int64(500*time.Millisecond)).UTC(), event.Timestamp)
+	assert.JSONEq(t, eventData, string(event.Raw))
+}
+
+func TestMailgunParserEventTypes(t *testing.T) {
+	parser, err := NewMailgunParser(mailgunTestKey)
+	require.NoError(t, err)
+
+	tests := []struct {
+		eventData string
+		want      EventType
+	}{
+		{eventData: `{"event":"accepted"}`, want: EventSent},
+		{eventData: `{"event":"delivered"}`, want: EventDelivered},
+		{eventData: `{"event":"failed","severity":"temporary"}`, want: EventDeferred},
+		{eventData: `{"event":"failed","severity":"permanent","reason":"suppress-bounce"}`, want: EventDropped},
+		{eventData: `{"event":"rejected"}`, want: EventDropped},
+		{eventData: `{"event":"complained"}`, want: EventComplained},
+		{eventData: `{"event":"opened"}`, want: EventOpened},
+		{eventData: `{"event":"clicked","url":"https://seinfeld.com"}`, want: EventClicked},
+		{eventData: `{"event":"unsubscribed"}`, want: EventUnsubscribed},
+		{eventData: `{"event":"stored"}`, want: EventUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.eventData, func(t *testing.T) {
+			events, err := parser.Parse(nil, mailgunBody(mailgunTestKey, tt.eventData, time.Now()))
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.Equal(t, tt.want, events[0].Type)
+		})
+	}
+}
+
+func TestMailgunParserVerification(t *testing.T) {
+	parser, err := NewMailgunParser(mailgunTestKey)
+	require.NoError(t, err)
+
+	_, err = parser.Parse(nil, mailgunBody("key-other", `{"event":"delivered"}`, time.Now()))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = parser.Parse(nil, mailgunBody(mailgunTestKey, `{"event":"delivered"}`, time.Now().Add(-time.Hour)))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = parser.Parse(nil, []byte(`{"event-data":{"event":"delivered"}}`))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = parser.Parse(nil, []byte(`not json`))
+	require.ErrorIs(t, err, ErrInvalidPayload)
+
+	_, err = NewMailgunParser("")
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
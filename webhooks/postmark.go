@@ -0,0 +1,129 @@
+package webhooks
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// postmarkProvider is the name of the Postmark provider, matching the provider package
+const postmarkProvider = "postmark"
+
+// postmarkParser checks the basic auth credentials Postmark sends with its webhooks
+type postmarkParser struct {
+	username string
+	password string
+}
+
+// postmarkEvent is the body of a Postmark webhook
+type postmarkEvent struct {
+	RecordType        string `json:"RecordType"`
+	MessageID         string `json:"MessageID"`
+	Recipient         string `json:"Recipient"`
+	Email             string `json:"Email"`
+	Type              string `json:"Type"`
+	Description       string `json:"Description"`
+	Details           string `json:"Details"`
+	OriginalLink      string `json:"OriginalLink"`
+	SuppressSending   bool   `json:"SuppressSending"`
+	SuppressionReason string `json:"SuppressionReason"`
+	DeliveredAt       string `json:"DeliveredAt"`
+	BouncedAt         string `json:"BouncedAt"`
+	ReceivedAt        string `json:"ReceivedAt"`
+	ChangedAt         string `json:"ChangedAt"`
+}
+
+// postmarkEventTypes maps Postmark record types to normalized types, other than SubscriptionChange which depends
+// on why the address was suppressed
+var postmarkEventTypes = map[string]EventType{
+	"Delivery":      EventDelivered,
+	"Bounce":        EventBounced,
+	"SpamComplaint": EventComplained,
+	"Open":          EventOpened,
+	"Click":         EventClicked,
+}
+
+// postmarkBounceTypes classifies the Postmark bounce types, leaving the rest undetermined
+var postmarkBounceTypes = map[string]BounceType{
+	"HardBounce":      BounceHard,
+	"BadEmailAddress": BounceHard,
+	"SoftBounce":      BounceSoft,
+	"Transient":       BounceSoft,
+	"DnsError":        BounceSoft,
+}
+
+// NewPostmarkParser creates a Parser for Postmark webhooks, which carry the basic auth credentials set in the
+// webhook URL since Postmark does not sign them
+func NewPostmarkParser(username, password string) (Parser, error) {
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("%w: a username and password are required", ErrInvalidKey)
+	}
+
+	return &postmarkParser{username: username, password: password}, nil
+}
+
+// Provider satisfies the Parser interface
+func (p *postmarkParser) Provider() string {
+	return postmarkProvider
+}
+
+// Parse satisfies the Parser interface, returning the single event Postmark posts with each request
+func (p *postmarkParser) Parse(header http.Header, body []byte) ([]Event, error) {
+	username, password, ok := (&http.Request{Header: header}).BasicAuth()
+
+	// both are compared so the time taken does not tell which one was wrong
+	usernameMatch := subtle.ConstantTimeCompare([]byte(username), []byte(p.username))
+	passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(p.password))
+
+	if !ok || usernameMatch&passwordMatch != 1 {
+		return nil, fmt.Errorf("%w: basic auth credentials do not match", ErrInvalidSignature)
+	}
+
+	var e postmarkEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+
+	event := Event{
+		Provider:     postmarkProvider,
+		MessageID:    e.MessageID,
+		Recipient:    e.Recipient,
+		Type:         eventType(postmarkEventTypes, e.RecordType),
+		ProviderType: e.RecordType,
+		URL:          e.OriginalLink,
+		Raw:          body,
+	}
+
+	if event.Recipient == "" {
+		event.Recipient = e.Email
+	}
+
+	for _, at := range []string{e.DeliveredAt, e.BouncedAt, e.ReceivedAt, e.ChangedAt} {
+		if timestamp, err := time.Parse(time.RFC3339Nano, at); err == nil {
+			event.Timestamp = timestamp.UTC()
+			break
+		}
+	}
+
+	switch {
+	case event.Type == EventBounced && e.Type == "SpamComplaint":
+		event.Type = EventComplained
+	case event.Type == EventBounced:
+		event.Bounce = postmarkBounceTypes[e.Type]
+		if event.Bounce == "" {
+			event.Bounce = BounceUndetermined
+		}
+
+		event.Reason = e.Description
+		if e.Details != "" {
+			event.Reason = e.Details
+		}
+	// hard bounces and spam complaints also suppress the address, but are reported by their own events
+	case e.RecordType == "SubscriptionChange" && e.SuppressSending && e.SuppressionReason == "ManualSuppression":
+		event.Type = EventUnsubscribed
+	}
+
+	return []Event{event}, nil
+}
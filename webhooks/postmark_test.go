@@ -0,0 +1,99 @@
+package webhooks
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postmarkHeader returns a header carrying the basic auth credentials
+func postmarkHeader(username, password string) http.Header {
+	r := &http.Request{Header: http.Header{}}
+	r.SetBasicAuth(username, password)
+
+	return r.Header
+}
+
+func TestPostmarkParser(t *testing.T) {
+	parser, err := NewPostmarkParser("newman", "hello-jerry")
+	require.NoError(t, err)
+	assert.Equal(t, "postmark", parser.Provider())
+
+	body := []byte(`{
+		"RecordType": "Bounce",
+		"MessageID": "883953f4-6105-42a2-a16a-77a8eac79483",
+		"Type": "HardBounce",
+		"Email": "newman@usps.com",
+		"Description": "The server was unable to deliver your message",
+		"Details": "smtp;550 5.1.1 user unknown",
+		"BouncedAt": "2026-10-17T12:00:00Z"
+	}`)
+
+	events, err := parser.Parse(postmarkHeader("newman", "hello-jerry"), body)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	event := events[0]
+	assert.Equal(t, "883953f4-6105-42a2-a16a-77a8eac79483", event.MessageID)
+	assert.Equal(t, "newman@usps.com", event.Recipient)
+	assert.Equal(t, EventBounced, event.Type)
+	assert.Equal(t, "Bounce", event.ProviderType)
+	assert.Equal(t, BounceHard, event.Bounce)
+	assert.Equal(t, "smtp;550 5.1.1 user unknown", event.Reason)
+	assert.Equal(t, time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC), event.Timestamp)
+	assert.JSONEq(t, string(body), string(event.Raw))
+}
+
+func TestPostmarkParserEventTypes(t *testing.T) {
+	parser, err := NewPostmarkParser("newman", "hello-jerry")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		body   string
+		want   EventType
+		bounce BounceType
+	}{
+		{name: "delivery", body: `{"RecordType":"Delivery","Recipient":"jerry@seinfeld.com","DeliveredAt":"2026-10-17T12:00:00.1234567Z"}`, want: EventDelivered},
+		{name: "soft bounce", body: `{"RecordType":"Bounce","Type":"SoftBounce"}`, want: EventBounced, bounce: BounceSoft},
+		{name: "unclassified bounce", body: `{"RecordType":"Bounce","Type":"ChallengeVerification"}`, want: EventBounced, bounce: BounceUndetermined},
+		{name: "spam complaint bounce", body: `{"RecordType":"Bounce","Type":"SpamComplaint"}`, want: EventComplained},
+		{name: "spam complaint", body: `{"RecordType":"SpamComplaint","Type":"SpamComplaint"}`, want: EventComplained},
+		{name: "open", body: `{"RecordType":"Open","Recipient":"jerry@seinfeld.com","ReceivedAt":"2026-10-17T12:00:00Z"}`, want: EventOpened},
+		{name: "click", body: `{"RecordType":"Click","OriginalLink":"https://seinfeld.com"}`, want: EventClicked},
+		{name: "unsubscribe", body: `{"RecordType":"SubscriptionChange","SuppressSending":true,"SuppressionReason":"ManualSuppression"}`, want: EventUnsubscribed},
+		{name: "reactivation", body: `{"RecordType":"SubscriptionChange","SuppressSending":false}`, want: EventUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := parser.Parse(postmarkHeader("newman", "hello-jerry"), []byte(tt.body))
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.Equal(t, tt.want, events[0].Type)
+			assert.Equal(t, tt.bounce, events[0].Bounce)
+		})
+	}
+}
+
+func TestPostmarkParserVerification(t *testing.T) {
+	parser, err := NewPostmarkParser("newman", "hello-jerry")
+	require.NoError(t, err)
+
+	body := []byte(`{"RecordType":"Delivery"}`)
+
+	_, err = parser.Parse(postmarkHeader("newman", "hello-newman"), body)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = parser.Parse(http.Header{}, body)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = parser.Parse(postmarkHeader("newman", "hello-jerry"), []byte(`not json`))
+	require.ErrorIs(t, err, ErrInvalidPayload)
+
+	_, err = NewPostmarkParser("newman", "")
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
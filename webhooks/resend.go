@@ -0,0 +1,171 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// resendProvider is the name of the Resend provider, matching the provider package
+	resendProvider = "resend"
+	// svixSecretPrefix starts the signing secrets svix hands out
+	svixSecretPrefix = "whsec_"
+)
+
+// resendParser verifies the svix signatures of Resend webhooks
+type resendParser struct {
+	secret  []byte
+	options *parserOptions
+}
+
+// resendPayload is the body of a Resend webhook
+type resendPayload struct {
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      struct {
+		EmailID string   `json:"email_id"`
+		To      []string `json:"to"`
+		Bounce  struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"bounce"`
+		Click struct {
+			Link string `json:"link"`
+		} `json:"click"`
+		Failed struct {
+			Reason string `json:"reason"`
+		} `json:"failed"`
+	} `json:"data"`
+}
+
+// resendEventTypes maps Resend event types to normalized types
+var resendEventTypes = map[string]EventType{
+	"email.sent":             EventSent,
+	"email.delivered":        EventDelivered,
+	"email.delivery_delayed": EventDeferred,
+	"email.bounced":          EventBounced,
+	"email.failed":           EventDropped,
+	"email.complained":       EventComplained,
+	"email.opened":           EventOpened,
+	"email.clicked":          EventClicked,
+}
+
+// NewResendParser creates a Parser for Resend webhooks, which are signed by svix with the signing secret of the
+// webhook, given with its whsec_ prefix
+func NewResendParser(secret string, opts ...ParserOption) (Parser, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, svixSecretPrefix))
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("%w: the signing secret is not a base64 svix secret", ErrInvalidKey)
+	}
+
+	return &resendParser{secret: key, options: newParserOptions(opts)}, nil
+}
+
+// Provider satisfies the Parser interface
+func (p *resendParser) Provider() string {
+	return resendProvider
+}
+
+// Parse satisfies the Parser interface, returning an event for each recipient of the message
+func (p *resendParser) Parse(header http.Header, body []byte) ([]Event, error) {
+	if err := p.verify(header, body); err != nil {
+		return nil, err
+	}
+
+	var payload resendPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+
+	event := Event{
+		Provider:     resendProvider,
+		MessageID:    payload.Data.EmailID,
+		Type:         eventType(resendEventTypes, payload.Type),
+		ProviderType: payload.Type,
+		Timestamp:    payload.CreatedAt,
+		URL:          payload.Data.Click.Link,
+		Raw:          body,
+	}
+
+	switch event.Type {
+	case EventBounced:
+		event.Reason = payload.Data.Bounce.Message
+
+		switch payload.Data.Bounce.Type {
+		case "Permanent":
+			event.Bounce = BounceHard
+		case "Transient":
+			event.Bounce = BounceSoft
+		default:
+			event.Bounce = BounceUndetermined
+		}
+	case EventDropped:
+		event.Reason = payload.Data.Failed.Reason
+	}
+
+	if len(payload.Data.To) == 0 {
+		return []Event{event}, nil
+	}
+
+	events := make([]Event, 0, len(payload.Data.To))
+
+	for _, to := range payload.Data.To {
+		event.Recipient = to
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// verify checks the svix signature of the request, which signs the message ID, timestamp and body
+func (p *resendParser) verify(header http.Header, body []byte) error {
+	id, timestamp, signatures := header.Get("svix-id"), header.Get("svix-timestamp"), header.Get("svix-signature")
+	if id == "" || timestamp == "" || signatures == "" {
+		return fmt.Errorf("%w: missing svix headers", ErrInvalidSignature)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp %q", ErrInvalidSignature, timestamp)
+	}
+
+	if err := p.options.checkTimestamp(time.Unix(seconds, 0)); err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+
+	expected := mac.Sum(nil)
+
+	// the header lists space separated version,signature pairs, several while the secret is being rotated
+	for _, versioned := range strings.Fields(signatures) {
+		version, signature, _ := strings.Cut(versioned, ",")
+		if version != "v1" {
+			continue
+		}
+
+		if decoded, err := base64.StdEncoding.DecodeString(signature); err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no matching svix signature", ErrInvalidSignature)
+}
+
+// eventType returns the normalized type of a provider event, or EventUnknown
+func eventType(types map[string]EventType, providerType string) EventType {
+	if t, ok := types[providerType]; ok {
+		return t
+	}
+
+	return EventUnknown
+}
@@ -0,0 +1,121 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const resendTestKey = "bmV3bWFuLXdlYmhvb2stc2lnbmluZy1zZWNyZXQ="
+
+// resendHeader signs the body the way svix does
+func resendHeader(t *testing.T, body []byte, at time.Time) http.Header {
+	t.Helper()
+
+	key, err := base64.StdEncoding.DecodeString(resendTestKey)
+	require.NoError(t, err)
+
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("msg_1." + timestamp + "."))
+	mac.Write(body)
+
+	header := http.Header{}
+	header.Set("svix-id", "msg_1")
+	header.Set("svix-timestamp", timestamp)
+	header.Set("svix-signature", "v1,b2xkLXNpZ25hdHVyZQ== v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	return header
+}
+
+func TestResendParser(t *testing.T) {
+	parser, err := NewResendParser(svixSecretPrefix + resendTestKey)
+	require.NoError(t, err)
+	assert.Equal(t, "resend", parser.Provider())
+
+	body := []byte(`{
+		"type": "email.bounced",
+		"created_at": "2026-10-17T12:00:00.000Z",
+		"data": {
+			"email_id": "4ef9a417-02e9-4d39-ad75-9611e0fcc33c",
+			"to": ["jerry@seinfeld.com", "elaine@pendant.com"],
+			"bounce": {"message": "mailbox does not exist", "type": "Permanent"}
+		}
+	}`)
+
+	events, err := parser.Parse(resendHeader(t, body, time.Now()), body)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	assert.Equal(t, "jerry@seinfeld.com", events[0].Recipient)
+	assert.Equal(t, "elaine@pendant.com", events[1].Recipient)
+
+	for _, event := range events {
+		assert.Equal(t, "4ef9a417-02e9-4d39-ad75-9611e0fcc33c", event.MessageID)
+		assert.Equal(t, EventBounced, event.Type)
+		assert.Equal(t, "email.bounced", event.ProviderType)
+		assert.Equal(t, BounceHard, event.Bounce)
+		assert.Equal(t, "mailbox does not exist", event.Reason)
+		assert.Equal(t, time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC), event.Timestamp)
+		assert.JSONEq(t, string(body), string(event.Raw))
+	}
+}
+
+func TestResendParserEventTypes(t *testing.T) {
+	parser, err := NewResendParser(resendTestKey)
+	require.NoError(t, err)
+
+	tests := map[string]EventType{
+		"email.sent":             EventSent,
+		"email.delivered":        EventDelivered,
+		"email.delivery_delayed": EventDeferred,
+		"email.failed":           EventDropped,
+		"email.complained":       EventComplained,
+		"email.opened":           EventOpened,
+		"email.clicked":          EventClicked,
+		"contact.created":        EventUnknown,
+	}
+
+	for providerType, want := range tests {
+		t.Run(providerType, func(t *testing.T) {
+			body := []byte(`{"type":"` + providerType + `","created_at":"2026-10-17T12:00:00Z","data":{"to":["jerry@seinfeld.com"]}}`)
+
+			events, err := parser.Parse(resendHeader(t, body, time.Now()), body)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.Equal(t, want, events[0].Type)
+		})
+	}
+}
+
+func TestResendParserVerification(t *testing.T) {
+	parser, err := NewResendParser(resendTestKey)
+	require.NoError(t, err)
+
+	body := []byte(`{"type":"email.delivered","data":{}}`)
+
+	header := resendHeader(t, body, time.Now())
+	_, err = parser.Parse(header, []byte(`{"type":"email.complained","data":{}}`))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = parser.Parse(resendHeader(t, body, time.Now().Add(-time.Hour)), body)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = parser.Parse(http.Header{}, body)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	invalid := []byte(`not json`)
+	_, err = parser.Parse(resendHeader(t, invalid, time.Now()), invalid)
+	require.ErrorIs(t, err, ErrInvalidPayload)
+
+	_, err = NewResendParser("whsec_not base64!")
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,172 @@
+package webhooks
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sendGridProvider is the name of the SendGrid provider, matching the provider package
+	sendGridProvider = "sendgrid"
+	// sendGridSignatureHeader carries the base64 ECDSA signature of a signed event webhook
+	sendGridSignatureHeader = "X-Twilio-Email-Event-Webhook-Signature"
+	// sendGridTimestampHeader carries the timestamp signed together with the body
+	sendGridTimestampHeader = "X-Twilio-Email-Event-Webhook-Timestamp"
+)
+
+// sendGridParser verifies the ECDSA signatures of the SendGrid event webhook
+type sendGridParser struct {
+	key     *ecdsa.PublicKey
+	options *parserOptions
+}
+
+// sendGridEvent is one event of a SendGrid event webhook
+type sendGridEvent struct {
+	Email     string `json:"email"`
+	Timestamp int64  `json:"timestamp"`
+	Event     string `json:"event"`
+	MessageID string `json:"sg_message_id"`
+	Reason    string `json:"reason"`
+	Response  string `json:"response"`
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+}
+
+// sendGridEventTypes maps SendGrid event types to normalized types
+var sendGridEventTypes = map[string]EventType{
+	"processed":         EventSent,
+	"delivered":         EventDelivered,
+	"deferred":          EventDeferred,
+	"bounce":            EventBounced,
+	"dropped":           EventDropped,
+	"spamreport":        EventComplained,
+	"open":              EventOpened,
+	"click":             EventClicked,
+	"unsubscribe":       EventUnsubscribed,
+	"group_unsubscribe": EventUnsubscribed,
+}
+
+// NewSendGridParser creates a Parser for the signed SendGrid event webhook with its verification key, the base64
+// public key shown in the SendGrid settings, or the same key PEM encoded
+func NewSendGridParser(publicKey string, opts ...ParserOption) (Parser, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if block, _ := pem.Decode([]byte(publicKey)); block != nil {
+		der, err = block.Bytes, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: the verification key is a %T, not an ECDSA key", ErrInvalidKey, parsed)
+	}
+
+	return &sendGridParser{key: key, options: newParserOptions(opts)}, nil
+}
+
+// Provider satisfies the Parser interface
+func (p *sendGridParser) Provider() string {
+	return sendGridProvider
+}
+
+// Parse satisfies the Parser interface, returning the events of the batch SendGrid posted
+func (p *sendGridParser) Parse(header http.Header, body []byte) ([]Event, error) {
+	if err := p.verify(header, body); err != nil {
+		return nil, err
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+
+	events := make([]Event, 0, len(raw))
+
+	for _, data := range raw {
+		var e sendGridEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+		}
+
+		// sg_message_id is the X-Message-Id returned when sending, followed by the ID of the filter that handled it
+		messageID, _, _ := strings.Cut(e.MessageID, ".")
+
+		event := Event{
+			Provider:     sendGridProvider,
+			MessageID:    messageID,
+			Recipient:    e.Email,
+			Type:         eventType(sendGridEventTypes, e.Event),
+			ProviderType: e.Event,
+			Timestamp:    time.Unix(e.Timestamp, 0).UTC(),
+			URL:          e.URL,
+			Raw:          data,
+		}
+
+		switch event.Type {
+		case EventBounced:
+			event.Reason = e.Reason
+
+			// SendGrid reports a message blocked by the receiving server as a bounce of type blocked
+			event.Bounce = BounceHard
+			if e.Type == "blocked" {
+				event.Bounce = BounceSoft
+			}
+		case EventDeferred:
+			event.Reason = e.Response
+		case EventDropped:
+			event.Reason = e.Reason
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// verify checks the ECDSA signature of the request, which signs the timestamp followed by the body
+func (p *sendGridParser) verify(header http.Header, body []byte) error {
+	signature, timestamp := header.Get(sendGridSignatureHeader), header.Get(sendGridTimestampHeader)
+	if signature == "" || timestamp == "" {
+		return fmt.Errorf("%w: missing SendGrid signature headers", ErrInvalidSignature)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp %q", ErrInvalidSignature, timestamp)
+	}
+
+	if err := p.options.checkTimestamp(time.Unix(seconds, 0)); err != nil {
+		return err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(timestamp))
+	hash.Write(body)
+
+	if !ecdsa.VerifyASN1(p.key, hash.Sum(nil), decoded) {
+		return fmt.Errorf("%w: the ECDSA signature does not match", ErrInvalidSignature)
+	}
+
+	return nil
+}
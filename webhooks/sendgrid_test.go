@@ -0,0 +1,126 @@
+package webhooks
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sendGridKey generates a verification key and returns it with its base64 DER encoding
+func sendGridKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	return key, der
+}
+
+// sendGridHeader signs the body the way the SendGrid event webhook does
+func sendGridHeader(t *testing.T, key *ecdsa.PrivateKey, body []byte, at time.Time) http.Header {
+	t.Helper()
+
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	digest := sha256.Sum256(append([]byte(timestamp), body...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	header := http.Header{}
+	header.Set(sendGridSignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	header.Set(sendGridTimestampHeader, timestamp)
+
+	return header
+}
+
+func TestSendGridParser(t *testing.T) {
+	key, der := sendGridKey(t)
+
+	parser, err := NewSendGridParser(base64.StdEncoding.EncodeToString(der))
+	require.NoError(t, err)
+	assert.Equal(t, "sendgrid", parser.Provider())
+
+	body := []byte(`[
+		{"email":"jerry@seinfeld.com","timestamp":1792238400,"event":"delivered","sg_message_id":"14c5d75ce93.dfd.64b469.filter0001.16648.5515E0B88.0"},
+		{"email":"newman@usps.com","timestamp":1792238401,"event":"bounce","sg_message_id":"14c5d75ce93.dfd.64b469.filter0001.16648.5515E0B88.0","reason":"550 5.1.1 unknown user","type":"bounce"},
+		{"email":"kramer@seinfeld.com","timestamp":1792238402,"event":"bounce","reason":"554 blocked","type":"blocked"},
+		{"email":"elaine@pendant.com","timestamp":1792238403,"event":"deferred","response":"421 try again later"},
+		{"email":"george@vandelay.com","timestamp":1792238404,"event":"click","url":"https://seinfeld.com/puffy-shirt"},
+		{"email":"george@vandelay.com","timestamp":1792238405,"event":"group_unsubscribe"},
+		{"email":"george@vandelay.com","timestamp":1792238406,"event":"machine_opened"}
+	]`)
+
+	events, err := parser.Parse(sendGridHeader(t, key, body, time.Now()), body)
+	require.NoError(t, err)
+	require.Len(t, events, 7)
+
+	assert.Equal(t, "14c5d75ce93", events[0].MessageID)
+	assert.Equal(t, "jerry@seinfeld.com", events[0].Recipient)
+	assert.Equal(t, EventDelivered, events[0].Type)
+	assert.Equal(t, time.Unix(1792238400, 0).UTC(), events[0].Timestamp)
+	assert.JSONEq(t, `{"email":"jerry@seinfeld.com","timestamp":1792238400,"event":"delivered","sg_message_id":"14c5d75ce93.dfd.64b469.filter0001.16648.5515E0B88.0"}`, string(events[0].Raw))
+
+	assert.Equal(t, EventBounced, events[1].Type)
+	assert.Equal(t, BounceHard, events[1].Bounce)
+	assert.Equal(t, "550 5.1.1 unknown user", events[1].Reason)
+
+	assert.Equal(t, EventBounced, events[2].Type)
+	assert.Equal(t, BounceSoft, events[2].Bounce)
+
+	assert.Equal(t, EventDeferred, events[3].Type)
+	assert.Equal(t, "421 try again later", events[3].Reason)
+
+	assert.Equal(t, EventClicked, events[4].Type)
+	assert.Equal(t, "https://seinfeld.com/puffy-shirt", events[4].URL)
+
+	assert.Equal(t, EventUnsubscribed, events[5].Type)
+
+	assert.Equal(t, EventUnknown, events[6].Type)
+	assert.Equal(t, "machine_opened", events[6].ProviderType)
+}
+
+func TestSendGridParserVerification(t *testing.T) {
+	key, der := sendGridKey(t)
+
+	parser, err := NewSendGridParser(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	require.NoError(t, err)
+
+	body := []byte(`[{"email":"jerry@seinfeld.com","timestamp":1792238400,"event":"open"}]`)
+
+	_, err = parser.Parse(sendGridHeader(t, key, body, time.Now()), body)
+	require.NoError(t, err)
+
+	_, err = parser.Parse(sendGridHeader(t, key, body, time.Now()), []byte(`[]`))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = parser.Parse(sendGridHeader(t, key, body, time.Now().Add(-time.Hour)), body)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	other, _ := sendGridKey(t)
+	_, err = parser.Parse(sendGridHeader(t, other, body, time.Now()), body)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = parser.Parse(http.Header{}, body)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	invalid := []byte(`{"event":"open"}`)
+	_, err = parser.Parse(sendGridHeader(t, key, invalid, time.Now()), invalid)
+	require.ErrorIs(t, err, ErrInvalidPayload)
+
+	_, err = NewSendGridParser("not a key")
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,248 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"time"
+)
+
+const (
+	// defaultTolerance is how far the timestamp of a signed request may be from now, guarding against replays
+	defaultTolerance = 5 * time.Minute
+	// defaultMaxBodySize bounds the body read from a webhook request
+	defaultMaxBodySize = 1024 * 1024 // 1 MB
+)
+
+// EventType is the kind of a delivery event, normalized across providers
+type EventType string
+
+const (
+	// EventSent is reported when the provider accepted the message for delivery
+	EventSent EventType = "sent"
+	// EventDelivered is reported when the receiving server accepted the message
+	EventDelivered EventType = "delivered"
+	// EventDeferred is reported when delivery failed temporarily and the provider will try again
+	EventDeferred EventType = "deferred"
+	// EventBounced is reported when the receiving server rejected the message
+	EventBounced EventType = "bounced"
+	// EventDropped is reported when the provider did not attempt delivery, such as for an address it suppresses
+	EventDropped EventType = "dropped"
+	// EventComplained is reported when the recipient marked the message as spam
+	EventComplained EventType = "complained"
+	// EventOpened is reported when the recipient opened the message
+	EventOpened EventType = "opened"
+	// EventClicked is reported when the recipient followed a tracked link
+	EventClicked EventType = "clicked"
+	// EventUnsubscribed is reported when the recipient unsubscribed through the provider
+	EventUnsubscribed EventType = "unsubscribed"
+	// EventUnknown is reported for provider events without a normalized type; ProviderType names the event
+	EventUnknown EventType = "unknown"
+)
+
+// BounceType classifies a bounce
+type BounceType string
+
+const (
+	// BounceHard is a permanent failure, such as an address that does not exist
+	BounceHard BounceType = "hard"
+	// BounceSoft is a failure that may not recur, such as a full mailbox or a blocked message
+	BounceSoft BounceType = "soft"
+	// BounceUndetermined is a bounce the provider did not classify
+	BounceUndetermined BounceType = "undetermined"
+)
+
+// Event is a delivery event reported by a provider
+type Event struct {
+	// Provider is the name of the provider that reported the event
+	Provider string `json:"provider"`
+	// MessageID is the identifier the provider assigned to the message, matching newman.SendResult.MessageID
+	MessageID string `json:"message_id,omitempty"`
+	// Recipient is the address the event is about
+	Recipient string `json:"recipient,omitempty"`
+	// Type is the normalized kind of the event
+	Type EventType `json:"type"`
+	// ProviderType is the name the provider gave the event
+	ProviderType string `json:"provider_type"`
+	// Timestamp is when the event happened
+	Timestamp time.Time `json:"timestamp"`
+	// Bounce classifies a bounced event
+	Bounce BounceType `json:"bounce,omitempty"`
+	// Reason is the explanation the provider gave for a bounce, deferral or drop
+	Reason string `json:"reason,omitempty"`
+	// URL is the link followed for a clicked event
+	URL string `json:"url,omitempty"`
+	// Raw is the provider payload the event was parsed from
+	Raw json.RawMessage `json:"raw"`
+}
+
+// Parser verifies and parses the webhook requests of a provider
+type Parser interface {
+	// Provider returns the name of the provider, which is also the path segment the Handler routes on
+	Provider() string
+	// Parse verifies the request and returns the events in its body, with an error wrapping ErrInvalidSignature
+	// when the request cannot be trusted and ErrInvalidPayload when the body cannot be parsed
+	Parse(header http.Header, body []byte) ([]Event, error)
+}
+
+// ParserOption configures a Parser
+type ParserOption func(*parserOptions)
+
+// parserOptions holds the settings applied by ParserOptions
+type parserOptions struct {
+	tolerance time.Duration
+}
+
+// WithTolerance sets how far the signature timestamp of a request may be from now, 5 minutes by default.
+// A tolerance of 0 accepts any timestamp
+func WithTolerance(tolerance time.Duration) ParserOption {
+	return func(o *parserOptions) {
+		o.tolerance = tolerance
+	}
+}
+
+// newParserOptions applies the options over the defaults
+func newParserOptions(opts []ParserOption) *parserOptions {
+	options := &parserOptions{tolerance: defaultTolerance}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return options
+}
+
+// checkTimestamp checks that the signature timestamp is within the tolerance of now
+func (o *parserOptions) checkTimestamp(timestamp time.Time) error {
+	if o.tolerance <= 0 {
+		return nil
+	}
+
+	if drift := time.Since(timestamp).Abs(); drift > o.tolerance {
+		return fmt.Errorf("%w: timestamp is %s from now, beyond the %s tolerance", ErrInvalidSignature, drift.Round(time.Second), o.tolerance)
+	}
+
+	return nil
+}
+
+// Callback handles a verified event. An error makes the Handler answer with a server error, so the provider sends
+// the request again; callbacks must therefore handle repeated events
+type Callback func(ctx context.Context, event Event) error
+
+// Handler is an http.Handler that verifies webhook requests with the parser of their provider and dispatches each
+// event to the callbacks registered for its type. Register parsers and callbacks before serving requests
+type Handler struct {
+	parsers     map[string]Parser
+	callbacks   map[EventType][]Callback
+	all         []Callback
+	maxBodySize int64
+}
+
+// NewHandler creates a Handler for the parsers. With a single parser every request is given to it; with more the
+// last segment of the request path picks the parser by provider name, so mount the handler at a prefix such as
+// /webhooks/ and point each provider at /webhooks/<provider>
+func NewHandler(parsers ...Parser) *Handler {
+	h := &Handler{
+		parsers:     make(map[string]Parser, len(parsers)),
+		callbacks:   map[EventType][]Callback{},
+		maxBodySize: defaultMaxBodySize,
+	}
+
+	for _, parser := range parsers {
+		h.parsers[parser.Provider()] = parser
+	}
+
+	return h
+}
+
+// On registers a callback for events of the type
+func (h *Handler) On(eventType EventType, callback Callback) *Handler {
+	h.callbacks[eventType] = append(h.callbacks[eventType], callback)
+	return h
+}
+
+// OnAll registers a callback for events of every type, called after the callbacks registered for the type
+func (h *Handler) OnAll(callback Callback) *Handler {
+	h.all = append(h.all, callback)
+	return h
+}
+
+// SetMaxBodySize sets the largest request body read, 1 MB by default
+func (h *Handler) SetMaxBodySize(size int64) *Handler {
+	if size > 0 {
+		h.maxBodySize = size
+	}
+
+	return h
+}
+
+// ServeHTTP satisfies the http.Handler interface. It answers 401 when a request does not verify, 400 when its
+// body cannot be parsed, 500 when a callback fails and 200 once every event has been handled
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	parser := h.parser(r)
+	if parser == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	events, err := parser.Parse(r.Header, body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrInvalidSignature) {
+			status = http.StatusUnauthorized
+		}
+
+		http.Error(w, http.StatusText(status), status)
+
+		return
+	}
+
+	if err := h.dispatch(r.Context(), events); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// parser returns the parser for the request, or nil when no parser matches its path
+func (h *Handler) parser(r *http.Request) Parser {
+	if len(h.parsers) == 1 {
+		for _, parser := range h.parsers {
+			return parser
+		}
+	}
+
+	return h.parsers[path.Base(r.URL.Path)]
+}
+
+// dispatch calls the callbacks of each event in turn, stopping at the first error
+func (h *Handler) dispatch(ctx context.Context, events []Event) error {
+	for _, event := range events {
+		for _, callback := range slices.Concat(h.callbacks[event.Type], h.all) {
+			if err := callback(ctx, event); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubParser is a Parser returning fixed events or an error
+type stubParser struct {
+	provider string
+	events   []Event
+	err      error
+}
+
+func (p stubParser) Provider() string {
+	return p.provider
+}
+
+func (p stubParser) Parse(_ http.Header, _ []byte) ([]Event, error) {
+	return p.events, p.err
+}
+
+// serve posts the body to the handler at the path and returns the response
+func serve(t *testing.T, h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+	return rec
+}
+
+func TestHandlerDispatch(t *testing.T) {
+	events := []Event{
+		{Provider: "stub", Type: EventDelivered, Recipient: "jerry@seinfeld.com"},
+		{Provider: "stub", Type: EventBounced, Recipient: "newman@usps.com"},
+	}
+
+	var delivered, bounced, all []string
+
+	h := NewHandler(stubParser{provider: "stub", events: events}).
+		On(EventDelivered, func(_ context.Context, e Event) error {
+			delivered = append(delivered, e.Recipient)
+			return nil
+		}).
+		On(EventBounced, func(_ context.Context, e Event) error {
+			bounced = append(bounced, e.Recipient)
+			return nil
+		}).
+		OnAll(func(_ context.Context, e Event) error {
+			all = append(all, e.Recipient)
+			return nil
+		})
+
+	rec := serve(t, h, http.MethodPost, "/anything", "{}")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"jerry@seinfeld.com"}, delivered)
+	assert.Equal(t, []string{"newman@usps.com"}, bounced)
+	assert.Equal(t, []string{"jerry@seinfeld.com", "newman@usps.com"}, all)
+}
+
+func TestHandlerRouting(t *testing.T) {
+	var providers []string
+
+	h := NewHandler(
+		stubParser{provider: "resend", events: []Event{{Provider: "resend"}}},
+		stubParser{provider: "postmark", events: []Event{{Provider: "postmark"}}},
+	).OnAll(func(_ context.Context, e Event) error {
+		providers = append(providers, e.Provider)
+		return nil
+	})
+
+	assert.Equal(t, http.StatusOK, serve(t, h, http.MethodPost, "/webhooks/postmark", "{}").Code)
+	assert.Equal(t, http.StatusOK, serve(t, h, http.MethodPost, "/webhooks/resend", "{}").Code)
+	assert.Equal(t, http.StatusNotFound, serve(t, h, http.MethodPost, "/webhooks/mailgun", "{}").Code)
+	assert.Equal(t, []string{"postmark", "resend"}, providers)
+}
+
+func TestHandlerStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		parser   stubParser
+		callback Callback
+		want     int
+	}{
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			parser: stubParser{provider: "stub"},
+			want:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "invalid signature",
+			method: http.MethodPost,
+			parser: stubParser{provider: "stub", err: ErrInvalidSignature},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "invalid payload",
+			method: http.MethodPost,
+			parser: stubParser{provider: "stub", err: ErrInvalidPayload},
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "body too large",
+			method: http.MethodPost,
+			body:   strings.Repeat("x", 64),
+			parser: stubParser{provider: "stub"},
+			want:   http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "callback error",
+			method: http.MethodPost,
+			parser: stubParser{provider: "stub", events: []Event{{Type: EventOpened}}},
+			callback: func(context.Context, Event) error {
+				return errors.New("database unavailable")
+			},
+			want: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(tt.parser).SetMaxBodySize(32)
+			if tt.callback != nil {
+				h.OnAll(tt.callback)
+			}
+
+			assert.Equal(t, tt.want, serve(t, h, tt.method, "/", tt.body).Code)
+		})
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	options := newParserOptions(nil)
+
+	require.NoError(t, options.checkTimestamp(time.Now().Add(-time.Minute)))
+	require.ErrorIs(t, options.checkTimestamp(time.Now().Add(-time.Hour)), ErrInvalidSignature)
+	require.ErrorIs(t, options.checkTimestamp(time.Now().Add(time.Hour)), ErrInvalidSignature)
+
+	options = newParserOptions([]ParserOption{WithTolerance(0)})
+	require.NoError(t, options.checkTimestamp(time.Unix(0, 0)))
+}